@@ -13,8 +13,33 @@ type RepositoryInterface interface {
 	UpdateImageProcessed(ctx context.Context, traceID string, processedPath string, metadata *ImageMetadata, status ImageStatus) error
 	GetImageByTraceID(ctx context.Context, traceID string) (*Image, error)
 	GetImagesByUser(ctx context.Context, telegramID int64, limit, offset int) ([]*Image, error)
+	GetImagesByTraceIDs(ctx context.Context, traceIDs []string) ([]*Image, error)
+	GetImagesByDateRange(ctx context.Context, telegramID *int64, startDate, endDate time.Time) ([]*Image, error)
+	GetImagesByCategory(ctx context.Context, telegramID int64, category string, limit, offset int) ([]*Image, error)
 	GetUserStats(ctx context.Context, telegramID int64) (map[string]int, error)
 
+	// Experiment operations
+	UpdateImageExperiment(ctx context.Context, traceID string, experiment *ImageExperiment) error
+	SetImageFeedback(ctx context.Context, traceID string, telegramID int64, feedback int) error
+	GetExperimentStats(ctx context.Context, startDate, endDate time.Time) ([]*ExperimentStats, error)
+
+	// User settings operations
+	GetUserSettings(ctx context.Context, telegramID int64) (*UserSettings, error)
+	SetUserPrivacyProfile(ctx context.Context, telegramID int64, profile string) error
+
+	// Creator profile operations
+	GetCreatorProfile(ctx context.Context, owner string) (*CreatorProfile, error)
+	SaveCreatorProfile(ctx context.Context, profile *CreatorProfile) error
+	DeleteCreatorProfile(ctx context.Context, owner string) error
+
+	// Outbox operations
+	CreateImageWithOutbox(ctx context.Context, img *Image, queue string, payload []byte, headers map[string]interface{}) error
+	ClaimPendingOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error)
+	ReleaseOutboxMessages(ctx context.Context, ids []int64) error
+	MarkOutboxMessageSent(ctx context.Context, id int64) error
+	MarkOutboxMessageFailed(ctx context.Context, id int64, errMsg string, park bool) error
+	DeleteSentOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+
 	// Statistics operations
 	CreateOrUpdateDailyStats(ctx context.Context, date time.Time) error
 	GetDailyStats(ctx context.Context, startDate, endDate time.Time) ([]*ProcessingStats, error)
@@ -24,3 +49,22 @@ type RepositoryInterface interface {
 	GetRecentErrors(ctx context.Context, service *string, limit int) ([]*Error, error)
 	GetErrorStats(ctx context.Context, startDate, endDate time.Time) (map[string]int, error)
 }
+
+// MetadataCacheInterface defines the interface for metadata cache operations
+type MetadataCacheInterface interface {
+	// FindCachedMetadata returns the best entry matching the SHA-256 exactly or the
+	// perceptual hash within maxDistance bits, or nil if nothing newer than since matches
+	FindCachedMetadata(
+		ctx context.Context, sha256 string, phash uint64, promptVersion string, maxDistance int, since time.Time,
+	) (*CachedMetadata, error)
+	SaveCachedMetadata(ctx context.Context, entry *CachedMetadata) error
+}
+
+// ProcessedMessageInterface defines the interface for the processed-message ledger
+type ProcessedMessageInterface interface {
+	ClaimMessage(ctx context.Context, stage, key string, lease time.Duration) (bool, error)
+	ReleaseMessage(ctx context.Context, stage, key string) error
+	IsMessageProcessed(ctx context.Context, stage, key string) (bool, error)
+	MarkMessageProcessed(ctx context.Context, stage, key string) error
+	DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
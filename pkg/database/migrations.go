@@ -6,3 +6,48 @@ import (
 
 //go:embed migrations/001_initial_schema.sql
 var InitialSchema string
+
+//go:embed migrations/002_experiments.sql
+var ExperimentsSchema string
+
+//go:embed migrations/003_metadata_cache.sql
+var MetadataCacheSchema string
+
+//go:embed migrations/004_user_settings.sql
+var UserSettingsSchema string
+
+//go:embed migrations/005_creator_profiles.sql
+var CreatorProfilesSchema string
+
+//go:embed migrations/006_image_category.sql
+var ImageCategorySchema string
+
+//go:embed migrations/007_processed_messages.sql
+var ProcessedMessagesSchema string
+
+//go:embed migrations/008_outbox.sql
+var OutboxSchema string
+
+//go:embed migrations/009_outbox_headers.sql
+var OutboxHeadersSchema string
+
+//go:embed migrations/010_outbox_claims.sql
+var OutboxClaimsSchema string
+
+//go:embed migrations/011_processed_message_claims.sql
+var ProcessedMessageClaimsSchema string
+
+// Migrations lists all schema migrations in the order they must be applied
+var Migrations = []string{
+	InitialSchema,
+	ExperimentsSchema,
+	MetadataCacheSchema,
+	UserSettingsSchema,
+	CreatorProfilesSchema,
+	ImageCategorySchema,
+	ProcessedMessagesSchema,
+	OutboxSchema,
+	OutboxHeadersSchema,
+	OutboxClaimsSchema,
+	ProcessedMessageClaimsSchema,
+}
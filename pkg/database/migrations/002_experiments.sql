@@ -0,0 +1,14 @@
+-- Migration: 002_experiments
+-- Description: Track prompt/model experiment variants and user feedback per image
+
+-- Add experiment columns to images table
+ALTER TABLE images ADD COLUMN IF NOT EXISTS experiment_variant VARCHAR(100);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS experiment_model VARCHAR(255);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS keyword_count INTEGER;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS parse_failures INTEGER DEFAULT 0;
+
+-- User feedback: 1 for thumbs up, -1 for thumbs down, NULL when not rated
+ALTER TABLE images ADD COLUMN IF NOT EXISTS feedback SMALLINT;
+
+-- Create index on experiment_variant for per-variant aggregation
+CREATE INDEX IF NOT EXISTS idx_images_experiment_variant ON images(experiment_variant);
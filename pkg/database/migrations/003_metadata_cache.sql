@@ -0,0 +1,17 @@
+-- Migration: 003_metadata_cache
+-- Description: Cache generated metadata by image content hash to avoid repeated model calls
+
+-- Create metadata_cache table keyed by SHA-256 and prompt version
+CREATE TABLE IF NOT EXISTS metadata_cache (
+    id SERIAL PRIMARY KEY,
+    sha256 CHAR(64) NOT NULL,
+    phash BIGINT NOT NULL,
+    prompt_version VARCHAR(100) NOT NULL,
+    model VARCHAR(255),
+    metadata JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (sha256, prompt_version)
+);
+
+-- Create index on prompt_version and created_at for TTL-bounded lookups
+CREATE INDEX IF NOT EXISTS idx_metadata_cache_prompt_created ON metadata_cache(prompt_version, created_at DESC);
@@ -0,0 +1,10 @@
+-- Migration: 004_user_settings
+-- Description: Per-user processing preferences selected in the Telegram bot
+
+-- Create user_settings table keyed by Telegram user
+CREATE TABLE IF NOT EXISTS user_settings (
+    telegram_id BIGINT PRIMARY KEY,
+    privacy_profile VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
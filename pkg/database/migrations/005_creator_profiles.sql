@@ -0,0 +1,17 @@
+-- Migration: 005_creator_profiles
+-- Description: Creator, rights and contact fields written to every image of a Telegram user or API key
+
+-- Create creator_profiles table; owner is "telegram:<id>" or "apikey:<sha256 of the key>"
+CREATE TABLE IF NOT EXISTS creator_profiles (
+    owner VARCHAR(100) PRIMARY KEY,
+    creator VARCHAR(255),
+    rights VARCHAR(500),
+    usage_terms TEXT,
+    email VARCHAR(255),
+    phone VARCHAR(50),
+    website VARCHAR(500),
+    city VARCHAR(255),
+    country VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
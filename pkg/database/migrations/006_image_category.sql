@@ -0,0 +1,5 @@
+-- Migration: 006_image_category
+-- Description: Index the generated category so images can be searched by it
+
+-- Case-insensitive lookup of metadata->>'category'
+CREATE INDEX IF NOT EXISTS idx_images_category ON images(telegram_id, LOWER(metadata->>'category'));
@@ -0,0 +1,13 @@
+-- Migration: 007_processed_messages
+-- Description: Ledger of messages each consumer stage has processed, so redeliveries are skipped
+
+-- Create processed_messages table keyed by consumer stage and message key (the trace ID)
+CREATE TABLE IF NOT EXISTS processed_messages (
+    stage VARCHAR(100) NOT NULL,
+    message_key VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (stage, message_key)
+);
+
+-- Create index on processed_at for pruning old entries
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
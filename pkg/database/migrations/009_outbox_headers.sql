@@ -0,0 +1,4 @@
+-- Migration: 009_outbox_headers
+-- Description: Message headers of outbox rows, carrying the trace context of the upload
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS headers JSONB;
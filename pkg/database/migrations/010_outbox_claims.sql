@@ -0,0 +1,11 @@
+-- Migration: 010_outbox_claims
+-- Description: Relay claims and parked rows of the outbox
+
+-- A relay claims rows until claimed_until so other gateway replicas skip them
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
+
+-- Rows that failed to publish too many times are parked with failed_at and no longer retried
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP WITH TIME ZONE;
+
+-- Create partial index on the rows the relay can claim, least attempted first
+CREATE INDEX IF NOT EXISTS idx_outbox_claimable ON outbox(attempts, id) WHERE sent_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,5 @@
+-- Migration: 011_processed_message_claims
+-- Description: Claims of messages a consumer stage is still processing
+
+-- A claimed message has claimed_until set until its handler finishes; processed messages have NULL
+ALTER TABLE processed_messages ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
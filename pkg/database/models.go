@@ -4,6 +4,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"time"
+
+	"github.com/shabohin/photo-tags/pkg/models"
 )
 
 // ImageStatus represents the status of image processing
@@ -34,14 +36,26 @@ type Image struct {
 
 // ImageMetadata represents metadata stored as JSONB
 type ImageMetadata struct {
-	Title       string   `json:"title,omitempty"`
-	Description string   `json:"description,omitempty"`
-	Keywords    []string `json:"keywords,omitempty"`
+	Title                string   `json:"title,omitempty"`
+	Description          string   `json:"description,omitempty"`
+	Keywords             []string `json:"keywords,omitempty"`
+	HierarchicalKeywords []string `json:"hierarchical_keywords,omitempty"`
+	// Category is indexed by idx_images_category for GetImagesByCategory
+	Category               string   `json:"category,omitempty"`
+	SupplementalCategories []string `json:"supplemental_categories,omitempty"`
+	// AltText is the short accessibility description written to AltTextAccessibility
+	AltText string `json:"alt_text,omitempty"`
+	// RemovedTags lists the identifying tags removed by the privacy profile
+	RemovedTags []string `json:"removed_tags,omitempty"`
+	// Consensus keeps the agreement scores of consensus metadata, so cache hits report them too
+	Consensus *models.Consensus `json:"consensus,omitempty"`
 }
 
 // Value implements driver.Valuer for ImageMetadata
 func (m ImageMetadata) Value() (driver.Value, error) {
-	if m.Title == "" && m.Description == "" && len(m.Keywords) == 0 {
+	if m.Title == "" && m.Description == "" && len(m.Keywords) == 0 &&
+		len(m.HierarchicalKeywords) == 0 && m.Category == "" && len(m.SupplementalCategories) == 0 &&
+		m.AltText == "" && len(m.RemovedTags) == 0 && m.Consensus == nil {
 		return nil, nil
 	}
 	return json.Marshal(m)
@@ -114,6 +128,80 @@ func (m *ErrorMetadata) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, m)
 }
 
+// Feedback values stored for user ratings of generated metadata
+const (
+	FeedbackPositive = 1
+	FeedbackNegative = -1
+)
+
+// ImageExperiment holds the experiment variant and quality signals for an image
+type ImageExperiment struct {
+	VariantID     string `json:"variant_id"`
+	Model         string `json:"model,omitempty"`
+	KeywordCount  int    `json:"keyword_count"`
+	ParseFailures int    `json:"parse_failures"`
+}
+
+// ExperimentStats represents aggregated quality statistics for an experiment variant
+type ExperimentStats struct {
+	VariantID        string  `json:"variant_id"`
+	TotalImages      int     `json:"total_images"`
+	SuccessfulImages int     `json:"successful_images"`
+	FailedImages     int     `json:"failed_images"`
+	AvgKeywordCount  float64 `json:"avg_keyword_count"`
+	ParseFailures    int     `json:"parse_failures"`
+	PositiveFeedback int     `json:"positive_feedback"`
+	NegativeFeedback int     `json:"negative_feedback"`
+	ApprovalRate     float64 `json:"approval_rate"`
+}
+
+// CachedMetadata represents a metadata_cache entry for previously analyzed image content
+type CachedMetadata struct {
+	ID            int64         `json:"id"`
+	SHA256        string        `json:"sha256"`
+	PHash         uint64        `json:"phash"`
+	PromptVersion string        `json:"prompt_version"`
+	Model         string        `json:"model,omitempty"`
+	Metadata      ImageMetadata `json:"metadata"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// UserSettings holds the processing preferences of a Telegram user.
+// Empty fields use the service defaults.
+type UserSettings struct {
+	TelegramID     int64     `json:"telegram_id"`
+	PrivacyProfile string    `json:"privacy_profile,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreatorProfile holds the creator, rights and contact fields of a Telegram user or API key.
+// Owner is "telegram:<id>" or "apikey:<sha256 of the key>".
+type CreatorProfile struct {
+	Owner      string    `json:"-"`
+	Creator    string    `json:"creator"`
+	Rights     string    `json:"rights"`
+	UsageTerms string    `json:"usage_terms"`
+	Email      string    `json:"email"`
+	Phone      string    `json:"phone"`
+	Website    string    `json:"website"`
+	City       string    `json:"city"`
+	Country    string    `json:"country"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// OutboxMessage is a queue message stored in the same transaction as the change that produced it
+type OutboxMessage struct {
+	ID        int64                  `json:"id"`
+	Queue     string                 `json:"queue"`
+	Payload   []byte                 `json:"payload"`
+	Headers   map[string]interface{} `json:"headers,omitempty"`
+	Attempts  int                    `json:"attempts"`
+	LastError *string                `json:"last_error,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	SentAt    *time.Time             `json:"sent_at,omitempty"`
+	FailedAt  *time.Time             `json:"failed_at,omitempty"`
+}
+
 // StatsFilter represents filters for statistics queries
 type StatsFilter struct {
 	StartDate *time.Time
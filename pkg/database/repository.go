@@ -3,8 +3,11 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Repository provides methods for database operations
@@ -151,6 +154,93 @@ func (r *Repository) GetImagesByUser(ctx context.Context, telegramID int64, limi
 	return images, nil
 }
 
+// GetImagesByTraceIDs retrieves the images with the given trace IDs, oldest first
+func (r *Repository) GetImagesByTraceIDs(ctx context.Context, traceIDs []string) ([]*Image, error) {
+	query := `
+		SELECT id, trace_id, telegram_id, telegram_username, filename, original_path,
+		       processed_path, status, error_message, metadata, created_at, updated_at
+		FROM images
+		WHERE trace_id = ANY($1)
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.client.db.QueryContext(ctx, query, pq.Array(traceIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images: %w", err)
+	}
+	defer rows.Close()
+
+	return scanImages(rows)
+}
+
+// GetImagesByDateRange retrieves images created between startDate and endDate (inclusive),
+// optionally for a single user, oldest first
+func (r *Repository) GetImagesByDateRange(
+	ctx context.Context, telegramID *int64, startDate, endDate time.Time,
+) ([]*Image, error) {
+	query := `
+		SELECT id, trace_id, telegram_id, telegram_username, filename, original_path,
+		       processed_path, status, error_message, metadata, created_at, updated_at
+		FROM images
+		WHERE ($1::bigint IS NULL OR telegram_id = $1)
+		  AND created_at >= $2::date AND created_at < $3::date + INTERVAL '1 day'
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.client.db.QueryContext(ctx, query, telegramID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images: %w", err)
+	}
+	defer rows.Close()
+
+	return scanImages(rows)
+}
+
+// GetImagesByCategory retrieves a user's images whose category (case-insensitive) matches, newest first
+func (r *Repository) GetImagesByCategory(
+	ctx context.Context, telegramID int64, category string, limit, offset int,
+) ([]*Image, error) {
+	query := `
+		SELECT id, trace_id, telegram_id, telegram_username, filename, original_path,
+		       processed_path, status, error_message, metadata, created_at, updated_at
+		FROM images
+		WHERE telegram_id = $1 AND LOWER(metadata->>'category') = LOWER($2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.client.db.QueryContext(ctx, query, telegramID, category, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images: %w", err)
+	}
+	defer rows.Close()
+
+	return scanImages(rows)
+}
+
+// scanImages reads image rows selected in the column order of GetImagesByUser
+func scanImages(rows *sql.Rows) ([]*Image, error) {
+	var images []*Image
+	for rows.Next() {
+		img := &Image{}
+		err := rows.Scan(
+			&img.ID, &img.TraceID, &img.TelegramID, &img.TelegramUsername, &img.Filename,
+			&img.OriginalPath, &img.ProcessedPath, &img.Status, &img.ErrorMessage,
+			&img.Metadata, &img.CreatedAt, &img.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan image: %w", err)
+		}
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return images, nil
+}
+
 // GetUserStats retrieves statistics for a specific user
 func (r *Repository) GetUserStats(ctx context.Context, telegramID int64) (map[string]int, error) {
 	query := `
@@ -183,6 +273,514 @@ func (r *Repository) GetUserStats(ctx context.Context, telegramID int64) (map[st
 	return stats, nil
 }
 
+// UpdateImageExperiment records the experiment variant and quality signals for an image
+func (r *Repository) UpdateImageExperiment(ctx context.Context, traceID string, experiment *ImageExperiment) error {
+	query := `
+		UPDATE images
+		SET experiment_variant = $1, experiment_model = $2, keyword_count = $3, parse_failures = $4,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE trace_id = $5
+	`
+
+	result, err := r.client.db.ExecContext(
+		ctx, query,
+		experiment.VariantID, experiment.Model, experiment.KeywordCount, experiment.ParseFailures, traceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update image experiment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("image with trace_id %s not found", traceID)
+	}
+
+	return nil
+}
+
+// SetImageFeedback stores user feedback for an image owned by the given user
+func (r *Repository) SetImageFeedback(ctx context.Context, traceID string, telegramID int64, feedback int) error {
+	query := `
+		UPDATE images
+		SET feedback = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE trace_id = $2 AND telegram_id = $3
+	`
+
+	result, err := r.client.db.ExecContext(ctx, query, feedback, traceID, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to set image feedback: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("image with trace_id %s not found", traceID)
+	}
+
+	return nil
+}
+
+// GetExperimentStats retrieves quality statistics grouped by experiment variant
+func (r *Repository) GetExperimentStats(ctx context.Context, startDate, endDate time.Time) ([]*ExperimentStats, error) {
+	query := `
+		SELECT
+			experiment_variant,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'success'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			COALESCE(AVG(keyword_count), 0),
+			COALESCE(SUM(parse_failures), 0),
+			COUNT(*) FILTER (WHERE feedback > 0),
+			COUNT(*) FILTER (WHERE feedback < 0)
+		FROM images
+		WHERE experiment_variant IS NOT NULL AND created_at BETWEEN $1 AND $2
+		GROUP BY experiment_variant
+		ORDER BY experiment_variant
+	`
+
+	rows, err := r.client.db.QueryContext(ctx, query, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiment stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*ExperimentStats
+	for rows.Next() {
+		stat := &ExperimentStats{}
+		err := rows.Scan(
+			&stat.VariantID, &stat.TotalImages, &stat.SuccessfulImages, &stat.FailedImages,
+			&stat.AvgKeywordCount, &stat.ParseFailures, &stat.PositiveFeedback, &stat.NegativeFeedback,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan experiment stat: %w", err)
+		}
+		if rated := stat.PositiveFeedback + stat.NegativeFeedback; rated > 0 {
+			stat.ApprovalRate = float64(stat.PositiveFeedback) / float64(rated)
+		}
+		stats = append(stats, stat)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// FindCachedMetadata looks up cached metadata by exact content hash or nearest perceptual hash
+func (r *Repository) FindCachedMetadata(
+	ctx context.Context, sha256 string, phash uint64, promptVersion string, maxDistance int, since time.Time,
+) (*CachedMetadata, error) {
+	query := `
+		SELECT id, sha256, phash, prompt_version, COALESCE(model, ''), metadata, created_at
+		FROM metadata_cache
+		WHERE prompt_version = $1
+		  AND created_at >= $2
+		  AND (sha256 = $3 OR bit_count((phash # $4)::bit(64)) <= $5)
+		ORDER BY (sha256 = $3) DESC, bit_count((phash # $4)::bit(64)), created_at DESC
+		LIMIT 1
+	`
+
+	entry := &CachedMetadata{}
+	var storedHash int64
+	// nolint:gosec // G115: perceptual hash is stored as the BIGINT bit pattern
+	err := r.client.db.QueryRowContext(ctx, query, promptVersion, since, sha256, int64(phash), maxDistance).Scan(
+		&entry.ID, &entry.SHA256, &storedHash, &entry.PromptVersion, &entry.Model, &entry.Metadata, &entry.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cached metadata: %w", err)
+	}
+
+	// nolint:gosec // G115: restore the unsigned perceptual hash from its bit pattern
+	entry.PHash = uint64(storedHash)
+	return entry, nil
+}
+
+// SaveCachedMetadata inserts or refreshes a metadata cache entry
+func (r *Repository) SaveCachedMetadata(ctx context.Context, entry *CachedMetadata) error {
+	query := `
+		INSERT INTO metadata_cache (sha256, phash, prompt_version, model, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (sha256, prompt_version) DO UPDATE SET
+			phash = EXCLUDED.phash,
+			model = EXCLUDED.model,
+			metadata = EXCLUDED.metadata,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at
+	`
+
+	// nolint:gosec // G115: perceptual hash is stored as the BIGINT bit pattern
+	err := r.client.db.QueryRowContext(
+		ctx, query,
+		entry.SHA256, int64(entry.PHash), entry.PromptVersion, entry.Model, entry.Metadata,
+	).Scan(&entry.ID, &entry.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save cached metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserSettings retrieves the settings of a user; users without stored settings get empty settings
+func (r *Repository) GetUserSettings(ctx context.Context, telegramID int64) (*UserSettings, error) {
+	query := `
+		SELECT telegram_id, COALESCE(privacy_profile, ''), updated_at
+		FROM user_settings
+		WHERE telegram_id = $1
+	`
+
+	settings := &UserSettings{}
+	err := r.client.db.QueryRowContext(ctx, query, telegramID).Scan(
+		&settings.TelegramID, &settings.PrivacyProfile, &settings.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return &UserSettings{TelegramID: telegramID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// SetUserPrivacyProfile stores the privacy profile applied to a user's images
+func (r *Repository) SetUserPrivacyProfile(ctx context.Context, telegramID int64, profile string) error {
+	query := `
+		INSERT INTO user_settings (telegram_id, privacy_profile)
+		VALUES ($1, $2)
+		ON CONFLICT (telegram_id) DO UPDATE SET
+			privacy_profile = EXCLUDED.privacy_profile,
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := r.client.db.ExecContext(ctx, query, telegramID, profile); err != nil {
+		return fmt.Errorf("failed to set privacy profile: %w", err)
+	}
+
+	return nil
+}
+
+// GetCreatorProfile retrieves the creator profile of an owner, or nil if none is stored
+func (r *Repository) GetCreatorProfile(ctx context.Context, owner string) (*CreatorProfile, error) {
+	query := `
+		SELECT owner, COALESCE(creator, ''), COALESCE(rights, ''), COALESCE(usage_terms, ''),
+		       COALESCE(email, ''), COALESCE(phone, ''), COALESCE(website, ''),
+		       COALESCE(city, ''), COALESCE(country, ''), updated_at
+		FROM creator_profiles
+		WHERE owner = $1
+	`
+
+	profile := &CreatorProfile{}
+	err := r.client.db.QueryRowContext(ctx, query, owner).Scan(
+		&profile.Owner, &profile.Creator, &profile.Rights, &profile.UsageTerms,
+		&profile.Email, &profile.Phone, &profile.Website,
+		&profile.City, &profile.Country, &profile.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get creator profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// SaveCreatorProfile creates or replaces the creator profile of profile.Owner
+func (r *Repository) SaveCreatorProfile(ctx context.Context, profile *CreatorProfile) error {
+	query := `
+		INSERT INTO creator_profiles (
+			owner, creator, rights, usage_terms, email, phone, website, city, country
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (owner) DO UPDATE SET
+			creator = EXCLUDED.creator,
+			rights = EXCLUDED.rights,
+			usage_terms = EXCLUDED.usage_terms,
+			email = EXCLUDED.email,
+			phone = EXCLUDED.phone,
+			website = EXCLUDED.website,
+			city = EXCLUDED.city,
+			country = EXCLUDED.country,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	err := r.client.db.QueryRowContext(
+		ctx, query,
+		profile.Owner, profile.Creator, profile.Rights, profile.UsageTerms,
+		profile.Email, profile.Phone, profile.Website, profile.City, profile.Country,
+	).Scan(&profile.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save creator profile: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCreatorProfile removes the creator profile of an owner
+func (r *Repository) DeleteCreatorProfile(ctx context.Context, owner string) error {
+	query := `DELETE FROM creator_profiles WHERE owner = $1`
+
+	if _, err := r.client.db.ExecContext(ctx, query, owner); err != nil {
+		return fmt.Errorf("failed to delete creator profile: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimMessage records that a consumer stage started processing the message with key and
+// reports whether it did. It fails if the message was processed or is claimed by another consumer,
+// unless that claim is older than lease.
+func (r *Repository) ClaimMessage(ctx context.Context, stage, key string, lease time.Duration) (bool, error) {
+	query := `
+		INSERT INTO processed_messages (stage, message_key, claimed_until)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (stage, message_key) DO UPDATE
+		SET claimed_until = EXCLUDED.claimed_until, processed_at = CURRENT_TIMESTAMP
+		WHERE processed_messages.claimed_until < CURRENT_TIMESTAMP
+	`
+
+	result, err := r.client.db.ExecContext(ctx, query, stage, key, lease.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim message: %w", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim message: %w", err)
+	}
+
+	return claimed == 1, nil
+}
+
+// ReleaseMessage drops the claim on a message that failed, so a redelivery processes it again
+func (r *Repository) ReleaseMessage(ctx context.Context, stage, key string) error {
+	query := `DELETE FROM processed_messages WHERE stage = $1 AND message_key = $2 AND claimed_until IS NOT NULL`
+
+	if _, err := r.client.db.ExecContext(ctx, query, stage, key); err != nil {
+		return fmt.Errorf("failed to release message: %w", err)
+	}
+
+	return nil
+}
+
+// IsMessageProcessed reports whether a consumer stage has already processed the message with key
+func (r *Repository) IsMessageProcessed(ctx context.Context, stage, key string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM processed_messages
+			WHERE stage = $1 AND message_key = $2 AND claimed_until IS NULL
+		)
+	`
+
+	var processed bool
+	if err := r.client.db.QueryRowContext(ctx, query, stage, key).Scan(&processed); err != nil {
+		return false, fmt.Errorf("failed to check processed message: %w", err)
+	}
+
+	return processed, nil
+}
+
+// MarkMessageProcessed records that a consumer stage has processed the message with key
+func (r *Repository) MarkMessageProcessed(ctx context.Context, stage, key string) error {
+	query := `
+		INSERT INTO processed_messages (stage, message_key)
+		VALUES ($1, $2)
+		ON CONFLICT (stage, message_key) DO UPDATE
+		SET claimed_until = NULL, processed_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := r.client.db.ExecContext(ctx, query, stage, key); err != nil {
+		return fmt.Errorf("failed to mark message processed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedMessagesBefore removes ledger entries recorded before the given time
+func (r *Repository) DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM processed_messages WHERE processed_at < $1`
+
+	result, err := r.client.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// CreateImageWithOutbox inserts a new image record and the queue message announcing it in one
+// transaction, so the message is published if and only if the image is recorded.
+// headers are published with the message.
+func (r *Repository) CreateImageWithOutbox(
+	ctx context.Context,
+	img *Image,
+	queue string,
+	payload []byte,
+	headers map[string]interface{},
+) error {
+	var headersJSON []byte
+	if len(headers) > 0 {
+		var err error
+		if headersJSON, err = json.Marshal(headers); err != nil {
+			return fmt.Errorf("failed to marshal outbox headers: %w", err)
+		}
+	}
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	imageQuery := `
+		INSERT INTO images (trace_id, telegram_id, telegram_username, filename, original_path, status, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRowContext(
+		ctx, imageQuery,
+		img.TraceID, img.TelegramID, img.TelegramUsername, img.Filename, img.OriginalPath, img.Status, img.Metadata,
+	).Scan(&img.ID, &img.CreatedAt, &img.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create image: %w", err)
+	}
+
+	outboxQuery := `INSERT INTO outbox (queue, payload, headers) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, outboxQuery, queue, payload, headersJSON); err != nil {
+		return fmt.Errorf("failed to create outbox message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimPendingOutboxMessages claims up to limit unsent, unparked messages for lease, least
+// attempted first, so a message that keeps failing does not hold back newer ones. Rows claimed by
+// another relay are skipped until their lease runs out.
+func (r *Repository) ClaimPendingOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	query := `
+		WITH claimable AS (
+			SELECT id
+			FROM outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL
+			  AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY attempts ASC, id ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE outbox
+			SET claimed_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+			FROM claimable
+			WHERE outbox.id = claimable.id
+			RETURNING outbox.id, outbox.queue, outbox.payload, outbox.headers, outbox.attempts,
+			          outbox.last_error, outbox.created_at
+		)
+		SELECT id, queue, payload, headers, attempts, last_error, created_at
+		FROM claimed
+		ORDER BY attempts ASC, id ASC
+	`
+
+	rows, err := r.client.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*OutboxMessage
+	for rows.Next() {
+		msg := &OutboxMessage{}
+		var headers []byte
+		if err := rows.Scan(&msg.ID, &msg.Queue, &msg.Payload, &headers, &msg.Attempts, &msg.LastError, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &msg.Headers); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal outbox headers: %w", err)
+			}
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return messages, nil
+}
+
+// ReleaseOutboxMessages drops the claims on outbox messages that were not attempted
+func (r *Repository) ReleaseOutboxMessages(ctx context.Context, ids []int64) error {
+	query := `UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1)`
+
+	if _, err := r.client.db.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to release outbox messages: %w", err)
+	}
+
+	return nil
+}
+
+// MarkOutboxMessageSent records that an outbox message was published
+func (r *Repository) MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	query := `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1, claimed_until = NULL WHERE id = $1`
+
+	if _, err := r.client.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox message sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkOutboxMessageFailed records a failed publish attempt of an outbox message.
+// A parked message gets failed_at and is no longer claimed.
+func (r *Repository) MarkOutboxMessageFailed(ctx context.Context, id int64, errMsg string, park bool) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $1, claimed_until = NULL,
+		    failed_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP ELSE failed_at END
+		WHERE id = $3
+	`
+
+	if _, err := r.client.db.ExecContext(ctx, query, errMsg, park, id); err != nil {
+		return fmt.Errorf("failed to mark outbox message failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSentOutboxMessagesBefore removes outbox messages sent before the given time
+func (r *Repository) DeleteSentOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM outbox WHERE sent_at < $1`
+
+	result, err := r.client.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
 // CreateOrUpdateDailyStats creates or updates daily processing statistics
 func (r *Repository) CreateOrUpdateDailyStats(ctx context.Context, date time.Time) error {
 	query := `
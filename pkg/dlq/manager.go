@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
 	"github.com/streadway/amqp"
 )
 
@@ -42,8 +43,16 @@ func (m *Manager) ConvertToFailedJob(msg amqp.Delivery) (*models.FailedJob, erro
 			}
 		}
 
+		// Messages moved here after the last retry tier name their queue and retries in headers
+		if queue, ok := msg.Headers[retryqueue.HeaderOriginalQueue].(string); ok && queue != "" {
+			originalQueue = queue
+		}
+		if count := retryqueue.RetryCount(msg.Headers); count > 0 {
+			retryCount = count
+		}
+
 		// Get custom error reason if provided
-		if reason, ok := msg.Headers["x-error-reason"].(string); ok {
+		if reason, ok := msg.Headers[retryqueue.HeaderErrorReason].(string); ok {
 			errorReason = reason
 		}
 	}
@@ -90,10 +99,10 @@ func CreateFailedJobMessage(originalQueue string, messageBody []byte, errorReaso
 	}
 
 	headers := map[string]interface{}{
-		"x-original-queue": originalQueue,
-		"x-error-reason":   errorReason,
-		"x-retry-count":    retryCount,
-		"x-failed-at":      time.Now().Format(time.RFC3339),
+		retryqueue.HeaderOriginalQueue: originalQueue,
+		retryqueue.HeaderErrorReason:   errorReason,
+		retryqueue.HeaderRetryCount:    retryCount,
+		retryqueue.HeaderFailedAt:      time.Now().Format(time.RFC3339),
 	}
 
 	return messageBody, headers, nil
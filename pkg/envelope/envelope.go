@@ -0,0 +1,163 @@
+// Package envelope versions the messages exchanged through RabbitMQ.
+//
+// Every message carries schema_version, type and produced_by next to its own fields, so
+// consumers that predate the envelope keep reading new messages. Consumers decode through
+// Decode, which upcasts older versions to CurrentVersion; services are therefore deployed
+// consumers first, then producers. A message newer than CurrentVersion is rejected rather than
+// misread, and can be replayed from the dead letter queue once the consumer is upgraded.
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Schema versions
+const (
+	// MinVersion is the oldest version consumers accept; version 1 messages predate the envelope
+	// and have no header fields
+	MinVersion = 1
+	// CurrentVersion is the version producers write
+	CurrentVersion = 2
+)
+
+// Message types, named after the queue that carries them
+const (
+	TypeImageUpload       = "image_upload"
+	TypeMetadataGenerated = "metadata_generated"
+	TypeImageProcess      = "image_process"
+	TypeImageProcessed    = "image_processed"
+)
+
+// Producers written to produced_by
+const (
+	ProducerGateway     = "gateway"
+	ProducerAnalyzer    = "analyzer"
+	ProducerProcessor   = "processor"
+	ProducerFilewatcher = "filewatcher"
+)
+
+var (
+	// ErrUnsupportedVersion is returned for messages older than MinVersion or newer than CurrentVersion
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	// ErrUnexpectedType is returned when a message of another type is decoded
+	ErrUnexpectedType = errors.New("unexpected message type")
+)
+
+// Header identifies the contract a message was produced with
+type Header struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	ProducedBy    string `json:"produced_by"`
+}
+
+// upcaster rewrites a message body of one version into the next version
+type upcaster func(body []byte) ([]byte, error)
+
+// upcasters lists, per message type, the upcaster from each version to the next.
+// A missing entry means the next version only added the header.
+var upcasters = map[string]map[int]upcaster{
+	// The web and batch uploads published the marshalled message through PublishMessage,
+	// which sent it as a base64 JSON string
+	TypeImageUpload: {1: unwrapBase64},
+}
+
+// Encode marshals message with a CurrentVersion header.
+// message must marshal to a JSON object.
+func Encode(msgType, producer string, message interface{}) ([]byte, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s message: %w", msgType, err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%s message is not a JSON object: %w", msgType, err)
+	}
+
+	header, err := json.Marshal(Header{SchemaVersion: CurrentVersion, Type: msgType, ProducedBy: producer})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(header, &fields); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+// Decode upcasts body to CurrentVersion and unmarshals it into message.
+// It returns the header the message was produced with.
+func Decode(body []byte, msgType string, message interface{}) (Header, error) {
+	header, upcast, err := Upcast(body, msgType)
+	if err != nil {
+		return header, err
+	}
+	if err := json.Unmarshal(upcast, message); err != nil {
+		return header, fmt.Errorf("failed to unmarshal %s message: %w", msgType, err)
+	}
+	return header, nil
+}
+
+// Upcast returns the header of body and body rewritten to CurrentVersion.
+// The header fields of the returned body are left as produced.
+func Upcast(body []byte, msgType string) (Header, []byte, error) {
+	header, err := ReadHeader(body)
+	if err != nil {
+		return header, nil, err
+	}
+
+	if header.Type != "" && header.Type != msgType {
+		return header, nil, fmt.Errorf("%w: got %s, want %s", ErrUnexpectedType, header.Type, msgType)
+	}
+	if header.SchemaVersion < MinVersion || header.SchemaVersion > CurrentVersion {
+		return header, nil, fmt.Errorf("%w: %s version %d, supported %d to %d",
+			ErrUnsupportedVersion, msgType, header.SchemaVersion, MinVersion, CurrentVersion)
+	}
+
+	for version := header.SchemaVersion; version < CurrentVersion; version++ {
+		up, ok := upcasters[msgType][version]
+		if !ok {
+			continue
+		}
+		if body, err = up(body); err != nil {
+			return header, nil, fmt.Errorf("failed to upcast %s message from version %d: %w", msgType, version, err)
+		}
+	}
+
+	return header, body, nil
+}
+
+// ReadHeader returns the header of body; a message without schema_version is version 1
+func ReadHeader(body []byte) (Header, error) {
+	header := Header{SchemaVersion: MinVersion}
+
+	// A version 1 body may be a base64 JSON string, see upcasters
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '"' {
+		return header, nil
+	}
+
+	if err := json.Unmarshal(body, &header); err != nil {
+		return Header{}, fmt.Errorf("failed to read message header: %w", err)
+	}
+	if header.SchemaVersion == 0 {
+		header.SchemaVersion = MinVersion
+	}
+	return header, nil
+}
+
+// unwrapBase64 decodes a message that was sent as a base64 JSON string
+func unwrapBase64(body []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '"' {
+		return body, nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(body, &encoded); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,86 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type upload struct {
+	TraceID string `json:"trace_id"`
+}
+
+func TestEncode_AddsHeaderNextToFields(t *testing.T) {
+	body, err := Encode(TypeImageUpload, ProducerGateway, upload{TraceID: "t1"})
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &fields))
+	assert.Equal(t, "t1", fields["trace_id"])
+	assert.Equal(t, float64(CurrentVersion), fields["schema_version"])
+	assert.Equal(t, TypeImageUpload, fields["type"])
+	assert.Equal(t, ProducerGateway, fields["produced_by"])
+}
+
+func TestEncode_RejectsNonObjects(t *testing.T) {
+	_, err := Encode(TypeImageUpload, ProducerGateway, []string{"t1"})
+	assert.Error(t, err)
+}
+
+func TestDecode_CurrentVersion(t *testing.T) {
+	body, err := Encode(TypeImageUpload, ProducerFilewatcher, upload{TraceID: "t1"})
+	require.NoError(t, err)
+
+	var msg upload
+	header, err := Decode(body, TypeImageUpload, &msg)
+	require.NoError(t, err)
+	assert.Equal(t, Header{SchemaVersion: CurrentVersion, Type: TypeImageUpload, ProducedBy: ProducerFilewatcher}, header)
+	assert.Equal(t, "t1", msg.TraceID)
+}
+
+func TestDecode_UnversionedMessageIsVersion1(t *testing.T) {
+	var msg upload
+	header, err := Decode([]byte(`{"trace_id":"t1"}`), TypeImageProcessed, &msg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.SchemaVersion)
+	assert.Empty(t, header.ProducedBy)
+	assert.Equal(t, "t1", msg.TraceID)
+}
+
+func TestDecode_UpcastsBase64Uploads(t *testing.T) {
+	body, err := json.Marshal([]byte(`{"trace_id":"t1"}`))
+	require.NoError(t, err)
+	require.Equal(t, `"`+base64.StdEncoding.EncodeToString([]byte(`{"trace_id":"t1"}`))+`"`, string(body))
+
+	var msg upload
+	_, err = Decode(body, TypeImageUpload, &msg)
+	require.NoError(t, err)
+	assert.Equal(t, "t1", msg.TraceID)
+}
+
+func TestDecode_RejectsUnsupportedVersions(t *testing.T) {
+	var msg upload
+	_, err := Decode([]byte(`{"schema_version":99,"type":"image_upload","trace_id":"t1"}`), TypeImageUpload, &msg)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = Decode([]byte(`{"schema_version":-1,"trace_id":"t1"}`), TypeImageUpload, &msg)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestDecode_RejectsOtherTypes(t *testing.T) {
+	body, err := Encode(TypeImageProcessed, ProducerProcessor, upload{TraceID: "t1"})
+	require.NoError(t, err)
+
+	var msg upload
+	_, err = Decode(body, TypeImageUpload, &msg)
+	assert.ErrorIs(t, err, ErrUnexpectedType)
+}
+
+func TestDecode_MalformedBody(t *testing.T) {
+	var msg upload
+	_, err := Decode([]byte(`not json`), TypeImageUpload, &msg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+// Package idempotency lets consumers skip messages they have already processed.
+//
+// RabbitMQ delivers at least once: a consumer that crashes after processing a message but
+// before acking it gets the message again. The ledger records every message a consumer stage
+// has processed, keyed by trace ID, so the redelivery is acked without being processed twice.
+// A message is claimed before it is handled, so two concurrent deliveries do not both handle it.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// Retention is how long processed messages are remembered by Prune
+const Retention = 7 * 24 * time.Hour
+
+// ClaimLease is how long a claim stops other deliveries of a message. A consumer that crashed
+// while handling the message leaves its claim behind; the message is processed again once the
+// lease has run out, before the last retry tier.
+const ClaimLease = 5 * time.Minute
+
+// ErrInProgress is returned for a message that another delivery is still handling. It is a
+// transient failure: the retry finds the message processed, or the claim of a crashed consumer expired.
+var ErrInProgress = errors.New("message is being processed by another delivery")
+
+// Store records processed messages per consumer stage
+type Store interface {
+	ClaimMessage(ctx context.Context, stage, key string, lease time.Duration) (bool, error)
+	ReleaseMessage(ctx context.Context, stage, key string) error
+	IsMessageProcessed(ctx context.Context, stage, key string) (bool, error)
+	MarkMessageProcessed(ctx context.Context, stage, key string) error
+}
+
+// Ledger skips messages a consumer stage has already processed
+type Ledger struct {
+	store Store
+	stage string
+}
+
+// NewLedger creates a ledger for one consumer stage, e.g. "analyzer" or "gateway.bot"
+func NewLedger(store Store, stage string) *Ledger {
+	return &Ledger{
+		store: store,
+		stage: stage,
+	}
+}
+
+// Process claims key and runs handle unless the stage has already processed key, and records key
+// once handle succeeds. It reports whether the message was a duplicate, in which case handle is
+// not run, and returns ErrInProgress while another delivery holds the claim. A failed handle
+// releases the claim so a redelivery is processed again.
+// Messages without a key are always processed. The ledger fails open: if the store cannot be
+// written the message is processed, and if it cannot be recorded a redelivery is processed again.
+func (l *Ledger) Process(ctx context.Context, key string, handle func() error) (bool, error) {
+	if key == "" {
+		return false, handle()
+	}
+
+	claimed, err := l.store.ClaimMessage(ctx, l.stage, key, ClaimLease)
+	if err != nil {
+		log.Printf("Error claiming message %s/%s: %v", l.stage, key, err)
+		return false, handle()
+	}
+	if !claimed {
+		processed, err := l.store.IsMessageProcessed(ctx, l.stage, key)
+		if err != nil {
+			log.Printf("Error checking processed message %s/%s: %v", l.stage, key, err)
+		}
+		if processed {
+			return true, nil
+		}
+		return false, ErrInProgress
+	}
+
+	if err := handle(); err != nil {
+		if releaseErr := l.store.ReleaseMessage(ctx, l.stage, key); releaseErr != nil {
+			log.Printf("Error releasing message %s/%s: %v", l.stage, key, releaseErr)
+		}
+		return false, err
+	}
+
+	if err := l.store.MarkMessageProcessed(ctx, l.stage, key); err != nil {
+		log.Printf("Error recording processed message %s/%s: %v", l.stage, key, err)
+	}
+	return false, nil
+}
+
+// TraceID returns the trace_id of a queue message, or "" if it has none
+func TraceID(body []byte) string {
+	var msg struct {
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return ""
+	}
+	return msg.TraceID
+}
+
+// Pruner deletes ledger entries older than a cutoff
+type Pruner interface {
+	DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Prune deletes entries older than Retention every interval until ctx is done
+func Prune(ctx context.Context, pruner Pruner, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := pruner.DeleteProcessedMessagesBefore(ctx, time.Now().Add(-Retention))
+			if err != nil {
+				log.Printf("Error pruning processed messages: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Pruned %d processed messages", deleted)
+			}
+		}
+	}
+}
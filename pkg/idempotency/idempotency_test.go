@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger_SkipsProcessedMessages(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(NewMemoryStore(10), "analyzer")
+
+	calls := 0
+	handle := func() error {
+		calls++
+		return nil
+	}
+
+	duplicate, err := ledger.Process(ctx, "trace-1", handle)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = ledger.Process(ctx, "trace-1", handle)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, 1, calls)
+}
+
+func TestLedger_FailedMessagesAreNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(NewMemoryStore(10), "processor")
+
+	failure := errors.New("exiftool failed")
+	duplicate, err := ledger.Process(ctx, "trace-1", func() error { return failure })
+	assert.ErrorIs(t, err, failure)
+	assert.False(t, duplicate)
+
+	calls := 0
+	duplicate, err = ledger.Process(ctx, "trace-1", func() error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, duplicate, "a retried message is processed again")
+	assert.Equal(t, 1, calls)
+}
+
+func TestLedger_StagesAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+
+	_, err := NewLedger(store, "gateway.bot").Process(ctx, "trace-1", func() error { return nil })
+	require.NoError(t, err)
+
+	duplicate, err := NewLedger(store, "gateway.batch").Process(ctx, "trace-1", func() error { return nil })
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestLedger_MessagesWithoutKeyAreAlwaysProcessed(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(NewMemoryStore(10), "filewatcher")
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		duplicate, err := ledger.Process(ctx, "", func() error {
+			calls++
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, duplicate)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestLedger_ConcurrentDeliveryIsNotHandledTwice(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(NewMemoryStore(10), "gateway.batch")
+
+	calls := 0
+	duplicate, err := ledger.Process(ctx, "trace-1", func() error {
+		calls++
+		// A second delivery arrives while the first is still being handled
+		duplicate, err := ledger.Process(ctx, "trace-1", func() error {
+			calls++
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrInProgress)
+		assert.False(t, duplicate)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.Equal(t, 1, calls)
+
+	duplicate, err = ledger.Process(ctx, "trace-1", func() error { return nil })
+	require.NoError(t, err)
+	assert.True(t, duplicate, "the retried delivery finds the message processed")
+}
+
+func TestMemoryStore_ExpiredClaimCanBeTakenOver(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	claimed, err := store.ClaimMessage(ctx, "stage", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, _ = store.ClaimMessage(ctx, "stage", "a", time.Minute)
+	assert.False(t, claimed, "the claim is held")
+
+	// The consumer that claimed the message crashed
+	now = now.Add(2 * time.Minute)
+	claimed, _ = store.ClaimMessage(ctx, "stage", "a", time.Minute)
+	assert.True(t, claimed)
+
+	require.NoError(t, store.MarkMessageProcessed(ctx, "stage", "a"))
+	now = now.Add(time.Hour)
+	claimed, _ = store.ClaimMessage(ctx, "stage", "a", time.Minute)
+	assert.False(t, claimed, "a processed message is never claimed again")
+}
+
+func TestMemoryStore_ForgetsOldestWhenFull(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, store.MarkMessageProcessed(ctx, "stage", key))
+	}
+
+	processed, _ := store.IsMessageProcessed(ctx, "stage", "a")
+	assert.False(t, processed)
+	processed, _ = store.IsMessageProcessed(ctx, "stage", "c")
+	assert.True(t, processed)
+}
+
+func TestTraceID(t *testing.T) {
+	assert.Equal(t, "abc", TraceID([]byte(`{"trace_id":"abc","group_id":"g"}`)))
+	assert.Equal(t, "", TraceID([]byte(`{"group_id":"g"}`)))
+	assert.Equal(t, "", TraceID([]byte(`not json`)))
+}
@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is the number of messages a MemoryStore remembers
+const DefaultCapacity = 10000
+
+// MemoryStore is a bounded in-process Store for services without a database.
+// Once full it forgets the oldest messages, so it catches redeliveries shortly after a
+// failed ack but not after a restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+// memoryEntry is a claimed or processed message; claimedUntil is zero once it is processed
+type memoryEntry struct {
+	id           string
+	claimedUntil time.Time
+}
+
+// NewMemoryStore creates a MemoryStore that remembers up to capacity messages
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// ClaimMessage records that stage started processing key, unless key is processed or claimed
+// by a claim that has not expired
+func (s *MemoryStore) ClaimMessage(_ context.Context, stage, key string, lease time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if element, ok := s.entries[stage+"\x00"+key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if entry.claimedUntil.IsZero() || now.Before(entry.claimedUntil) {
+			return false, nil
+		}
+		entry.claimedUntil = now.Add(lease)
+		return true, nil
+	}
+
+	s.add(stage+"\x00"+key, now.Add(lease))
+	return true, nil
+}
+
+// ReleaseMessage drops the claim of stage on key
+func (s *MemoryStore) ReleaseMessage(_ context.Context, stage, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[stage+"\x00"+key]; ok && !element.Value.(*memoryEntry).claimedUntil.IsZero() {
+		s.order.Remove(element)
+		delete(s.entries, stage+"\x00"+key)
+	}
+	return nil
+}
+
+// IsMessageProcessed reports whether stage has processed key
+func (s *MemoryStore) IsMessageProcessed(_ context.Context, stage, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[stage+"\x00"+key]
+	return ok && element.Value.(*memoryEntry).claimedUntil.IsZero(), nil
+}
+
+// MarkMessageProcessed records that stage has processed key
+func (s *MemoryStore) MarkMessageProcessed(_ context.Context, stage, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := stage + "\x00" + key
+	if element, ok := s.entries[id]; ok {
+		element.Value.(*memoryEntry).claimedUntil = time.Time{}
+		return nil
+	}
+
+	s.add(id, time.Time{})
+	return nil
+}
+
+// add remembers a new entry, forgetting the oldest once the store is full
+func (s *MemoryStore) add(id string, claimedUntil time.Time) {
+	s.entries[id] = s.order.PushBack(&memoryEntry{id: id, claimedUntil: claimedUntil})
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).id)
+	}
+}
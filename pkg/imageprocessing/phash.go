@@ -0,0 +1,44 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// dHashSize is the width of the grid used for difference hashing (height is one less)
+const dHashSize = 9
+
+// PerceptualHash computes a 64-bit difference hash (dHash) of the image.
+// Visually similar images (re-encoded, resized, slightly edited) produce hashes
+// with a small Hamming distance.
+func PerceptualHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	small := imaging.Resize(imaging.Grayscale(img), dHashSize, dHashSize-1, imaging.Box)
+
+	var hash uint64
+	for y := 0; y < dHashSize-1; y++ {
+		for x := 0; x < dHashSize-1; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// HammingDistance returns the number of differing bits between two perceptual hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,79 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createCheckerImage(width, height, cell int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 20, G: 20, B: 20, A: 255}
+			if (x/cell+y/cell)%2 == 0 {
+				c = color.RGBA{R: 230, G: 230, B: 230, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestPerceptualHash_SameImageDifferentEncoding(t *testing.T) {
+	jpegHash, err := PerceptualHash(createTestImage(400, 300, FormatJPEG))
+	require.NoError(t, err)
+
+	pngHash, err := PerceptualHash(createTestImage(400, 300, FormatPNG))
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, HammingDistance(jpegHash, pngHash), 4)
+}
+
+func TestPerceptualHash_ResizedImage(t *testing.T) {
+	data := createCheckerImage(360, 320, 45)
+	original, err := PerceptualHash(data)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, imaging.Resize(img, 120, 0, imaging.Lanczos)))
+
+	resized, err := PerceptualHash(buf.Bytes())
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, HammingDistance(original, resized), 8)
+}
+
+func TestPerceptualHash_DifferentImages(t *testing.T) {
+	gradient, err := PerceptualHash(createTestImage(400, 300, FormatPNG))
+	require.NoError(t, err)
+
+	checker, err := PerceptualHash(createCheckerImage(400, 300, 50))
+	require.NoError(t, err)
+
+	assert.Greater(t, HammingDistance(gradient, checker), 10)
+}
+
+func TestPerceptualHash_InvalidData(t *testing.T) {
+	_, err := PerceptualHash([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+func TestHammingDistance(t *testing.T) {
+	assert.Equal(t, 0, HammingDistance(0xFF, 0xFF))
+	assert.Equal(t, 8, HammingDistance(0xFF, 0x00))
+	assert.Equal(t, 64, HammingDistance(0, ^uint64(0)))
+}
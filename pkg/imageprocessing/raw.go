@@ -0,0 +1,51 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+)
+
+// ErrNoPreview is returned when a camera RAW file has no embedded JPEG preview
+var ErrNoPreview = errors.New("no embedded JPEG preview")
+
+// jpegStart is the start of image marker followed by the first marker prefix
+var jpegStart = []byte{0xFF, 0xD8, 0xFF}
+
+// EmbeddedPreview returns the largest JPEG preview embedded in a camera RAW file, re-encoded as
+// a standalone JPEG. RAW formats store sensor data that cannot be decoded here next to one or more
+// baseline JPEG previews; lossless JPEG sensor data is skipped because it does not decode.
+func EmbeddedPreview(data []byte) ([]byte, error) {
+	bestOffset, bestArea := -1, 0
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], jpegStart)
+		if i < 0 {
+			break
+		}
+		start := offset + i
+		offset = start + len(jpegStart)
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data[start:]))
+		if err != nil {
+			continue
+		}
+		if area := cfg.Width * cfg.Height; area > bestArea {
+			bestOffset, bestArea = start, area
+		}
+	}
+	if bestOffset < 0 {
+		return nil, ErrNoPreview
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data[bestOffset:]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode embedded preview: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode embedded preview: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,33 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedPreview(t *testing.T) {
+	// A RAW file stores a thumbnail and a larger preview between undecodable sensor data
+	var raw bytes.Buffer
+	raw.WriteString("II*\x00fake raw header")
+	raw.Write(createTestImage(160, 120, FormatJPEG))
+	raw.Write([]byte{0xFF, 0xD8, 0xFF, 0xC3, 0x00, 0x01, 0x02}) // lossless JPEG sensor data
+	raw.Write(createTestImage(640, 480, FormatJPEG))
+	raw.WriteString("trailing sensor data")
+
+	preview, err := EmbeddedPreview(raw.Bytes())
+	require.NoError(t, err)
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+	require.NoError(t, err)
+	assert.Equal(t, 640, cfg.Width)
+	assert.Equal(t, 480, cfg.Height)
+}
+
+func TestEmbeddedPreview_NoPreview(t *testing.T) {
+	_, err := EmbeddedPreview([]byte("II*\x00sensor data only"))
+	assert.ErrorIs(t, err, ErrNoPreview)
+}
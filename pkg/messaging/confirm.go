@@ -0,0 +1,174 @@
+package messaging
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// publishConfirmTimeout is how long a publish waits for the broker to confirm it
+const publishConfirmTimeout = 5 * time.Second
+
+// Defaults for PublishWithRetry used by the upload paths
+const (
+	DefaultPublishAttempts   = 3
+	DefaultPublishRetryDelay = 500 * time.Millisecond
+)
+
+// Publish errors. ErrUnroutable is permanent: the queue does not exist.
+var (
+	ErrPublishTimeout = errors.New("rabbitmq: publish not confirmed in time")
+	ErrPublishNacked  = errors.New("rabbitmq: publish rejected by broker")
+	ErrUnroutable     = errors.New("rabbitmq: message could not be routed to a queue")
+)
+
+// confirmer matches publisher confirms and returned messages to the publish waiting for them.
+// Publishes are serialized by the client, so a basic.return always belongs to the next confirm.
+type confirmer struct {
+	mu       sync.Mutex
+	nextTag  uint64
+	pending  map[uint64]chan error
+	returned bool
+	closed   bool
+}
+
+// newConfirmer puts channel into confirm mode and starts dispatching its confirms
+func newConfirmer(channel *amqp.Channel) (*confirmer, error) {
+	if err := channel.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	cf := &confirmer{nextTag: 1, pending: make(map[uint64]chan error)}
+	// Unbuffered, so the return is received before the confirm that follows it
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation))
+	returns := channel.NotifyReturn(make(chan amqp.Return))
+	go cf.dispatch(confirms, returns)
+
+	return cf, nil
+}
+
+// dispatch delivers confirms to waiting publishes until the channel closes
+func (cf *confirmer) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case _, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			cf.mu.Lock()
+			cf.returned = true
+			cf.mu.Unlock()
+		case confirm, ok := <-confirms:
+			if !ok {
+				cf.close()
+				return
+			}
+			cf.resolve(confirm)
+		}
+	}
+}
+
+// expect registers the next publish and returns the channel its result is sent to
+func (cf *confirmer) expect() (uint64, <-chan error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	tag := cf.nextTag
+	cf.nextTag++
+	result := make(chan error, 1)
+	if cf.closed {
+		result <- ErrNotConnected
+		return tag, result
+	}
+	cf.pending[tag] = result
+	return tag, result
+}
+
+// unpublish reverts expect for a publish that was never sent
+func (cf *confirmer) unpublish(tag uint64) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	delete(cf.pending, tag)
+	cf.nextTag = tag
+}
+
+// forget stops waiting for a publish that timed out; its late confirm is ignored
+func (cf *confirmer) forget(tag uint64) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	delete(cf.pending, tag)
+}
+
+// resolve reports a confirm to the publish waiting for it
+func (cf *confirmer) resolve(confirm amqp.Confirmation) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	var err error
+	switch {
+	case !confirm.Ack:
+		err = ErrPublishNacked
+	case cf.returned:
+		err = ErrUnroutable
+	}
+	cf.returned = false
+
+	if result, ok := cf.pending[confirm.DeliveryTag]; ok {
+		result <- err
+		delete(cf.pending, confirm.DeliveryTag)
+	}
+}
+
+// close fails all waiting publishes once the channel is gone
+func (cf *confirmer) close() {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	cf.closed = true
+	for tag, result := range cf.pending {
+		result <- ErrNotConnected
+		delete(cf.pending, tag)
+	}
+}
+
+// Retryable reports whether a publish error is transient, so the publish may be retried
+func Retryable(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, ErrPublishTimeout) ||
+		errors.Is(err, ErrPublishNacked) || errors.Is(err, amqp.ErrClosed)
+}
+
+// ErrorReason returns a short reason for a publish error, for metric tags
+func ErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrUnroutable):
+		return "unroutable"
+	case errors.Is(err, ErrPublishTimeout):
+		return "confirm_timeout"
+	case errors.Is(err, ErrPublishNacked):
+		return "nacked"
+	case errors.Is(err, ErrNotConnected), errors.Is(err, amqp.ErrClosed):
+		return "not_connected"
+	default:
+		return "publish_failed"
+	}
+}
+
+// PublishWithRetry calls publish up to attempts times while it fails with a retryable error,
+// doubling delay after each failure
+func PublishWithRetry(attempts int, delay time.Duration, publish func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = publish(); err == nil || !Retryable(err) {
+			return err
+		}
+		if attempt < attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
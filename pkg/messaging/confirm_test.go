@@ -0,0 +1,120 @@
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfirmer() (*confirmer, chan amqp.Confirmation, chan amqp.Return) {
+	cf := &confirmer{nextTag: 1, pending: make(map[uint64]chan error)}
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+	go cf.dispatch(confirms, returns)
+	return cf, confirms, returns
+}
+
+func receive(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no publish result")
+		return nil
+	}
+}
+
+func TestConfirmer_AckNackAndReturn(t *testing.T) {
+	cf, confirms, returns := newTestConfirmer()
+
+	tag, result := cf.expect()
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+	assert.NoError(t, receive(t, result))
+
+	tag, result = cf.expect()
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: false}
+	assert.ErrorIs(t, receive(t, result), ErrPublishNacked)
+
+	tag, result = cf.expect()
+	returns <- amqp.Return{RoutingKey: "missing"}
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+	assert.ErrorIs(t, receive(t, result), ErrUnroutable)
+
+	tag, result = cf.expect()
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+	assert.NoError(t, receive(t, result), "a return only affects the next confirm")
+}
+
+func TestConfirmer_LateConfirmAfterTimeout(t *testing.T) {
+	cf, confirms, _ := newTestConfirmer()
+
+	late, _ := cf.expect()
+	cf.forget(late)
+
+	tag, result := cf.expect()
+	confirms <- amqp.Confirmation{DeliveryTag: late, Ack: true}
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: false}
+	assert.ErrorIs(t, receive(t, result), ErrPublishNacked)
+}
+
+func TestConfirmer_UnpublishReusesTag(t *testing.T) {
+	cf, _, _ := newTestConfirmer()
+
+	tag, _ := cf.expect()
+	cf.unpublish(tag)
+	next, _ := cf.expect()
+	assert.Equal(t, tag, next)
+}
+
+func TestConfirmer_ChannelClosed(t *testing.T) {
+	cf, confirms, _ := newTestConfirmer()
+
+	_, result := cf.expect()
+	close(confirms)
+	assert.ErrorIs(t, receive(t, result), ErrNotConnected)
+
+	_, result = cf.expect()
+	assert.ErrorIs(t, receive(t, result), ErrNotConnected)
+}
+
+func TestPublishWithRetry(t *testing.T) {
+	calls := 0
+	err := PublishWithRetry(3, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("publish: %w", ErrPublishTimeout)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = PublishWithRetry(3, time.Millisecond, func() error {
+		calls++
+		return ErrUnroutable
+	})
+	assert.ErrorIs(t, err, ErrUnroutable)
+	assert.Equal(t, 1, calls, "unroutable messages are not retried")
+
+	calls = 0
+	err = PublishWithRetry(2, time.Millisecond, func() error {
+		calls++
+		return ErrNotConnected
+	})
+	assert.ErrorIs(t, err, ErrNotConnected)
+	assert.Equal(t, 2, calls)
+}
+
+func TestErrorReason(t *testing.T) {
+	assert.Equal(t, "unroutable", ErrorReason(fmt.Errorf("x: %w", ErrUnroutable)))
+	assert.Equal(t, "confirm_timeout", ErrorReason(ErrPublishTimeout))
+	assert.Equal(t, "not_connected", ErrorReason(amqp.ErrClosed))
+	assert.Equal(t, "publish_failed", ErrorReason(errors.New("boom")))
+}
@@ -1,22 +1,34 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
+
+	"github.com/shabohin/photo-tags/pkg/priority"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 // RabbitMQInterface defines the interface for RabbitMQ operations
 type RabbitMQInterface interface {
 	DeclareQueue(name string) (interface{}, error)
 	DeclareQueueWithDLQ(name string, dlqName string) (interface{}, error)
+	DeclareLanes(name string) error
 	PublishMessage(queueName string, message interface{}) error
-	PublishMessageWithHeaders(queueName string, message interface{}, headers map[string]interface{}) error
+	PublishMessageWithHeaders(ctx context.Context, queueName string, message interface{}, headers map[string]interface{}) error
 	ConsumeMessages(queueName string, handler func([]byte) error) error
+	ConsumeMessagesWithContext(queueName string, handler func(context.Context, []byte) error) error
 	ConsumeMessagesChannel(queueName string) (<-chan []byte, error)
 	GetMessages(queueName string, maxMessages int) ([]amqp.Delivery, error)
 	RequeueMessage(queueName string, message []byte) error
+	State() ConnectionState
 	Close()
 }
 
@@ -29,37 +41,282 @@ const (
 	QueueDeadLetter        = "dead_letter_queue"
 )
 
-// RabbitMQClient handles messaging with RabbitMQ
+// Reconnect backoff limits; the delay doubles after every failed attempt
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// ErrNotConnected is returned while the connection to RabbitMQ is down.
+// Publishes are not buffered, so callers can report the failure immediately.
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+// ConnectionState describes the RabbitMQ connection for health endpoints
+type ConnectionState struct {
+	Connected  bool      `json:"connected"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"last_error,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+// queueDeclaration is a declared queue, declared again after a reconnect
+type queueDeclaration struct {
+	name string
+	args amqp.Table
+}
+
+// consumer is a registered consumer, registered again after a reconnect
+type consumer struct {
+	queueName string
+	autoAck   bool
+	deliver   func(msgs <-chan amqp.Delivery)
+	// out is closed by Close once all deliver goroutines have stopped; nil for handler consumers
+	out chan []byte
+	wg  sync.WaitGroup
+}
+
+// RabbitMQClient handles messaging with RabbitMQ.
+// It watches the connection and reconnects with exponential backoff, declaring the
+// queues and registering the consumers again, so consumers survive a broker restart.
 type RabbitMQClient struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	url  string
+	done chan struct{}
+
+	// publishMu serializes publishes so returns and confirms can be matched to them
+	publishMu sync.Mutex
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	confirms  *confirmer
+	queues    []queueDeclaration
+	consumers []*consumer
+	state     ConnectionState
+	closed    bool
 }
 
 // NewRabbitMQClient creates a new RabbitMQ client
 func NewRabbitMQClient(url string) (*RabbitMQClient, error) {
-	// Connect to RabbitMQ
-	conn, err := amqp.Dial(url)
+	c := &RabbitMQClient{
+		url:  url,
+		done: make(chan struct{}),
+	}
+
+	conn, channel, confirms, err := c.dial()
 	if err != nil {
 		return nil, err
 	}
 
+	c.conn = conn
+	c.channel = channel
+	c.confirms = confirms
+	c.state = ConnectionState{Connected: true, Since: time.Now()}
+
+	go c.supervise(conn, channel)
+
+	return c, nil
+}
+
+// dial opens a connection and a channel in confirm mode
+func (c *RabbitMQClient) dial() (*amqp.Connection, *amqp.Channel, *confirmer, error) {
+	// Connect to RabbitMQ
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Create a channel
 	channel, err := conn.Channel()
-	if err != nil {
-		if closeErr := conn.Close(); closeErr != nil {
-			log.Printf("Error closing connection: %v", closeErr)
+	if err == nil {
+		var confirms *confirmer
+		if confirms, err = newConfirmer(channel); err == nil {
+			return conn, channel, confirms, nil
 		}
-		return nil, err
 	}
 
-	return &RabbitMQClient{
-		conn:    conn,
-		channel: channel,
-	}, nil
+	if closeErr := conn.Close(); closeErr != nil {
+		log.Printf("Error closing connection: %v", closeErr)
+	}
+	return nil, nil, nil, err
+}
+
+// supervise waits for the connection or channel to close and reconnects until Close is called
+func (c *RabbitMQClient) supervise(conn *amqp.Connection, channel *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-c.done:
+			return
+		case reason = <-connClosed:
+		case reason = <-channelClosed:
+			// A channel error leaves the connection open; close it to recover both
+			if err := conn.Close(); err != nil && err != amqp.ErrClosed {
+				log.Printf("Error closing connection: %v", err)
+			}
+		}
+
+		if c.isClosed() {
+			return
+		}
+		c.setDisconnected(reason)
+		log.Printf("RabbitMQ connection lost: %v, reconnecting", reason)
+
+		conn, channel = c.reconnect()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials with exponential backoff until it succeeds or the client is closed.
+// It returns nil if the client was closed.
+func (c *RabbitMQClient) reconnect() (*amqp.Connection, *amqp.Channel) {
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.done:
+			return nil, nil
+		case <-time.After(delay):
+		}
+
+		conn, channel, confirms, err := c.dial()
+		if err == nil {
+			if err = c.restore(channel); err != nil {
+				if closeErr := conn.Close(); closeErr != nil {
+					log.Printf("Error closing connection: %v", closeErr)
+				}
+			}
+		}
+		if err != nil {
+			c.setLastError(err)
+			log.Printf("Failed to reconnect to RabbitMQ (attempt %d): %v", attempt, err)
+			delay = nextDelay(delay)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			if closeErr := conn.Close(); closeErr != nil {
+				log.Printf("Error closing connection: %v", closeErr)
+			}
+			return nil, nil
+		}
+		c.conn = conn
+		c.channel = channel
+		c.confirms = confirms
+		c.state = ConnectionState{Connected: true, Reconnects: c.state.Reconnects + 1, Since: time.Now()}
+		c.mu.Unlock()
+
+		log.Printf("Reconnected to RabbitMQ after %d attempts", attempt)
+		return conn, channel
+	}
+}
+
+// restore declares the known queues and registers the consumers on a new channel
+func (c *RabbitMQClient) restore(channel *amqp.Channel) error {
+	c.mu.RLock()
+	queues := append([]queueDeclaration(nil), c.queues...)
+	c.mu.RUnlock()
+
+	for _, queue := range queues {
+		if _, err := declare(channel, queue); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.name, err)
+		}
+	}
+
+	// Hold the lock so addConsumer cannot register a consumer half way through
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cons := range c.consumers {
+		if err := c.startConsumer(channel, cons); err != nil {
+			return fmt.Errorf("failed to consume from %s: %w", cons.queueName, err)
+		}
+	}
+	return nil
+}
+
+// nextDelay doubles the reconnect delay up to reconnectMaxDelay
+func nextDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > reconnectMaxDelay {
+		return reconnectMaxDelay
+	}
+	return delay
+}
+
+// setDisconnected records a lost connection
+func (c *RabbitMQClient) setDisconnected(reason *amqp.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = nil
+	c.channel = nil
+	c.confirms = nil
+	c.state.Connected = false
+	c.state.Since = time.Now()
+	if reason != nil {
+		c.state.LastError = reason.Error()
+	}
+}
+
+// setLastError records the error of a failed reconnect attempt
+func (c *RabbitMQClient) setLastError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.LastError = err.Error()
+}
+
+// isClosed reports whether Close was called
+func (c *RabbitMQClient) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
+
+// currentChannel returns the open channel or ErrNotConnected
+func (c *RabbitMQClient) currentChannel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.state.Connected || c.channel == nil {
+		return nil, ErrNotConnected
+	}
+	return c.channel, nil
+}
+
+// currentPublisher returns the open channel and its confirmer or ErrNotConnected
+func (c *RabbitMQClient) currentPublisher() (*amqp.Channel, *confirmer, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.state.Connected || c.channel == nil || c.confirms == nil {
+		return nil, nil, ErrNotConnected
+	}
+	return c.channel, c.confirms, nil
+}
+
+// State returns the current connection state
+func (c *RabbitMQClient) State() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
 }
 
-// Close closes the connection and channel
+// Close stops reconnecting and closes the connection and channel.
+// Channels returned by ConsumeMessagesChannel are closed once their consumers stop.
 func (c *RabbitMQClient) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.done)
+
 	if c.channel != nil {
 		if err := c.channel.Close(); err != nil {
 			log.Printf("Error closing channel: %v", err)
@@ -70,46 +327,89 @@ func (c *RabbitMQClient) Close() {
 			log.Printf("Error closing connection: %v", err)
 		}
 	}
+	c.state.Connected = false
+	consumers := c.consumers
+	c.mu.Unlock()
+
+	for _, cons := range consumers {
+		if cons.out != nil {
+			go func(cons *consumer) {
+				cons.wg.Wait()
+				close(cons.out)
+			}(cons)
+		}
+	}
 }
 
 // DeclareQueue declares a queue with the given name
 func (c *RabbitMQClient) DeclareQueue(name string) (interface{}, error) {
-	return c.channel.QueueDeclare(
-		name,  // queue name
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
+	return c.declareQueue(queueDeclaration{name: name})
 }
 
 // DeclareQueueWithDLQ declares a queue with dead letter queue support
 func (c *RabbitMQClient) DeclareQueueWithDLQ(name string, dlqName string) (interface{}, error) {
 	// First, declare the dead letter queue
-	_, err := c.channel.QueueDeclare(
-		dlqName, // queue name
-		true,    // durable
-		false,   // delete when unused
-		false,   // exclusive
-		false,   // no-wait
-		nil,     // arguments
-	)
-	if err != nil {
+	if _, err := c.declareQueue(queueDeclaration{name: dlqName}); err != nil {
 		return nil, err
 	}
 
 	// Then declare the main queue with DLQ configuration
-	return c.channel.QueueDeclare(
-		name,  // queue name
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		amqp.Table{
+	return c.declareQueue(queueDeclaration{
+		name: name,
+		args: amqp.Table{
 			"x-dead-letter-exchange":    "",
 			"x-dead-letter-routing-key": dlqName,
 		},
+	})
+}
+
+// DeclareLanes declares the interactive and bulk lanes of a queue, see package priority.
+// Both lanes dead-letter to QueueDeadLetter, matching the consumers' declarations.
+func (c *RabbitMQClient) DeclareLanes(name string) error {
+	if _, err := c.DeclareQueueWithDLQ(priority.QueueName(name, priority.LaneInteractive), QueueDeadLetter); err != nil {
+		return err
+	}
+
+	bulk := priority.QueueName(name, priority.LaneBulk)
+	if _, err := c.declareQueue(queueDeclaration{name: bulk, args: amqp.Table(priority.BulkQueueArgs(QueueDeadLetter))}); err != nil {
+		return fmt.Errorf("failed to declare bulk queue %s: %w", bulk, err)
+	}
+	return nil
+}
+
+// declareQueue declares a queue and remembers it for reconnects
+func (c *RabbitMQClient) declareQueue(queue queueDeclaration) (interface{}, error) {
+	channel, err := c.currentChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	declared, err := declare(channel, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.queues {
+		if c.queues[i].name == queue.name {
+			c.queues[i] = queue
+			return declared, nil
+		}
+	}
+	c.queues = append(c.queues, queue)
+	return declared, nil
+}
+
+// declare declares a durable queue on channel
+func declare(channel *amqp.Channel, queue queueDeclaration) (amqp.Queue, error) {
+	return channel.QueueDeclare(
+		queue.name, // queue name
+		true,       // durable
+		false,      // delete when unused
+		false,      // exclusive
+		false,      // no-wait
+		queue.args, // arguments
 	)
 }
 
@@ -121,21 +421,21 @@ func (c *RabbitMQClient) PublishMessage(queueName string, message interface{}) e
 		return err
 	}
 
-	// Publish message
-	return c.channel.Publish(
-		"",        // exchange
-		queueName, // routing key
-		false,     // mandatory
-		false,     // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return c.publish(queueName, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
 }
 
-// PublishMessageWithHeaders publishes a message with custom headers to the given queue
-func (c *RabbitMQClient) PublishMessageWithHeaders(queueName string, message interface{}, headers map[string]interface{}) error {
+// PublishMessageWithHeaders publishes a message with custom headers to the given queue.
+// The trace context of ctx is added to the headers, so consumers continue the trace.
+// The source header sets the message priority, see package priority.
+func (c *RabbitMQClient) PublishMessageWithHeaders(
+	ctx context.Context,
+	queueName string,
+	message interface{},
+	headers map[string]interface{},
+) error {
 	// Marshal message to JSON
 	body, err := json.Marshal(message)
 	if err != nil {
@@ -147,97 +447,222 @@ func (c *RabbitMQClient) PublishMessageWithHeaders(queueName string, message int
 	for k, v := range headers {
 		amqpHeaders[k] = v
 	}
+	tracing.Inject(ctx, amqpHeaders)
+
+	return c.publish(queueName, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+		Headers:     amqpHeaders,
+		Priority:    priority.Priority(priority.Source(amqpHeaders)),
+	})
+}
+
+// publish sends a persistent message to the default exchange and waits for the broker to confirm it.
+// It fails fast while disconnected and returns ErrUnroutable if no queue received the message.
+func (c *RabbitMQClient) publish(queueName string, msg amqp.Publishing) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	channel, confirms, err := c.currentPublisher()
+	if err != nil {
+		return err
+	}
 
-	// Publish message
-	return c.channel.Publish(
+	msg.DeliveryMode = amqp.Persistent
+	tag, result := confirms.expect()
+	err = channel.Publish(
 		"",        // exchange
 		queueName, // routing key
-		false,     // mandatory
+		true,      // mandatory
 		false,     // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-			Headers:     amqpHeaders,
-		},
+		msg,
 	)
+	if err != nil {
+		confirms.unpublish(tag)
+		return err
+	}
+
+	timer := time.NewTimer(publishConfirmTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", queueName, err)
+		}
+		return nil
+	case <-timer.C:
+		confirms.forget(tag)
+		return fmt.Errorf("failed to publish to %s: %w", queueName, ErrPublishTimeout)
+	}
 }
 
-// ConsumeMessages consumes messages from the given queue
+// ConsumeMessages consumes messages from the given queue.
+// The handler keeps receiving messages after a reconnect. Messages the handler fails are
+// retried through the retry queues of queueName and then moved to the dead letter queue.
 func (c *RabbitMQClient) ConsumeMessages(queueName string, handler func([]byte) error) error {
-	// Get messages from queue
-	msgs, err := c.channel.Consume(
-		queueName, // queue
-		"",        // consumer
-		false,     // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
-	if err != nil {
+	return c.ConsumeMessagesWithContext(queueName, func(_ context.Context, body []byte) error {
+		return handler(body)
+	})
+}
+
+// ConsumeMessagesWithContext consumes messages like ConsumeMessages and passes the handler a
+// context carrying a consume span, child of the trace context in the message headers
+func (c *RabbitMQClient) ConsumeMessagesWithContext(queueName string, handler func(context.Context, []byte) error) error {
+	if err := c.declareRetryQueues(queueName); err != nil {
 		return err
 	}
 
-	// Process messages
-	go func() {
-		for msg := range msgs {
-			log.Printf("Received message from queue: %s", queueName)
-
-			// Process message
-			err := handler(msg.Body)
-			if err != nil {
-				log.Printf("Error processing message: %v", err)
-				if nackErr := msg.Nack(false, true); nackErr != nil {
-					log.Printf("Error sending NACK: %v", nackErr)
-				}
-			} else {
-				if ackErr := msg.Ack(false); ackErr != nil {
-					log.Printf("Error sending ACK: %v", ackErr)
+	return c.addConsumer(&consumer{
+		queueName: queueName,
+		deliver: func(msgs <-chan amqp.Delivery) {
+			for msg := range msgs {
+				log.Printf("Received message from queue: %s", queueName)
+
+				// Process message in the trace of its producer
+				ctx := tracing.Extract(context.Background(), msg.Headers)
+				span, ctx := tracing.StartSpan(ctx, "rabbitmq.consume")
+				span.SetTag("queue", queueName)
+				err := handler(ctx, msg.Body)
+				span.Finish(err)
+				if err != nil {
+					log.Printf("Error processing message: %v", err)
+					c.retry(queueName, msg, err)
+				} else {
+					if ackErr := msg.Ack(false); ackErr != nil {
+						log.Printf("Error sending ACK: %v", ackErr)
+					}
 				}
 			}
-		}
-	}()
+		},
+	})
+}
 
+// declareRetryQueues declares the dead letter queue and the retry queues of queueName
+func (c *RabbitMQClient) declareRetryQueues(queueName string) error {
+	if _, err := c.declareQueue(queueDeclaration{name: QueueDeadLetter}); err != nil {
+		return err
+	}
+	for _, queue := range retryqueue.Queues(queueName) {
+		if _, err := c.declareQueue(queueDeclaration{name: queue.Name, args: amqp.Table(queue.Args)}); err != nil {
+			return fmt.Errorf("failed to declare retry queue %s: %w", queue.Name, err)
+		}
+	}
 	return nil
 }
 
-// ConsumeMessagesChannel consumes messages from the given queue and returns a channel
-func (c *RabbitMQClient) ConsumeMessagesChannel(queueName string) (<-chan []byte, error) {
-	// Get messages from queue
-	msgs, err := c.channel.Consume(
-		queueName, // queue
-		"",        // consumer
-		true,      // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
+// retry publishes a failed message to its next retry queue, or the dead letter queue after
+// the last tier, and acks it. If that publish fails the message is dead-lettered by the broker.
+func (c *RabbitMQClient) retry(queueName string, msg amqp.Delivery, failure error) {
+	target, headers := retryqueue.Route(queueName, msg.Headers, failure, time.Now())
+
+	err := c.publish(target, amqp.Publishing{
+		ContentType:   msg.ContentType,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Priority:      msg.Priority,
+		Headers:       amqp.Table(headers),
+		Body:          msg.Body,
+	})
 	if err != nil {
-		return nil, err
+		log.Printf("Error moving message to %s, sending to DLQ: %v", target, err)
+		// Nack with requeue=false to send message to dead letter queue
+		if nackErr := msg.Nack(false, false); nackErr != nil {
+			log.Printf("Error sending NACK: %v", nackErr)
+		}
+		return
+	}
+
+	log.Printf("Moved failed message from %s to %s", queueName, target)
+	if ackErr := msg.Ack(false); ackErr != nil {
+		log.Printf("Error sending ACK: %v", ackErr)
 	}
+}
 
+// ConsumeMessagesChannel consumes messages from the given queue and returns a channel.
+// The channel stays open across reconnects and is closed by Close.
+func (c *RabbitMQClient) ConsumeMessagesChannel(queueName string) (<-chan []byte, error) {
 	// Create output channel
 	out := make(chan []byte)
 
-	// Forward messages to output channel
-	go func() {
-		defer close(out)
-		for msg := range msgs {
-			log.Printf("Received message from queue: %s", queueName)
-			out <- msg.Body
-		}
-	}()
+	err := c.addConsumer(&consumer{
+		queueName: queueName,
+		autoAck:   true,
+		out:       out,
+		deliver: func(msgs <-chan amqp.Delivery) {
+			// Forward messages to output channel
+			for msg := range msgs {
+				log.Printf("Received message from queue: %s", queueName)
+				select {
+				case out <- msg.Body:
+				case <-c.done:
+					return
+				}
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return out, nil
 }
 
+// addConsumer registers a consumer on the current channel and remembers it for reconnects.
+// It starts the consumer under c.mu, so a consumer is tracked if and only if it was started.
+func (c *RabbitMQClient) addConsumer(cons *consumer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.state.Connected || c.channel == nil {
+		return ErrNotConnected
+	}
+	if err := c.startConsumer(c.channel, cons); err != nil {
+		return err
+	}
+	c.consumers = append(c.consumers, cons)
+	return nil
+}
+
+// startConsumer starts delivering messages from channel to cons. The caller holds c.mu.
+func (c *RabbitMQClient) startConsumer(channel *amqp.Channel, cons *consumer) error {
+	// Close waits for the deliver goroutines before closing cons.out
+	if c.closed {
+		return ErrNotConnected
+	}
+
+	msgs, err := channel.Consume(
+		cons.queueName, // queue
+		"",             // consumer
+		cons.autoAck,   // auto-ack
+		false,          // exclusive
+		false,          // no-local
+		false,          // no-wait
+		nil,            // args
+	)
+	if err != nil {
+		return err
+	}
+
+	cons.wg.Add(1)
+	go func() {
+		defer cons.wg.Done()
+		cons.deliver(msgs)
+	}()
+	return nil
+}
+
 // GetMessages retrieves messages from a queue without consuming them permanently
 func (c *RabbitMQClient) GetMessages(queueName string, maxMessages int) ([]amqp.Delivery, error) {
+	channel, err := c.currentChannel()
+	if err != nil {
+		return nil, err
+	}
+
 	messages := make([]amqp.Delivery, 0, maxMessages)
 
 	for i := 0; i < maxMessages; i++ {
-		msg, ok, err := c.channel.Get(queueName, false)
+		msg, ok, err := channel.Get(queueName, false)
 		if err != nil {
 			return nil, err
 		}
@@ -253,14 +678,8 @@ func (c *RabbitMQClient) GetMessages(queueName string, maxMessages int) ([]amqp.
 
 // RequeueMessage publishes a message back to the original queue
 func (c *RabbitMQClient) RequeueMessage(queueName string, message []byte) error {
-	return c.channel.Publish(
-		"",        // exchange
-		queueName, // routing key
-		false,     // mandatory
-		false,     // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-		},
-	)
+	return c.publish(queueName, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        message,
+	})
 }
@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextDelay(t *testing.T) {
+	assert.Equal(t, 2*time.Second, nextDelay(reconnectMinDelay))
+	assert.Equal(t, 16*time.Second, nextDelay(8*time.Second))
+	assert.Equal(t, reconnectMaxDelay, nextDelay(20*time.Second))
+	assert.Equal(t, reconnectMaxDelay, nextDelay(reconnectMaxDelay))
+}
+
+func TestDisconnectedClientFailsFast(t *testing.T) {
+	c := &RabbitMQClient{done: make(chan struct{})}
+
+	assert.False(t, c.State().Connected)
+	assert.ErrorIs(t, c.PublishMessage(QueueImageUpload, map[string]string{"trace_id": "t1"}), ErrNotConnected)
+	assert.ErrorIs(t, c.RequeueMessage(QueueImageUpload, []byte("{}")), ErrNotConnected)
+
+	_, err := c.DeclareQueue(QueueImageUpload)
+	assert.ErrorIs(t, err, ErrNotConnected)
+	assert.Empty(t, c.queues, "failed declarations are not restored after a reconnect")
+
+	_, err = c.ConsumeMessagesChannel(QueueImageProcessed)
+	assert.ErrorIs(t, err, ErrNotConnected)
+	assert.Empty(t, c.consumers)
+}
+
+func TestCloseClosesConsumerChannels(t *testing.T) {
+	c := &RabbitMQClient{done: make(chan struct{})}
+	out := make(chan []byte)
+	c.consumers = []*consumer{{queueName: QueueImageProcessed, out: out}}
+
+	c.Close()
+	c.Close()
+
+	select {
+	case _, ok := <-out:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("consumer channel was not closed")
+	}
+}
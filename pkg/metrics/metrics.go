@@ -0,0 +1,220 @@
+// Package metrics records service metrics through a pluggable backend.
+//
+// Services record metrics through Metrics, which forwards every sample to the installed
+// Backend: DogStatsD for Datadog, a Prometheus /metrics endpoint, or an OTLP exporter for
+// OpenTelemetry collectors. Until a backend is installed samples are discarded, so metrics
+// can be recorded unconditionally.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Backend names
+const (
+	BackendDatadog    = "datadog"
+	BackendPrometheus = "prometheus"
+	BackendOTLP       = "otlp"
+	BackendNone       = "none"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "photo_tags"
+
+// Defaults used by ConfigFromEnv
+const (
+	DefaultOTLPEndpoint = "http://otel-collector:4318"
+	DefaultOTLPInterval = 15 * time.Second
+)
+
+// ErrUnknownBackend is returned for a backend name that is not supported
+var ErrUnknownBackend = errors.New("unknown metrics backend")
+
+// Backend receives metric samples. Tags are "key:value" pairs.
+type Backend interface {
+	// Count adds value to a counter
+	Count(name string, value int64, tags []string)
+	// Gauge sets a gauge value
+	Gauge(name string, value float64, tags []string)
+	// Histogram records a value in a distribution
+	Histogram(name string, value float64, tags []string)
+	// Timing records a duration in milliseconds
+	Timing(name string, value int64, tags []string)
+	// Close flushes pending samples and releases the backend
+	Close() error
+}
+
+var (
+	mu     sync.RWMutex
+	global Backend = Noop{}
+)
+
+// SetBackend installs the backend used by Metrics
+func SetBackend(backend Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+	global = backend
+}
+
+func current() Backend {
+	mu.RLock()
+	defer mu.RUnlock()
+	return global
+}
+
+// Config selects and configures a backend
+type Config struct {
+	Backend string
+	Service string
+	Version string
+	Env     string
+	// StatsDAddr is the address of the DogStatsD agent
+	StatsDAddr string
+	// OTLPEndpoint is the base URL of the OTLP/HTTP collector
+	OTLPEndpoint string
+	// OTLPInterval is the time between two OTLP exports
+	OTLPInterval time.Duration
+}
+
+// ConfigFromEnv reads the backend configuration from the environment.
+// METRICS_BACKEND selects the backend; by default Datadog is used when DD_API_KEY is set and
+// Prometheus otherwise.
+func ConfigFromEnv(service, version string) Config {
+	cfg := Config{
+		Backend:      os.Getenv("METRICS_BACKEND"),
+		Service:      service,
+		Version:      version,
+		Env:          getEnv("DD_ENV", "development"),
+		StatsDAddr:   getEnv("DD_AGENT_HOST", "datadog") + ":8125",
+		OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", DefaultOTLPEndpoint),
+		OTLPInterval: DefaultOTLPInterval,
+	}
+
+	if cfg.Backend == "" {
+		cfg.Backend = BackendPrometheus
+		if os.Getenv("DD_API_KEY") != "" {
+			cfg.Backend = BackendDatadog
+		}
+	}
+	if interval, err := time.ParseDuration(os.Getenv("METRICS_EXPORT_INTERVAL")); err == nil && interval > 0 {
+		cfg.OTLPInterval = interval
+	}
+
+	return cfg
+}
+
+// Init creates the backend selected by cfg and installs it
+func Init(cfg Config) (Backend, error) {
+	var constTags []string
+	for _, tag := range [][2]string{{"service", cfg.Service}, {"version", cfg.Version}, {"env", cfg.Env}} {
+		if tag[1] != "" {
+			constTags = append(constTags, tag[0]+":"+tag[1])
+		}
+	}
+
+	var backend Backend
+	switch cfg.Backend {
+	case BackendDatadog:
+		statsd, err := NewStatsD(cfg.StatsDAddr, constTags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize DogStatsD client: %w", err)
+		}
+		backend = statsd
+	case BackendPrometheus:
+		backend = NewPrometheus(constTags)
+	case BackendOTLP:
+		backend = NewOTLP(cfg.OTLPEndpoint, cfg.OTLPInterval, map[string]string{
+			"service.name":           cfg.Service,
+			"service.version":        cfg.Version,
+			"deployment.environment": cfg.Env,
+		})
+	case BackendNone:
+		backend = Noop{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, cfg.Backend)
+	}
+
+	SetBackend(backend)
+	return backend, nil
+}
+
+// Stop closes the installed backend and discards later samples
+func Stop() error {
+	mu.Lock()
+	backend := global
+	global = Noop{}
+	mu.Unlock()
+
+	return backend.Close()
+}
+
+// Handler serves the installed Prometheus backend; with another backend it responds 404
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prometheus, ok := current().(*Prometheus)
+		if !ok {
+			http.Error(w, "Prometheus metrics are not enabled", http.StatusNotFound)
+			return
+		}
+		prometheus.ServeHTTP(w, r)
+	})
+}
+
+// Metrics provides helper functions for sending metrics to the installed backend
+type Metrics struct{}
+
+// New creates a new Metrics instance
+func New() *Metrics {
+	return &Metrics{}
+}
+
+// Count increments a counter
+func (m *Metrics) Count(name string, value int64, tags []string) {
+	current().Count(name, value, tags)
+}
+
+// Gauge sets a gauge value
+func (m *Metrics) Gauge(name string, value float64, tags []string) {
+	current().Gauge(name, value, tags)
+}
+
+// Histogram sends a histogram value
+func (m *Metrics) Histogram(name string, value float64, tags []string) {
+	current().Histogram(name, value, tags)
+}
+
+// Timing sends a timing metric in milliseconds
+func (m *Metrics) Timing(name string, value int64, tags []string) {
+	current().Timing(name, value, tags)
+}
+
+// Incr increments a counter by 1
+func (m *Metrics) Incr(name string, tags []string) {
+	m.Count(name, 1, tags)
+}
+
+// Decr decrements a counter by 1
+func (m *Metrics) Decr(name string, tags []string) {
+	m.Count(name, -1, tags)
+}
+
+// Noop discards metrics
+type Noop struct{}
+
+func (Noop) Count(string, int64, []string)       {}
+func (Noop) Gauge(string, float64, []string)     {}
+func (Noop) Histogram(string, float64, []string) {}
+func (Noop) Timing(string, int64, []string)      {}
+func (Noop) Close() error                        { return nil }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
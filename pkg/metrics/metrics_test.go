@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheus_Write(t *testing.T) {
+	p := NewPrometheus([]string{"service:gateway"})
+	p.Count("image.uploaded", 1, []string{"source:telegram"})
+	p.Count("image.uploaded", 2, []string{"source:telegram"})
+	p.Gauge("metadata_cache.hit_rate", 0.5, nil)
+	p.Timing("image.upload.duration", 30, nil)
+	p.Timing("image.upload.duration", 2e8, nil)
+
+	var out bytes.Buffer
+	require.NoError(t, p.Write(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# TYPE photo_tags_image_uploaded_total counter\n")
+	assert.Contains(t, text, `photo_tags_image_uploaded_total{service="gateway",source="telegram"} 3`+"\n")
+	assert.Contains(t, text, "# TYPE photo_tags_metadata_cache_hit_rate gauge\n")
+	assert.Contains(t, text, `photo_tags_metadata_cache_hit_rate{service="gateway"} 0.5`+"\n")
+	assert.Contains(t, text, "# TYPE photo_tags_image_upload_duration_milliseconds histogram\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_bucket{service="gateway",le="25"} 0`+"\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_bucket{service="gateway",le="50"} 1`+"\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_bucket{service="gateway",le="1e+07"} 1`+"\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_bucket{service="gateway",le="+Inf"} 2`+"\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_sum{service="gateway"} 2.0000003e+08`+"\n")
+	assert.Contains(t, text, `photo_tags_image_upload_duration_milliseconds_count{service="gateway"} 2`+"\n")
+}
+
+func TestPrometheus_DecrementedCounterIsGauge(t *testing.T) {
+	p := NewPrometheus(nil)
+	p.Count("workers.active", 2, nil)
+	p.Count("workers.active", -1, nil)
+
+	var out bytes.Buffer
+	require.NoError(t, p.Write(&out))
+	assert.Equal(t, "# TYPE photo_tags_workers_active gauge\nphoto_tags_workers_active 1\n", out.String())
+}
+
+func TestParseTags(t *testing.T) {
+	labels := parseTags([]string{"status:ok", "model.name:a:b", "cached", "status:error", ":x"})
+
+	assert.Equal(t, []label{
+		{key: "cached", value: "true"},
+		{key: "model_name", value: "a:b"},
+		{key: "status", value: "error"},
+	}, labels)
+	assert.Equal(t, `{a="say \"hi\"\\n"}`, formatLabels([]label{{key: "a", value: `say "hi"\n`}}))
+}
+
+func TestStatsD_Send(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := NewStatsD(conn.LocalAddr().String(), []string{"service:analyzer"})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Count("consensus.requests", 1, []string{"mode:full"})
+	s.Timing("consensus.duration", 120, nil)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 512)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "photo_tags.consensus.requests:1|c|#service:analyzer,mode:full", string(buf[:n]))
+
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "photo_tags.consensus.duration:120|ms|#service:analyzer", string(buf[:n]))
+}
+
+func TestOTLP_Export(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req otlpRequest
+		require.NoError(t, json.Unmarshal(body, &req))
+		received <- req
+	}))
+	defer server.Close()
+
+	o := NewOTLP(server.URL, time.Hour, map[string]string{"service.name": "processor"})
+	o.Count("image.processing.success", 2, []string{"format:jpeg"})
+	o.Gauge("workers.active", 3, nil)
+	o.Timing("image.processing.duration", 40, nil)
+	require.NoError(t, o.Close())
+
+	req := <-received
+	require.Len(t, req.ResourceMetrics, 1)
+	assert.Equal(t, []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: "processor"}}},
+		req.ResourceMetrics[0].Resource.Attributes)
+
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 3)
+
+	assert.Equal(t, "photo_tags.image.processing.duration", metrics[0].Name)
+	assert.Equal(t, "ms", metrics[0].Unit)
+	require.NotNil(t, metrics[0].Histogram)
+	point := metrics[0].Histogram.DataPoints[0]
+	assert.Equal(t, "1", point.Count)
+	assert.Equal(t, 40.0, point.Sum)
+	assert.Equal(t, "1", point.BucketCounts[4])
+	assert.Len(t, point.BucketCounts, len(point.ExplicitBounds)+1)
+
+	assert.Equal(t, "photo_tags.image.processing.success", metrics[1].Name)
+	require.NotNil(t, metrics[1].Sum)
+	assert.True(t, metrics[1].Sum.IsMonotonic)
+	assert.Equal(t, otlpCumulative, metrics[1].Sum.AggregationTemporality)
+	assert.Equal(t, 2.0, metrics[1].Sum.DataPoints[0].AsDouble)
+	assert.Equal(t, []otlpKeyValue{{Key: "format", Value: otlpAnyValue{StringValue: "jpeg"}}},
+		metrics[1].Sum.DataPoints[0].Attributes)
+
+	assert.Equal(t, "photo_tags.workers.active", metrics[2].Name)
+	require.NotNil(t, metrics[2].Gauge)
+	assert.Equal(t, 3.0, metrics[2].Gauge.DataPoints[0].AsDouble)
+}
+
+func TestOTLP_ExportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	o := NewOTLP(server.URL+"/v1/metrics", time.Hour, nil)
+	o.Count("outbox.published", 1, nil)
+
+	err := o.Export(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Error(t, o.Close())
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("Prometheus without Datadog", func(t *testing.T) {
+		t.Setenv("METRICS_BACKEND", "")
+		t.Setenv("DD_API_KEY", "")
+
+		cfg := ConfigFromEnv("gateway", "v1.0.0")
+		assert.Equal(t, BackendPrometheus, cfg.Backend)
+		assert.Equal(t, "gateway", cfg.Service)
+		assert.Equal(t, DefaultOTLPInterval, cfg.OTLPInterval)
+	})
+
+	t.Run("Datadog with an API key", func(t *testing.T) {
+		t.Setenv("METRICS_BACKEND", "")
+		t.Setenv("DD_API_KEY", "key")
+		t.Setenv("DD_AGENT_HOST", "agent")
+
+		cfg := ConfigFromEnv("gateway", "v1.0.0")
+		assert.Equal(t, BackendDatadog, cfg.Backend)
+		assert.Equal(t, "agent:8125", cfg.StatsDAddr)
+	})
+
+	t.Run("Explicit backend", func(t *testing.T) {
+		t.Setenv("METRICS_BACKEND", BackendOTLP)
+		t.Setenv("DD_API_KEY", "key")
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+		t.Setenv("METRICS_EXPORT_INTERVAL", "30s")
+
+		cfg := ConfigFromEnv("processor", "v1.0.0")
+		assert.Equal(t, BackendOTLP, cfg.Backend)
+		assert.Equal(t, "http://collector:4318", cfg.OTLPEndpoint)
+		assert.Equal(t, 30*time.Second, cfg.OTLPInterval)
+	})
+}
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	_, err := Init(Config{Backend: "graphite"})
+	assert.ErrorIs(t, err, ErrUnknownBackend)
+
+	backend, err := Init(Config{Backend: BackendPrometheus, Service: "filewatcher"})
+	require.NoError(t, err)
+	require.IsType(t, &Prometheus{}, backend)
+
+	New().Incr("files.processed", nil)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `photo_tags_files_processed_total{service="filewatcher"} 1`)
+
+	require.NoError(t, Stop())
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
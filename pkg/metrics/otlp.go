@@ -0,0 +1,287 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpMetricsPath is the OTLP/HTTP path for metrics
+const otlpMetricsPath = "/v1/metrics"
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const otlpCumulative = 2
+
+// OTLP aggregates metrics in memory and exports them periodically to an OpenTelemetry
+// collector over OTLP/HTTP with JSON encoding. Sums and histograms are cumulative.
+type OTLP struct {
+	registry *registry
+	url      string
+	resource []otlpKeyValue
+	client   *http.Client
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewOTLP creates an OTLP backend exporting to endpoint every interval.
+// resource holds the attributes of the service, e.g. service.name.
+func NewOTLP(endpoint string, interval time.Duration, resource map[string]string) *OTLP {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, otlpMetricsPath) {
+		url += otlpMetricsPath
+	}
+
+	keys := make([]string, 0, len(resource))
+	for key := range resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: resource[key]}})
+	}
+
+	o := &OTLP{
+		registry: newRegistry(),
+		url:      url,
+		resource: attributes,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go o.run(interval)
+	return o
+}
+
+// Count adds value to a sum
+func (o *OTLP) Count(name string, value int64, tags []string) {
+	o.registry.count(name, value, tags)
+}
+
+// Gauge sets a gauge value
+func (o *OTLP) Gauge(name string, value float64, tags []string) {
+	o.registry.gauge(name, value, tags)
+}
+
+// Histogram records a value in a histogram
+func (o *OTLP) Histogram(name string, value float64, tags []string) {
+	o.registry.observe(name, "", value, tags)
+}
+
+// Timing records a duration in milliseconds in a histogram
+func (o *OTLP) Timing(name string, value int64, tags []string) {
+	o.registry.observe(name, unitMilliseconds, float64(value), tags)
+}
+
+// Close stops the periodic export and exports the metrics one last time
+func (o *OTLP) Close() error {
+	close(o.stop)
+	<-o.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.Export(ctx)
+}
+
+func (o *OTLP) run(interval time.Duration) {
+	defer close(o.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := o.Export(ctx); err != nil {
+				log.Printf("Failed to export metrics: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Export sends the current value of every series to the collector
+func (o *OTLP) Export(ctx context.Context) error {
+	snapshot := o.registry.snapshot()
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(o.request(snapshot, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// request builds the export request, one metric per name and kind
+func (o *OTLP) request(snapshot []series, now time.Time) otlpRequest {
+	var metrics []otlpMetric
+	for _, s := range snapshot {
+		name := Namespace + "." + s.name
+		last := len(metrics) - 1
+		if last < 0 || metrics[last].Name != name || metrics[last].kind != s.kind {
+			metrics = append(metrics, newOTLPMetric(name, s))
+			last++
+		}
+		metrics[last].addPoint(s, now)
+	}
+
+	return otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: o.resource},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "github.com/shabohin/photo-tags/pkg/metrics"},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+// OTLP/HTTP JSON encoding of ExportMetricsServiceRequest
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	kind      kind
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPMetric(name string, s series) otlpMetric {
+	metric := otlpMetric{kind: s.kind, Name: name, Unit: s.unit}
+	switch s.kind {
+	case kindCounter:
+		metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: s.monotonic}
+	case kindGauge:
+		metric.Gauge = &otlpGauge{}
+	case kindHistogram:
+		metric.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+	}
+	return metric
+}
+
+func (m *otlpMetric) addPoint(s series, now time.Time) {
+	attributes := make([]otlpKeyValue, 0, len(s.labels))
+	for _, l := range s.labels {
+		attributes = append(attributes, otlpKeyValue{Key: l.key, Value: otlpAnyValue{StringValue: l.value}})
+	}
+	start := strconv.FormatInt(s.start.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	switch s.kind {
+	case kindCounter:
+		m.Sum.IsMonotonic = m.Sum.IsMonotonic && s.monotonic
+		m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberPoint{
+			Attributes: attributes, StartTimeUnixNano: start, TimeUnixNano: timestamp, AsDouble: s.value,
+		})
+	case kindGauge:
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberPoint{
+			Attributes: attributes, TimeUnixNano: timestamp, AsDouble: s.value,
+		})
+	case kindHistogram:
+		counts := make([]string, 0, len(s.counts))
+		for _, c := range s.counts {
+			counts = append(counts, strconv.FormatUint(c, 10))
+		}
+		m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      timestamp,
+			Count:             strconv.FormatUint(s.count, 10),
+			Sum:               s.sum,
+			BucketCounts:      counts,
+			ExplicitBounds:    DefaultBuckets,
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// prometheusContentType is the version of the text exposition format written by Prometheus
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prometheus aggregates metrics in memory and serves them in the Prometheus text format.
+// Names are prefixed with the namespace and dots become underscores, so
+// "image.processing.duration" is exported as photo_tags_image_processing_duration_milliseconds.
+type Prometheus struct {
+	registry    *registry
+	constLabels []label
+}
+
+// NewPrometheus creates a Prometheus backend; constTags are added to every series
+func NewPrometheus(constTags []string) *Prometheus {
+	return &Prometheus{
+		registry:    newRegistry(),
+		constLabels: parseTags(constTags),
+	}
+}
+
+// Count adds value to a counter
+func (p *Prometheus) Count(name string, value int64, tags []string) {
+	p.registry.count(name, value, tags)
+}
+
+// Gauge sets a gauge value
+func (p *Prometheus) Gauge(name string, value float64, tags []string) {
+	p.registry.gauge(name, value, tags)
+}
+
+// Histogram records a value in a histogram
+func (p *Prometheus) Histogram(name string, value float64, tags []string) {
+	p.registry.observe(name, "", value, tags)
+}
+
+// Timing records a duration in milliseconds in a histogram
+func (p *Prometheus) Timing(name string, value int64, tags []string) {
+	p.registry.observe(name, unitMilliseconds, float64(value), tags)
+}
+
+// Close does nothing; the series are kept until the process exits
+func (p *Prometheus) Close() error {
+	return nil
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	_ = p.Write(w)
+}
+
+// Write writes the metrics in the text exposition format
+func (p *Prometheus) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	family := ""
+	for _, s := range p.registry.snapshot() {
+		name := prometheusName(s)
+		if name != family {
+			family = name
+			out.WriteString("# TYPE " + name + " " + prometheusType(s) + "\n")
+		}
+
+		labels := append(append([]label(nil), p.constLabels...), s.labels...)
+		if s.kind != kindHistogram {
+			out.WriteString(name + formatLabels(labels) + " " + formatFloat(s.value) + "\n")
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range p.registry.buckets {
+			cumulative += s.counts[i]
+			le := append(labels[:len(labels):len(labels)], label{key: "le", value: formatFloat(bound)})
+			out.WriteString(name + "_bucket" + formatLabels(le) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		inf := append(labels[:len(labels):len(labels)], label{key: "le", value: "+Inf"})
+		out.WriteString(name + "_bucket" + formatLabels(inf) + " " + strconv.FormatUint(s.count, 10) + "\n")
+		out.WriteString(name + "_sum" + formatLabels(labels) + " " + formatFloat(s.sum) + "\n")
+		out.WriteString(name + "_count" + formatLabels(labels) + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+
+	return out.Flush()
+}
+
+// prometheusName returns the exported name of a series
+func prometheusName(s series) string {
+	name := Namespace + "_" + sanitizeName(s.name)
+	switch {
+	case s.kind == kindCounter && s.monotonic:
+		name += "_total"
+	case s.unit == unitMilliseconds:
+		name += "_milliseconds"
+	}
+	return name
+}
+
+// prometheusType returns the metric type of a series; a counter that was decremented is a gauge
+func prometheusType(s series) string {
+	switch {
+	case s.kind == kindCounter && s.monotonic:
+		return "counter"
+	case s.kind == kindHistogram:
+		return "histogram"
+	default:
+		return "gauge"
+	}
+}
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.key+`="`+escapeLabelValue(l.value)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
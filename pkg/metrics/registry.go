@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kind is the type of an aggregated series
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindGauge
+	kindHistogram
+)
+
+// unitMilliseconds is the unit of series recorded through Timing
+const unitMilliseconds = "ms"
+
+// DefaultBuckets are the histogram upper bounds. They are wide enough for counts, milliseconds
+// and bytes, which share the same histograms.
+var DefaultBuckets = []float64{
+	1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 1e5, 1e6, 1e7,
+}
+
+// label is a tag split into a key and a value
+type label struct {
+	key   string
+	value string
+}
+
+// series is the aggregate of the samples with one name, kind and tag set
+type series struct {
+	name      string
+	kind      kind
+	unit      string
+	labels    []label
+	start     time.Time
+	value     float64
+	monotonic bool
+	// counts holds the samples per bucket; the last entry counts samples above every bound
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// registry aggregates samples in memory for backends that are scraped or export periodically
+type registry struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*series
+}
+
+func newRegistry() *registry {
+	return &registry{
+		buckets: DefaultBuckets,
+		series:  make(map[string]*series),
+	}
+}
+
+// lookup returns the series of name, kind and tags, creating it on first use
+func (r *registry) lookup(k kind, name, unit string, tags []string) *series {
+	labels := parseTags(tags)
+
+	var key strings.Builder
+	key.WriteString(name)
+	key.WriteByte(byte('0' + k))
+	for _, l := range labels {
+		key.WriteString("\xff" + l.key + "=" + l.value)
+	}
+
+	s, ok := r.series[key.String()]
+	if !ok {
+		s = &series{name: name, kind: k, unit: unit, labels: labels, start: time.Now(), monotonic: true}
+		if k == kindHistogram {
+			s.counts = make([]uint64, len(r.buckets)+1)
+		}
+		r.series[key.String()] = s
+	}
+	return s
+}
+
+func (r *registry) count(name string, value int64, tags []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.lookup(kindCounter, name, "", tags)
+	s.value += float64(value)
+	if value < 0 {
+		s.monotonic = false
+	}
+}
+
+func (r *registry) gauge(name string, value float64, tags []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookup(kindGauge, name, "", tags).value = value
+}
+
+func (r *registry) observe(name, unit string, value float64, tags []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.lookup(kindHistogram, name, unit, tags)
+	i := sort.SearchFloat64s(r.buckets, value)
+	s.counts[i]++
+	s.sum += value
+	s.count++
+}
+
+// snapshot returns a copy of every series, ordered by name, kind and labels
+func (r *registry) snapshot() []series {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make([]series, 0, len(r.series))
+	for _, s := range r.series {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		snapshot = append(snapshot, c)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		a, b := snapshot[i], snapshot[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return labelsKey(a.labels) < labelsKey(b.labels)
+	})
+	return snapshot
+}
+
+// parseTags splits "key:value" tags into labels sorted by key.
+// A tag without a value becomes a label with the value "true"; a tag without a key is dropped.
+func parseTags(tags []string) []label {
+	labels := make([]label, 0, len(tags))
+	seen := make(map[string]int, len(tags))
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = "true"
+		}
+		key = sanitizeName(key)
+		if key == "" {
+			continue
+		}
+		if i, ok := seen[key]; ok {
+			labels[i].value = value
+			continue
+		}
+		seen[key] = len(labels)
+		labels = append(labels, label{key: key, value: value})
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].key < labels[j].key })
+	return labels
+}
+
+func labelsKey(labels []label) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.key+"="+l.value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// sanitizeName replaces the characters Prometheus does not allow in names, e.g. the dots of
+// "image.processing.duration", with underscores
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
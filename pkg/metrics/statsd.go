@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsD sends metrics to a DogStatsD agent over UDP, one datagram per sample
+type StatsD struct {
+	conn      net.Conn
+	constTags []string
+}
+
+// NewStatsD creates a DogStatsD backend; constTags are added to every sample
+func NewStatsD(addr string, constTags []string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
+	}
+
+	return &StatsD{
+		conn:      conn,
+		constTags: constTags,
+	}, nil
+}
+
+// Count adds value to a counter
+func (s *StatsD) Count(name string, value int64, tags []string) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Gauge sets a gauge value
+func (s *StatsD) Gauge(name string, value float64, tags []string) {
+	s.send(name, formatFloat(value), "g", tags)
+}
+
+// Histogram sends a histogram value
+func (s *StatsD) Histogram(name string, value float64, tags []string) {
+	s.send(name, formatFloat(value), "h", tags)
+}
+
+// Timing sends a timing metric in milliseconds
+func (s *StatsD) Timing(name string, value int64, tags []string) {
+	s.send(name, strconv.FormatInt(value, 10), "ms", tags)
+}
+
+// Close closes the connection to the agent
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// send writes a sample such as "photo_tags.image.uploaded:1|c|#service:gateway".
+// Write errors are ignored: the agent may be down and metrics must not fail the caller.
+func (s *StatsD) send(name, value, metricType string, tags []string) {
+	var b strings.Builder
+	b.WriteString(Namespace + "." + name + ":" + value + "|" + metricType)
+
+	all := append(append([]string(nil), s.constTags...), tags...)
+	if len(all) > 0 {
+		b.WriteString("|#" + strings.Join(all, ","))
+	}
+
+	_, _ = s.conn.Write([]byte(b.String()))
+}
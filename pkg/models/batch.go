@@ -30,6 +30,8 @@ type BatchImageStatus struct {
 	Status           string     `json:"status"` // pending, processing, completed, failed
 	TraceID          string     `json:"trace_id"`
 	ProcessedPath    string     `json:"processed_path,omitempty"`
+	RemovedTags      []string   `json:"removed_tags,omitempty"`
+	AltText          string     `json:"alt_text,omitempty"`
 	Error            string     `json:"error,omitempty"`
 	StartTime        *time.Time `json:"start_time,omitempty"`
 	EndTime          *time.Time `json:"end_time,omitempty"`
@@ -96,6 +98,32 @@ func (b *BatchJob) UpdateImageStatus(traceID string, status string, processedPat
 	}
 }
 
+// SetImageRemovedTags records the tags removed from an image by the privacy profile
+func (b *BatchJob) SetImageRemovedTags(traceID string, tags []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.Images {
+		if b.Images[i].TraceID == traceID {
+			b.Images[i].RemovedTags = tags
+			return
+		}
+	}
+}
+
+// SetImageAltText records the generated alt text of an image
+func (b *BatchJob) SetImageAltText(traceID string, altText string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.Images {
+		if b.Images[i].TraceID == traceID {
+			b.Images[i].AltText = altText
+			return
+		}
+	}
+}
+
 // GetProgress returns the current progress as a percentage
 func (b *BatchJob) GetProgress() float64 {
 	b.mu.RLock()
@@ -120,6 +148,10 @@ func (b *BatchJob) IsComplete() bool {
 // BatchCreateRequest represents a request to create a batch job
 type BatchCreateRequest struct {
 	Images []ImageSource `json:"images"`
+	// PrivacyProfile is applied to every image of the batch; empty uses the Processor default
+	PrivacyProfile string `json:"privacy_profile,omitempty"`
+	// MergePolicy is applied to every image of the batch; empty uses the Processor default
+	MergePolicy string `json:"merge_policy,omitempty"`
 }
 
 // BatchCreateResponse represents the response after creating a batch job
@@ -2,26 +2,111 @@ package models
 
 import "time"
 
+// Merge policies select how generated metadata is combined with tags already embedded in the image
+const (
+	// MergePolicyReplace overwrites existing title, description and keywords
+	MergePolicyReplace = "replace"
+	// MergePolicyAppendUnique overwrites title and description and adds keywords that are not present yet
+	MergePolicyAppendUnique = "append-unique"
+	// MergePolicyKeepExisting keeps every existing field and only fills the missing ones
+	MergePolicyKeepExisting = "keep-existing"
+)
+
+// MergePolicies lists the merge policy names accepted in messages
+var MergePolicies = []string{MergePolicyReplace, MergePolicyAppendUnique, MergePolicyKeepExisting}
+
+// IsMergePolicy reports whether name is a known merge policy
+func IsMergePolicy(name string) bool {
+	for _, policy := range MergePolicies {
+		if name == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// Output modes select where the Processor writes metadata
+const (
+	// OutputModeEmbedded writes metadata into the processed copy of the image
+	OutputModeEmbedded = "embedded"
+	// OutputModeSidecar leaves the image byte-identical and writes an .xmp sidecar next to it
+	OutputModeSidecar = "sidecar"
+)
+
+// Privacy profiles select which groups of identifying tags the Processor removes from embedded output
+const (
+	// PrivacyProfileOff keeps every tag
+	PrivacyProfileOff = "off"
+	// PrivacyProfileLocation removes GPS coordinates
+	PrivacyProfileLocation = "location"
+	// PrivacyProfileStandard removes GPS coordinates, serial numbers and owner/artist names
+	PrivacyProfileStandard = "standard"
+	// PrivacyProfileStrict additionally removes MakerNotes
+	PrivacyProfileStrict = "strict"
+)
+
+// PrivacyProfiles lists the profile names accepted in messages, in increasing order of removal
+var PrivacyProfiles = []string{
+	PrivacyProfileOff, PrivacyProfileLocation, PrivacyProfileStandard, PrivacyProfileStrict,
+}
+
+// IsPrivacyProfile reports whether name is a known privacy profile
+func IsPrivacyProfile(name string) bool {
+	for _, profile := range PrivacyProfiles {
+		if name == profile {
+			return true
+		}
+	}
+	return false
+}
+
 // ImageUpload represents a message for the image_upload queue
 type ImageUpload struct {
-	Timestamp        time.Time `json:"timestamp"`
-	TraceID          string    `json:"trace_id"`
-	GroupID          string    `json:"group_id"`
-	TelegramUsername string    `json:"telegram_username"`
-	OriginalFilename string    `json:"original_filename"`
-	OriginalPath     string    `json:"original_path"`
-	TelegramID       int64     `json:"telegram_id"`
+	Timestamp        time.Time       `json:"timestamp"`
+	TraceID          string          `json:"trace_id"`
+	GroupID          string          `json:"group_id"`
+	TelegramUsername string          `json:"telegram_username"`
+	OriginalFilename string          `json:"original_filename"`
+	OriginalPath     string          `json:"original_path"`
+	TelegramID       int64           `json:"telegram_id"`
+	BypassCache      bool            `json:"bypass_cache,omitempty"`
+	MergePolicy      string          `json:"merge_policy,omitempty"`
+	OutputMode       string          `json:"output_mode,omitempty"`
+	PrivacyProfile   string          `json:"privacy_profile,omitempty"`
+	Creator          *CreatorProfile `json:"creator,omitempty"`
 }
 
 // MetadataGenerated represents a message for the metadata_generated queue
 type MetadataGenerated struct {
-	Timestamp        time.Time `json:"timestamp"`
-	TraceID          string    `json:"trace_id"`
-	GroupID          string    `json:"group_id"`
-	OriginalFilename string    `json:"original_filename"`
-	OriginalPath     string    `json:"original_path"`
-	Metadata         Metadata  `json:"metadata"`
-	TelegramID       int64     `json:"telegram_id"`
+	Timestamp        time.Time       `json:"timestamp"`
+	TraceID          string          `json:"trace_id"`
+	GroupID          string          `json:"group_id"`
+	OriginalFilename string          `json:"original_filename"`
+	OriginalPath     string          `json:"original_path"`
+	Metadata         Metadata        `json:"metadata"`
+	TelegramID       int64           `json:"telegram_id"`
+	Experiment       *Experiment     `json:"experiment,omitempty"`
+	MergePolicy      string          `json:"merge_policy,omitempty"`
+	OutputMode       string          `json:"output_mode,omitempty"`
+	PrivacyProfile   string          `json:"privacy_profile,omitempty"`
+	Creator          *CreatorProfile `json:"creator,omitempty"`
+}
+
+// CreatorProfile holds the creator, rights and contact fields written to every image of a user
+type CreatorProfile struct {
+	Creator    string `json:"creator,omitempty"`
+	Rights     string `json:"rights,omitempty"`
+	UsageTerms string `json:"usage_terms,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Website    string `json:"website,omitempty"`
+	City       string `json:"city,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// IsEmpty reports whether no field of the profile is set
+func (p *CreatorProfile) IsEmpty() bool {
+	return p == nil || *p == CreatorProfile{}
 }
 
 // ImageProcess represents a message for the image_process queue
@@ -38,22 +123,51 @@ type ImageProcess struct {
 
 // ImageProcessed represents a message for the image_processed queue
 type ImageProcessed struct {
-	Timestamp        time.Time `json:"timestamp"`
-	TraceID          string    `json:"trace_id"`
-	GroupID          string    `json:"group_id"`
-	TelegramUsername string    `json:"telegram_username"`
-	OriginalFilename string    `json:"original_filename"`
-	ProcessedPath    string    `json:"processed_path"`
-	Status           string    `json:"status"`
-	Error            string    `json:"error,omitempty"`
-	TelegramID       int64     `json:"telegram_id"`
+	Timestamp        time.Time   `json:"timestamp"`
+	TraceID          string      `json:"trace_id"`
+	GroupID          string      `json:"group_id"`
+	TelegramUsername string      `json:"telegram_username"`
+	OriginalFilename string      `json:"original_filename"`
+	ProcessedPath    string      `json:"processed_path"`
+	SidecarPath      string      `json:"sidecar_path,omitempty"`
+	RemovedTags      []string    `json:"removed_tags,omitempty"`
+	Status           string      `json:"status"`
+	Error            string      `json:"error,omitempty"`
+	TelegramID       int64       `json:"telegram_id"`
+	Metadata         *Metadata   `json:"metadata,omitempty"`
+	Experiment       *Experiment `json:"experiment,omitempty"`
 }
 
-// Metadata represents image metadata
+// Metadata represents image metadata.
+// HierarchicalKeywords are Lightroom-style keyword paths, e.g. "Animals|Mammals|Dog".
+// Category and SupplementalCategories come from the analyzer's configured category list.
+// AltText is a short accessibility description (at most 125 characters) distinct from Description.
 type Metadata struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Keywords    []string `json:"keywords"`
+	Title                  string     `json:"title"`
+	Description            string     `json:"description"`
+	Keywords               []string   `json:"keywords"`
+	HierarchicalKeywords   []string   `json:"hierarchical_keywords,omitempty"`
+	Category               string     `json:"category,omitempty"`
+	SupplementalCategories []string   `json:"supplemental_categories,omitempty"`
+	AltText                string     `json:"alt_text,omitempty"`
+	Consensus              *Consensus `json:"consensus,omitempty"`
+}
+
+// Consensus records how strongly the analyzer models agreed on the metadata.
+// Agreement scores range from 0 to 1 and allow filtering low-confidence keywords.
+type Consensus struct {
+	Models           []string           `json:"models"`
+	Queried          int                `json:"queried"`
+	TitleAgreement   float64            `json:"title_agreement"`
+	KeywordAgreement map[string]float64 `json:"keyword_agreement"`
+}
+
+// Experiment describes the analyzer variant that generated the metadata
+type Experiment struct {
+	VariantID     string `json:"variant_id"`
+	Model         string `json:"model,omitempty"`
+	KeywordCount  int    `json:"keyword_count"`
+	ParseFailures int    `json:"parse_failures"`
 }
 
 // FailedJob represents a failed message in the dead letter queue
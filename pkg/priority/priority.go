@@ -0,0 +1,143 @@
+// Package priority keeps single interactive uploads from waiting behind bulk work.
+//
+// Every pipeline queue has two lanes. The interactive lane keeps the queue name, e.g.
+// "image_upload", and carries Telegram and web uploads; the bulk lane adds ".bulk", e.g.
+// "image_upload.bulk", and carries batch jobs and filewatcher dumps. The bulk lane is a priority
+// queue, so batch jobs overtake filewatcher dumps. The source of a message travels in the
+// x-source header, so the analyzer publishes metadata to the lane the upload came from.
+//
+// Consumers read both lanes through a Receiver, which serves them by weight while both have
+// messages waiting, so an interactive upload is picked up within a few messages and bulk work
+// keeps moving.
+package priority
+
+import (
+	"context"
+	"errors"
+)
+
+// Sources of uploads, from the highest priority to the lowest
+const (
+	SourceTelegram    = "telegram"
+	SourceWeb         = "web"
+	SourceBatch       = "batch"
+	SourceFilewatcher = "filewatcher"
+)
+
+// HeaderSource is the message header carrying the source of an upload
+const HeaderSource = "x-source"
+
+// MaxPriority is the highest message priority, declared as x-max-priority on bulk lanes
+const MaxPriority = 3
+
+// bulkSuffix is appended to a queue name to name its bulk lane
+const bulkSuffix = ".bulk"
+
+// Lane is an interactive or bulk queue of a pipeline queue
+type Lane string
+
+// Lanes
+const (
+	LaneInteractive Lane = "interactive"
+	LaneBulk        Lane = "bulk"
+)
+
+// ErrLaneClosed is returned by Receive when the delivery channel of a lane is closed
+var ErrLaneClosed = errors.New("priority: lane closed")
+
+// Priority returns the message priority of source, from 0 to MaxPriority
+func Priority(source string) uint8 {
+	switch source {
+	case SourceTelegram:
+		return 3
+	case SourceWeb:
+		return 2
+	case SourceBatch:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// LaneOf returns the lane of source. Messages without a source predate the lanes and stay
+// interactive.
+func LaneOf(source string) Lane {
+	switch source {
+	case SourceBatch, SourceFilewatcher:
+		return LaneBulk
+	default:
+		return LaneInteractive
+	}
+}
+
+// QueueName returns the name of the lane of queueName
+func QueueName(queueName string, lane Lane) string {
+	if lane == LaneBulk {
+		return queueName + bulkSuffix
+	}
+	return queueName
+}
+
+// QueueFor returns the lane of queueName that messages from source are published to
+func QueueFor(queueName, source string) string {
+	return QueueName(queueName, LaneOf(source))
+}
+
+// BulkQueueArgs returns the arguments of a bulk lane: a priority queue whose rejected messages
+// go to deadLetterQueue. Producers and consumers declare it with the same arguments.
+func BulkQueueArgs(deadLetterQueue string) map[string]interface{} {
+	return map[string]interface{}{
+		"x-max-priority":            int64(MaxPriority),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": deadLetterQueue,
+	}
+}
+
+// Headers returns new message headers carrying source
+func Headers(source string) map[string]interface{} {
+	headers := make(map[string]interface{}, 1)
+	if source != "" {
+		headers[HeaderSource] = source
+	}
+	return headers
+}
+
+// Source returns the source header of a message; AMQP headers may hold strings or bytes
+func Source(headers map[string]interface{}) string {
+	switch value := headers[HeaderSource].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return ""
+	}
+}
+
+type sourceKey struct{}
+
+// ContextWithSource returns ctx carrying the source of the message being processed
+func ContextWithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFromContext returns the source carried by ctx
+func SourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
+
+// Inject writes the source carried by ctx to headers
+func Inject(ctx context.Context, headers map[string]interface{}) {
+	if source := SourceFromContext(ctx); source != "" {
+		headers[HeaderSource] = source
+	}
+}
+
+// Extract returns ctx carrying the source read from headers
+func Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	if source := Source(headers); source != "" {
+		return ContextWithSource(ctx, source)
+	}
+	return ctx
+}
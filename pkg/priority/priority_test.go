@@ -0,0 +1,135 @@
+package priority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityOrder(t *testing.T) {
+	assert.Greater(t, Priority(SourceTelegram), Priority(SourceWeb))
+	assert.Greater(t, Priority(SourceWeb), Priority(SourceBatch))
+	assert.Greater(t, Priority(SourceBatch), Priority(SourceFilewatcher))
+	assert.Equal(t, uint8(MaxPriority), Priority(SourceTelegram))
+	assert.Equal(t, uint8(0), Priority(""))
+}
+
+func TestQueueFor(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{SourceTelegram, "image_upload"},
+		{SourceWeb, "image_upload"},
+		{SourceBatch, "image_upload.bulk"},
+		{SourceFilewatcher, "image_upload.bulk"},
+		{"", "image_upload"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, QueueFor("image_upload", tt.source), tt.source)
+	}
+}
+
+func TestSourceHeaders(t *testing.T) {
+	assert.Equal(t, SourceBatch, Source(map[string]interface{}{HeaderSource: []byte(SourceBatch)}))
+	assert.Empty(t, Headers(""))
+
+	ctx := Extract(context.Background(), Headers(SourceFilewatcher))
+	assert.Equal(t, SourceFilewatcher, SourceFromContext(ctx))
+
+	headers := map[string]interface{}{}
+	Inject(ctx, headers)
+	assert.Equal(t, SourceFilewatcher, headers[HeaderSource])
+
+	headers = map[string]interface{}{}
+	Inject(context.Background(), headers)
+	assert.Empty(t, headers)
+}
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler(DefaultWeights)
+
+	var lanes []Lane
+	for i := 0; i < 10; i++ {
+		lanes = append(lanes, s.Next())
+	}
+	assert.Equal(t, []Lane{
+		LaneInteractive, LaneInteractive, LaneBulk, LaneInteractive, LaneInteractive,
+		LaneInteractive, LaneInteractive, LaneBulk, LaneInteractive, LaneInteractive,
+	}, lanes)
+
+	// A zero weight still gets turns
+	s = NewScheduler(Weights{Interactive: 1})
+	assert.Equal(t, LaneInteractive, s.Next())
+	assert.Equal(t, LaneBulk, s.Next())
+}
+
+func TestReceiver_ServesByWeight(t *testing.T) {
+	interactive := make(chan int, 20)
+	bulk := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		interactive <- i
+		bulk <- 100 + i
+	}
+
+	r := NewReceiver(DefaultWeights, interactive, bulk)
+	counts := map[Lane]int{}
+	for i := 0; i < 10; i++ {
+		_, lane, err := r.Receive(context.Background())
+		require.NoError(t, err)
+		counts[lane]++
+	}
+	assert.Equal(t, map[Lane]int{LaneInteractive: 8, LaneBulk: 2}, counts)
+}
+
+func TestReceiver_ServesWaitingLane(t *testing.T) {
+	interactive := make(chan int, 5)
+	bulk := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		bulk <- i
+	}
+
+	r := NewReceiver(DefaultWeights, interactive, bulk)
+	for i := 0; i < 5; i++ {
+		msg, lane, err := r.Receive(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, LaneBulk, lane)
+		assert.Equal(t, i, msg)
+	}
+
+	// The bulk turns served while the interactive lane was empty are not held against it
+	interactive <- 1
+	bulk <- 5
+	_, lane, err := r.Receive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, LaneInteractive, lane)
+}
+
+func TestReceiver_Blocks(t *testing.T) {
+	interactive := make(chan int)
+	bulk := make(chan int)
+	r := NewReceiver(DefaultWeights, interactive, bulk)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		bulk <- 7
+	}()
+	msg, lane, err := r.Receive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 7, msg)
+	assert.Equal(t, LaneBulk, lane)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = r.Receive(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(interactive)
+	_, lane, err = r.Receive(context.Background())
+	assert.ErrorIs(t, err, ErrLaneClosed)
+	assert.Equal(t, LaneInteractive, lane)
+}
@@ -0,0 +1,127 @@
+package priority
+
+import "context"
+
+// Weights are the shares of messages each lane receives while both lanes have messages waiting
+type Weights struct {
+	Interactive int
+	Bulk        int
+}
+
+// DefaultWeights serve four interactive messages for every bulk message
+var DefaultWeights = Weights{Interactive: 4, Bulk: 1}
+
+// normalize replaces weights below 1, so no lane is starved
+func (w Weights) normalize() Weights {
+	if w.Interactive < 1 {
+		w.Interactive = 1
+	}
+	if w.Bulk < 1 {
+		w.Bulk = 1
+	}
+	return w
+}
+
+// Scheduler picks the lane to serve next by smooth weighted round-robin, which spreads the
+// bulk turns evenly instead of serving them in bursts. It is not safe for concurrent use.
+type Scheduler struct {
+	weights     Weights
+	interactive int
+	bulk        int
+}
+
+// NewScheduler creates a scheduler serving the lanes by weights
+func NewScheduler(weights Weights) *Scheduler {
+	return &Scheduler{weights: weights.normalize()}
+}
+
+// Next returns the lane whose turn it is
+func (s *Scheduler) Next() Lane {
+	s.interactive += s.weights.Interactive
+	s.bulk += s.weights.Bulk
+	total := s.weights.Interactive + s.weights.Bulk
+
+	if s.interactive >= s.bulk {
+		s.interactive -= total
+		return LaneInteractive
+	}
+	s.bulk -= total
+	return LaneBulk
+}
+
+// Reset forgets the turns served so far. A lane that was empty must not bank turns and then
+// starve the other lane once it fills up.
+func (s *Scheduler) Reset() {
+	s.interactive = 0
+	s.bulk = 0
+}
+
+// Receiver receives messages from the interactive and bulk lanes of a queue by weight.
+// It is not safe for concurrent use; every worker creates its own.
+type Receiver[T any] struct {
+	scheduler   *Scheduler
+	interactive <-chan T
+	bulk        <-chan T
+}
+
+// NewReceiver creates a receiver of the deliveries of both lanes
+func NewReceiver[T any](weights Weights, interactive, bulk <-chan T) *Receiver[T] {
+	return &Receiver[T]{
+		scheduler:   NewScheduler(weights),
+		interactive: interactive,
+		bulk:        bulk,
+	}
+}
+
+// Receive returns the next message and its lane. The lane whose turn it is is served if it has a
+// message waiting, otherwise the other lane is, so a lane never idles while the other has work.
+// It returns ctx.Err() once ctx is done and ErrLaneClosed once a delivery channel is closed.
+func (r *Receiver[T]) Receive(ctx context.Context) (T, Lane, error) {
+	var zero T
+
+	turn := r.scheduler.Next()
+	for i, lane := range []Lane{turn, other(turn)} {
+		select {
+		case msg, ok := <-r.deliveries(lane):
+			if !ok {
+				return zero, lane, ErrLaneClosed
+			}
+			if i > 0 {
+				r.scheduler.Reset()
+			}
+			return msg, lane, nil
+		default:
+		}
+	}
+
+	// Both lanes are empty: serve whichever receives a message first
+	r.scheduler.Reset()
+	select {
+	case <-ctx.Done():
+		return zero, turn, ctx.Err()
+	case msg, ok := <-r.interactive:
+		if !ok {
+			return zero, LaneInteractive, ErrLaneClosed
+		}
+		return msg, LaneInteractive, nil
+	case msg, ok := <-r.bulk:
+		if !ok {
+			return zero, LaneBulk, ErrLaneClosed
+		}
+		return msg, LaneBulk, nil
+	}
+}
+
+func (r *Receiver[T]) deliveries(lane Lane) <-chan T {
+	if lane == LaneBulk {
+		return r.bulk
+	}
+	return r.interactive
+}
+
+func other(lane Lane) Lane {
+	if lane == LaneBulk {
+		return LaneInteractive
+	}
+	return LaneBulk
+}
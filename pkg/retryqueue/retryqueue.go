@@ -0,0 +1,158 @@
+// Package retryqueue routes failed messages through delay queues before the dead letter queue.
+//
+// Every consumed queue has one retry queue per tier, e.g. "image_upload.retry.10s". A retry queue
+// has no consumers: its messages expire after the tier delay and are dead-lettered back to the
+// main queue. A message that fails after the last tier goes to the dead letter queue.
+package retryqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeadLetterQueue receives messages that failed after the last retry tier
+const DeadLetterQueue = "dead_letter_queue"
+
+// Headers set on retried and dead-lettered messages
+const (
+	HeaderRetryCount    = "x-retry-count"
+	HeaderErrorReason   = "x-error-reason"
+	HeaderOriginalQueue = "x-original-queue"
+	HeaderFailedAt      = "x-failed-at"
+)
+
+// Tiers are the delays before the first, second and third retry
+var Tiers = []time.Duration{10 * time.Second, time.Minute, 10 * time.Minute}
+
+// Queue is a retry queue to declare next to a consumed queue
+type Queue struct {
+	Name  string
+	Delay time.Duration
+	Args  map[string]interface{}
+}
+
+// Queues returns the retry queues of queueName, one per tier
+func Queues(queueName string) []Queue {
+	queues := make([]Queue, 0, len(Tiers))
+	for _, delay := range Tiers {
+		queues = append(queues, Queue{
+			Name:  QueueName(queueName, delay),
+			Delay: delay,
+			Args: map[string]interface{}{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			},
+		})
+	}
+	return queues
+}
+
+// QueueName returns the name of the retry queue of queueName with the given delay
+func QueueName(queueName string, delay time.Duration) string {
+	return queueName + ".retry." + formatDelay(delay)
+}
+
+// formatDelay formats a delay in its largest whole unit: 10s, 1m, 10m, 1h
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay >= time.Hour && delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay >= time.Minute && delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return fmt.Sprintf("%dms", delay.Milliseconds())
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so the message goes straight to the dead letter queue
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryCount returns how many times a message has been retried, from its headers
+func RetryCount(headers map[string]interface{}) int {
+	switch count := headers[HeaderRetryCount].(type) {
+	case int:
+		return count
+	case int16:
+		return int(count)
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+type retryCountKey struct{}
+
+// ContextWithRetryCount returns ctx carrying the retry count of the message being processed
+func ContextWithRetryCount(ctx context.Context, count int) context.Context {
+	return context.WithValue(ctx, retryCountKey{}, count)
+}
+
+// RetryCountFromContext returns the retry count carried by ctx
+func RetryCountFromContext(ctx context.Context) int {
+	count, _ := ctx.Value(retryCountKey{}).(int)
+	return count
+}
+
+// Extract returns ctx carrying the retry count read from headers
+func Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	return ContextWithRetryCount(ctx, RetryCount(headers))
+}
+
+// LastAttempt reports whether a failure of the message processed with ctx goes to the dead letter queue
+func LastAttempt(ctx context.Context) bool {
+	return RetryCountFromContext(ctx) >= len(Tiers)
+}
+
+// Route returns the queue a message that failed on queueName is published to next and the headers
+// to publish it with: the retry queue of the next tier, or the dead letter queue once the tiers are
+// used up or the failure is permanent.
+func Route(queueName string, headers map[string]interface{}, failure error, now time.Time) (string, map[string]interface{}) {
+	retries := RetryCount(headers)
+
+	next := make(map[string]interface{}, len(headers)+4)
+	for key, value := range headers {
+		// RabbitMQ adds x-death when a retry queue expires; the retry headers replace it
+		if key == "x-death" {
+			continue
+		}
+		next[key] = value
+	}
+	next[HeaderOriginalQueue] = queueName
+	next[HeaderErrorReason] = failure.Error()
+
+	if retries < len(Tiers) && !IsPermanent(failure) {
+		next[HeaderRetryCount] = int64(retries + 1)
+		return QueueName(queueName, Tiers[retries]), next
+	}
+
+	next[HeaderRetryCount] = int64(retries)
+	next[HeaderFailedAt] = now.Format(time.RFC3339)
+	return DeadLetterQueue, next
+}
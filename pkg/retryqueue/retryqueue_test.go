@@ -0,0 +1,84 @@
+package retryqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues(t *testing.T) {
+	queues := Queues("image_upload")
+	require.Len(t, queues, len(Tiers))
+
+	assert.Equal(t, "image_upload.retry.10s", queues[0].Name)
+	assert.Equal(t, "image_upload.retry.1m", queues[1].Name)
+	assert.Equal(t, "image_upload.retry.10m", queues[2].Name)
+
+	assert.Equal(t, int64(10000), queues[0].Args["x-message-ttl"])
+	assert.Equal(t, "", queues[0].Args["x-dead-letter-exchange"])
+	assert.Equal(t, "image_upload", queues[0].Args["x-dead-letter-routing-key"])
+}
+
+func TestRoute_WalksTiersThenDeadLetters(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("openrouter unavailable")
+
+	var headers map[string]interface{}
+	for _, delay := range Tiers {
+		var queue string
+		queue, headers = Route("image_upload", headers, failure, now)
+		assert.Equal(t, QueueName("image_upload", delay), queue)
+		assert.Equal(t, "openrouter unavailable", headers[HeaderErrorReason])
+		assert.Equal(t, "image_upload", headers[HeaderOriginalQueue])
+	}
+	assert.Equal(t, int64(len(Tiers)), headers[HeaderRetryCount])
+
+	queue, headers := Route("image_upload", headers, failure, now)
+	assert.Equal(t, DeadLetterQueue, queue)
+	assert.Equal(t, int64(len(Tiers)), headers[HeaderRetryCount])
+	assert.Equal(t, "2026-03-01T12:00:00Z", headers[HeaderFailedAt])
+}
+
+func TestRoute_PermanentFailureSkipsTiers(t *testing.T) {
+	failure := fmt.Errorf("failed to unmarshal message: %w", Permanent(errors.New("bad json")))
+
+	queue, headers := Route("image_upload", map[string]interface{}{"trace_id": "abc"}, failure, time.Now())
+
+	assert.Equal(t, DeadLetterQueue, queue)
+	assert.Equal(t, int64(0), headers[HeaderRetryCount])
+	assert.Equal(t, "abc", headers["trace_id"])
+	assert.Equal(t, "failed to unmarshal message: bad json", headers[HeaderErrorReason])
+}
+
+func TestRoute_DropsDeathHeader(t *testing.T) {
+	headers := map[string]interface{}{
+		HeaderRetryCount: int32(1),
+		"x-death":        []interface{}{map[string]interface{}{"queue": "image_upload.retry.10s"}},
+	}
+
+	queue, next := Route("image_upload", headers, errors.New("timeout"), time.Now())
+
+	assert.Equal(t, "image_upload.retry.1m", queue)
+	assert.Equal(t, int64(2), next[HeaderRetryCount])
+	assert.NotContains(t, next, "x-death")
+	assert.Contains(t, headers, "x-death", "the delivery headers are not modified")
+}
+
+func TestExtract(t *testing.T) {
+	ctx := Extract(context.Background(), nil)
+	assert.Equal(t, 0, RetryCountFromContext(ctx))
+	assert.False(t, LastAttempt(ctx))
+
+	_, headers := Route("image_upload", nil, errors.New("boom"), time.Now())
+	ctx = Extract(context.Background(), headers)
+	assert.Equal(t, 1, RetryCountFromContext(ctx))
+	assert.False(t, LastAttempt(ctx))
+
+	ctx = Extract(context.Background(), map[string]interface{}{HeaderRetryCount: int64(len(Tiers))})
+	assert.True(t, LastAttempt(ctx))
+}
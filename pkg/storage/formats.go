@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ImageExtensions are the upload formats the analyzer decodes directly
+var ImageExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// rawContentTypes are the camera RAW upload formats. They are analyzed from their embedded JPEG
+// preview and get an XMP sidecar, since their metadata is not written in place.
+var rawContentTypes = map[string]string{
+	".arw": "image/x-sony-arw",
+	".cr2": "image/x-canon-cr2",
+	".cr3": "image/x-canon-cr3",
+	".dng": "image/x-adobe-dng",
+	".nef": "image/x-nikon-nef",
+	".orf": "image/x-olympus-orf",
+	".raf": "image/x-fuji-raf",
+	".rw2": "image/x-panasonic-rw2",
+	".srw": "image/x-samsung-srw",
+	".pef": "image/x-pentax-pef",
+}
+
+// RAWExtensions lists the camera RAW upload formats
+var RAWExtensions = []string{".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2", ".srw", ".pef"}
+
+// UploadExtensions lists every accepted upload format
+var UploadExtensions = append(append([]string{}, ImageExtensions...), RAWExtensions...)
+
+// IsRAW reports whether filename is a camera RAW file
+func IsRAW(filename string) bool {
+	_, ok := rawContentTypes[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+// IsSupportedUpload reports whether filename has an accepted upload format
+func IsSupportedUpload(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, supported := range UploadExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType returns the content type of an upload by its extension
+func ContentType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	}
+	if contentType, ok := rawContentTypes[ext]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
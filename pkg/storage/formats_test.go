@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadFormats(t *testing.T) {
+	assert.True(t, IsSupportedUpload("photo.JPG"))
+	assert.True(t, IsSupportedUpload("IMG_0001.CR2"))
+	assert.False(t, IsSupportedUpload("notes.txt"))
+	assert.False(t, IsSupportedUpload("photo"))
+
+	assert.True(t, IsRAW("IMG_0001.cr2"))
+	assert.True(t, IsRAW("original/DSC_0001.NEF"))
+	assert.False(t, IsRAW("photo.jpg"))
+
+	assert.Equal(t, "image/jpeg", ContentType("photo.jpeg"))
+	assert.Equal(t, "image/x-canon-cr2", ContentType("IMG_0001.CR2"))
+	assert.Equal(t, "application/octet-stream", ContentType("notes.txt"))
+
+	for _, ext := range RAWExtensions {
+		assert.True(t, IsRAW("file"+ext), ext)
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 // MinIOInterface defines the interface for MinIO operations
@@ -15,6 +17,15 @@ type MinIOInterface interface {
 	UploadFile(ctx context.Context, bucketName, objectName string, reader io.Reader, contentType string) error
 	DownloadFile(ctx context.Context, bucketName, objectName string) (*minio.Object, error)
 	GetPresignedURL(ctx context.Context, bucketName, objectName string, expiry time.Duration) (string, error)
+	ListObjects(ctx context.Context, bucketName, prefix string) ([]ObjectInfo, error)
+	RemoveObject(ctx context.Context, bucketName, objectName string) error
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
 }
 
 // MinIOClient handles object storage operations
@@ -28,6 +39,9 @@ const (
 	BucketProcessed = "processed"
 )
 
+// TelegramPrefix is the object name prefix of originals uploaded through the Telegram bot
+const TelegramPrefix = "telegram/"
+
 // NewMinIOClient creates a new MinIO client
 func NewMinIOClient(endpoint, accessKey, secretKey string, useSSL bool) (*MinIOClient, error) {
 	// Initialize MinIO client
@@ -51,17 +65,33 @@ func (c *MinIOClient) UploadFile(
 	reader io.Reader,
 	contentType string,
 ) error {
+	span, ctx := startSpan(ctx, "minio.upload", bucketName, objectName)
+
 	// Upload file to bucket
 	_, err := c.client.PutObject(ctx, bucketName, objectName, reader, -1, minio.PutObjectOptions{
 		ContentType: contentType,
 	})
+	span.Finish(err)
 	return err
 }
 
-// DownloadFile downloads a file from MinIO
+// DownloadFile downloads a file from MinIO.
+// The object is read lazily, so its span covers opening the object only.
 func (c *MinIOClient) DownloadFile(ctx context.Context, bucketName, objectName string) (*minio.Object, error) {
+	span, ctx := startSpan(ctx, "minio.download", bucketName, objectName)
+
 	// Get object from bucket
-	return c.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	object, err := c.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	span.Finish(err)
+	return object, err
+}
+
+// startSpan starts a span for an operation on an object
+func startSpan(ctx context.Context, operation, bucketName, objectName string) (tracing.Span, context.Context) {
+	span, ctx := tracing.StartSpan(ctx, operation)
+	span.SetTag("bucket", bucketName)
+	span.SetTag("object", objectName)
+	return span, ctx
 }
 
 // GetPresignedURL generates a presigned URL for an object
@@ -93,3 +123,24 @@ func (c *MinIOClient) EnsureBucketExists(ctx context.Context, bucketName string)
 
 	return nil
 }
+
+// ListObjects lists the objects in a bucket whose names start with prefix, recursively
+func (c *MinIOClient) ListObjects(ctx context.Context, bucketName, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range c.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Name:         object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+// RemoveObject deletes an object from a bucket
+func (c *MinIOClient) RemoveObject(ctx context.Context, bucketName, objectName string) error {
+	return c.client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,20 @@
+// Package text holds helpers for the free text of image metadata
+package text
+
+import "strings"
+
+// Truncate trims text and truncates it to limit characters at a word boundary when possible.
+// A limit of 0 or less leaves the text as it is.
+func Truncate(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+
+	cut := string(runes[:limit])
+	if i := strings.LastIndex(cut, " "); i > 0 && runes[limit] != ' ' {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:-")
+}
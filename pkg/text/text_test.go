@@ -0,0 +1,16 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", Truncate(" short ", 10))
+	assert.Equal(t, "hello", Truncate("hello world", 8))
+	assert.Equal(t, "hello", Truncate("hello world", 5))
+	assert.Equal(t, "supercalif", Truncate("supercalifragilistic", 10))
+	assert.Equal(t, "Привет", Truncate("Привет мир", 8), "limits count characters, not bytes")
+	assert.Equal(t, "a dog on the beach", Truncate("a dog on the beach", 0), "no limit")
+}
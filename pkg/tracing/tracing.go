@@ -0,0 +1,214 @@
+// Package tracing carries distributed trace context through RabbitMQ message headers.
+//
+// Services start spans through StartSpan and move their context in and out of message headers
+// with Inject and Extract. The default tracer propagates W3C trace context without reporting
+// spans, so a trace continues through services that have no tracing backend; services that
+// report spans, e.g. to Datadog, install their own Tracer with SetTracer.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// W3C trace context headers
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+// ErrInvalidTraceparent is returned for a malformed traceparent header
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// Span is a unit of work within a trace
+type Span interface {
+	// SetTag annotates the span
+	SetTag(key string, value interface{})
+	// Finish ends the span, marking it failed when err is not nil
+	Finish(err error)
+}
+
+// Tracer starts spans and moves their context in and out of message headers
+type Tracer interface {
+	// StartSpan starts a span named operation, child of the span or remote context in ctx
+	StartSpan(ctx context.Context, operation string) (Span, context.Context)
+	// Inject writes the trace context of ctx to headers
+	Inject(ctx context.Context, headers map[string]interface{})
+	// Extract returns ctx carrying the trace context read from headers
+	Extract(ctx context.Context, headers map[string]interface{}) context.Context
+}
+
+var (
+	mu     sync.RWMutex
+	global Tracer = W3CTracer{}
+)
+
+// SetTracer installs the tracer used by the package functions
+func SetTracer(tracer Tracer) {
+	mu.Lock()
+	defer mu.Unlock()
+	global = tracer
+}
+
+func current() Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return global
+}
+
+// StartSpan starts a span named operation with the installed tracer
+func StartSpan(ctx context.Context, operation string) (Span, context.Context) {
+	return current().StartSpan(ctx, operation)
+}
+
+// Inject writes the trace context of ctx to headers with the installed tracer
+func Inject(ctx context.Context, headers map[string]interface{}) {
+	current().Inject(ctx, headers)
+}
+
+// Extract returns ctx carrying the trace context read from headers with the installed tracer
+func Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	return current().Extract(ctx, headers)
+}
+
+// Headers returns new message headers carrying the trace context of ctx
+func Headers(ctx context.Context) map[string]interface{} {
+	headers := make(map[string]interface{})
+	Inject(ctx, headers)
+	return headers
+}
+
+// SpanContext identifies a span of a W3C trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether the trace and span IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the span context as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrInvalidTraceparent
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns ctx carrying sc as the current span context
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// HeaderString returns a header value as a string; AMQP headers may hold strings or bytes
+func HeaderString(headers map[string]interface{}, key string) string {
+	switch value := headers[key].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return ""
+	}
+}
+
+// W3CTracer propagates W3C trace context without reporting spans
+type W3CTracer struct{}
+
+// StartSpan starts a span in the trace of ctx, or a new sampled trace
+func (W3CTracer) StartSpan(ctx context.Context, _ string) (Span, context.Context) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		sc = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	sc.SpanID = newSpanID()
+	return noopSpan{}, ContextWithSpanContext(ctx, sc)
+}
+
+// Inject writes the traceparent of the span context in ctx
+func (W3CTracer) Inject(ctx context.Context, headers map[string]interface{}) {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		headers[HeaderTraceparent] = sc.Traceparent()
+	}
+}
+
+// Extract reads the traceparent header; an invalid header starts no trace
+func (W3CTracer) Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	sc, err := ParseTraceparent(HeaderString(headers, HeaderTraceparent))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// noopSpan is a span that is not reported
+type noopSpan struct{}
+
+func (noopSpan) SetTag(string, interface{}) {}
+func (noopSpan) Finish(error)               {}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	for id == [16]byte{} {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	for id == [8]byte{} {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(sampleTraceparent)
+	require.NoError(t, err)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, sampleTraceparent, sc.Traceparent())
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(header)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, header)
+	}
+
+	// Later versions may append fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.NoError(t, err)
+}
+
+func TestW3CTracer_ContinuesExtractedTrace(t *testing.T) {
+	tracer := W3CTracer{}
+
+	ctx := tracer.Extract(context.Background(), map[string]interface{}{HeaderTraceparent: []byte(sampleTraceparent)})
+	_, ctx = tracer.StartSpan(ctx, "consume")
+
+	headers := map[string]interface{}{}
+	tracer.Inject(ctx, headers)
+
+	sc, err := ParseTraceparent(HeaderString(headers, HeaderTraceparent))
+	require.NoError(t, err)
+	parent, _ := ParseTraceparent(sampleTraceparent)
+	assert.Equal(t, parent.TraceID, sc.TraceID, "the trace continues")
+	assert.NotEqual(t, parent.SpanID, sc.SpanID, "the published message is a child of the new span")
+}
+
+func TestW3CTracer_StartsNewTrace(t *testing.T) {
+	tracer := W3CTracer{}
+
+	ctx := tracer.Extract(context.Background(), map[string]interface{}{HeaderTraceparent: "garbage"})
+	_, noTrace := SpanContextFromContext(ctx)
+	assert.False(t, noTrace)
+
+	_, ctx = tracer.StartSpan(ctx, "telegram.update")
+	sc, ok := SpanContextFromContext(ctx)
+	require.True(t, ok)
+	assert.True(t, sc.Sampled)
+
+	headers := map[string]interface{}{}
+	tracer.Inject(context.Background(), headers)
+	assert.Empty(t, headers, "nothing is injected without a span")
+}
+
+func TestHeaders_UsesInstalledTracer(t *testing.T) {
+	defer SetTracer(W3CTracer{})
+
+	SetTracer(stubTracer{})
+	assert.Equal(t, map[string]interface{}{"x-stub": "1"}, Headers(context.Background()))
+}
+
+type stubTracer struct{ W3CTracer }
+
+func (stubTracer) Inject(_ context.Context, headers map[string]interface{}) {
+	headers["x-stub"] = "1"
+}
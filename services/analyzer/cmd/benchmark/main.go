@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/api/openrouter"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/benchmark"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/config"
+)
+
+func main() {
+	cfg := config.New()
+
+	goldenDir := flag.String("golden", "testdata/golden", "directory with golden.json and reference images")
+	models := flag.String("models", cfg.OpenRouter.Model, "comma-separated list of candidate model IDs")
+	output := flag.String("output", "model_ranking.json", "path to write the model ranking")
+	prompt := flag.String("prompt", cfg.OpenRouter.Prompt, "prompt used for every model")
+	baseURL := flag.String("base-url", cfg.OpenRouter.BaseURL, "OpenRouter-compatible API base URL")
+	apiKey := flag.String("api-key", cfg.OpenRouter.APIKey, "OpenRouter API key")
+	timeout := flag.Duration("timeout", 60*time.Second, "timeout per image request")
+	fake := flag.Bool("fake", false, "run against a local fake provider instead of OpenRouter")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	images, err := benchmark.LoadGoldenSet(*goldenDir)
+	if err != nil {
+		log.Fatalf("Failed to load golden set: %v", err)
+	}
+
+	modelIDs := splitModels(*models)
+	if *fake {
+		fakeModels := fakeModels(images)
+		server := httptest.NewServer(benchmark.NewFakeProvider(fakeModels))
+		defer server.Close()
+
+		*baseURL = server.URL
+		modelIDs = modelIDs[:0]
+		for id := range fakeModels {
+			modelIDs = append(modelIDs, id)
+		}
+	}
+	if len(modelIDs) == 0 {
+		log.Fatalf("No models to benchmark")
+	}
+
+	newAnalyzer := func(modelID string) benchmark.Analyzer {
+		client := openrouter.NewClient(*apiKey, modelID, cfg.OpenRouter.MaxTokens, cfg.OpenRouter.Temperature, *prompt, logger)
+		client.SetBaseURL(*baseURL)
+		return client
+	}
+
+	runner := benchmark.NewRunner(images, newAnalyzer, *timeout, logger)
+	ranking := &benchmark.Ranking{
+		GeneratedAt: time.Now().UTC(),
+		GoldenSet:   *goldenDir,
+		Models:      runner.Run(context.Background(), modelIDs),
+	}
+
+	if err := ranking.Save(*output); err != nil {
+		log.Fatalf("Failed to save ranking: %v", err)
+	}
+
+	for _, result := range ranking.Models {
+		log.Printf("#%d %s score=%.3f precision=%.3f recall=%.3f json_validity=%.2f avg_latency=%dms p95_latency=%dms",
+			result.Rank, result.Model, result.Score, result.Precision, result.Recall,
+			result.JSONValidityRate, result.AvgLatencyMs, result.P95LatencyMs)
+	}
+	log.Printf("Ranking written to %s", *output)
+}
+
+// splitModels parses a comma-separated list of model IDs
+func splitModels(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// fakeModels builds canned models for a dry run of the benchmark pipeline
+func fakeModels(images []benchmark.GoldenImage) map[string]benchmark.FakeModel {
+	keywords := images[0].Keywords
+
+	return map[string]benchmark.FakeModel{
+		"fake/accurate": {Title: "Accurate", Keywords: keywords, Latency: 50 * time.Millisecond},
+		"fake/noisy":    {Title: "Noisy", Keywords: append([]string{"noise", "random"}, keywords[:len(keywords)/2+1]...)},
+		"fake/broken":   {InvalidJSON: true},
+	}
+}
@@ -9,7 +9,6 @@ replace gopkg.in/DataDog/dd-trace-go.v1 => github.com/DataDog/dd-trace-go v1.68.
 require github.com/shabohin/photo-tags/pkg v0.0.0
 
 require (
-	github.com/DataDog/datadog-go/v5 v5.5.0
 	github.com/DataDog/dd-trace-go v1.68.0
 	github.com/eduardolat/openroutergo v0.1.0
 	github.com/minio/minio-go/v7 v7.0.87
@@ -19,6 +18,7 @@ require (
 )
 
 require (
+	github.com/DataDog/datadog-go/v5 v5.5.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/disintegration/imaging v1.6.2 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -27,6 +27,7 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
+	github.com/lib/pq v1.10.9 // indirect
 	github.com/minio/crc64nvme v1.0.1 // indirect
 	github.com/minio/md5-simd v1.1.2 // indirect
 	github.com/orsinium-labs/enum v1.4.0 // indirect
@@ -0,0 +1,33 @@
+// Package alttext requests and limits the short accessibility description of an image
+package alttext
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shabohin/photo-tags/pkg/text"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// MaxLength is the alt text limit in characters recommended for screen readers
+const MaxLength = 125
+
+// Prompt appends the alt text instruction to a prompt
+func Prompt(prompt string) string {
+	return fmt.Sprintf(
+		"%s Also return 'alt_text': a plain description of what the image shows for screen readers, "+
+			"at most %d characters, without keywords and different from the description.",
+		strings.TrimSpace(prompt), MaxLength,
+	)
+}
+
+// Apply limits the alt text to MaxLength characters. Without alt text from the model
+// the title is used, since it is short and describes the subject.
+func Apply(metadata model.Metadata) model.Metadata {
+	altText := strings.Join(strings.Fields(metadata.AltText), " ")
+	if altText == "" {
+		altText = strings.Join(strings.Fields(metadata.Title), " ")
+	}
+	metadata.AltText = text.Truncate(altText, MaxLength)
+	return metadata
+}
@@ -0,0 +1,36 @@
+package alttext
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+func TestApply(t *testing.T) {
+	metadata := Apply(model.Metadata{Title: "Dog", AltText: "  Brown dog\n running on a beach "})
+	assert.Equal(t, "Brown dog running on a beach", metadata.AltText)
+	assert.Equal(t, "Dog", metadata.Title)
+}
+
+func TestApply_FallsBackToTitle(t *testing.T) {
+	metadata := Apply(model.Metadata{Title: "Dog on the beach", Description: "A long description"})
+	assert.Equal(t, "Dog on the beach", metadata.AltText)
+}
+
+func TestApply_LimitsLength(t *testing.T) {
+	long := strings.Repeat("мокрый песок, ", 20)
+
+	metadata := Apply(model.Metadata{AltText: long})
+	assert.LessOrEqual(t, utf8.RuneCountInString(metadata.AltText), MaxLength)
+	assert.True(t, strings.HasSuffix(metadata.AltText, "песок"), "cut at a word boundary: %q", metadata.AltText)
+}
+
+func TestPrompt(t *testing.T) {
+	prompt := Prompt("Describe the image. ")
+	assert.True(t, strings.HasPrefix(prompt, "Describe the image. Also return 'alt_text'"))
+	assert.Contains(t, prompt, "125 characters")
+}
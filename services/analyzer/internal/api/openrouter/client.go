@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,8 +16,9 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
-	"github.com/shabohin/photo-tags/services/analyzer/internal/monitoring"
 )
 
 type OpenRouterClient interface {
@@ -27,8 +29,9 @@ type OpenRouterClient interface {
 
 const (
 	defaultTimeout     = 60 * time.Second
-	apiURL             = "https://openrouter.ai/api/v1/chat/completions"
-	modelsURL          = "https://openrouter.ai/api/v1/models"
+	defaultBaseURL     = "https://openrouter.ai/api/v1"
+	chatCompletionPath = "/chat/completions"
+	modelsPath         = "/models"
 	maxRetries         = 3
 	initialRetryDelay  = 2 * time.Second
 	rateLimitResetWait = 5 * time.Second
@@ -38,11 +41,12 @@ type Client struct {
 	httpClient  *http.Client
 	logger      *logrus.Logger
 	apiKey      string
+	baseURL     string
 	model       string
 	prompt      string
 	temperature float64
 	maxTokens   int
-	metrics     *monitoring.Metrics
+	metrics     *metrics.Metrics
 }
 
 type OpenRouterRequest struct {
@@ -80,9 +84,13 @@ type Choice struct {
 }
 
 type MetadataResponse struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Keywords    []string `json:"keywords"`
+	Title                  string   `json:"title"`
+	Description            string   `json:"description"`
+	Keywords               []string `json:"keywords"`
+	HierarchicalKeywords   []string `json:"hierarchical_keywords,omitempty"`
+	Category               string   `json:"category,omitempty"`
+	SupplementalCategories []string `json:"supplemental_categories,omitempty"`
+	AltText                string   `json:"alt_text,omitempty"`
 }
 
 // Model represents an OpenRouter model
@@ -137,6 +145,12 @@ func (e *RateLimitError) Error() string {
 	return fmt.Sprintf("rate limit exceeded: %s, retry after %v", e.Message, e.RetryAfter)
 }
 
+// IsRateLimitError reports whether err is or wraps a RateLimitError
+func IsRateLimitError(err error) bool {
+	var rateLimitErr *RateLimitError
+	return errors.As(err, &rateLimitErr)
+}
+
 func NewClient(
 	apiKey string,
 	modelName string,
@@ -147,6 +161,7 @@ func NewClient(
 ) *Client {
 	return &Client{
 		apiKey:      apiKey,
+		baseURL:     defaultBaseURL,
 		model:       modelName,
 		maxTokens:   maxTokens,
 		temperature: temperature,
@@ -155,11 +170,26 @@ func NewClient(
 			Timeout: defaultTimeout,
 		},
 		logger:  logger,
-		metrics: monitoring.NewMetrics(),
+		metrics: metrics.New(),
 	}
 }
 
+// SetBaseURL overrides the OpenRouter API base URL, e.g. to use a compatible or fake provider
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// AnalyzeImage generates metadata for an image in an "openrouter.analyze" span
 func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error) {
+	span, ctx := tracing.StartSpan(ctx, "openrouter.analyze")
+	span.SetTag("model", c.model)
+	span.SetTag("trace_id", traceID)
+	metadata, err := c.analyzeImage(ctx, imageBytes, traceID)
+	span.Finish(err)
+	return metadata, err
+}
+
+func (c *Client) analyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error) {
 	startTime := time.Now()
 	c.metrics.Incr("openrouter.analyze_image.requests", []string{})
 
@@ -200,7 +230,7 @@ func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID st
 		return model.Metadata{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(requestJSON))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+chatCompletionPath, bytes.NewBuffer(requestJSON))
 	if err != nil {
 		c.logger.WithFields(logrus.Fields{
 			"trace_id": traceID,
@@ -262,6 +292,11 @@ func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID st
 				retryAfter = rateLimitResetWait
 			}
 
+			// Out of attempts: report the rate limit, so the analyzer lowers its concurrency
+			if attempt == maxRetries-1 {
+				return model.Metadata{}, &RateLimitError{RetryAfter: retryAfter, Message: resp.Status}
+			}
+
 			c.logger.WithFields(logrus.Fields{
 				"trace_id":    traceID,
 				"retry_after": retryAfter,
@@ -364,7 +399,8 @@ func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID st
 			"content":  content,
 			"error":    err.Error(),
 		}).Error("Failed to parse metadata from response")
-		return model.Metadata{}, fmt.Errorf("failed to parse metadata: %w", err)
+		c.metrics.Incr("openrouter.analyze_image.errors", []string{"error:parse_failed"})
+		return model.Metadata{}, fmt.Errorf("%w: %v", model.ErrMetadataParse, err)
 	}
 
 	// Record successful analysis
@@ -374,9 +410,13 @@ func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID st
 	c.metrics.Histogram("openrouter.metadata.keywords_count", float64(len(metadataResp.Keywords)), []string{})
 
 	return model.Metadata{
-		Title:       metadataResp.Title,
-		Description: metadataResp.Description,
-		Keywords:    metadataResp.Keywords,
+		Title:                  metadataResp.Title,
+		Description:            metadataResp.Description,
+		Keywords:               metadataResp.Keywords,
+		HierarchicalKeywords:   metadataResp.HierarchicalKeywords,
+		Category:               metadataResp.Category,
+		SupplementalCategories: metadataResp.SupplementalCategories,
+		AltText:                metadataResp.AltText,
 	}, nil
 }
 
@@ -384,7 +424,7 @@ func (c *Client) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID st
 func (c *Client) GetAvailableModels(ctx context.Context) ([]Model, error) {
 	c.metrics.Incr("openrouter.get_models.requests", []string{})
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, modelsURL, http.NoBody)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+modelsPath, http.NoBody)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to create models request")
 		return nil, fmt.Errorf("failed to create models request: %w", err)
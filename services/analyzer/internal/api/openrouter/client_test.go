@@ -3,9 +3,12 @@ package openrouter
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -321,3 +324,11 @@ func TestSelectBestFreeVisionModel_NoFreeModels(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no free vision models available")
 }
+
+func TestIsRateLimitError(t *testing.T) {
+	err := fmt.Errorf("image analysis failed: %w", &RateLimitError{RetryAfter: time.Second, Message: "429 Too Many Requests"})
+
+	assert.True(t, IsRateLimitError(err))
+	assert.False(t, IsRateLimitError(errors.New("server error")))
+	assert.False(t, IsRateLimitError(nil))
+}
@@ -63,7 +63,7 @@ func (a *OpenRouterGoAdapter) AnalyzeImage(
 	var metadata model.Metadata
 	err = json.Unmarshal([]byte(content), &metadata)
 	if err != nil {
-		return model.Metadata{}, fmt.Errorf("failed to parse metadata: %w", err)
+		return model.Metadata{}, fmt.Errorf("%w: %v", model.ErrMetadataParse, err)
 	}
 
 	return metadata, nil
@@ -2,18 +2,31 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/idempotency"
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/alttext"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/api/openrouter"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/benchmark"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/cache"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/category"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/config"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/consensus"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/service"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/experiment"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/handler"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/keywords"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/limiter"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/monitoring"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/selector"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/storage/minio"
@@ -26,8 +39,11 @@ type App struct {
 	publisher     *rabbitmq.Publisher
 	minioClient   *minio.Client
 	processor     *service.MessageProcessorService
+	ledger        *idempotency.Ledger
 	modelSelector *selector.ModelSelector
+	dbClient      *database.Client
 	httpHandler   *handler.Handler
+	limiter       *limiter.Limiter
 	logger        *logrus.Logger
 	shutdownWg    sync.WaitGroup
 	workerCount   int
@@ -39,14 +55,23 @@ func New(cfg *config.Config) (*App, error) {
 
 	logger.Info("Initializing Analyzer Service")
 
-	// Initialize Datadog monitoring
+	// Initialize Datadog tracing
 	if err := monitoring.Init("analyzer", "v1.0.0"); err != nil {
-		logger.WithError(err).Error("Failed to initialize Datadog monitoring")
+		logger.WithError(err).Error("Failed to initialize Datadog tracing")
 		// Continue anyway as monitoring is optional
 	} else if monitoring.IsEnabled() {
-		logger.Info("Datadog monitoring initialized successfully")
+		logger.Info("Datadog tracing initialized successfully")
 	} else {
-		logger.Info("Datadog monitoring disabled (DD_API_KEY not set)")
+		logger.Info("Datadog tracing disabled (DD_API_KEY not set)")
+	}
+
+	// Initialize metrics
+	metricsCfg := metrics.ConfigFromEnv("analyzer", "v1.0.0")
+	if _, err := metrics.Init(metricsCfg); err != nil {
+		logger.WithError(err).Error("Failed to initialize metrics")
+		// Continue anyway as metrics are optional
+	} else {
+		logger.WithField("backend", metricsCfg.Backend).Info("Metrics initialized")
 	}
 
 	// Initialize MinIO client
@@ -65,25 +90,12 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
-	var openRouterClient openrouter.OpenRouterClient
-	if cfg.OpenRouter.UseOpenRouterGoAdapter {
-		openRouterClient = openrouter.NewOpenRouterGoAdapter(
-			cfg.OpenRouter.APIKey,
-			cfg.OpenRouter.Model,
-			cfg.OpenRouter.Prompt,
-			cfg.OpenRouter.Temperature,
-			cfg.OpenRouter.MaxTokens,
-		)
-	} else {
-		openRouterClient = openrouter.NewClient(
-			cfg.OpenRouter.APIKey,
-			cfg.OpenRouter.Model,
-			cfg.OpenRouter.MaxTokens,
-			cfg.OpenRouter.Temperature,
-			cfg.OpenRouter.Prompt,
-			logger,
-		)
-	}
+	// Ask for alt text and a category from the configured list alongside the title and keywords
+	categories := category.NewClassifier(cfg.Categories.List)
+	prompt := alttext.Prompt(categories.Prompt(cfg.OpenRouter.Prompt))
+	experimentPrompt := alttext.Prompt(categories.Prompt(cfg.Experiment.Prompt))
+
+	openRouterClient := newOpenRouterClient(cfg, cfg.OpenRouter.Model, prompt, logger)
 
 	// Initialize Model Selector for automatic model selection
 	modelSelector := selector.NewModelSelector(
@@ -93,6 +105,17 @@ func New(cfg *config.Config) (*App, error) {
 		cfg.OpenRouter.Model, // fallback model
 	)
 
+	// Prefer models in the order ranked by the benchmark command
+	if cfg.OpenRouter.ModelRankingFile != "" {
+		ranking, err := benchmark.LoadRanking(cfg.OpenRouter.ModelRankingFile)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to load model ranking, using automatic model selection")
+		} else {
+			modelSelector.SetPreferredModels(ranking.ModelIDs())
+			logger.WithField("models", ranking.ModelIDs()).Info("Loaded model ranking")
+		}
+	}
+
 	// Initialize RabbitMQ publisher
 	publisher, err := rabbitmq.NewPublisher(
 		cfg.RabbitMQ.URL,
@@ -106,23 +129,99 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
+	// Query several models and merge their metadata by vote if consensus mode is enabled
+	var analyzerClient service.OpenRouterClientInterface = openRouterClient
+	analyzerModel := cfg.OpenRouter.Model
+	if cfg.Consensus.Enabled && len(cfg.Consensus.Models) > 0 {
+		members := make([]consensus.Member, 0, len(cfg.Consensus.Models))
+		for _, modelID := range cfg.Consensus.Models {
+			members = append(members, consensus.Member{
+				Model:    modelID,
+				Analyzer: newOpenRouterClient(cfg, modelID, prompt, logger),
+			})
+		}
+		analyzerClient = consensus.NewConsensus(members, cfg.Consensus.MinAgreement, logger)
+		analyzerModel = "consensus:" + strings.Join(cfg.Consensus.Models, ",")
+		logger.WithFields(logrus.Fields{
+			"models":        cfg.Consensus.Models,
+			"min_agreement": cfg.Consensus.MinAgreement,
+		}).Info("Consensus mode enabled")
+	}
+
 	// Initialize image analyzer service
-	imageAnalyzer := service.NewImageAnalyzer(minioClient, openRouterClient, logger)
+	imageAnalyzer := service.NewImageAnalyzer(minioClient, analyzerClient, logger)
+
+	// Initialize metadata cache if enabled
+	var dbClient *database.Client
+	if cfg.Cache.Enabled {
+		dbClient, err = newDatabaseClient(cfg)
+		if err != nil {
+			logger.WithError(err).Error("Failed to initialize metadata cache, continuing without it")
+		} else {
+			metadataCache := cache.NewMetadataCache(
+				database.NewRepository(dbClient),
+				cfg.Cache.TTL,
+				cfg.Cache.MaxHammingDistance,
+				cfg.Cache.Bypass,
+				logger,
+			)
+			imageAnalyzer.SetMetadataCache(
+				metadataCache,
+				promptVersion(cfg, analyzerModel, prompt),
+				analyzerModel,
+			)
+			logger.WithFields(logrus.Fields{
+				"ttl":    cfg.Cache.TTL,
+				"bypass": cfg.Cache.Bypass,
+			}).Info("Metadata cache enabled")
+		}
+	}
 
 	// Initialize message processor
 	processor := service.NewMessageProcessor(
 		imageAnalyzer,
 		publisher,
 		logger,
-		cfg.Worker.MaxRetries,
-		cfg.Worker.RetryDelay,
 	)
 
+	// Normalize keywords and map them to the controlled vocabulary
+	if cfg.Keywords.Normalize {
+		processor.SetKeywordNormalizer(newKeywordNormalizer(cfg, logger))
+	}
+
+	// Keep only categories from the configured list
+	if len(categories.Categories()) > 0 {
+		processor.SetCategoryClassifier(categories)
+	}
+
+	// Route a share of traffic to the experiment variant if configured
+	if cfg.Experiment.Enabled {
+		control := experiment.Variant{
+			ID:            experiment.ControlVariantID,
+			Model:         analyzerModel,
+			PromptVersion: promptVersion(cfg, analyzerModel, prompt),
+			Analyzer:      analyzerClient,
+		}
+		candidate := &experiment.Variant{
+			ID:            cfg.Experiment.VariantID,
+			Model:         cfg.Experiment.Model,
+			PromptVersion: cache.PromptVersion(cfg.Experiment.Model, experimentPrompt),
+			Analyzer:      newOpenRouterClient(cfg, cfg.Experiment.Model, experimentPrompt, logger),
+		}
+		processor.SetExperimentRouter(experiment.NewRouter(control, candidate, cfg.Experiment.TrafficPercent, logger))
+		logger.WithFields(logrus.Fields{
+			"variant_id":      cfg.Experiment.VariantID,
+			"variant_model":   cfg.Experiment.Model,
+			"traffic_percent": cfg.Experiment.TrafficPercent,
+		}).Info("Experiment routing enabled")
+	}
+
 	// Initialize RabbitMQ consumer
 	consumer, err := rabbitmq.NewConsumer(
 		cfg.RabbitMQ.URL,
 		cfg.RabbitMQ.ConsumerQueue,
 		cfg.RabbitMQ.PrefetchCount,
+		cfg.RabbitMQ.LaneWeights,
 		cfg.RabbitMQ.ReconnectAttempts,
 		cfg.RabbitMQ.ReconnectDelay,
 		logger,
@@ -131,10 +230,35 @@ func New(cfg *config.Config) (*App, error) {
 		if closeErr := publisher.Close(); closeErr != nil {
 			logger.WithError(closeErr).Error("Failed to close publisher during cleanup")
 		}
+		if dbClient != nil {
+			if closeErr := database.Close(dbClient); closeErr != nil {
+				logger.WithError(closeErr).Error("Failed to close database during cleanup")
+			}
+		}
 		logger.WithError(err).Error("Failed to initialize RabbitMQ consumer")
 		return nil, err
 	}
 
+	// Adapt the number of concurrent analyses to latency and rate limits; every worker holds one
+	// unacked message, so the channel prefetch follows the limit
+	concurrency := limiter.NewLimiter(limiter.Config{
+		Initial:       cfg.Worker.Concurrency,
+		Min:           cfg.Worker.MinConcurrency,
+		Max:           max(cfg.Worker.MaxConcurrency, cfg.Worker.Concurrency),
+		LatencyTarget: cfg.Worker.LatencyTarget,
+		Backoff:       cfg.Worker.ConcurrencyBackoff,
+		IsRateLimited: openrouter.IsRateLimitError,
+	}, logger)
+	if err := consumer.SetChannelPrefetch(concurrency.Limit()); err != nil {
+		logger.WithError(err).Error("Failed to set channel prefetch")
+	}
+	concurrency.OnChange(func(limit int) {
+		if err := consumer.SetChannelPrefetch(limit); err != nil {
+			logger.WithError(err).Error("Failed to set channel prefetch")
+		}
+	})
+	_, maxConcurrency := concurrency.Bounds()
+
 	// Initialize HTTP handler for health checks
 	httpHandler := handler.NewHandler(
 		logger,
@@ -142,23 +266,120 @@ func New(cfg *config.Config) (*App, error) {
 		consumer,
 		publisher,
 		minioClient,
-		cfg.Worker.Concurrency,
+		maxConcurrency,
 	)
+	httpHandler.SetLimiter(concurrency)
+
+	// Skip redelivered uploads that were already analyzed; the ledger is shared through
+	// PostgreSQL when the metadata cache database is available
+	var ledgerStore idempotency.Store = idempotency.NewMemoryStore(idempotency.DefaultCapacity)
+	if dbClient != nil {
+		ledgerStore = database.NewRepository(dbClient)
+	}
 
 	return &App{
 		consumer:      consumer,
 		publisher:     publisher,
 		minioClient:   minioClient,
 		processor:     processor,
+		ledger:        idempotency.NewLedger(ledgerStore, "analyzer"),
 		modelSelector: modelSelector,
+		dbClient:      dbClient,
 		httpHandler:   httpHandler,
+		limiter:       concurrency,
 		logger:        logger,
-		workerCount:   cfg.Worker.Concurrency,
+		workerCount:   maxConcurrency,
 		shutdown:      make(chan struct{}),
 		cfg:           cfg,
 	}, nil
 }
 
+// newDatabaseClient connects to PostgreSQL and ensures the metadata cache and ledger schemas exist
+func newDatabaseClient(cfg *config.Config) (*database.Client, error) {
+	dbClient, err := database.NewClient(database.Config{
+		Host:     cfg.Postgres.Host,
+		Port:     cfg.Postgres.Port,
+		Database: cfg.Postgres.DB,
+		User:     cfg.Postgres.User,
+		Password: cfg.Postgres.Password,
+		SSLMode:  cfg.Postgres.SSLMode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := []string{
+		database.MetadataCacheSchema,
+		database.ProcessedMessagesSchema,
+		database.ProcessedMessageClaimsSchema,
+	}
+	for _, schema := range schemas {
+		if err := dbClient.RunMigrations(context.Background(), schema); err != nil {
+			_ = database.Close(dbClient)
+			return nil, err
+		}
+	}
+
+	return dbClient, nil
+}
+
+// promptVersion returns the configured cache prompt version or derives one from the model and prompt
+func promptVersion(cfg *config.Config, modelName, prompt string) string {
+	if cfg.Cache.PromptVersion != "" {
+		return cfg.Cache.PromptVersion
+	}
+	return cache.PromptVersion(modelName, prompt)
+}
+
+// newKeywordNormalizer creates the keyword normalizer, loading the controlled vocabulary if configured
+func newKeywordNormalizer(cfg *config.Config, logger *logrus.Logger) *keywords.Normalizer {
+	opts := keywords.Options{
+		StopWords: cfg.Keywords.StopWords,
+		MaxLength: cfg.Keywords.MaxLength,
+		Strict:    cfg.Keywords.Strict,
+	}
+
+	if cfg.Keywords.VocabularyFile != "" {
+		vocabulary, err := keywords.LoadVocabulary(cfg.Keywords.VocabularyFile)
+		if err != nil {
+			logger.WithError(err).Error("Failed to load keyword vocabulary, continuing without it")
+		} else {
+			opts.Vocabulary = vocabulary
+			logger.WithFields(logrus.Fields{
+				"file":   cfg.Keywords.VocabularyFile,
+				"terms":  vocabulary.Len(),
+				"strict": cfg.Keywords.Strict,
+			}).Info("Keyword vocabulary loaded")
+		}
+	}
+
+	return keywords.NewNormalizer(opts)
+}
+
+// newOpenRouterClient creates an OpenRouter client for the given model and prompt
+func newOpenRouterClient(cfg *config.Config, modelName, prompt string, logger *logrus.Logger) openrouter.OpenRouterClient {
+	if cfg.OpenRouter.UseOpenRouterGoAdapter {
+		return openrouter.NewOpenRouterGoAdapter(
+			cfg.OpenRouter.APIKey,
+			modelName,
+			prompt,
+			cfg.OpenRouter.Temperature,
+			cfg.OpenRouter.MaxTokens,
+		)
+	}
+
+	client := openrouter.NewClient(
+		cfg.OpenRouter.APIKey,
+		modelName,
+		cfg.OpenRouter.MaxTokens,
+		cfg.OpenRouter.Temperature,
+		prompt,
+		logger,
+	)
+	client.SetBaseURL(cfg.OpenRouter.BaseURL)
+	return client
+}
+
 func (a *App) Start() error {
 	a.logger.WithField("worker_count", a.workerCount).Info("Starting workers")
 
@@ -184,6 +405,11 @@ func (a *App) Start() error {
 		close(a.shutdown)
 	}()
 
+	// Forget processed messages after the retention period
+	if a.dbClient != nil {
+		go idempotency.Prune(ctx, database.NewRepository(a.dbClient), time.Hour)
+	}
+
 	// Start workers
 	for i := 0; i < a.workerCount; i++ {
 		workerID := i
@@ -214,15 +440,27 @@ func (a *App) startWorker(ctx context.Context, id int) {
 	logger.Info("Worker started")
 
 	// Define message handler function
-	handler := func(message []byte) error {
-		processingCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-		defer cancel()
+	handler := func(msgCtx context.Context, message []byte) error {
+		duplicate, err := a.ledger.Process(msgCtx, idempotency.TraceID(message), func() error {
+			// Waiting for a slot does not count against the analysis deadline
+			token, err := a.limiter.Acquire(msgCtx)
+			if err != nil {
+				return fmt.Errorf("%w: %v", rabbitmq.ErrNotAttempted, err)
+			}
 
-		err := a.processor.Process(processingCtx, message)
+			processingCtx, cancel := context.WithTimeout(msgCtx, 2*time.Minute)
+			defer cancel()
+			err = a.processor.Process(processingCtx, message)
+			a.limiter.Release(token, err)
+			return err
+		})
 		if err != nil {
 			logger.WithError(err).Error("Message processing failed")
 			return err
 		}
+		if duplicate {
+			logger.WithField("trace_id", idempotency.TraceID(message)).Info("Skipping already processed message")
+		}
 		return nil
 	}
 
@@ -263,8 +501,17 @@ func (a *App) Shutdown() {
 		a.logger.WithError(err).Error("Error closing publisher")
 	}
 
-	// Stop Datadog monitoring
+	if a.dbClient != nil {
+		if err := database.Close(a.dbClient); err != nil {
+			a.logger.WithError(err).Error("Error closing database")
+		}
+	}
+
+	// Stop Datadog tracing and flush metrics
 	monitoring.Stop()
+	if err := metrics.Stop(); err != nil {
+		a.logger.WithError(err).Error("Error flushing metrics")
+	}
 
 	a.logger.Info("Application shutdown complete")
 }
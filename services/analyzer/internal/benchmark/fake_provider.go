@@ -0,0 +1,99 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FakeModel describes the canned behaviour of a model served by FakeProvider
+type FakeModel struct {
+	Title       string
+	Description string
+	Keywords    []string
+	Latency     time.Duration
+	InvalidJSON bool
+}
+
+// FakeProvider is an OpenRouter-compatible HTTP handler returning canned responses.
+// It lets the benchmark run locally without network access or API costs.
+type FakeProvider struct {
+	models map[string]FakeModel
+}
+
+// NewFakeProvider creates a new FakeProvider serving the given models
+func NewFakeProvider(models map[string]FakeModel) *FakeProvider {
+	return &FakeProvider{models: models}
+}
+
+// ServeHTTP implements http.Handler
+func (p *FakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/models"):
+		p.serveModels(w)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		p.serveCompletion(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *FakeProvider) serveModels(w http.ResponseWriter) {
+	data := make([]map[string]interface{}, 0, len(p.models))
+	for id := range p.models {
+		data = append(data, map[string]interface{}{
+			"id":      id,
+			"name":    id,
+			"pricing": map[string]string{"prompt": "0", "completion": "0"},
+			"architecture": map[string]string{
+				"modality": "text+image->text",
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (p *FakeProvider) serveCompletion(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	fake, ok := p.models[req.Model]
+	if !ok {
+		http.Error(w, `{"error":"unknown model"}`, http.StatusNotFound)
+		return
+	}
+
+	if fake.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(fake.Latency):
+		}
+	}
+
+	content := "I cannot describe this image."
+	if !fake.InvalidJSON {
+		metadata, _ := json.Marshal(map[string]interface{}{
+			"title":       fake.Title,
+			"description": fake.Description,
+			"keywords":    fake.Keywords,
+		})
+		content = string(metadata)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id": "fake-" + req.Model,
+		"choices": []map[string]interface{}{
+			{"message": map[string]string{"role": "assistant", "content": content}},
+		},
+	})
+}
@@ -0,0 +1,49 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ManifestFile is the name of the golden set manifest inside the image directory
+const ManifestFile = "golden.json"
+
+// GoldenImage is a reference image with the keywords a good model is expected to produce
+type GoldenImage struct {
+	File     string   `json:"file"`
+	Keywords []string `json:"keywords"`
+	Data     []byte   `json:"-"`
+}
+
+// LoadGoldenSet reads the manifest and reference images from dir
+func LoadGoldenSet(dir string) ([]GoldenImage, error) {
+	manifest, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var images []GoldenImage
+	if err := json.Unmarshal(manifest, &images); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("golden set %s is empty", dir)
+	}
+
+	for i := range images {
+		if len(images[i].Keywords) == 0 {
+			return nil, fmt.Errorf("image %s has no expected keywords", images[i].File)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, images[i].File))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %s: %w", images[i].File, err)
+		}
+		images[i].Data = data
+	}
+
+	return images, nil
+}
@@ -0,0 +1,71 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ModelResult holds the benchmark scores of a single model
+type ModelResult struct {
+	Model            string  `json:"model"`
+	Rank             int     `json:"rank"`
+	Score            float64 `json:"score"`
+	Precision        float64 `json:"precision"`
+	Recall           float64 `json:"recall"`
+	F1               float64 `json:"f1"`
+	JSONValidityRate float64 `json:"json_validity_rate"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+	P95LatencyMs     int64   `json:"p95_latency_ms"`
+	Images           int     `json:"images"`
+	ParseFailures    int     `json:"parse_failures"`
+	Errors           int     `json:"errors"`
+}
+
+// Ranking is the benchmark output, ordered from best to worst model
+type Ranking struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	GoldenSet   string        `json:"golden_set"`
+	Models      []ModelResult `json:"models"`
+}
+
+// ModelIDs returns model IDs in preference order, skipping models that produced no usable output
+func (r *Ranking) ModelIDs() []string {
+	ids := make([]string, 0, len(r.Models))
+	for _, m := range r.Models {
+		if m.Score > 0 {
+			ids = append(ids, m.Model)
+		}
+	}
+	return ids
+}
+
+// Save writes the ranking as indented JSON
+func (r *Ranking) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ranking: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write ranking: %w", err)
+	}
+
+	return nil
+}
+
+// LoadRanking reads a ranking written by Save
+func LoadRanking(path string) (*Ranking, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ranking: %w", err)
+	}
+
+	var ranking Ranking
+	if err := json.Unmarshal(data, &ranking); err != nil {
+		return nil, fmt.Errorf("failed to parse ranking: %w", err)
+	}
+
+	return &ranking, nil
+}
@@ -0,0 +1,197 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/imageprocessing"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// Analyzer generates metadata for an image
+type Analyzer interface {
+	AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error)
+}
+
+// AnalyzerFactory creates an Analyzer bound to the given model ID
+type AnalyzerFactory func(modelID string) Analyzer
+
+// Runner runs the golden image set through candidate models
+type Runner struct {
+	newAnalyzer AnalyzerFactory
+	optimizer   *imageprocessing.Optimizer
+	logger      *logrus.Logger
+	images      []GoldenImage
+	timeout     time.Duration
+}
+
+// NewRunner creates a new Runner
+func NewRunner(images []GoldenImage, newAnalyzer AnalyzerFactory, timeout time.Duration, logger *logrus.Logger) *Runner {
+	return &Runner{
+		images:      images,
+		newAnalyzer: newAnalyzer,
+		optimizer:   imageprocessing.NewOptimizer(logger),
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+// Run benchmarks every model and returns results ranked from best to worst
+func (r *Runner) Run(ctx context.Context, models []string) []ModelResult {
+	results := make([]ModelResult, 0, len(models))
+	for _, modelID := range models {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, r.evaluate(ctx, modelID))
+	}
+
+	return Rank(results)
+}
+
+// evaluate runs every golden image through a single model
+func (r *Runner) evaluate(ctx context.Context, modelID string) ModelResult {
+	analyzer := r.newAnalyzer(modelID)
+	result := ModelResult{Model: modelID, Images: len(r.images)}
+
+	var precisionSum, recallSum float64
+	var scored int
+	latencies := make([]time.Duration, 0, len(r.images))
+
+	for i, img := range r.images {
+		traceID := fmt.Sprintf("benchmark-%s-%d", modelID, i)
+
+		data := img.Data
+		if optimized, err := r.optimizer.Optimize(img.Data, traceID); err == nil {
+			data = optimized.Data
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		start := time.Now()
+		metadata, err := analyzer.AnalyzeImage(callCtx, data, traceID)
+		latency := time.Since(start)
+		cancel()
+
+		if err != nil {
+			if errors.Is(err, model.ErrMetadataParse) {
+				result.ParseFailures++
+				latencies = append(latencies, latency)
+			} else {
+				result.Errors++
+			}
+			r.logger.WithFields(logrus.Fields{
+				"model": modelID,
+				"file":  img.File,
+				"error": err.Error(),
+			}).Warn("Benchmark request failed")
+			continue
+		}
+
+		latencies = append(latencies, latency)
+		precision, recall := keywordScores(metadata.Keywords, img.Keywords)
+		precisionSum += precision
+		recallSum += recall
+		scored++
+	}
+
+	if scored > 0 {
+		result.Precision = precisionSum / float64(scored)
+		result.Recall = recallSum / float64(scored)
+	}
+	if result.Precision+result.Recall > 0 {
+		result.F1 = 2 * result.Precision * result.Recall / (result.Precision + result.Recall)
+	}
+
+	if responses := result.Images - result.Errors; responses > 0 {
+		result.JSONValidityRate = float64(responses-result.ParseFailures) / float64(responses)
+	}
+
+	result.AvgLatencyMs, result.P95LatencyMs = latencyStats(latencies)
+
+	// Failed or unparseable responses count as zero quality
+	if result.Images > 0 {
+		result.Score = result.F1 * float64(scored) / float64(result.Images)
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"model":              modelID,
+		"score":              result.Score,
+		"precision":          result.Precision,
+		"recall":             result.Recall,
+		"json_validity_rate": result.JSONValidityRate,
+		"avg_latency_ms":     result.AvgLatencyMs,
+	}).Info("Model benchmark completed")
+
+	return result
+}
+
+// Rank orders results by score, breaking ties by lower average latency, and assigns ranks
+func Rank(results []ModelResult) []ModelResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].AvgLatencyMs < results[j].AvgLatencyMs
+	})
+
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+
+	return results
+}
+
+// keywordScores returns precision and recall of generated keywords against the expected ones
+func keywordScores(generated, expected []string) (float64, float64) {
+	expectedSet := normalizeKeywords(expected)
+	generatedSet := normalizeKeywords(generated)
+	if len(generatedSet) == 0 || len(expectedSet) == 0 {
+		return 0, 0
+	}
+
+	matched := 0
+	for keyword := range generatedSet {
+		if _, ok := expectedSet[keyword]; ok {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(len(generatedSet)), float64(matched) / float64(len(expectedSet))
+}
+
+// normalizeKeywords lowercases, trims and deduplicates keywords
+func normalizeKeywords(keywords []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keywords))
+	for _, k := range keywords {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k != "" {
+			set[k] = struct{}{}
+		}
+	}
+	return set
+}
+
+// latencyStats returns the average and 95th percentile latency in milliseconds
+func latencyStats(latencies []time.Duration) (int64, int64) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+
+	p95 := sorted[(len(sorted)*95+99)/100-1]
+	return (total / time.Duration(len(sorted))).Milliseconds(), p95.Milliseconds()
+}
@@ -0,0 +1,133 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/api/openrouter"
+)
+
+func writeGoldenSet(t *testing.T, keywords []string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sunset.jpg"), buf.Bytes(), 0o600))
+
+	manifest, err := json.Marshal([]GoldenImage{{File: "sunset.jpg", Keywords: keywords}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFile), manifest, 0o600))
+
+	return dir
+}
+
+func TestLoadGoldenSet(t *testing.T) {
+	dir := writeGoldenSet(t, []string{"sunset", "beach"})
+
+	images, err := LoadGoldenSet(dir)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, "sunset.jpg", images[0].File)
+	assert.NotEmpty(t, images[0].Data)
+
+	_, err = LoadGoldenSet(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestRunner_RanksModelsAgainstFakeProvider(t *testing.T) {
+	expected := []string{"sunset", "beach", "ocean", "sky"}
+	images, err := LoadGoldenSet(writeGoldenSet(t, expected))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(NewFakeProvider(map[string]FakeModel{
+		"fake/accurate": {Title: "Sunset", Keywords: []string{"Sunset", "beach ", "ocean", "sky"}},
+		"fake/noisy":    {Title: "Sunset", Keywords: []string{"sunset", "beach", "car", "city"}},
+		"fake/broken":   {InvalidJSON: true},
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	newAnalyzer := func(modelID string) Analyzer {
+		client := openrouter.NewClient("test-key", modelID, 500, 0.2, "describe", logger)
+		client.SetBaseURL(server.URL)
+		return client
+	}
+
+	results := NewRunner(images, newAnalyzer, 5*time.Second, logger).
+		Run(context.Background(), []string{"fake/broken", "fake/noisy", "fake/accurate", "fake/missing"})
+	require.Len(t, results, 4)
+
+	assert.Equal(t, "fake/accurate", results[0].Model)
+	assert.Equal(t, 1, results[0].Rank)
+	assert.InDelta(t, 1.0, results[0].Score, 0.001)
+	assert.InDelta(t, 1.0, results[0].JSONValidityRate, 0.001)
+
+	assert.Equal(t, "fake/noisy", results[1].Model)
+	assert.InDelta(t, 0.5, results[1].Precision, 0.001)
+	assert.InDelta(t, 0.5, results[1].Recall, 0.001)
+
+	var broken, missing ModelResult
+	for _, r := range results[2:] {
+		switch r.Model {
+		case "fake/broken":
+			broken = r
+		case "fake/missing":
+			missing = r
+		}
+	}
+	assert.Equal(t, 1, broken.ParseFailures)
+	assert.Zero(t, broken.JSONValidityRate)
+	assert.Zero(t, broken.Score)
+	assert.Equal(t, 1, missing.Errors)
+
+	ranking := &Ranking{GeneratedAt: time.Now().UTC(), Models: results}
+	path := filepath.Join(t.TempDir(), "ranking.json")
+	require.NoError(t, ranking.Save(path))
+
+	loaded, err := LoadRanking(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fake/accurate", "fake/noisy"}, loaded.ModelIDs())
+}
+
+func TestKeywordScores(t *testing.T) {
+	precision, recall := keywordScores([]string{"a", "b", "c", "d"}, []string{"A", "b"})
+	assert.InDelta(t, 0.5, precision, 0.001)
+	assert.InDelta(t, 1.0, recall, 0.001)
+
+	precision, recall = keywordScores(nil, []string{"a"})
+	assert.Zero(t, precision)
+	assert.Zero(t, recall)
+}
+
+func TestLatencyStats(t *testing.T) {
+	latencies := make([]time.Duration, 0, 20)
+	for i := 1; i <= 20; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	avg, p95 := latencyStats(latencies)
+	assert.Equal(t, int64(10), avg)
+	assert.Equal(t, int64(19), p95)
+}
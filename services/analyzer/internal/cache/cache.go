@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/imageprocessing"
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// Key identifies image content by exact and perceptual hash
+type Key struct {
+	SHA256 string
+	PHash  uint64
+}
+
+// ComputeKey hashes the image bytes
+func ComputeKey(imageBytes []byte) (Key, error) {
+	sum := sha256.Sum256(imageBytes)
+
+	phash, err := imageprocessing.PerceptualHash(imageBytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to compute perceptual hash: %w", err)
+	}
+
+	return Key{
+		SHA256: hex.EncodeToString(sum[:]),
+		PHash:  phash,
+	}, nil
+}
+
+// PromptVersion derives a stable version identifier from the model and prompt
+func PromptVersion(modelName, prompt string) string {
+	sum := sha256.Sum256([]byte(modelName + "\n" + prompt))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// MetadataCache reuses metadata generated for identical or visually similar images
+type MetadataCache struct {
+	store       database.MetadataCacheInterface
+	logger      *logrus.Logger
+	metrics     *metrics.Metrics
+	ttl         time.Duration
+	maxDistance int
+	bypass      bool
+	lookups     atomic.Int64
+	hits        atomic.Int64
+}
+
+// NewMetadataCache creates a new MetadataCache.
+// When bypass is set, lookups always miss but fresh results are still stored.
+func NewMetadataCache(
+	store database.MetadataCacheInterface,
+	ttl time.Duration,
+	maxDistance int,
+	bypass bool,
+	logger *logrus.Logger,
+) *MetadataCache {
+	return &MetadataCache{
+		store:       store,
+		ttl:         ttl,
+		maxDistance: maxDistance,
+		bypass:      bypass,
+		logger:      logger,
+		metrics:     metrics.New(),
+	}
+}
+
+// Lookup returns cached metadata for the image content and prompt version
+func (c *MetadataCache) Lookup(ctx context.Context, key Key, promptVersion, traceID string) (model.Metadata, bool) {
+	if c.bypass {
+		c.metrics.Incr("metadata_cache.lookups", []string{"result:bypass"})
+		return model.Metadata{}, false
+	}
+
+	entry, err := c.store.FindCachedMetadata(ctx, key.SHA256, key.PHash, promptVersion, c.maxDistance, time.Now().Add(-c.ttl))
+	if err != nil {
+		c.metrics.Incr("metadata_cache.lookups", []string{"result:error"})
+		c.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"error":    err.Error(),
+		}).Warn("Metadata cache lookup failed")
+		return model.Metadata{}, false
+	}
+
+	hit := entry != nil
+	c.recordLookup(hit)
+	if !hit {
+		return model.Metadata{}, false
+	}
+
+	match := "exact"
+	if entry.SHA256 != key.SHA256 {
+		match = "perceptual"
+	}
+	c.metrics.Incr("metadata_cache.hits", []string{"match:" + match})
+	c.logger.WithFields(logrus.Fields{
+		"trace_id":       traceID,
+		"match":          match,
+		"prompt_version": promptVersion,
+		"cached_at":      entry.CreatedAt,
+	}).Info("Using cached metadata")
+
+	return model.Metadata{
+		Title:                  entry.Metadata.Title,
+		Description:            entry.Metadata.Description,
+		Keywords:               entry.Metadata.Keywords,
+		HierarchicalKeywords:   entry.Metadata.HierarchicalKeywords,
+		Category:               entry.Metadata.Category,
+		SupplementalCategories: entry.Metadata.SupplementalCategories,
+		AltText:                entry.Metadata.AltText,
+		Consensus:              entry.Metadata.Consensus,
+	}, true
+}
+
+// Store saves generated metadata for the image content and prompt version
+func (c *MetadataCache) Store(
+	ctx context.Context,
+	key Key,
+	promptVersion string,
+	modelName string,
+	metadata model.Metadata,
+	traceID string,
+) {
+	entry := &database.CachedMetadata{
+		SHA256:        key.SHA256,
+		PHash:         key.PHash,
+		PromptVersion: promptVersion,
+		Model:         modelName,
+		Metadata: database.ImageMetadata{
+			Title:                  metadata.Title,
+			Description:            metadata.Description,
+			Keywords:               metadata.Keywords,
+			HierarchicalKeywords:   metadata.HierarchicalKeywords,
+			Category:               metadata.Category,
+			SupplementalCategories: metadata.SupplementalCategories,
+			AltText:                metadata.AltText,
+			Consensus:              metadata.Consensus,
+		},
+	}
+
+	if err := c.store.SaveCachedMetadata(ctx, entry); err != nil {
+		c.metrics.Incr("metadata_cache.store.errors", []string{})
+		c.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"error":    err.Error(),
+		}).Warn("Failed to store metadata in cache")
+		return
+	}
+
+	c.metrics.Incr("metadata_cache.stored", []string{})
+}
+
+// recordLookup updates hit/miss counters and the hit rate gauge
+func (c *MetadataCache) recordLookup(hit bool) {
+	lookups := c.lookups.Add(1)
+	hits := c.hits.Load()
+	result := "miss"
+	if hit {
+		hits = c.hits.Add(1)
+		result = "hit"
+	}
+
+	c.metrics.Incr("metadata_cache.lookups", []string{"result:" + result})
+	c.metrics.Gauge("metadata_cache.hit_rate", float64(hits)/float64(lookups), []string{})
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+type fakeStore struct {
+	entry    *database.CachedMetadata
+	findErr  error
+	saved    []*database.CachedMetadata
+	lastFind struct {
+		promptVersion string
+		maxDistance   int
+		since         time.Time
+	}
+}
+
+func (f *fakeStore) FindCachedMetadata(
+	ctx context.Context, sha256 string, phash uint64, promptVersion string, maxDistance int, since time.Time,
+) (*database.CachedMetadata, error) {
+	f.lastFind.promptVersion = promptVersion
+	f.lastFind.maxDistance = maxDistance
+	f.lastFind.since = since
+	return f.entry, f.findErr
+}
+
+func (f *fakeStore) SaveCachedMetadata(ctx context.Context, entry *database.CachedMetadata) error {
+	f.saved = append(f.saved, entry)
+	return nil
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	return logger
+}
+
+func createTestJPEG() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	return buf.Bytes()
+}
+
+func TestComputeKey(t *testing.T) {
+	data := createTestJPEG()
+
+	key, err := ComputeKey(data)
+	require.NoError(t, err)
+	assert.Len(t, key.SHA256, 64)
+
+	again, err := ComputeKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	_, err = ComputeKey([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+func TestPromptVersion(t *testing.T) {
+	v1 := PromptVersion("model-a", "prompt")
+	assert.Len(t, v1, 16)
+	assert.Equal(t, v1, PromptVersion("model-a", "prompt"))
+	assert.NotEqual(t, v1, PromptVersion("model-b", "prompt"))
+	assert.NotEqual(t, v1, PromptVersion("model-a", "other prompt"))
+}
+
+func TestLookup_Hit(t *testing.T) {
+	store := &fakeStore{
+		entry: &database.CachedMetadata{
+			SHA256: "abc",
+			Metadata: database.ImageMetadata{
+				Title:    "Cached",
+				Keywords: []string{"cached"},
+			},
+		},
+	}
+	cache := NewMetadataCache(store, time.Hour, 4, false, newTestLogger())
+
+	metadata, ok := cache.Lookup(context.Background(), Key{SHA256: "abc"}, "v1", "trace")
+
+	assert.True(t, ok)
+	assert.Equal(t, model.Metadata{Title: "Cached", Keywords: []string{"cached"}}, metadata)
+	assert.Equal(t, "v1", store.lastFind.promptVersion)
+	assert.Equal(t, 4, store.lastFind.maxDistance)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), store.lastFind.since, time.Second)
+	assert.Equal(t, int64(1), cache.hits.Load())
+	assert.Equal(t, int64(1), cache.lookups.Load())
+}
+
+func TestLookup_Miss(t *testing.T) {
+	cache := NewMetadataCache(&fakeStore{}, time.Hour, 4, false, newTestLogger())
+
+	_, ok := cache.Lookup(context.Background(), Key{SHA256: "abc"}, "v1", "trace")
+
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), cache.hits.Load())
+	assert.Equal(t, int64(1), cache.lookups.Load())
+}
+
+func TestLookup_StoreError(t *testing.T) {
+	cache := NewMetadataCache(&fakeStore{findErr: errors.New("db down")}, time.Hour, 4, false, newTestLogger())
+
+	_, ok := cache.Lookup(context.Background(), Key{SHA256: "abc"}, "v1", "trace")
+
+	assert.False(t, ok)
+}
+
+func TestLookup_Bypass(t *testing.T) {
+	store := &fakeStore{entry: &database.CachedMetadata{SHA256: "abc"}}
+	cache := NewMetadataCache(store, time.Hour, 4, true, newTestLogger())
+
+	_, ok := cache.Lookup(context.Background(), Key{SHA256: "abc"}, "v1", "trace")
+
+	assert.False(t, ok)
+	assert.Empty(t, store.lastFind.promptVersion)
+}
+
+func TestStore(t *testing.T) {
+	store := &fakeStore{}
+	cache := NewMetadataCache(store, time.Hour, 4, true, newTestLogger())
+
+	metadata := model.Metadata{Title: "Title", Description: "Description", Keywords: []string{"a", "b"}}
+	cache.Store(context.Background(), Key{SHA256: "abc", PHash: 42}, "v1", "model-a", metadata, "trace")
+
+	require.Len(t, store.saved, 1)
+	assert.Equal(t, "abc", store.saved[0].SHA256)
+	assert.Equal(t, uint64(42), store.saved[0].PHash)
+	assert.Equal(t, "v1", store.saved[0].PromptVersion)
+	assert.Equal(t, "model-a", store.saved[0].Model)
+	assert.Equal(t, []string{"a", "b"}, store.saved[0].Metadata.Keywords)
+}
+
+func TestStoreAndLookup_Consensus(t *testing.T) {
+	store := &fakeStore{}
+	cache := NewMetadataCache(store, time.Hour, 4, false, newTestLogger())
+
+	consensus := &model.Consensus{
+		Models:           []string{"model-a", "model-b"},
+		Queried:          2,
+		TitleAgreement:   1,
+		KeywordAgreement: map[string]float64{"dog": 1, "park": 0.5},
+	}
+	metadata := model.Metadata{Title: "Dog", Keywords: []string{"dog", "park"}, Consensus: consensus}
+	cache.Store(context.Background(), Key{SHA256: "abc"}, "v1", "consensus:model-a,model-b", metadata, "trace")
+
+	require.Len(t, store.saved, 1)
+	store.entry = store.saved[0]
+
+	cached, ok := cache.Lookup(context.Background(), Key{SHA256: "abc"}, "v1", "trace")
+	require.True(t, ok)
+	assert.Equal(t, consensus, cached.Consensus)
+}
@@ -0,0 +1,95 @@
+// Package category constrains generated categories to a configured list
+package category
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// MaxSupplemental limits the supplemental categories kept per image
+const MaxSupplemental = 3
+
+// DefaultCategories are used when CATEGORIES is not set
+var DefaultCategories = []string{
+	"Abstract", "Animals", "Architecture", "Business", "Food and Drink", "Industry", "Lifestyle",
+	"Nature", "People", "Plants", "Science", "Sports", "Technology", "Transportation", "Travel",
+}
+
+// Classifier maps the categories returned by the model onto the configured list
+type Classifier struct {
+	categories []string
+	canonical  map[string]string
+}
+
+// NewClassifier creates a Classifier for the given categories
+func NewClassifier(categories []string) *Classifier {
+	c := &Classifier{canonical: make(map[string]string, len(categories))}
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		key := strings.ToLower(category)
+		if category == "" || c.canonical[key] != "" {
+			continue
+		}
+		c.categories = append(c.categories, category)
+		c.canonical[key] = category
+	}
+	return c
+}
+
+// Categories returns the configured categories
+func (c *Classifier) Categories() []string {
+	return c.categories
+}
+
+// Prompt appends the category instruction to a prompt
+func (c *Classifier) Prompt(prompt string) string {
+	if len(c.categories) == 0 {
+		return prompt
+	}
+	return fmt.Sprintf(
+		"%s Also return 'category': the single best matching category from this list, "+
+			"and 'supplemental_categories': up to %d other categories from the same list that also apply. "+
+			"Categories: %s.",
+		strings.TrimSpace(prompt), MaxSupplemental, strings.Join(c.categories, ", "),
+	)
+}
+
+// Match returns the configured spelling of a category, or false if it is not in the list
+func (c *Classifier) Match(category string) (string, bool) {
+	canonical, ok := c.canonical[strings.ToLower(strings.TrimSpace(category))]
+	return canonical, ok
+}
+
+// Apply drops categories that are not in the list and supplemental categories that repeat
+// the main one. If the main category is unknown, the first valid supplemental category replaces it.
+func (c *Classifier) Apply(metadata model.Metadata) model.Metadata {
+	candidates := append([]string{metadata.Category}, metadata.SupplementalCategories...)
+
+	var valid []string
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		canonical, ok := c.Match(candidate)
+		if !ok || seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+		valid = append(valid, canonical)
+	}
+
+	metadata.Category = ""
+	metadata.SupplementalCategories = nil
+	if len(valid) == 0 {
+		return metadata
+	}
+
+	metadata.Category = valid[0]
+	if supplemental := valid[1:]; len(supplemental) > 0 {
+		if len(supplemental) > MaxSupplemental {
+			supplemental = supplemental[:MaxSupplemental]
+		}
+		metadata.SupplementalCategories = supplemental
+	}
+	return metadata
+}
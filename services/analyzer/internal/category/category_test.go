@@ -0,0 +1,45 @@
+package category
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+func TestClassifier_Apply(t *testing.T) {
+	c := NewClassifier([]string{"Animals", "Nature", "Travel", "Sports", "People", " ", "animals"})
+
+	assert.Equal(t, []string{"Animals", "Nature", "Travel", "Sports", "People"}, c.Categories())
+
+	metadata := c.Apply(model.Metadata{
+		Title:                  "Dog",
+		Category:               " animals ",
+		SupplementalCategories: []string{"NATURE", "Pets", "Animals", "Travel", "Sports", "People"},
+	})
+	assert.Equal(t, "Dog", metadata.Title)
+	assert.Equal(t, "Animals", metadata.Category)
+	assert.Equal(t, []string{"Nature", "Travel", "Sports"}, metadata.SupplementalCategories)
+}
+
+func TestClassifier_ApplyUnknownCategory(t *testing.T) {
+	c := NewClassifier([]string{"Animals", "Nature"})
+
+	metadata := c.Apply(model.Metadata{Category: "Pets", SupplementalCategories: []string{"nature"}})
+	assert.Equal(t, "Nature", metadata.Category, "a valid supplemental category is promoted")
+	assert.Nil(t, metadata.SupplementalCategories)
+
+	metadata = c.Apply(model.Metadata{Category: "Pets"})
+	assert.Empty(t, metadata.Category)
+}
+
+func TestClassifier_Prompt(t *testing.T) {
+	c := NewClassifier([]string{"Animals", "Nature"})
+
+	prompt := c.Prompt("Describe the image. ")
+	assert.Contains(t, prompt, "Describe the image. Also return 'category'")
+	assert.Contains(t, prompt, "Categories: Animals, Nature.")
+
+	assert.Equal(t, "Describe", NewClassifier(nil).Prompt("Describe"))
+}
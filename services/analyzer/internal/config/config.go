@@ -3,11 +3,14 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/priority"
 	pkgstorage "github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/category"
 )
 
 type Config struct {
@@ -27,16 +30,62 @@ type Config struct {
 		ReconnectDelay    time.Duration
 		ReconnectAttempts int
 		PrefetchCount     int
+		LaneWeights       priority.Weights
 	}
 
 	OpenRouter struct {
 		APIKey                 string
+		BaseURL                string
 		Model                  string
 		Prompt                 string
 		Temperature            float64
 		MaxTokens              int
 		UseOpenRouterGoAdapter bool
 		ModelCheckInterval     time.Duration
+		ModelRankingFile       string
+	}
+
+	Postgres struct {
+		Host     string
+		DB       string
+		User     string
+		Password string
+		SSLMode  string
+		Port     int
+	}
+
+	Cache struct {
+		PromptVersion      string
+		TTL                time.Duration
+		MaxHammingDistance int
+		Enabled            bool
+		Bypass             bool
+	}
+
+	Keywords struct {
+		VocabularyFile string
+		StopWords      []string
+		MaxLength      int
+		Normalize      bool
+		Strict         bool
+	}
+
+	Categories struct {
+		List []string
+	}
+
+	Consensus struct {
+		Models       []string
+		MinAgreement float64
+		Enabled      bool
+	}
+
+	Experiment struct {
+		VariantID      string
+		Model          string
+		Prompt         string
+		TrafficPercent int
+		Enabled        bool
 	}
 
 	MinIO struct {
@@ -51,9 +100,11 @@ type Config struct {
 	}
 
 	Worker struct {
-		RetryDelay  time.Duration
-		Concurrency int
-		MaxRetries  int
+		LatencyTarget      time.Duration
+		ConcurrencyBackoff float64
+		Concurrency        int
+		MinConcurrency     int
+		MaxConcurrency     int
 	}
 }
 
@@ -68,6 +119,8 @@ func New() *Config {
 	cfg.RabbitMQ.ConsumerQueue = getEnv("RABBITMQ_CONSUMER_QUEUE", "image_upload")
 	cfg.RabbitMQ.PublisherQueue = getEnv("RABBITMQ_PUBLISHER_QUEUE", "metadata_generated")
 	cfg.RabbitMQ.PrefetchCount = getEnvAsInt("RABBITMQ_PREFETCH_COUNT", 1)
+	cfg.RabbitMQ.LaneWeights.Interactive = getEnvAsInt("RABBITMQ_INTERACTIVE_WEIGHT", priority.DefaultWeights.Interactive)
+	cfg.RabbitMQ.LaneWeights.Bulk = getEnvAsInt("RABBITMQ_BULK_WEIGHT", priority.DefaultWeights.Bulk)
 	cfg.RabbitMQ.ReconnectAttempts = getEnvAsInt("RABBITMQ_RECONNECT_ATTEMPTS", 5)
 	cfg.RabbitMQ.ReconnectDelay = getEnvAsDuration("RABBITMQ_RECONNECT_DELAY", 5*time.Second)
 
@@ -83,6 +136,7 @@ func New() *Config {
 
 	// OpenRouter Config
 	cfg.OpenRouter.APIKey = getEnv("OPENROUTER_API_KEY", "")
+	cfg.OpenRouter.BaseURL = getEnv("OPENROUTER_BASE_URL", "https://openrouter.ai/api/v1")
 	cfg.OpenRouter.Model = getEnv("OPENROUTER_MODEL", "openai/gpt-4o")
 	cfg.OpenRouter.MaxTokens = getEnvAsInt("OPENROUTER_MAX_TOKENS", 500)
 	cfg.OpenRouter.Temperature = getEnvAsFloat("OPENROUTER_TEMPERATURE", 0.7)
@@ -91,6 +145,44 @@ func New() *Config {
 	cfg.OpenRouter.Prompt = getEnv("OPENROUTER_PROMPT", defaultPrompt)
 	cfg.OpenRouter.UseOpenRouterGoAdapter = getEnvAsBool("USE_OPENROUTERGO_ADAPTER", false)
 	cfg.OpenRouter.ModelCheckInterval = getEnvAsDuration("OPENROUTER_MODEL_CHECK_INTERVAL", 24*time.Hour)
+	cfg.OpenRouter.ModelRankingFile = getEnv("OPENROUTER_MODEL_RANKING_FILE", "")
+
+	// Postgres Config
+	cfg.Postgres.Host = getEnv("POSTGRES_HOST", "localhost")
+	cfg.Postgres.Port = getEnvAsInt("POSTGRES_PORT", 5432)
+	cfg.Postgres.DB = getEnv("POSTGRES_DB", "photo_tags")
+	cfg.Postgres.User = getEnv("POSTGRES_USER", "photo_tags_user")
+	cfg.Postgres.Password = getEnv("POSTGRES_PASSWORD", "photo_tags_password")
+	cfg.Postgres.SSLMode = getEnv("POSTGRES_SSL_MODE", "disable")
+
+	// Metadata Cache Config
+	cfg.Cache.Enabled = getEnvAsBool("CACHE_ENABLED", false)
+	cfg.Cache.Bypass = getEnvAsBool("CACHE_BYPASS", false)
+	cfg.Cache.TTL = getEnvAsDuration("CACHE_TTL", 30*24*time.Hour)
+	cfg.Cache.MaxHammingDistance = getEnvAsInt("CACHE_MAX_HAMMING_DISTANCE", 4)
+	cfg.Cache.PromptVersion = getEnv("CACHE_PROMPT_VERSION", "")
+
+	// Keyword Normalization Config
+	cfg.Keywords.Normalize = getEnvAsBool("KEYWORDS_NORMALIZE", true)
+	cfg.Keywords.VocabularyFile = getEnv("KEYWORDS_VOCABULARY_FILE", "")
+	cfg.Keywords.Strict = getEnvAsBool("KEYWORDS_VOCABULARY_STRICT", false)
+	cfg.Keywords.StopWords = getEnvAsSlice("KEYWORDS_STOP_WORDS", nil)
+	cfg.Keywords.MaxLength = getEnvAsInt("KEYWORDS_MAX_LENGTH", 50)
+
+	// Category Config; an empty CATEGORIES value disables category classification
+	cfg.Categories.List = getEnvAsSlice("CATEGORIES", category.DefaultCategories)
+
+	// Consensus Config
+	cfg.Consensus.Enabled = getEnvAsBool("CONSENSUS_ENABLED", false)
+	cfg.Consensus.Models = getEnvAsSlice("CONSENSUS_MODELS", nil)
+	cfg.Consensus.MinAgreement = getEnvAsFloat("CONSENSUS_MIN_AGREEMENT", 0.5)
+
+	// Experiment Config
+	cfg.Experiment.Enabled = getEnvAsBool("EXPERIMENT_ENABLED", false)
+	cfg.Experiment.VariantID = getEnv("EXPERIMENT_VARIANT_ID", "variant")
+	cfg.Experiment.Model = getEnv("EXPERIMENT_MODEL", cfg.OpenRouter.Model)
+	cfg.Experiment.Prompt = getEnv("EXPERIMENT_PROMPT", cfg.OpenRouter.Prompt)
+	cfg.Experiment.TrafficPercent = getEnvAsInt("EXPERIMENT_TRAFFIC_PERCENT", 10)
 
 	// Log Config
 	cfg.Log.Level = getEnv("LOG_LEVEL", "info")
@@ -98,8 +190,10 @@ func New() *Config {
 
 	// Worker Config
 	cfg.Worker.Concurrency = getEnvAsInt("WORKER_CONCURRENCY", 3)
-	cfg.Worker.MaxRetries = getEnvAsInt("WORKER_MAX_RETRIES", 3)
-	cfg.Worker.RetryDelay = getEnvAsDuration("WORKER_RETRY_DELAY", 5*time.Second)
+	cfg.Worker.MinConcurrency = getEnvAsInt("WORKER_MIN_CONCURRENCY", 1)
+	cfg.Worker.MaxConcurrency = getEnvAsInt("WORKER_MAX_CONCURRENCY", 10)
+	cfg.Worker.LatencyTarget = getEnvAsDuration("WORKER_LATENCY_TARGET", 30*time.Second)
+	cfg.Worker.ConcurrencyBackoff = getEnvAsFloat("WORKER_CONCURRENCY_BACKOFF", 0.5)
 
 	return cfg
 }
@@ -138,6 +232,21 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(key); exists {
 		if duration, err := time.ParseDuration(value); err == nil {
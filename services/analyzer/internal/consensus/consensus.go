@@ -0,0 +1,232 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/keywords"
+)
+
+// maxKeywords matches the keyword limit of the metadata_generated contract
+const maxKeywords = 50
+
+// Analyzer generates metadata for an image
+type Analyzer interface {
+	AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error)
+}
+
+// Member is a model taking part in the vote
+type Member struct {
+	Analyzer Analyzer
+	Model    string
+}
+
+// Consensus queries several models concurrently and merges their metadata by vote
+type Consensus struct {
+	logger       *logrus.Logger
+	metrics      *metrics.Metrics
+	members      []Member
+	minAgreement float64
+}
+
+// response is the outcome of a single member query
+type response struct {
+	err      error
+	model    string
+	metadata model.Metadata
+}
+
+// NewConsensus creates a new Consensus.
+// Keywords proposed by less than minAgreement of the responding models are dropped.
+func NewConsensus(members []Member, minAgreement float64, logger *logrus.Logger) *Consensus {
+	return &Consensus{
+		members:      members,
+		minAgreement: minAgreement,
+		logger:       logger,
+		metrics:      metrics.New(),
+	}
+}
+
+// Models returns the IDs of the participating models
+func (c *Consensus) Models() []string {
+	models := make([]string, 0, len(c.members))
+	for _, m := range c.members {
+		models = append(models, m.Model)
+	}
+	return models
+}
+
+// AnalyzeImage queries all models and returns the merged metadata with agreement scores
+func (c *Consensus) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error) {
+	startTime := time.Now()
+	c.metrics.Incr("consensus.requests", []string{})
+
+	responses := make([]response, len(c.members))
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		wg.Add(1)
+		go func(i int, member Member) {
+			defer wg.Done()
+			metadata, err := member.Analyzer.AnalyzeImage(ctx, imageBytes, traceID)
+			responses[i] = response{model: member.Model, metadata: metadata, err: err}
+		}(i, member)
+	}
+	wg.Wait()
+
+	successful := make([]response, 0, len(responses))
+	var firstErr error
+	for _, r := range responses {
+		if r.err != nil {
+			c.metrics.Incr("consensus.model_errors", []string{"model:" + r.model})
+			c.logger.WithFields(logrus.Fields{
+				"trace_id": traceID,
+				"model":    r.model,
+				"error":    r.err.Error(),
+			}).Warn("Consensus model failed")
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		successful = append(successful, r)
+	}
+
+	if len(successful) == 0 {
+		c.metrics.Incr("consensus.errors", []string{"error:all_models_failed"})
+		return model.Metadata{}, fmt.Errorf("all %d consensus models failed: %w", len(responses), firstErr)
+	}
+
+	metadata := c.merge(successful)
+	metadata.Consensus.Queried = len(c.members)
+
+	c.metrics.Histogram("consensus.title_agreement", metadata.Consensus.TitleAgreement, []string{})
+	c.metrics.Histogram("consensus.responses", float64(len(successful)), []string{})
+	c.metrics.Timing("consensus.duration", time.Since(startTime).Milliseconds(), []string{})
+
+	c.logger.WithFields(logrus.Fields{
+		"trace_id":        traceID,
+		"responses":       len(successful),
+		"queried":         len(c.members),
+		"title_agreement": metadata.Consensus.TitleAgreement,
+		"keywords_count":  len(metadata.Keywords),
+	}).Info("Consensus metadata merged")
+
+	return metadata, nil
+}
+
+// merge combines the responses by vote. Responses are in member order so ties are deterministic.
+func (c *Consensus) merge(responses []response) model.Metadata {
+	total := float64(len(responses))
+
+	// Vote for titles; the description and alt text follow the winning title
+	titleVotes := make(map[string]int)
+	winner := 0
+	for i, r := range responses {
+		key := normalizeTitle(r.metadata.Title)
+		titleVotes[key]++
+		if titleVotes[key] > titleVotes[normalizeTitle(responses[winner].metadata.Title)] {
+			winner = i
+		}
+	}
+	winning := responses[winner].metadata
+
+	// Vote for keywords, each model votes at most once per canonical keyword
+	keywordVotes := make(map[string]int)
+	var order []string
+	for _, r := range responses {
+		seen := make(map[string]bool)
+		for _, keyword := range r.metadata.Keywords {
+			canonical := normalizeKeyword(keyword)
+			if canonical == "" || seen[canonical] {
+				continue
+			}
+			seen[canonical] = true
+			if keywordVotes[canonical] == 0 {
+				order = append(order, canonical)
+			}
+			keywordVotes[canonical]++
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return keywordVotes[order[i]] > keywordVotes[order[j]]
+	})
+
+	merged := make([]string, 0, len(order))
+	agreement := make(map[string]float64, len(order))
+	for _, keyword := range order {
+		score := float64(keywordVotes[keyword]) / total
+		if score < c.minAgreement || len(merged) == maxKeywords {
+			continue
+		}
+		merged = append(merged, keyword)
+		agreement[keyword] = score
+	}
+
+	// Keep hierarchy paths whose leaf survived the keyword vote
+	var hierarchy []string
+	seenPaths := make(map[string]bool)
+	for _, r := range responses {
+		for _, path := range r.metadata.HierarchicalKeywords {
+			path = keywords.CleanPath(path)
+			if path == "" || seenPaths[path] {
+				continue
+			}
+			if _, ok := agreement[normalizeKeyword(keywords.Leaf(path))]; ok {
+				seenPaths[path] = true
+				hierarchy = append(hierarchy, path)
+			}
+		}
+	}
+
+	// Vote for the category; the first response proposing the winner supplies its spelling
+	// and the supplemental categories
+	categoryVotes := make(map[string]int)
+	categoryWinner := -1
+	for i, r := range responses {
+		key := normalizeCategory(r.metadata.Category)
+		if key == "" {
+			continue
+		}
+		categoryVotes[key]++
+		if categoryWinner < 0 || categoryVotes[key] > categoryVotes[normalizeCategory(responses[categoryWinner].metadata.Category)] {
+			categoryWinner = i
+		}
+	}
+	var category string
+	var supplemental []string
+	for _, r := range responses {
+		if categoryWinner >= 0 && normalizeCategory(r.metadata.Category) == normalizeCategory(responses[categoryWinner].metadata.Category) {
+			category = r.metadata.Category
+			supplemental = r.metadata.SupplementalCategories
+			break
+		}
+	}
+
+	models := make([]string, 0, len(responses))
+	for _, r := range responses {
+		models = append(models, r.model)
+	}
+
+	return model.Metadata{
+		Title:                  winning.Title,
+		Description:            winning.Description,
+		AltText:                winning.AltText,
+		Keywords:               merged,
+		HierarchicalKeywords:   hierarchy,
+		Category:               category,
+		SupplementalCategories: supplemental,
+		Consensus: &model.Consensus{
+			Models:           models,
+			TitleAgreement:   float64(titleVotes[normalizeTitle(winning.Title)]) / total,
+			KeywordAgreement: agreement,
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/mocks"
+)
+
+func newMember(modelID string, metadata model.Metadata, err error) Member {
+	client := new(mocks.MockOpenRouterClient)
+	client.On("AnalyzeImage", mock.Anything, mock.Anything, "trace-1").Return(metadata, err)
+	return Member{Model: modelID, Analyzer: client}
+}
+
+func newTestConsensus(minAgreement float64, members ...Member) *Consensus {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	return NewConsensus(members, minAgreement, logger)
+}
+
+func TestAnalyzeImage_MergesByVote(t *testing.T) {
+	c := newTestConsensus(0.5,
+		newMember("model-a", model.Metadata{
+			Title:                "Dog on the beach",
+			Description:          "A dog running on the beach",
+			Keywords:             []string{"Dogs", "beach", "ocean", "unicorn"},
+			HierarchicalKeywords: []string{"Animals|Mammals|Dog", "Fantasy|Unicorn"},
+		}, nil),
+		newMember("model-b", model.Metadata{
+			Title:       "Sunset over the sea",
+			Description: "The sun setting",
+			Keywords:    []string{"puppy", "sea", "sunset"},
+		}, nil),
+		newMember("model-c", model.Metadata{
+			Title:       "Dog on the beach.",
+			Description: "A happy dog",
+			Keywords:    []string{"dog", "Beaches", "sunset", "dog"},
+		}, nil),
+	)
+
+	metadata, err := c.AnalyzeImage(context.Background(), []byte("image"), "trace-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Dog on the beach", metadata.Title)
+	assert.Equal(t, "A dog running on the beach", metadata.Description)
+	assert.Equal(t, []string{"dog", "beach", "ocean", "sunset"}, metadata.Keywords)
+	assert.Equal(t, []string{"Animals|Mammals|Dog"}, metadata.HierarchicalKeywords)
+
+	require.NotNil(t, metadata.Consensus)
+	assert.Equal(t, []string{"model-a", "model-b", "model-c"}, metadata.Consensus.Models)
+	assert.Equal(t, 3, metadata.Consensus.Queried)
+	assert.InDelta(t, 2.0/3.0, metadata.Consensus.TitleAgreement, 0.001)
+	assert.InDelta(t, 1.0, metadata.Consensus.KeywordAgreement["dog"], 0.001)
+	assert.InDelta(t, 2.0/3.0, metadata.Consensus.KeywordAgreement["sunset"], 0.001)
+	assert.NotContains(t, metadata.Consensus.KeywordAgreement, "unicorn")
+}
+
+func TestAnalyzeImage_VotesForCategory(t *testing.T) {
+	c := newTestConsensus(0.5,
+		newMember("model-a", model.Metadata{
+			Title: "Dog", Keywords: []string{"dog"}, Category: "Nature", SupplementalCategories: []string{"Travel"},
+		}, nil),
+		newMember("model-b", model.Metadata{
+			Title: "Dog", Keywords: []string{"dog"}, Category: "Animals", SupplementalCategories: []string{"Nature"},
+		}, nil),
+		newMember("model-c", model.Metadata{Title: "Dog", Keywords: []string{"dog"}}, nil),
+		newMember("model-d", model.Metadata{Title: "Dog", Keywords: []string{"dog"}, Category: "animals"}, nil),
+	)
+
+	metadata, err := c.AnalyzeImage(context.Background(), []byte("image"), "trace-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Animals", metadata.Category)
+	assert.Equal(t, []string{"Nature"}, metadata.SupplementalCategories)
+}
+
+func TestAnalyzeImage_IgnoresFailedModels(t *testing.T) {
+	c := newTestConsensus(0.5,
+		newMember("model-a", model.Metadata{Title: "Cat", Keywords: []string{"cat"}}, nil),
+		newMember("model-b", model.Metadata{}, errors.New("timeout")),
+	)
+
+	metadata, err := c.AnalyzeImage(context.Background(), []byte("image"), "trace-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"cat"}, metadata.Keywords)
+	assert.Equal(t, []string{"model-a"}, metadata.Consensus.Models)
+	assert.Equal(t, 2, metadata.Consensus.Queried)
+}
+
+func TestAnalyzeImage_AllModelsFailed(t *testing.T) {
+	c := newTestConsensus(0.5,
+		newMember("model-a", model.Metadata{}, model.ErrMetadataParse),
+		newMember("model-b", model.Metadata{}, errors.New("timeout")),
+	)
+
+	_, err := c.AnalyzeImage(context.Background(), []byte("image"), "trace-1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, model.ErrMetadataParse)
+}
+
+func TestNormalizeKeyword(t *testing.T) {
+	tests := map[string]string{
+		"Dogs":              "dog",
+		"  Beach  ":         "beach",
+		"golden retrievers": "golden retriever",
+		"butterflies":       "butterfly",
+		"glasses":           "glass",
+		"bus":               "bus",
+		"Automobile":        "car",
+		"children":          "kid",
+		"leaves":            "leaf",
+		"black-and-white":   "black-and-white",
+		"!!!":               "",
+	}
+
+	for input, expected := range tests {
+		assert.Equal(t, expected, normalizeKeyword(input), input)
+	}
+}
@@ -0,0 +1,65 @@
+package consensus
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/keywords"
+)
+
+// synonyms maps common keyword variants to a canonical form so they vote together
+var synonyms = map[string]string{
+	"automobile": "car",
+	"auto":       "car",
+	"puppy":      "dog",
+	"doggy":      "dog",
+	"kitten":     "cat",
+	"kitty":      "cat",
+	"sea":        "ocean",
+	"seashore":   "beach",
+	"shore":      "beach",
+	"coast":      "beach",
+	"woods":      "forest",
+	"woodland":   "forest",
+	"human":      "person",
+	"child":      "kid",
+	"sundown":    "sunset",
+	"daybreak":   "sunrise",
+	"dawn":       "sunrise",
+	"photo":      "photograph",
+	"picture":    "photograph",
+	"metropolis": "city",
+	"urban":      "city",
+}
+
+// normalizeKeyword reduces a keyword to a canonical form used for voting
+func normalizeKeyword(keyword string) string {
+	words := strings.FieldsFunc(strings.ToLower(keyword), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	if canonical, ok := synonyms[strings.Join(words, " ")]; ok {
+		return canonical
+	}
+
+	normalized := strings.Join(keywords.SingularizePhrase(words), " ")
+	if canonical, ok := synonyms[normalized]; ok {
+		return canonical
+	}
+	return normalized
+}
+
+// normalizeTitle reduces a title to a form used for voting
+func normalizeTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// normalizeCategory reduces a category to a form used for voting
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
@@ -1,25 +1,12 @@
 package model
 
-import (
-	"time"
-)
+import "github.com/shabohin/photo-tags/pkg/models"
 
-type ImageUploadMessage struct {
-	Timestamp        time.Time `json:"timestamp"`
-	TraceID          string    `json:"trace_id"`
-	GroupID          string    `json:"group_id"`
-	TelegramUsername string    `json:"telegram_username"`
-	OriginalFilename string    `json:"original_filename"`
-	OriginalPath     string    `json:"original_path"`
-	TelegramID       int64     `json:"telegram_id"`
-}
+// ImageUploadMessage is the image_upload contract shared with the other services
+type ImageUploadMessage = models.ImageUpload
 
-type MetadataGeneratedMessage struct {
-	TraceID          string    `json:"trace_id"`
-	GroupID          string    `json:"group_id"`
-	OriginalFilename string    `json:"original_filename"`
-	OriginalPath     string    `json:"original_path"`
-	Timestamp        time.Time `json:"timestamp"`
-	Metadata         Metadata  `json:"metadata"`
-	TelegramID       int64     `json:"telegram_id"`
-}
+// MetadataGeneratedMessage is the metadata_generated contract shared with the other services
+type MetadataGeneratedMessage = models.MetadataGenerated
+
+// Experiment describes the variant that generated the metadata and its quality signals
+type Experiment = models.Experiment
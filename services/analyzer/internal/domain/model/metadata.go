@@ -1,7 +1,19 @@
 package model
 
-type Metadata struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Keywords    []string `json:"keywords"`
-}
+import (
+	"errors"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// ErrMetadataParse is returned when the model response cannot be parsed into Metadata
+var ErrMetadataParse = errors.New("failed to parse metadata")
+
+// Metadata is the generated image metadata.
+// HierarchicalKeywords are Lightroom-style keyword paths, e.g. "Animals|Mammals|Dog".
+// Category and SupplementalCategories are constrained to the configured category list.
+// AltText is a short accessibility description, see alttext.MaxLength.
+type Metadata = models.Metadata
+
+// Consensus records how strongly the queried models agreed on the metadata
+type Consensus = models.Consensus
@@ -7,7 +7,11 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/shabohin/photo-tags/pkg/imageprocessing"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	pkgstorage "github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/cache"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/experiment"
 )
 
 type ImageAnalyzerService struct {
@@ -15,6 +19,9 @@ type ImageAnalyzerService struct {
 	openRouterClient OpenRouterClientInterface
 	imageOptimizer   *imageprocessing.Optimizer
 	logger           *logrus.Logger
+	metadataCache    MetadataCacheInterface
+	promptVersion    string
+	modelName        string
 }
 
 func NewImageAnalyzer(minioClient MinioClientInterface,
@@ -28,7 +35,34 @@ func NewImageAnalyzer(minioClient MinioClientInterface,
 	}
 }
 
+// SetMetadataCache enables reuse of metadata generated for the same image content.
+// promptVersion and modelName describe the default OpenRouter client.
+func (s *ImageAnalyzerService) SetMetadataCache(metadataCache MetadataCacheInterface, promptVersion, modelName string) {
+	s.metadataCache = metadataCache
+	s.promptVersion = promptVersion
+	s.modelName = modelName
+}
+
 func (s *ImageAnalyzerService) AnalyzeImage(ctx context.Context, msg model.ImageUploadMessage) (model.Metadata, error) {
+	return s.analyze(ctx, msg, s.openRouterClient, s.promptVersion, s.modelName)
+}
+
+// AnalyzeImageWithVariant analyzes the image using the prompt and model of an experiment variant
+func (s *ImageAnalyzerService) AnalyzeImageWithVariant(
+	ctx context.Context,
+	msg model.ImageUploadMessage,
+	variant experiment.Variant,
+) (model.Metadata, error) {
+	return s.analyze(ctx, msg, variant.Analyzer, variant.PromptVersion, variant.Model)
+}
+
+func (s *ImageAnalyzerService) analyze(
+	ctx context.Context,
+	msg model.ImageUploadMessage,
+	client OpenRouterClientInterface,
+	promptVersion string,
+	modelName string,
+) (model.Metadata, error) {
 	s.logger.WithFields(logrus.Fields{
 		"trace_id":          msg.TraceID,
 		"original_filename": msg.OriginalFilename,
@@ -50,6 +84,38 @@ func (s *ImageAnalyzerService) AnalyzeImage(ctx context.Context, msg model.Image
 		"image_size_kb": len(imageBytes) / 1024,
 	}).Debug("Image downloaded successfully")
 
+	// Camera RAW files are analyzed from their embedded JPEG preview
+	if pkgstorage.IsRAW(msg.OriginalPath) {
+		imageBytes, err = imageprocessing.EmbeddedPreview(imageBytes)
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"trace_id": msg.TraceID,
+				"error":    err.Error(),
+			}).Error("Failed to extract RAW preview")
+			return model.Metadata{}, retryqueue.Permanent(fmt.Errorf("failed to extract RAW preview: %w", err))
+		}
+	}
+
+	// Reuse metadata previously generated for the same image content
+	var cacheKey cache.Key
+	useCache := s.metadataCache != nil
+	if useCache {
+		cacheKey, err = cache.ComputeKey(imageBytes)
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"trace_id": msg.TraceID,
+				"error":    err.Error(),
+			}).Warn("Failed to compute image hash, skipping metadata cache")
+			useCache = false
+		}
+	}
+
+	if useCache && !msg.BypassCache {
+		if metadata, ok := s.metadataCache.Lookup(ctx, cacheKey, promptVersion, msg.TraceID); ok {
+			return metadata, nil
+		}
+	}
+
 	// Optimize image before sending to OpenRouter
 	optimizationResult, err := s.imageOptimizer.Optimize(imageBytes, msg.TraceID)
 	if err != nil {
@@ -61,18 +127,18 @@ func (s *ImageAnalyzerService) AnalyzeImage(ctx context.Context, msg model.Image
 	}
 
 	s.logger.WithFields(logrus.Fields{
-		"trace_id":           msg.TraceID,
-		"original_size_kb":   optimizationResult.OriginalSize / 1024,
-		"optimized_size_kb":  optimizationResult.OptimizedSize / 1024,
-		"compression_ratio":  optimizationResult.CompressionRatio,
-		"was_resized":        optimizationResult.WasResized,
-		"was_converted":      optimizationResult.WasConverted,
-		"original_format":    optimizationResult.OriginalFormat,
-		"optimized_format":   optimizationResult.OptimizedFormat,
+		"trace_id":          msg.TraceID,
+		"original_size_kb":  optimizationResult.OriginalSize / 1024,
+		"optimized_size_kb": optimizationResult.OptimizedSize / 1024,
+		"compression_ratio": optimizationResult.CompressionRatio,
+		"was_resized":       optimizationResult.WasResized,
+		"was_converted":     optimizationResult.WasConverted,
+		"original_format":   optimizationResult.OriginalFormat,
+		"optimized_format":  optimizationResult.OptimizedFormat,
 	}).Info("Image optimized successfully")
 
 	// Analyze image with OpenRouter using optimized data
-	metadata, err := s.openRouterClient.AnalyzeImage(ctx, optimizationResult.Data, msg.TraceID)
+	metadata, err := client.AnalyzeImage(ctx, optimizationResult.Data, msg.TraceID)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": msg.TraceID,
@@ -87,5 +153,9 @@ func (s *ImageAnalyzerService) AnalyzeImage(ctx context.Context, msg model.Image
 		"keywords_count": len(metadata.Keywords),
 	}).Info("Image analyzed successfully")
 
+	if useCache {
+		s.metadataCache.Store(ctx, cacheKey, promptVersion, modelName, metadata, msg.TraceID)
+	}
+
 	return metadata, nil
 }
@@ -13,7 +13,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/experiment"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/mocks"
 )
 
@@ -90,6 +93,135 @@ func TestAnalyzeImage_Success(t *testing.T) {
 	openRouterClient.AssertExpectations(t)
 }
 
+func TestAnalyzeImageWithVariant_UsesVariantClient(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	controlClient := &mocks.MockOpenRouterClient{}
+	variantClient := &mocks.MockOpenRouterClient{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	minioClient.On("DownloadImage", mock.Anything, "test-image.jpg").Return(createTestJPEG(), nil)
+
+	expectedMetadata := model.Metadata{
+		Title:       "Variant Title",
+		Description: "Variant Description",
+		Keywords:    []string{"variant"},
+	}
+	variantClient.On("AnalyzeImage", mock.Anything, mock.AnythingOfType("[]uint8"), "test-trace-id").Return(expectedMetadata, nil)
+
+	analyzer := NewImageAnalyzer(minioClient, controlClient, logger)
+
+	message := model.ImageUploadMessage{
+		TraceID:      "test-trace-id",
+		OriginalPath: "test-image.jpg",
+	}
+	variant := experiment.Variant{ID: "variant-a", Analyzer: variantClient}
+
+	metadata, err := analyzer.AnalyzeImageWithVariant(context.Background(), message, variant)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedMetadata, metadata)
+	variantClient.AssertExpectations(t)
+	controlClient.AssertNotCalled(t, "AnalyzeImage")
+}
+
+func TestAnalyzeImage_CacheHit(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	openRouterClient := &mocks.MockOpenRouterClient{}
+	metadataCache := &mocks.MockMetadataCache{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	minioClient.On("DownloadImage", mock.Anything, "test-image.jpg").Return(createTestJPEG(), nil)
+
+	cachedMetadata := model.Metadata{
+		Title:    "Cached Title",
+		Keywords: []string{"cached"},
+	}
+	metadataCache.On("Lookup", mock.Anything, mock.AnythingOfType("cache.Key"), "v1", "test-trace-id").
+		Return(cachedMetadata, true)
+
+	analyzer := NewImageAnalyzer(minioClient, openRouterClient, logger)
+	analyzer.SetMetadataCache(metadataCache, "v1", "test-model")
+
+	message := model.ImageUploadMessage{
+		TraceID:      "test-trace-id",
+		OriginalPath: "test-image.jpg",
+	}
+
+	metadata, err := analyzer.AnalyzeImage(context.Background(), message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, cachedMetadata, metadata)
+	openRouterClient.AssertNotCalled(t, "AnalyzeImage")
+	metadataCache.AssertNotCalled(t, "Store")
+}
+
+func TestAnalyzeImage_CacheMissStoresResult(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	openRouterClient := &mocks.MockOpenRouterClient{}
+	metadataCache := &mocks.MockMetadataCache{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	minioClient.On("DownloadImage", mock.Anything, "test-image.jpg").Return(createTestJPEG(), nil)
+
+	expectedMetadata := model.Metadata{
+		Title:    "Fresh Title",
+		Keywords: []string{"fresh"},
+	}
+	openRouterClient.On("AnalyzeImage", mock.Anything, mock.AnythingOfType("[]uint8"), "test-trace-id").Return(expectedMetadata, nil)
+	metadataCache.On("Lookup", mock.Anything, mock.AnythingOfType("cache.Key"), "v1", "test-trace-id").
+		Return(model.Metadata{}, false)
+	metadataCache.On("Store", mock.Anything, mock.AnythingOfType("cache.Key"), "v1", "test-model", expectedMetadata, "test-trace-id").
+		Return()
+
+	analyzer := NewImageAnalyzer(minioClient, openRouterClient, logger)
+	analyzer.SetMetadataCache(metadataCache, "v1", "test-model")
+
+	message := model.ImageUploadMessage{
+		TraceID:      "test-trace-id",
+		OriginalPath: "test-image.jpg",
+	}
+
+	metadata, err := analyzer.AnalyzeImage(context.Background(), message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedMetadata, metadata)
+	metadataCache.AssertExpectations(t)
+	openRouterClient.AssertExpectations(t)
+}
+
+func TestAnalyzeImage_BypassCache(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	openRouterClient := &mocks.MockOpenRouterClient{}
+	metadataCache := &mocks.MockMetadataCache{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	minioClient.On("DownloadImage", mock.Anything, "test-image.jpg").Return(createTestJPEG(), nil)
+
+	expectedMetadata := model.Metadata{Title: "Fresh Title"}
+	openRouterClient.On("AnalyzeImage", mock.Anything, mock.AnythingOfType("[]uint8"), "test-trace-id").Return(expectedMetadata, nil)
+	metadataCache.On("Store", mock.Anything, mock.AnythingOfType("cache.Key"), "v1", "test-model", expectedMetadata, "test-trace-id").
+		Return()
+
+	analyzer := NewImageAnalyzer(minioClient, openRouterClient, logger)
+	analyzer.SetMetadataCache(metadataCache, "v1", "test-model")
+
+	message := model.ImageUploadMessage{
+		TraceID:      "test-trace-id",
+		OriginalPath: "test-image.jpg",
+		BypassCache:  true,
+	}
+
+	_, err := analyzer.AnalyzeImage(context.Background(), message)
+
+	assert.NoError(t, err)
+	metadataCache.AssertNotCalled(t, "Lookup")
+	metadataCache.AssertExpectations(t)
+}
+
 func TestAnalyzeImage_MinioError(t *testing.T) {
 	// Create mocks
 	minioClient := &mocks.MockMinioClient{}
@@ -209,3 +341,53 @@ func TestAnalyzeImage_OptimizationError(t *testing.T) {
 	// OpenRouter should not be called if optimization fails
 	openRouterClient.AssertNotCalled(t, "AnalyzeImage")
 }
+
+func TestAnalyzeImage_RAWUsesEmbeddedPreview(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	openRouterClient := &mocks.MockOpenRouterClient{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	// A RAW container with a JPEG preview between sensor data
+	raw := append([]byte("II*\x00raw-header"), createTestJPEG()...)
+	raw = append(raw, bytes.Repeat([]byte{0x42}, 64)...)
+	minioClient.On("DownloadImage", mock.Anything, "IMG_0001.CR2").Return(raw, nil)
+
+	expectedMetadata := model.Metadata{Title: "RAW Title"}
+	openRouterClient.On("AnalyzeImage", mock.Anything, mock.MatchedBy(func(data []byte) bool {
+		_, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		return err == nil
+	}), "test-trace-id").Return(expectedMetadata, nil)
+
+	analyzer := NewImageAnalyzer(minioClient, openRouterClient, logger)
+
+	metadata, err := analyzer.AnalyzeImage(context.Background(), model.ImageUploadMessage{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "IMG_0001.CR2",
+		OriginalPath:     "IMG_0001.CR2",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedMetadata, metadata)
+	openRouterClient.AssertExpectations(t)
+}
+
+func TestAnalyzeImage_RAWWithoutPreviewIsPermanent(t *testing.T) {
+	minioClient := &mocks.MockMinioClient{}
+	openRouterClient := &mocks.MockOpenRouterClient{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	minioClient.On("DownloadImage", mock.Anything, "IMG_0002.NEF").Return([]byte("MM\x00*no-preview"), nil)
+
+	analyzer := NewImageAnalyzer(minioClient, openRouterClient, logger)
+
+	_, err := analyzer.AnalyzeImage(context.Background(), model.ImageUploadMessage{
+		TraceID:      "test-trace-id",
+		OriginalPath: "IMG_0002.NEF",
+	})
+
+	assert.Error(t, err)
+	assert.True(t, retryqueue.IsPermanent(err))
+	openRouterClient.AssertNotCalled(t, "AnalyzeImage")
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 
+	"github.com/shabohin/photo-tags/services/analyzer/internal/cache"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
 )
 
@@ -13,3 +14,8 @@ type MinioClientInterface interface {
 type OpenRouterClientInterface interface {
 	AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error)
 }
+
+type MetadataCacheInterface interface {
+	Lookup(ctx context.Context, key cache.Key, promptVersion, traceID string) (model.Metadata, bool)
+	Store(ctx context.Context, key cache.Key, promptVersion, modelName string, metadata model.Metadata, traceID string)
+}
@@ -2,14 +2,20 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/alttext"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/category"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
-	"github.com/shabohin/photo-tags/services/analyzer/internal/monitoring"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/experiment"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/keywords"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/transport/rabbitmq"
 )
 
@@ -17,39 +23,51 @@ type MessageProcessorService struct {
 	imageAnalyzer *ImageAnalyzerService
 	publisher     *rabbitmq.Publisher
 	logger        *logrus.Logger
-	maxRetries    int
-	retryDelay    time.Duration
-	metrics       *monitoring.Metrics
+	metrics       *metrics.Metrics
+	experiments   *experiment.Router
+	keywords      *keywords.Normalizer
+	categories    *category.Classifier
 }
 
 func NewMessageProcessor(
 	imageAnalyzer *ImageAnalyzerService,
 	publisher *rabbitmq.Publisher,
 	logger *logrus.Logger,
-	maxRetries int,
-	retryDelay time.Duration,
 ) *MessageProcessorService {
 	return &MessageProcessorService{
 		imageAnalyzer: imageAnalyzer,
 		publisher:     publisher,
 		logger:        logger,
-		maxRetries:    maxRetries,
-		retryDelay:    retryDelay,
-		metrics:       monitoring.NewMetrics(),
+		metrics:       metrics.New(),
 	}
 }
 
+// SetExperimentRouter enables prompt/model experiments for processed messages
+func (s *MessageProcessorService) SetExperimentRouter(router *experiment.Router) {
+	s.experiments = router
+}
+
+// SetKeywordNormalizer enables keyword post-processing before metadata is published
+func (s *MessageProcessorService) SetKeywordNormalizer(normalizer *keywords.Normalizer) {
+	s.keywords = normalizer
+}
+
+// SetCategoryClassifier constrains generated categories to the configured list
+func (s *MessageProcessorService) SetCategoryClassifier(classifier *category.Classifier) {
+	s.categories = classifier
+}
+
 func (s *MessageProcessorService) Process(ctx context.Context, message []byte) error {
 	startTime := time.Now()
 	s.metrics.Incr("rabbitmq.messages.consumed", []string{"queue:image_upload"})
 
 	var uploadMsg model.ImageUploadMessage
-	if err := json.Unmarshal(message, &uploadMsg); err != nil {
+	if _, err := envelope.Decode(message, envelope.TypeImageUpload, &uploadMsg); err != nil {
 		s.metrics.Incr("message_processor.errors", []string{"error:unmarshal_failed"})
 		s.logger.WithFields(logrus.Fields{
 			"error": err.Error(),
-		}).Error("Failed to unmarshal message")
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+		}).Error("Failed to decode message")
+		return retryqueue.Permanent(fmt.Errorf("failed to decode message: %w", err))
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -57,55 +75,56 @@ func (s *MessageProcessorService) Process(ctx context.Context, message []byte) e
 		"group_id":          uploadMsg.GroupID,
 		"telegram_id":       uploadMsg.TelegramID,
 		"original_filename": uploadMsg.OriginalFilename,
+		"retry_count":       retryqueue.RetryCountFromContext(ctx),
 	}).Info("Processing image upload message")
 	s.metrics.Incr("image.processing.started", []string{})
 
+	var variant *experiment.Variant
+	if s.experiments != nil {
+		assigned := s.experiments.Assign(uploadMsg.TraceID)
+		variant = &assigned
+	}
+
+	// A failed analysis is returned to the consumer, which retries it through the delay queues
 	var metadata model.Metadata
 	var err error
-
-	// Try to analyze the image with retries
-	for attempt := 0; attempt <= s.maxRetries; attempt++ {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		// Skip delay on first attempt
-		if attempt > 0 {
-			s.logger.WithFields(logrus.Fields{
-				"trace_id": uploadMsg.TraceID,
-				"attempt":  attempt,
-			}).Info("Retrying image analysis")
-			time.Sleep(s.retryDelay)
-		}
-
+	if variant != nil {
+		metadata, err = s.imageAnalyzer.AnalyzeImageWithVariant(ctx, uploadMsg, *variant)
+	} else {
 		metadata, err = s.imageAnalyzer.AnalyzeImage(ctx, uploadMsg)
-		if err == nil {
-			break
+	}
+	if err != nil {
+		if errors.Is(err, model.ErrMetadataParse) && variant != nil {
+			s.metrics.Incr("experiment.parse_failures", []string{"variant:" + variant.ID})
 		}
-
+		s.metrics.Incr("image.processing.failed", []string{"error:analysis_failed"})
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": uploadMsg.TraceID,
-			"attempt":  attempt,
 			"error":    err.Error(),
-		}).Warn("Image analysis attempt failed")
-
-		if attempt == s.maxRetries {
-			s.metrics.Incr("image.processing.failed", []string{"error:max_retries"})
-			s.metrics.Gauge("image.processing.retries", float64(attempt), []string{})
-			s.logger.WithFields(logrus.Fields{
-				"trace_id": uploadMsg.TraceID,
-				"error":    err.Error(),
-			}).Error("Image analysis failed after max retries")
-			return fmt.Errorf("image analysis failed after %d retries: %w", s.maxRetries, err)
+		}).Error("Image analysis failed")
+		return fmt.Errorf("image analysis failed: %w", err)
+	}
+
+	// Clean up keywords before they leave the analyzer
+	if s.keywords != nil {
+		generated := len(metadata.Keywords)
+		metadata = s.keywords.Apply(metadata)
+		s.metrics.Count("keywords.dropped", int64(generated-len(metadata.Keywords)), []string{})
+	}
+
+	// Keep only categories from the configured list
+	if s.categories != nil {
+		metadata = s.categories.Apply(metadata)
+		if metadata.Category == "" {
+			s.metrics.Incr("category.missing", []string{})
 		}
 	}
 
-	// Record retry count if any
-	if err == nil && metadata.Title != "" {
-		s.metrics.Gauge("image.processing.retries", float64(attempt), []string{})
+	// Limit the alt text, falling back to the title
+	if metadata.AltText == "" {
+		s.metrics.Incr("alt_text.missing", []string{})
 	}
+	metadata = alttext.Apply(metadata)
 
 	// Create metadata generated message
 	generatedMsg := model.MetadataGeneratedMessage{
@@ -116,16 +135,31 @@ func (s *MessageProcessorService) Process(ctx context.Context, message []byte) e
 		OriginalPath:     uploadMsg.OriginalPath,
 		Metadata:         metadata,
 		Timestamp:        time.Now(),
+		MergePolicy:      uploadMsg.MergePolicy,
+		OutputMode:       uploadMsg.OutputMode,
+		PrivacyProfile:   uploadMsg.PrivacyProfile,
+		Creator:          uploadMsg.Creator,
+	}
+
+	if variant != nil {
+		generatedMsg.Experiment = &model.Experiment{
+			VariantID:    variant.ID,
+			Model:        variant.Model,
+			KeywordCount: len(metadata.Keywords),
+			// Earlier deliveries that failed to parse were retried through the delay queues
+			ParseFailures: rabbitmq.ParseFailures(ctx),
+		}
+		s.metrics.Histogram("experiment.keywords_count", float64(len(metadata.Keywords)), []string{"variant:" + variant.ID})
 	}
 
-	// Marshal the message to JSON
-	jsonMsg, err := json.Marshal(generatedMsg)
+	// Encode the message with its schema version
+	jsonMsg, err := envelope.Encode(envelope.TypeMetadataGenerated, envelope.ProducerAnalyzer, generatedMsg)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": uploadMsg.TraceID,
 			"error":    err.Error(),
-		}).Error("Failed to marshal metadata message")
-		return fmt.Errorf("failed to marshal metadata message: %w", err)
+		}).Error("Failed to encode metadata message")
+		return fmt.Errorf("failed to encode metadata message: %w", err)
 	}
 
 	// Publish the message
@@ -0,0 +1,79 @@
+package experiment
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/metrics"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// ControlVariantID identifies the baseline prompt and model configuration
+const ControlVariantID = "control"
+
+// Analyzer generates metadata for an image
+type Analyzer interface {
+	AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error)
+}
+
+// Variant is a prompt/model configuration that can receive traffic
+type Variant struct {
+	Analyzer      Analyzer
+	ID            string
+	Model         string
+	PromptVersion string
+}
+
+// Router splits image_upload traffic between the control and a candidate variant
+type Router struct {
+	logger         *logrus.Logger
+	metrics        *metrics.Metrics
+	candidate      *Variant
+	control        Variant
+	trafficPercent int
+}
+
+// NewRouter creates a new Router. A nil candidate routes all traffic to control.
+func NewRouter(control Variant, candidate *Variant, trafficPercent int, logger *logrus.Logger) *Router {
+	if trafficPercent < 0 {
+		trafficPercent = 0
+	}
+	if trafficPercent > 100 {
+		trafficPercent = 100
+	}
+
+	return &Router{
+		control:        control,
+		candidate:      candidate,
+		trafficPercent: trafficPercent,
+		logger:         logger,
+		metrics:        metrics.New(),
+	}
+}
+
+// Assign returns the variant for the given trace ID.
+// Assignment is deterministic so retries of the same message stay in one variant.
+func (r *Router) Assign(traceID string) Variant {
+	variant := r.control
+	if r.candidate != nil && bucket(traceID) < r.trafficPercent {
+		variant = *r.candidate
+	}
+
+	r.metrics.Incr("experiment.assigned", []string{"variant:" + variant.ID})
+	r.logger.WithFields(logrus.Fields{
+		"trace_id": traceID,
+		"variant":  variant.ID,
+		"model":    variant.Model,
+	}).Debug("Assigned experiment variant")
+
+	return variant
+}
+
+// bucket maps a trace ID to a stable bucket in the range [0, 100)
+func bucket(traceID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(traceID))
+	return int(h.Sum32() % 100)
+}
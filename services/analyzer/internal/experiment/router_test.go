@@ -0,0 +1,84 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+type stubAnalyzer struct{}
+
+func (stubAnalyzer) AnalyzeImage(ctx context.Context, imageBytes []byte, traceID string) (model.Metadata, error) {
+	return model.Metadata{}, nil
+}
+
+func newTestRouter(candidate *Variant, trafficPercent int) *Router {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	control := Variant{ID: ControlVariantID, Model: "control-model", Analyzer: stubAnalyzer{}}
+	return NewRouter(control, candidate, trafficPercent, logger)
+}
+
+func TestAssign_NoCandidate(t *testing.T) {
+	router := newTestRouter(nil, 100)
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, ControlVariantID, router.Assign(fmt.Sprintf("trace-%d", i)).ID)
+	}
+}
+
+func TestAssign_FullTraffic(t *testing.T) {
+	candidate := &Variant{ID: "variant-a", Model: "variant-model", Analyzer: stubAnalyzer{}}
+	router := newTestRouter(candidate, 100)
+
+	for i := 0; i < 50; i++ {
+		variant := router.Assign(fmt.Sprintf("trace-%d", i))
+		assert.Equal(t, "variant-a", variant.ID)
+		assert.Equal(t, "variant-model", variant.Model)
+	}
+}
+
+func TestAssign_ZeroTraffic(t *testing.T) {
+	candidate := &Variant{ID: "variant-a", Analyzer: stubAnalyzer{}}
+	router := newTestRouter(candidate, 0)
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, ControlVariantID, router.Assign(fmt.Sprintf("trace-%d", i)).ID)
+	}
+}
+
+func TestAssign_IsDeterministic(t *testing.T) {
+	candidate := &Variant{ID: "variant-a", Analyzer: stubAnalyzer{}}
+	router := newTestRouter(candidate, 50)
+
+	for i := 0; i < 50; i++ {
+		traceID := fmt.Sprintf("trace-%d", i)
+		assert.Equal(t, router.Assign(traceID).ID, router.Assign(traceID).ID)
+	}
+}
+
+func TestAssign_SplitsTraffic(t *testing.T) {
+	candidate := &Variant{ID: "variant-a", Analyzer: stubAnalyzer{}}
+	router := newTestRouter(candidate, 30)
+
+	assigned := 0
+	total := 10000
+	for i := 0; i < total; i++ {
+		if router.Assign(fmt.Sprintf("trace-%d", i)).ID == "variant-a" {
+			assigned++
+		}
+	}
+
+	ratio := float64(assigned) / float64(total)
+	assert.InDelta(t, 0.30, ratio, 0.05)
+}
+
+func TestNewRouter_ClampsTrafficPercent(t *testing.T) {
+	assert.Equal(t, 0, newTestRouter(nil, -10).trafficPercent)
+	assert.Equal(t, 100, newTestRouter(nil, 150).trafficPercent)
+}
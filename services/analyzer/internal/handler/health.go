@@ -10,7 +10,9 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/config"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/limiter"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/storage/minio"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/transport/rabbitmq"
 )
@@ -27,6 +29,7 @@ type Handler struct {
 	consumer        *rabbitmq.Consumer
 	publisher       *rabbitmq.Publisher
 	minioClient     *minio.Client
+	limiter         *limiter.Limiter
 	workerCount     int
 	activeWorkersMu sync.RWMutex
 	activeWorkers   int
@@ -65,6 +68,11 @@ func (h *Handler) GetActiveWorkers() int {
 	return h.activeWorkers
 }
 
+// SetLimiter sets the adaptive concurrency limiter reported by the health check
+func (h *Handler) SetLimiter(l *limiter.Limiter) {
+	h.limiter = l
+}
+
 // ComponentStatus represents the status of a single component
 type ComponentStatus struct {
 	Status  string                 `json:"status"`
@@ -116,6 +124,11 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, _ *http.Request) {
 		overallHealthy = false
 	}
 
+	// Report the adaptive concurrency limit
+	if h.limiter != nil {
+		components["concurrency"] = h.checkConcurrency()
+	}
+
 	// Prepare response
 	response := HealthResponse{
 		Status:     "ok",
@@ -206,12 +219,28 @@ func (h *Handler) checkWorkers() ComponentStatus {
 	}
 }
 
+// checkConcurrency reports the current analysis concurrency limit and its bounds
+func (h *Handler) checkConcurrency() ComponentStatus {
+	minLimit, maxLimit := h.limiter.Bounds()
+
+	return ComponentStatus{
+		Status: "ok",
+		Details: map[string]interface{}{
+			"limit":     h.limiter.Limit(),
+			"in_flight": h.limiter.InFlight(),
+			"min":       minLimit,
+			"max":       maxLimit,
+		},
+	}
+}
+
 // SetupRoutes sets up HTTP routes
 func (h *Handler) SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	// Add routes
 	mux.HandleFunc("/health", h.HealthCheck)
+	mux.Handle("/metrics", metrics.Handler())
 
 	// Log middleware
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
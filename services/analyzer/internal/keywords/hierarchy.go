@@ -0,0 +1,23 @@
+package keywords
+
+import "strings"
+
+// PathSeparator separates levels of a Lightroom keyword hierarchy
+const PathSeparator = "|"
+
+// CleanPath trims every level of a hierarchy path and drops empty levels
+func CleanPath(path string) string {
+	levels := strings.Split(path, PathSeparator)
+	cleaned := levels[:0]
+	for _, level := range levels {
+		if level = strings.Join(strings.Fields(level), " "); level != "" {
+			cleaned = append(cleaned, level)
+		}
+	}
+	return strings.Join(cleaned, PathSeparator)
+}
+
+// Leaf returns the last level of a hierarchy path
+func Leaf(path string) string {
+	return path[strings.LastIndex(path, PathSeparator)+1:]
+}
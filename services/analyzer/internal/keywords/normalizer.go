@@ -0,0 +1,191 @@
+package keywords
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// DefaultStopWords are removed from the edges of keywords, and keywords made only of them are dropped
+var DefaultStopWords = []string{
+	"a", "an", "the", "and", "or", "of", "in", "on", "at", "with", "for", "to", "by",
+	"image", "photo", "picture", "photograph", "stock",
+}
+
+// Options configures a Normalizer
+type Options struct {
+	Vocabulary *Vocabulary
+	StopWords  []string
+	MaxLength  int
+	Strict     bool
+}
+
+// Normalizer cleans up generated keywords: lowercasing, singularization, stop-word removal,
+// length limits, de-duplication and mapping to a controlled vocabulary
+type Normalizer struct {
+	vocabulary *Vocabulary
+	stopWords  map[string]bool
+	maxLength  int
+	strict     bool
+}
+
+// NewNormalizer creates a new Normalizer. Nil StopWords uses DefaultStopWords.
+// With Strict set, keywords not found in the vocabulary are dropped.
+func NewNormalizer(opts Options) *Normalizer {
+	stopWords := opts.StopWords
+	if stopWords == nil {
+		stopWords = DefaultStopWords
+	}
+
+	n := &Normalizer{
+		vocabulary: opts.Vocabulary,
+		stopWords:  make(map[string]bool, len(stopWords)),
+		maxLength:  opts.MaxLength,
+		strict:     opts.Strict && opts.Vocabulary != nil,
+	}
+	for _, w := range stopWords {
+		n.stopWords[strings.ToLower(strings.TrimSpace(w))] = true
+	}
+
+	return n
+}
+
+// Normalize returns the normalized form of a keyword, or false if it should be dropped
+func (n *Normalizer) Normalize(keyword string) (string, bool) {
+	normalized, _, ok := n.normalize(keyword)
+	return normalized, ok
+}
+
+// NormalizeKeywords normalizes keywords and removes duplicates, keeping the original order
+func (n *Normalizer) NormalizeKeywords(keywords []string) []string {
+	flat, _ := n.normalizeAll(keywords, nil)
+	return flat
+}
+
+// Apply normalizes the flat and hierarchical keywords of metadata.
+// Vocabulary terms with a taxonomy path add hierarchical keywords, and the leaves of
+// hierarchical keywords are added as flat keywords. Consensus agreement scores are
+// remapped to the normalized keywords.
+func (n *Normalizer) Apply(metadata model.Metadata) model.Metadata {
+	metadata.Keywords, metadata.HierarchicalKeywords = n.normalizeAll(metadata.Keywords, metadata.HierarchicalKeywords)
+
+	if metadata.Consensus != nil {
+		consensus := *metadata.Consensus
+		agreement := make(map[string]float64, len(consensus.KeywordAgreement))
+		for keyword, score := range consensus.KeywordAgreement {
+			normalized, ok := n.Normalize(keyword)
+			if ok && score > agreement[normalized] {
+				agreement[normalized] = score
+			}
+		}
+		consensus.KeywordAgreement = agreement
+		metadata.Consensus = &consensus
+	}
+
+	return metadata
+}
+
+// normalizeAll normalizes flat keywords and hierarchy paths, removing duplicates
+func (n *Normalizer) normalizeAll(keywords, paths []string) ([]string, []string) {
+	flat := make([]string, 0, len(keywords))
+	seenFlat := make(map[string]bool, len(keywords))
+	var hierarchy []string
+	seenPaths := make(map[string]bool)
+
+	addFlat := func(keyword string) {
+		if !seenFlat[keyword] {
+			seenFlat[keyword] = true
+			flat = append(flat, keyword)
+		}
+	}
+	addPath := func(path string) {
+		if path != "" && !seenPaths[path] {
+			seenPaths[path] = true
+			hierarchy = append(hierarchy, path)
+		}
+	}
+
+	for _, keyword := range keywords {
+		normalized, path, ok := n.normalize(keyword)
+		if !ok {
+			continue
+		}
+		addFlat(normalized)
+		addPath(path)
+	}
+
+	for _, path := range paths {
+		path = CleanPath(path)
+		if path == "" {
+			continue
+		}
+
+		// The taxonomy wins over a path proposed by the model
+		normalized, vocabularyPath, ok := n.normalize(Leaf(path))
+		if !ok {
+			continue
+		}
+		if vocabularyPath != "" {
+			path = vocabularyPath
+		}
+		addFlat(normalized)
+		addPath(path)
+	}
+
+	return flat, hierarchy
+}
+
+// normalize returns the normalized keyword and its taxonomy path, or false if it should be dropped
+func (n *Normalizer) normalize(keyword string) (string, string, bool) {
+	words := clean(keyword)
+
+	// Strip stop words from both ends, e.g. "a dog" -> "dog"
+	for len(words) > 0 && n.stopWords[words[0]] {
+		words = words[1:]
+	}
+	for len(words) > 0 && n.stopWords[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+
+	normalized := canonicalForm(words)
+	if normalized == "" {
+		return "", "", false
+	}
+
+	var path string
+	if n.vocabulary != nil {
+		if term, termPath, ok := n.vocabulary.Lookup(normalized); ok {
+			normalized, path = term, termPath
+		} else if n.strict {
+			return "", "", false
+		}
+	}
+
+	if n.maxLength > 0 && utf8.RuneCountInString(normalized) > n.maxLength {
+		return "", "", false
+	}
+
+	return normalized, path, true
+}
+
+// clean lowercases a keyword and splits it into words without surrounding punctuation
+func clean(keyword string) []string {
+	fields := strings.Fields(strings.ToLower(keyword))
+	words := fields[:0]
+	for _, field := range fields {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// canonicalForm joins cleaned words with the head noun singularized
+func canonicalForm(words []string) string {
+	return strings.Join(SingularizePhrase(words), " ")
+}
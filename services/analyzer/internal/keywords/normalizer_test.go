@@ -0,0 +1,125 @@
+package keywords
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+func TestNormalizeKeywords(t *testing.T) {
+	n := NewNormalizer(Options{MaxLength: 20})
+
+	result := n.NormalizeKeywords([]string{
+		"Dog", "dogs", " DOGS ", "a cat", "the", "Butterflies!", "photo",
+		"golden retrievers", "black and white", "an extremely long keyword phrase",
+	})
+
+	assert.Equal(t, []string{"dog", "cat", "butterfly", "golden retriever", "black and white"}, result)
+}
+
+func TestNormalize_Vocabulary(t *testing.T) {
+	vocabulary := NewVocabulary(map[string][]string{
+		"dog":   {"puppy", "puppy dog", "Doggies"},
+		"ocean": {"sea"},
+	})
+
+	n := NewNormalizer(Options{Vocabulary: vocabulary})
+	assert.Equal(t, []string{"dog", "ocean", "beach"}, n.NormalizeKeywords([]string{"Puppy Dogs", "doggy", "seas", "beach", "dog"}))
+
+	strict := NewNormalizer(Options{Vocabulary: vocabulary, Strict: true})
+	assert.Equal(t, []string{"dog", "ocean"}, strict.NormalizeKeywords([]string{"puppies", "beach", "sea"}))
+}
+
+func TestApply_RemapsConsensusAgreement(t *testing.T) {
+	n := NewNormalizer(Options{Vocabulary: NewVocabulary(map[string][]string{"dog": {"puppy"}})})
+
+	metadata := n.Apply(model.Metadata{
+		Title:    "Dog",
+		Keywords: []string{"dog", "puppy", "beach"},
+		Consensus: &model.Consensus{
+			KeywordAgreement: map[string]float64{"dog": 0.5, "puppy": 1, "beach": 0.5},
+		},
+	})
+
+	assert.Equal(t, []string{"dog", "beach"}, metadata.Keywords)
+	assert.Equal(t, map[string]float64{"dog": 1, "beach": 0.5}, metadata.Consensus.KeywordAgreement)
+}
+
+func TestApply_HierarchicalKeywords(t *testing.T) {
+	vocabulary := NewVocabulary(map[string][]string{
+		"Animals|Mammals|dog": {"puppy"},
+		"ocean":               {"sea"},
+	})
+	n := NewNormalizer(Options{Vocabulary: vocabulary})
+
+	metadata := n.Apply(model.Metadata{
+		Keywords:             []string{"puppies", "sea", "beach"},
+		HierarchicalKeywords: []string{" Places | Beach ", "Animals|Pets|Dogs", "Nature||Trees", "|"},
+	})
+
+	assert.Equal(t, []string{"dog", "ocean", "beach", "tree"}, metadata.Keywords)
+	assert.Equal(t, []string{"Animals|Mammals|dog", "Places|Beach", "Nature|Trees"}, metadata.HierarchicalKeywords)
+
+	strict := NewNormalizer(Options{Vocabulary: vocabulary, Strict: true})
+	metadata = strict.Apply(model.Metadata{
+		Keywords:             []string{"dog"},
+		HierarchicalKeywords: []string{"Places|Beach"},
+	})
+	assert.Equal(t, []string{"dog"}, metadata.Keywords)
+	assert.Equal(t, []string{"Animals|Mammals|dog"}, metadata.HierarchicalKeywords)
+}
+
+func TestLoadVocabulary(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "vocabulary.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"dog": ["puppy"], "car": ["automobile", "autos"]}`), 0o600))
+
+	csvPath := filepath.Join(dir, "vocabulary.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("# preferred,synonyms...\ndog, puppy\ncar,automobile,autos\n"), 0o600))
+
+	for _, path := range []string{jsonPath, csvPath} {
+		vocabulary, err := LoadVocabulary(path)
+		require.NoError(t, err, path)
+
+		term, _, ok := vocabulary.Lookup("puppy")
+		assert.True(t, ok)
+		assert.Equal(t, "dog", term)
+
+		term, _, ok = vocabulary.Lookup("auto")
+		assert.True(t, ok)
+		assert.Equal(t, "car", term)
+
+		_, _, ok = vocabulary.Lookup("cat")
+		assert.False(t, ok)
+	}
+
+	_, err := LoadVocabulary(filepath.Join(dir, "vocabulary.txt"))
+	assert.Error(t, err)
+}
+
+func TestSingularize(t *testing.T) {
+	tests := map[string]string{
+		"dogs":        "dog",
+		"berries":     "berry",
+		"boxes":       "box",
+		"churches":    "church",
+		"grass":       "grass",
+		"cactus":      "cactus",
+		"children":    "child",
+		"species":     "species",
+		"bus":         "bus",
+		"mountain":    "mountain",
+		"sunglasses":  "sunglasses",
+		"butterflies": "butterfly",
+	}
+
+	for input, expected := range tests {
+		assert.Equal(t, expected, Singularize(input), input)
+	}
+}
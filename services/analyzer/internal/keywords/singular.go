@@ -0,0 +1,64 @@
+package keywords
+
+import "strings"
+
+// irregularPlurals covers plurals that suffix stripping gets wrong
+var irregularPlurals = map[string]string{
+	"men":      "man",
+	"women":    "woman",
+	"children": "child",
+	"people":   "person",
+	"feet":     "foot",
+	"teeth":    "tooth",
+	"geese":    "goose",
+	"mice":     "mouse",
+	"leaves":   "leaf",
+	"wolves":   "wolf",
+	"knives":   "knife",
+	"lives":    "life",
+}
+
+// uncountable words are left unchanged
+var uncountable = map[string]bool{
+	"news":       true,
+	"series":     true,
+	"species":    true,
+	"clothes":    true,
+	"sunglasses": true,
+}
+
+// Singularize applies simple English plural stemming to a single word
+func Singularize(word string) string {
+	if singular, ok := irregularPlurals[word]; ok {
+		return singular
+	}
+	if uncountable[word] {
+		return word
+	}
+
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	default:
+		return word
+	}
+}
+
+// SingularizePhrase singularizes the head noun of a phrase, e.g. "golden retrievers" -> "golden retriever"
+func SingularizePhrase(words []string) []string {
+	if len(words) == 0 {
+		return words
+	}
+	last := len(words) - 1
+	words[last] = Singularize(words[last])
+	return words
+}
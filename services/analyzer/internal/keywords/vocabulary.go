@@ -0,0 +1,99 @@
+package keywords
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vocabulary is a controlled vocabulary mapping synonyms to preferred terms.
+// A preferred term may be a taxonomy path such as "Animals|Mammals|Dog";
+// its last level is then used as the flat keyword.
+type Vocabulary struct {
+	terms map[string]vocabularyTerm
+}
+
+// vocabularyTerm is a preferred term and its optional hierarchy path
+type vocabularyTerm struct {
+	term string
+	path string
+}
+
+// NewVocabulary creates a Vocabulary from preferred terms and their synonyms.
+// Every preferred term is also a synonym of itself.
+func NewVocabulary(entries map[string][]string) *Vocabulary {
+	v := &Vocabulary{terms: make(map[string]vocabularyTerm)}
+	for term, synonyms := range entries {
+		v.add(term, synonyms)
+	}
+	return v
+}
+
+// LoadVocabulary reads a vocabulary file.
+// JSON files map preferred terms to synonym lists: {"dog": ["puppy", "doggy"]}.
+// CSV files have one preferred term per row followed by its synonyms: dog,puppy,doggy.
+func LoadVocabulary(path string) (*Vocabulary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var entries map[string][]string
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse vocabulary: %w", err)
+		}
+		return NewVocabulary(entries), nil
+	case ".csv":
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vocabulary: %w", err)
+		}
+
+		v := &Vocabulary{terms: make(map[string]vocabularyTerm)}
+		for _, record := range records {
+			v.add(record[0], record[1:])
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported vocabulary format: %s", path)
+	}
+}
+
+// Len returns the number of known terms and synonyms
+func (v *Vocabulary) Len() int {
+	return len(v.terms)
+}
+
+// Lookup returns the preferred term and its hierarchy path, if any, for a normalized keyword
+func (v *Vocabulary) Lookup(keyword string) (string, string, bool) {
+	entry, ok := v.terms[keyword]
+	return entry.term, entry.path, ok
+}
+
+// add registers a preferred term and its synonyms
+func (v *Vocabulary) add(term string, synonyms []string) {
+	entry := vocabularyTerm{term: strings.TrimSpace(term)}
+	if strings.Contains(term, PathSeparator) {
+		entry.path = CleanPath(term)
+		entry.term = Leaf(entry.path)
+	}
+	if entry.term == "" {
+		return
+	}
+
+	for _, synonym := range append([]string{entry.term}, synonyms...) {
+		if key := canonicalForm(clean(synonym)); key != "" {
+			v.terms[key] = entry
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package limiter adapts the number of concurrent analyses to what the model provider sustains.
+//
+// The limit follows AIMD (additive increase, multiplicative decrease): it grows by one after a
+// full limit of analyses succeeded while every slot was in use, and is multiplied by the backoff
+// factor when an analysis is rate limited or slower than the latency target. Free models
+// rate-limit aggressively, so a fixed worker count either wastes capacity or causes 429 storms.
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/metrics"
+)
+
+// Config configures a Limiter
+type Config struct {
+	// Initial is the limit before any analysis completed
+	Initial int
+	// Min and Max bound the limit
+	Min int
+	Max int
+	// LatencyTarget is the duration above which an analysis counts as congestion; 0 disables it
+	LatencyTarget time.Duration
+	// Backoff multiplies the limit on congestion, between 0 and 1
+	Backoff float64
+	// IsRateLimited reports whether an analysis error is a rate limit response
+	IsRateLimited func(err error) bool
+}
+
+// Token is held by an analysis between Acquire and Release
+type Token struct {
+	start time.Time
+	// saturated is set when the analysis took the last free slot
+	saturated bool
+}
+
+// Limiter limits the number of concurrent analyses with an adaptive limit
+type Limiter struct {
+	cfg     Config
+	logger  *logrus.Logger
+	metrics *metrics.Metrics
+
+	// notifyMu orders the listener calls, so listeners end with the latest limit
+	notifyMu sync.Mutex
+
+	mu           sync.Mutex
+	limit        int
+	inFlight     int
+	successes    int
+	lastDecrease time.Time
+	// released is closed and replaced whenever a slot may have become free
+	released  chan struct{}
+	listeners []func(limit int)
+}
+
+// NewLimiter creates a Limiter. The bounds are corrected so that 1 <= Min <= Initial <= Max.
+func NewLimiter(cfg Config, logger *logrus.Logger) *Limiter {
+	if cfg.Min < 1 {
+		cfg.Min = 1
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	if cfg.Initial < cfg.Min {
+		cfg.Initial = cfg.Min
+	}
+	if cfg.Initial > cfg.Max {
+		cfg.Initial = cfg.Max
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.5
+	}
+
+	l := &Limiter{
+		cfg:      cfg,
+		logger:   logger,
+		metrics:  metrics.New(),
+		limit:    cfg.Initial,
+		released: make(chan struct{}),
+	}
+	l.metrics.Gauge("concurrency.limit", float64(l.limit), nil)
+	return l
+}
+
+// OnChange registers fn to be called with the new limit after every change
+func (l *Limiter) OnChange(fn func(limit int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InFlight returns the number of analyses holding a slot
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Bounds returns the configured minimum and maximum limit
+func (l *Limiter) Bounds() (minLimit, maxLimit int) {
+	return l.cfg.Min, l.cfg.Max
+}
+
+// Acquire waits for a free slot. It returns ctx.Err() if ctx is done first.
+func (l *Limiter) Acquire(ctx context.Context) (Token, error) {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			token := Token{start: time.Now(), saturated: l.inFlight == l.limit}
+			l.metrics.Gauge("concurrency.in_flight", float64(l.inFlight), nil)
+			l.mu.Unlock()
+			return token, nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Token{}, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Release frees the slot of token and adjusts the limit by the outcome of the analysis
+func (l *Limiter) Release(token Token, err error) {
+	latency := time.Since(token.start)
+	rateLimited := err != nil && l.cfg.IsRateLimited != nil && l.cfg.IsRateLimited(err)
+	slow := l.cfg.LatencyTarget > 0 && latency > l.cfg.LatencyTarget
+
+	l.mu.Lock()
+	l.inFlight--
+	l.metrics.Gauge("concurrency.in_flight", float64(l.inFlight), nil)
+
+	previous := l.limit
+	switch {
+	case rateLimited || slow:
+		// Analyses started before the last decrease ran at the old limit; one congestion event
+		// decreases the limit once
+		if token.start.After(l.lastDecrease) {
+			l.limit = max(l.cfg.Min, int(float64(l.limit)*l.cfg.Backoff))
+			l.lastDecrease = time.Now()
+			l.successes = 0
+
+			reason := "latency"
+			if rateLimited {
+				reason = "rate_limit"
+			}
+			l.metrics.Incr("concurrency.decreases", []string{"reason:" + reason})
+		}
+	case err == nil && token.saturated:
+		// The limit only grows while it is in use
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.cfg.Max {
+			l.limit++
+			l.successes = 0
+		}
+	}
+
+	limit := l.limit
+	close(l.released)
+	l.released = make(chan struct{})
+	listeners := l.listeners
+	l.mu.Unlock()
+
+	if limit == previous {
+		return
+	}
+
+	l.metrics.Gauge("concurrency.limit", float64(limit), nil)
+	l.logger.WithFields(logrus.Fields{
+		"previous":     previous,
+		"limit":        limit,
+		"latency":      latency.String(),
+		"rate_limited": rateLimited,
+	}).Info("Analysis concurrency limit changed")
+
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	limit = l.Limit()
+	for _, fn := range listeners {
+		fn(limit)
+	}
+}
@@ -0,0 +1,147 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRateLimited = errors.New("rate limited")
+
+func newTestLimiter(cfg Config) *Limiter {
+	cfg.IsRateLimited = func(err error) bool { return errors.Is(err, errRateLimited) }
+	return NewLimiter(cfg, logrus.New())
+}
+
+// saturate acquires every free slot
+func saturate(t *testing.T, l *Limiter) []Token {
+	var tokens []Token
+	for l.InFlight() < l.Limit() {
+		token, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func TestNewLimiter_Bounds(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 20, Min: 0, Max: 8})
+	assert.Equal(t, 8, l.Limit())
+
+	minLimit, maxLimit := l.Bounds()
+	assert.Equal(t, 1, minLimit)
+	assert.Equal(t, 8, maxLimit)
+}
+
+func TestLimiter_AdditiveIncrease(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 2, Min: 1, Max: 3})
+
+	var changes []int
+	l.OnChange(func(limit int) { changes = append(changes, limit) })
+
+	// Two saturated successes raise the limit by one
+	for _, token := range saturate(t, l) {
+		l.Release(token, nil)
+	}
+	assert.Equal(t, 2, l.Limit(), "only the analysis that took the last slot was saturated")
+
+	for i := 0; i < 2; i++ {
+		tokens := saturate(t, l)
+		l.Release(tokens[len(tokens)-1], nil)
+		for _, token := range tokens[:len(tokens)-1] {
+			l.Release(token, nil)
+		}
+	}
+	assert.Equal(t, 3, l.Limit())
+	assert.Equal(t, []int{3}, changes)
+
+	// The limit does not grow past Max
+	for i := 0; i < 10; i++ {
+		for _, token := range saturate(t, l) {
+			l.Release(token, nil)
+		}
+	}
+	assert.Equal(t, 3, l.Limit())
+}
+
+func TestLimiter_UnusedLimitDoesNotGrow(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 4, Min: 1, Max: 10})
+
+	for i := 0; i < 20; i++ {
+		token, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		l.Release(token, nil)
+	}
+	assert.Equal(t, 4, l.Limit())
+}
+
+func TestLimiter_MultiplicativeDecrease(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 8, Min: 3, Max: 8})
+
+	var changes []int
+	l.OnChange(func(limit int) { changes = append(changes, limit) })
+
+	// Every analysis of one congestion event fails; the limit halves once
+	tokens := saturate(t, l)
+	for _, token := range tokens {
+		l.Release(token, errRateLimited)
+	}
+	assert.Equal(t, 4, l.Limit())
+
+	// A later rate limit halves it again, down to Min
+	token, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	l.Release(token, errRateLimited)
+	assert.Equal(t, 3, l.Limit())
+	assert.Equal(t, []int{4, 3}, changes)
+
+	// Other errors leave the limit unchanged
+	token, err = l.Acquire(context.Background())
+	require.NoError(t, err)
+	l.Release(token, errors.New("invalid image"))
+	assert.Equal(t, 3, l.Limit())
+}
+
+func TestLimiter_SlowAnalysisDecreases(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 4, Min: 1, Max: 4, LatencyTarget: time.Millisecond})
+
+	token, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	l.Release(token, nil)
+
+	assert.Equal(t, 2, l.Limit())
+}
+
+func TestLimiter_AcquireWaitsForSlot(t *testing.T) {
+	l := newTestLimiter(Config{Initial: 1, Min: 1, Max: 1})
+
+	token, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan struct{})
+	go func() {
+		next, err := l.Acquire(context.Background())
+		assert.NoError(t, err)
+		l.Release(next, nil)
+		close(acquired)
+	}()
+
+	l.Release(token, nil)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire did not return after Release")
+	}
+	assert.Equal(t, 0, l.InFlight())
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/mock"
 
+	"github.com/shabohin/photo-tags/services/analyzer/internal/cache"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
 )
 
@@ -74,3 +75,25 @@ func (m *MockImageAnalyzer) AnalyzeImage(ctx context.Context, msg model.ImageUpl
 	}
 	return result, args.Error(1)
 }
+
+// MockMetadataCache mock for metadata cache
+type MockMetadataCache struct {
+	mock.Mock
+}
+
+func (m *MockMetadataCache) Lookup(
+	ctx context.Context, key cache.Key, promptVersion, traceID string,
+) (model.Metadata, bool) {
+	args := m.Called(ctx, key, promptVersion, traceID)
+	result, ok := args.Get(0).(model.Metadata)
+	if !ok {
+		return model.Metadata{}, false
+	}
+	return result, args.Bool(1)
+}
+
+func (m *MockMetadataCache) Store(
+	ctx context.Context, key cache.Key, promptVersion, modelName string, metadata model.Metadata, traceID string,
+) {
+	m.Called(ctx, key, promptVersion, modelName, metadata, traceID)
+}
@@ -8,8 +8,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/api/openrouter"
-	"github.com/shabohin/photo-tags/services/analyzer/internal/monitoring"
 )
 
 // ModelSelector manages automatic selection and caching of the best free vision model
@@ -20,9 +20,10 @@ type ModelSelector struct {
 	currentModel   string
 	currentModelMu sync.RWMutex
 	fallbackModel  string
+	preferred      []string
 	stopChan       chan struct{}
 	stoppedChan    chan struct{}
-	metrics        *monitoring.Metrics
+	metrics        *metrics.Metrics
 }
 
 // NewModelSelector creates a new ModelSelector instance
@@ -39,7 +40,7 @@ func NewModelSelector(
 		fallbackModel: fallbackModel,
 		stopChan:      make(chan struct{}),
 		stoppedChan:   make(chan struct{}),
-		metrics:       monitoring.NewMetrics(),
+		metrics:       metrics.New(),
 	}
 }
 
@@ -92,7 +93,10 @@ func (s *ModelSelector) updateModels(ctx context.Context) {
 		return
 	}
 
-	selected, err := s.client.SelectBestFreeVisionModel(models)
+	selected := s.selectPreferredModel(models)
+	if selected == nil {
+		selected, err = s.client.SelectBestFreeVisionModel(models)
+	}
 	if err != nil {
 		s.metrics.Incr("model_selector.update.errors", []string{"error:selection_failed"})
 		s.logger.WithError(err).Error("Failed to select best free vision model")
@@ -129,6 +133,31 @@ func (s *ModelSelector) updateModels(ctx context.Context) {
 	}
 }
 
+// SetPreferredModels sets an ordered preference list, e.g. from a benchmark ranking.
+// The first preferred model that is currently available wins over automatic selection.
+func (s *ModelSelector) SetPreferredModels(modelIDs []string) {
+	s.currentModelMu.Lock()
+	defer s.currentModelMu.Unlock()
+	s.preferred = modelIDs
+}
+
+// selectPreferredModel returns the highest ranked preferred model that is available
+func (s *ModelSelector) selectPreferredModel(models []openrouter.Model) *openrouter.Model {
+	s.currentModelMu.RLock()
+	preferred := s.preferred
+	s.currentModelMu.RUnlock()
+
+	for _, id := range preferred {
+		for i := range models {
+			if models[i].ID == id {
+				return &models[i]
+			}
+		}
+	}
+
+	return nil
+}
+
 // GetCurrentModel returns the currently selected model ID
 func (s *ModelSelector) GetCurrentModel() (string, error) {
 	s.currentModelMu.RLock()
@@ -230,3 +230,49 @@ func TestModelSelector_ThreadSafety(t *testing.T) {
 
 	mockClient.AssertExpectations(t)
 }
+
+func TestModelSelector_UpdateModels_PreferredModel(t *testing.T) {
+	mockClient := new(MockOpenRouterClient)
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	testModels := []openrouter.Model{
+		{ID: "test-model-1", Name: "Test Model 1"},
+		{ID: "test-model-2", Name: "Test Model 2"},
+	}
+
+	mockClient.On("GetAvailableModels", mock.Anything).Return(testModels, nil)
+
+	selector := NewModelSelector(mockClient, logger, 1*time.Hour, "fallback-model")
+	selector.SetPreferredModels([]string{"unavailable-model", "test-model-2", "test-model-1"})
+	selector.updateModels(context.Background())
+
+	currentModel, err := selector.GetCurrentModel()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-model-2", currentModel)
+
+	mockClient.AssertNotCalled(t, "SelectBestFreeVisionModel", mock.Anything)
+}
+
+func TestModelSelector_UpdateModels_PreferredModelUnavailable(t *testing.T) {
+	mockClient := new(MockOpenRouterClient)
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	testModels := []openrouter.Model{
+		{ID: "test-model-1", Name: "Test Model 1"},
+	}
+
+	mockClient.On("GetAvailableModels", mock.Anything).Return(testModels, nil)
+	mockClient.On("SelectBestFreeVisionModel", testModels).Return(&testModels[0], nil)
+
+	selector := NewModelSelector(mockClient, logger, 1*time.Hour, "fallback-model")
+	selector.SetPreferredModels([]string{"unavailable-model"})
+	selector.updateModels(context.Background())
+
+	currentModel, err := selector.GetCurrentModel()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-model-1", currentModel)
+
+	mockClient.AssertExpectations(t)
+}
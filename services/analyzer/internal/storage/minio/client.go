@@ -10,6 +10,8 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 type Client struct {
@@ -68,7 +70,17 @@ func NewClient(endpoint,
 	return nil, err
 }
 
+// DownloadImage reads an original image in a "minio.download" span
 func (c *Client) DownloadImage(ctx context.Context, path string) ([]byte, error) {
+	span, ctx := tracing.StartSpan(ctx, "minio.download")
+	span.SetTag("bucket", c.originalBucket)
+	span.SetTag("object", path)
+	data, err := c.downloadImage(ctx, path)
+	span.Finish(err)
+	return data, err
+}
+
+func (c *Client) downloadImage(ctx context.Context, path string) ([]byte, error) {
 	object, err := c.client.GetObject(ctx, c.originalBucket, path, minio.GetObjectOptions{})
 	if err != nil {
 		c.logger.WithFields(logrus.Fields{
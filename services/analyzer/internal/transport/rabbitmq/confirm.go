@@ -0,0 +1,155 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retryConfirmTimeout is how long a retry publish waits for the broker to confirm it
+const retryConfirmTimeout = 5 * time.Second
+
+// Retry publish errors
+var (
+	errConfirmTimeout = errors.New("publish not confirmed in time")
+	errPublishNacked  = errors.New("publish rejected by broker")
+	errUnroutable     = errors.New("message could not be routed to a queue")
+	errChannelClosed  = errors.New("channel closed before the publish was confirmed")
+)
+
+// confirmer matches the publisher confirms and returned messages of a channel to the retry
+// publish waiting for them, like the confirmer of pkg/messaging. Publishes are serialized, so a
+// basic.return always belongs to the next confirm.
+type confirmer struct {
+	publishMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  map[uint64]chan error
+	returned bool
+	closed   bool
+}
+
+// newConfirmer puts channel into confirm mode and starts dispatching its confirms
+func newConfirmer(channel *amqp.Channel) (*confirmer, error) {
+	if err := channel.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	cf := &confirmer{pending: make(map[uint64]chan error)}
+	// Unbuffered, so the return is received before the confirm that follows it
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation))
+	returns := channel.NotifyReturn(make(chan amqp.Return))
+	go cf.dispatch(confirms, returns)
+
+	return cf, nil
+}
+
+// publish publishes msg to queue with mandatory set and waits until the broker confirms it
+func (cf *confirmer) publish(ctx context.Context, channel *amqp.Channel, queue string, msg amqp.Publishing) error {
+	cf.publishMu.Lock()
+	defer cf.publishMu.Unlock()
+
+	tag := channel.GetNextPublishSeqNo()
+	result := cf.expect(tag)
+	err := channel.PublishWithContext(
+		ctx,
+		"",    // exchange
+		queue, // routing key
+		true,  // mandatory
+		false, // immediate
+		msg,
+	)
+	if err != nil {
+		cf.forget(tag)
+		return err
+	}
+
+	timer := time.NewTimer(retryConfirmTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		cf.forget(tag)
+		return errConfirmTimeout
+	}
+}
+
+// dispatch delivers confirms to waiting publishes until the channel closes
+func (cf *confirmer) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case _, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			cf.mu.Lock()
+			cf.returned = true
+			cf.mu.Unlock()
+		case confirm, ok := <-confirms:
+			if !ok {
+				cf.close()
+				return
+			}
+			cf.resolve(confirm)
+		}
+	}
+}
+
+// expect registers the publish with delivery tag and returns the channel its result is sent to
+func (cf *confirmer) expect(tag uint64) <-chan error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	result := make(chan error, 1)
+	if cf.closed {
+		result <- errChannelClosed
+		return result
+	}
+	cf.pending[tag] = result
+	return result
+}
+
+// forget stops waiting for a publish that failed or timed out; its late confirm is ignored
+func (cf *confirmer) forget(tag uint64) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	delete(cf.pending, tag)
+}
+
+// resolve reports a confirm to the publish waiting for it
+func (cf *confirmer) resolve(confirm amqp.Confirmation) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	var err error
+	switch {
+	case !confirm.Ack:
+		err = errPublishNacked
+	case cf.returned:
+		err = errUnroutable
+	}
+	cf.returned = false
+
+	if result, ok := cf.pending[confirm.DeliveryTag]; ok {
+		result <- err
+		delete(cf.pending, confirm.DeliveryTag)
+	}
+}
+
+// close fails all waiting publishes once the channel is gone
+func (cf *confirmer) close() {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	cf.closed = true
+	for tag, result := range cf.pending {
+		result <- errChannelClosed
+		delete(cf.pending, tag)
+	}
+}
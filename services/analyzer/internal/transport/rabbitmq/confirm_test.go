@@ -0,0 +1,70 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConfirmer() (*confirmer, chan amqp.Confirmation, chan amqp.Return) {
+	cf := &confirmer{pending: make(map[uint64]chan error)}
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+	go cf.dispatch(confirms, returns)
+	return cf, confirms, returns
+}
+
+func receive(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no publish result")
+		return nil
+	}
+}
+
+func TestConfirmer_AckNackAndReturn(t *testing.T) {
+	cf, confirms, returns := newTestConfirmer()
+
+	result := cf.expect(1)
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	assert.NoError(t, receive(t, result))
+
+	result = cf.expect(2)
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	assert.ErrorIs(t, receive(t, result), errPublishNacked)
+
+	result = cf.expect(3)
+	returns <- amqp.Return{RoutingKey: "image_upload.retry.10s"}
+	confirms <- amqp.Confirmation{DeliveryTag: 3, Ack: true}
+	assert.ErrorIs(t, receive(t, result), errUnroutable)
+
+	result = cf.expect(4)
+	confirms <- amqp.Confirmation{DeliveryTag: 4, Ack: true}
+	assert.NoError(t, receive(t, result), "a return only affects the next confirm")
+}
+
+func TestConfirmer_LateConfirmAfterTimeout(t *testing.T) {
+	cf, confirms, _ := newTestConfirmer()
+
+	cf.expect(1)
+	cf.forget(1)
+
+	result := cf.expect(2)
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	assert.ErrorIs(t, receive(t, result), errPublishNacked)
+}
+
+func TestConfirmer_ChannelClosed(t *testing.T) {
+	cf, confirms, _ := newTestConfirmer()
+
+	result := cf.expect(1)
+	close(confirms)
+	assert.ErrorIs(t, receive(t, result), errChannelClosed)
+	assert.ErrorIs(t, receive(t, cf.expect(2)), errChannelClosed)
+}
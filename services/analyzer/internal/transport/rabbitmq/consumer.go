@@ -4,27 +4,51 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/priority"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/tracing"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
 )
 
+// ErrNotAttempted marks a handler failure before the message was processed, such as shutdown
+// while waiting for a concurrency slot. The message is requeued without using a retry tier.
+var ErrNotAttempted = errors.New("message was not attempted")
+
+// HeaderParseFailures counts the failed deliveries of a message whose model response could not be parsed
+const HeaderParseFailures = "x-parse-failures"
+
+type parseFailuresKey struct{}
+
 type Consumer struct {
 	logger        *logrus.Logger
 	conn          *amqp.Connection
 	channel       *amqp.Channel
+	confirms      *confirmer
 	url           string
 	queueName     string
 	retryDelay    time.Duration
 	prefetchCount int
 	maxRetries    int
+	weights       priority.Weights
+
+	// channelPrefetch caps the unacked messages of all consumers on the channel; 0 means no cap
+	channelPrefetch int
+
+	// mu guards conn, channel, confirms and channelPrefetch, which the reconnect goroutine replaces
+	mu sync.Mutex
 }
 
 func NewConsumer(
 	url string,
 	queueName string,
 	prefetchCount int,
+	weights priority.Weights,
 	maxRetries int,
 	retryDelay time.Duration,
 	logger *logrus.Logger,
@@ -33,6 +57,7 @@ func NewConsumer(
 		url:           url,
 		queueName:     queueName,
 		prefetchCount: prefetchCount,
+		weights:       weights,
 		maxRetries:    maxRetries,
 		retryDelay:    retryDelay,
 		logger:        logger,
@@ -46,10 +71,13 @@ func NewConsumer(
 }
 
 func (c *Consumer) connect() error {
-	var err error
+	var (
+		conn *amqp.Connection
+		err  error
+	)
 
 	for i := 0; i < c.maxRetries; i++ {
-		c.conn, err = amqp.Dial(c.url)
+		conn, err = amqp.Dial(c.url)
 		if err == nil {
 			break
 		}
@@ -62,17 +90,17 @@ func (c *Consumer) connect() error {
 		return fmt.Errorf("failed to connect to RabbitMQ after %d attempts: %w", c.maxRetries, err)
 	}
 
-	c.channel, err = c.conn.Channel()
+	channel, err := conn.Channel()
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to open channel: %w", err)
 	}
 
 	// First, declare the dead letter queue
-	dlqName := "dead_letter_queue"
-	_, err = c.channel.QueueDeclare(
+	dlqName := retryqueue.DeadLetterQueue
+	_, err = channel.QueueDeclare(
 		dlqName,
 		true,  // durable
 		false, // delete when unused
@@ -81,14 +109,14 @@ func (c *Consumer) connect() error {
 		nil,   // arguments
 	)
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to declare dead letter queue: %w", err)
 	}
 
 	// Then declare the main queue with DLQ configuration
-	_, err = c.channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		c.queueName,
 		true,  // durable
 		false, // delete when unused
@@ -100,26 +128,86 @@ func (c *Consumer) connect() error {
 		},
 	)
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	err = c.channel.Qos(
+	// Batch and filewatcher uploads wait in the bulk lane
+	bulkQueue := priority.QueueName(c.queueName, priority.LaneBulk)
+	_, err = channel.QueueDeclare(
+		bulkQueue,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table(priority.BulkQueueArgs(dlqName)),
+	)
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+		}
+		return fmt.Errorf("failed to declare bulk queue: %w", err)
+	}
+
+	// Failed messages wait in the retry queues of their lane before they are delivered again
+	for _, queue := range append(retryqueue.Queues(c.queueName), retryqueue.Queues(bulkQueue)...) {
+		_, err = channel.QueueDeclare(
+			queue.Name,
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table(queue.Args),
+		)
+		if err != nil {
+			if closeErr := conn.Close(); closeErr != nil {
+				c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+			}
+			return fmt.Errorf("failed to declare retry queue %s: %w", queue.Name, err)
+		}
+	}
+
+	err = channel.Qos(
 		c.prefetchCount, // prefetch count
 		0,               // prefetch size
 		false,           // global
 	)
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to set QoS: %w", err)
 	}
 
+	// Retry publishes wait for the broker to confirm them before the failed message is acked
+	confirms, err := newConfirmer(channel)
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+		}
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	// Hold the lock while the channel cap is applied, so SetChannelPrefetch cannot miss the new channel
+	c.mu.Lock()
+	if c.channelPrefetch > 0 {
+		if err := channel.Qos(c.channelPrefetch, 0, true); err != nil {
+			c.mu.Unlock()
+			if closeErr := conn.Close(); closeErr != nil {
+				c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+			}
+			return fmt.Errorf("failed to set channel QoS: %w", err)
+		}
+	}
+	c.conn = conn
+	c.channel = channel
+	c.confirms = confirms
+	c.mu.Unlock()
+
 	go func() {
-		<-c.conn.NotifyClose(make(chan *amqp.Error))
+		<-conn.NotifyClose(make(chan *amqp.Error))
 		c.logger.Warn("RabbitMQ connection closed, attempting to reconnect...")
 		for {
 			if err := c.connect(); err != nil {
@@ -135,13 +223,88 @@ func (c *Consumer) connect() error {
 	return nil
 }
 
-func (c *Consumer) Consume(ctx context.Context, handler func(message []byte) error) error {
-	if c.conn == nil || c.conn.IsClosed() {
+// SetChannelPrefetch caps the unacked messages of all consumers on the channel at count, on top
+// of the prefetch count of every consumer. The cap is applied again after a reconnect.
+func (c *Consumer) SetChannelPrefetch(count int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channelPrefetch = count
+
+	if c.channel == nil || c.channel.IsClosed() {
+		return errors.New("channel is not open")
+	}
+	if err := c.channel.Qos(count, 0, true); err != nil {
+		return fmt.Errorf("failed to set channel QoS: %w", err)
+	}
+	return nil
+}
+
+// Consume delivers messages from the interactive and bulk lanes to handler, weighted by the
+// consumer weights, with a context carrying the trace context and source of the message
+func (c *Consumer) Consume(ctx context.Context, handler func(ctx context.Context, message []byte) error) error {
+	conn, channel := c.current()
+	if conn == nil || conn.IsClosed() {
 		return errors.New("connection is not open")
 	}
 
-	msgs, err := c.channel.Consume(
-		c.queueName,
+	interactive, err := c.consumeLane(channel, priority.LaneInteractive)
+	if err != nil {
+		return err
+	}
+	bulk, err := c.consumeLane(channel, priority.LaneBulk)
+	if err != nil {
+		return err
+	}
+	receiver := priority.NewReceiver(c.weights, interactive, bulk)
+
+	for {
+		msg, lane, err := receiver.Receive(ctx)
+		if errors.Is(err, priority.ErrLaneClosed) {
+			c.logger.Warn("Consumer channel closed")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		queueName := priority.QueueName(c.queueName, lane)
+		c.logger.WithFields(logrus.Fields{
+			"delivery_tag": msg.DeliveryTag,
+			"content_type": msg.ContentType,
+			"queue":        queueName,
+		}).Debug("Received message")
+
+		msgCtx := priority.Extract(tracing.Extract(ctx, msg.Headers), msg.Headers)
+		msgCtx = withParseFailures(retryqueue.Extract(msgCtx, msg.Headers), msg.Headers)
+		span, msgCtx := tracing.StartSpan(msgCtx, "rabbitmq.consume")
+		span.SetTag("queue", queueName)
+		err = handler(msgCtx, msg.Body)
+		span.Finish(err)
+		c.settle(ctx, queueName, msg, err)
+	}
+}
+
+// settle acks a handled message, requeues one that was not attempted and retries a failed one
+func (c *Consumer) settle(ctx context.Context, queueName string, msg amqp.Delivery, failure error) {
+	switch {
+	case failure == nil:
+		if err := msg.Ack(false); err != nil {
+			c.logger.WithError(err).Error("Failed to ack message")
+		}
+	case errors.Is(failure, ErrNotAttempted):
+		c.logger.WithError(failure).Debug("Message was not attempted, requeueing")
+		if err := msg.Nack(false, true); err != nil {
+			c.logger.WithError(err).Error("Failed to nack message")
+		}
+	default:
+		c.retry(ctx, queueName, msg, failure)
+	}
+}
+
+// consumeLane registers a consumer on the queue of lane
+func (c *Consumer) consumeLane(channel *amqp.Channel, lane priority.Lane) (<-chan amqp.Delivery, error) {
+	msgs, err := channel.Consume(
+		priority.QueueName(c.queueName, lane),
 		"",    // consumer
 		false, // auto-ack
 		false, // exclusive
@@ -150,49 +313,124 @@ func (c *Consumer) Consume(ctx context.Context, handler func(message []byte) err
 		nil,   // args
 	)
 	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+		return nil, fmt.Errorf("failed to register %s consumer: %w", lane, err)
 	}
+	return msgs, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case msg, ok := <-msgs:
-			if !ok {
-				c.logger.Warn("Consumer channel closed")
-				return nil
-			}
+// retry publishes a message that failed on queueName to its next retry queue, or the dead letter
+// queue after the last tier, and acks it once the broker confirms the publish. If that publish
+// fails, is rejected or is not confirmed in time the message is dead-lettered by the broker.
+func (c *Consumer) retry(ctx context.Context, queueName string, msg amqp.Delivery, failure error) {
+	// Interrupted by shutdown: deliver the message again after the restart
+	if ctx.Err() != nil {
+		if err := msg.Nack(false, true); err != nil {
+			c.logger.WithError(err).Error("Failed to nack message")
+		}
+		return
+	}
 
-			c.logger.WithFields(logrus.Fields{
-				"delivery_tag": msg.DeliveryTag,
-				"content_type": msg.ContentType,
-			}).Debug("Received message")
-
-			err := handler(msg.Body)
-			if err != nil {
-				c.logger.WithError(err).Error("Failed to process message, sending to DLQ")
-				// Nack with requeue=false to send message to dead letter queue
-				if err := msg.Nack(false, false); err != nil {
-					c.logger.WithError(err).Error("Failed to nack message")
-				}
-			} else {
-				if err := msg.Ack(false); err != nil {
-					c.logger.WithError(err).Error("Failed to ack message")
-				}
-			}
+	target, headers := retryqueue.Route(queueName, msg.Headers, failure, time.Now())
+	countParseFailure(headers, failure)
+	log := c.logger.WithFields(logrus.Fields{
+		"error":       failure.Error(),
+		"retry_count": retryqueue.RetryCount(headers),
+		"target":      target,
+	})
+
+	channel, confirms := c.retryPublisher()
+	err := confirms.publish(
+		ctx,
+		channel,
+		target,
+		amqp.Publishing{
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			DeliveryMode:  amqp.Persistent,
+			Priority:      msg.Priority,
+			Headers:       amqp.Table(headers),
+			Body:          msg.Body,
+		},
+	)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish message for retry, sending to DLQ")
+		// Nack with requeue=false to send message to dead letter queue
+		if err := msg.Nack(false, false); err != nil {
+			c.logger.WithError(err).Error("Failed to nack message")
 		}
+		return
+	}
+
+	if target == retryqueue.DeadLetterQueue {
+		log.Error("Failed to process message, sending to DLQ")
+	} else {
+		log.Warn("Failed to process message, scheduling retry")
+	}
+	if err := msg.Ack(false); err != nil {
+		c.logger.WithError(err).Error("Failed to ack message")
+	}
+}
+
+// withParseFailures returns ctx carrying the parse failures from the message headers
+func withParseFailures(ctx context.Context, headers amqp.Table) context.Context {
+	return context.WithValue(ctx, parseFailuresKey{}, intHeader(headers, HeaderParseFailures))
+}
+
+// ParseFailures returns how many earlier deliveries of the message handled with ctx failed because
+// the model response could not be parsed
+func ParseFailures(ctx context.Context) int {
+	count, _ := ctx.Value(parseFailuresKey{}).(int)
+	return count
+}
+
+// countParseFailure adds failure to the parse failures in the headers of the next delivery
+func countParseFailure(headers map[string]interface{}, failure error) {
+	if errors.Is(failure, model.ErrMetadataParse) {
+		headers[HeaderParseFailures] = int64(intHeader(headers, HeaderParseFailures) + 1)
+	}
+}
+
+// intHeader returns the integer header key, or 0 if it is missing
+func intHeader(headers map[string]interface{}, key string) int {
+	switch value := headers[key].(type) {
+	case int:
+		return value
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	default:
+		return 0
 	}
 }
 
+// current returns the connection and channel, which a reconnect replaces
+func (c *Consumer) current() (*amqp.Connection, *amqp.Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.channel
+}
+
+// retryPublisher returns the channel and its confirmer, which a reconnect replaces
+func (c *Consumer) retryPublisher() (*amqp.Channel, *confirmer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.channel, c.confirms
+}
+
 func (c *Consumer) Close() error {
-	if c.channel != nil {
-		if err := c.channel.Close(); err != nil {
+	conn, channel := c.current()
+	if channel != nil {
+		if err := channel.Close(); err != nil {
 			return err
 		}
 	}
 
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil {
 			return err
 		}
 	}
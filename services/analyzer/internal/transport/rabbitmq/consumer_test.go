@@ -0,0 +1,92 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
+)
+
+// redeliver routes a failed delivery and returns the context of its next delivery
+func redeliver(headers amqp.Table, failure error) (amqp.Table, context.Context) {
+	_, next := retryqueue.Route("image_upload", headers, failure, time.Now())
+	countParseFailure(next, failure)
+	return amqp.Table(next), withParseFailures(retryqueue.Extract(context.Background(), next), amqp.Table(next))
+}
+
+func TestParseFailures_CarriedAcrossDeliveries(t *testing.T) {
+	ctx := withParseFailures(context.Background(), nil)
+	assert.Equal(t, 0, retryqueue.RetryCountFromContext(ctx))
+	assert.Equal(t, 0, ParseFailures(ctx))
+
+	parseErr := fmt.Errorf("image analysis failed: %w", model.ErrMetadataParse)
+	headers, ctx := redeliver(nil, parseErr)
+	assert.Equal(t, 1, retryqueue.RetryCountFromContext(ctx))
+	assert.Equal(t, 1, ParseFailures(ctx))
+
+	headers, ctx = redeliver(headers, errors.New("connection reset"))
+	assert.Equal(t, 2, retryqueue.RetryCountFromContext(ctx))
+	assert.Equal(t, 1, ParseFailures(ctx))
+
+	_, ctx = redeliver(headers, parseErr)
+	assert.Equal(t, 3, retryqueue.RetryCountFromContext(ctx))
+	assert.Equal(t, 2, ParseFailures(ctx))
+}
+
+func TestParseFailures_WithoutDelivery(t *testing.T) {
+	assert.Equal(t, 0, ParseFailures(context.Background()))
+}
+
+// fakeAcknowledger records how a delivery was settled
+type fakeAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *fakeAcknowledger) Ack(uint64, bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(_ uint64, requeue bool) error {
+	return a.Nack(0, false, requeue)
+}
+
+func TestSettle_NotAttemptedIsRequeuedWithoutRetryTier(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	c := &Consumer{logger: logger}
+
+	ack := &fakeAcknowledger{}
+	failure := fmt.Errorf("%w: %v", ErrNotAttempted, context.DeadlineExceeded)
+	c.settle(context.Background(), "image_upload", amqp.Delivery{Acknowledger: ack}, failure)
+
+	assert.True(t, ack.nacked)
+	assert.True(t, ack.requeue)
+	assert.False(t, ack.acked)
+}
+
+func TestSettle_AcksHandledMessage(t *testing.T) {
+	c := &Consumer{logger: logrus.New()}
+
+	ack := &fakeAcknowledger{}
+	c.settle(context.Background(), "image_upload", amqp.Delivery{Acknowledger: ack}, nil)
+
+	assert.True(t, ack.acked)
+	assert.False(t, ack.nacked)
+}
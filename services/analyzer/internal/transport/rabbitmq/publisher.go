@@ -7,6 +7,10 @@ import (
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/priority"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 type Publisher struct {
@@ -67,7 +71,10 @@ func (p *Publisher) connect() error {
 		false, // delete when unused
 		false, // exclusive
 		false, // no-wait
-		nil,   // arguments
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": retryqueue.DeadLetterQueue,
+		},
 	)
 	if err != nil {
 		if closeErr := p.conn.Close(); closeErr != nil {
@@ -76,6 +83,21 @@ func (p *Publisher) connect() error {
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
+	_, err = p.channel.QueueDeclare(
+		priority.QueueName(p.queueName, priority.LaneBulk),
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table(priority.BulkQueueArgs(retryqueue.DeadLetterQueue)),
+	)
+	if err != nil {
+		if closeErr := p.conn.Close(); closeErr != nil {
+			p.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+		}
+		return fmt.Errorf("failed to declare bulk queue: %w", err)
+	}
+
 	go func() {
 		<-p.conn.NotifyClose(make(chan *amqp.Error))
 		p.logger.Warn("RabbitMQ connection closed, attempting to reconnect...")
@@ -93,6 +115,8 @@ func (p *Publisher) connect() error {
 	return nil
 }
 
+// Publish publishes message to the lane of the source carried by ctx, so metadata of bulk uploads
+// stays in the bulk lane
 func (p *Publisher) Publish(ctx context.Context, message []byte) error {
 	if p.conn == nil || p.conn.IsClosed() {
 		if err := p.connect(); err != nil {
@@ -103,14 +127,22 @@ func (p *Publisher) Publish(ctx context.Context, message []byte) error {
 	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	headers := amqp.Table{}
+	tracing.Inject(ctx, headers)
+	priority.Inject(ctx, headers)
+
+	source := priority.SourceFromContext(ctx)
+	queueName := priority.QueueFor(p.queueName, source)
 	err := p.channel.PublishWithContext(
 		publishCtx,
-		"",          // exchange
-		p.queueName, // routing key
-		false,       // mandatory
-		false,       // immediate
+		"",        // exchange
+		queueName, // routing key
+		false,     // mandatory
+		false,     // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			Headers:     headers,
+			Priority:    priority.Priority(source),
 			Body:        message,
 		},
 	)
@@ -120,7 +152,7 @@ func (p *Publisher) Publish(ctx context.Context, message []byte) error {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
-	p.logger.WithField("queue", p.queueName).Debug("Message published successfully")
+	p.logger.WithField("queue", queueName).Debug("Message published successfully")
 	return nil
 }
 
@@ -18,6 +18,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/api/openrouter"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/config"
 	"github.com/shabohin/photo-tags/services/analyzer/internal/domain/model"
@@ -380,6 +381,7 @@ func TestGracefulShutdown(t *testing.T) {
 		testRabbitMQURL,
 		"test-shutdown-queue-"+time.Now().Format("20060102150405"),
 		5,
+		priority.DefaultWeights,
 		retryAttempts,
 		retryDelay,
 		logger,
@@ -402,7 +404,7 @@ func TestGracefulShutdown(t *testing.T) {
 
 	go func() {
 		defer close(consumeDone)
-		handler := func(msg []byte) error {
+		handler := func(_ context.Context, msg []byte) error {
 			logger.Info("Received message during shutdown test")
 			return nil
 		}
@@ -465,6 +467,7 @@ func TestEndToEndWorkflow(t *testing.T) {
 		testRabbitMQURL,
 		queueName,
 		1,
+		priority.DefaultWeights,
 		retryAttempts,
 		retryDelay,
 		logger,
@@ -523,8 +526,8 @@ func TestEndToEndWorkflow(t *testing.T) {
 
 	// Consume and process message
 	messageProcessed := make(chan bool, 1)
-	handler := func(msg []byte) error {
-		err := processor.Process(ctx, msg)
+	handler := func(msgCtx context.Context, msg []byte) error {
+		err := processor.Process(msgCtx, msg)
 		if err == nil {
 			messageProcessed <- true
 		}
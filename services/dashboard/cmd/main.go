@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	pkgmetrics "github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/dashboard/internal/api"
 	"github.com/shabohin/photo-tags/services/dashboard/internal/config"
 	"github.com/shabohin/photo-tags/services/dashboard/internal/metrics"
@@ -20,6 +21,15 @@ func main() {
 	// Загружаем конфигурацию
 	cfg := config.Load()
 
+	// Инициализируем экспорт метрик (Prometheus, OTLP или Datadog)
+	metricsCfg := pkgmetrics.ConfigFromEnv("dashboard", "v1.0.0")
+	if _, err := pkgmetrics.Init(metricsCfg); err != nil {
+		log.Printf("Failed to initialize metrics: %v", err)
+	} else {
+		log.Printf("Metrics initialized with %s backend", metricsCfg.Backend)
+		defer func() { _ = pkgmetrics.Stop() }()
+	}
+
 	// Создаем сервис метрик
 	metricsService := metrics.NewService(cfg.RabbitMQURL)
 
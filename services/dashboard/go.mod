@@ -1,8 +1,11 @@
 module github.com/shabohin/photo-tags/services/dashboard
 
-go 1.21
+go 1.24.0
+
+replace github.com/shabohin/photo-tags/pkg => ../../pkg
 
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/rabbitmq/amqp091-go v1.10.0
+	github.com/shabohin/photo-tags/pkg v0.0.0
 )
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	pkgmetrics "github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/dashboard/internal/config"
 	"github.com/shabohin/photo-tags/services/dashboard/internal/metrics"
 )
@@ -30,6 +31,9 @@ func (h *Handler) SetupRoutes(router *mux.Router) {
 	router.HandleFunc("/api/rabbitmq/queues", h.handleRabbitMQQueues).Methods("GET")
 	router.HandleFunc("/api/config", h.handleConfig).Methods("GET")
 
+	// Prometheus metrics
+	router.Handle("/metrics", pkgmetrics.Handler()).Methods("GET")
+
 	// Static files
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static")))
 }
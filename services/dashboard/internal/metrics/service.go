@@ -8,10 +8,12 @@ import (
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	pkgmetrics "github.com/shabohin/photo-tags/pkg/metrics"
 )
 
 type Service struct {
 	rabbitMQURL string
+	recorder    *pkgmetrics.Metrics
 }
 
 type ServiceStatus struct {
@@ -42,6 +44,7 @@ type Stats struct {
 func NewService(rabbitMQURL string) *Service {
 	return &Service{
 		rabbitMQURL: rabbitMQURL,
+		recorder:    pkgmetrics.New(),
 	}
 }
 
@@ -105,7 +108,9 @@ func (s *Service) GetRabbitMQQueues(ctx context.Context) ([]QueueInfo, error) {
 
 	queues := []string{
 		"image_uploaded",
+		"image_upload.bulk",
 		"metadata_generated",
+		"metadata_generated.bulk",
 		"image_processed",
 	}
 
@@ -156,6 +161,7 @@ func (s *Service) GetMetrics(ctx context.Context, gatewayURL, analyzerURL, proce
 	for _, svc := range services {
 		status := s.CheckServiceHealth(ctx, svc.name, svc.url)
 		metrics.Services = append(metrics.Services, status)
+		s.recorder.Gauge("service.healthy", boolToFloat(status.Healthy), []string{"target:" + svc.name})
 	}
 
 	// Получаем информацию об очередях
@@ -166,6 +172,9 @@ func (s *Service) GetMetrics(ctx context.Context, gatewayURL, analyzerURL, proce
 		// Подсчитываем общее количество сообщений в очередях
 		for _, queue := range queues {
 			metrics.Stats.QueuedImages += queue.Messages
+			tags := []string{"queue:" + queue.Name}
+			s.recorder.Gauge("rabbitmq.queue.messages", float64(queue.Messages), tags)
+			s.recorder.Gauge("rabbitmq.queue.consumers", float64(queue.Consumers), tags)
 		}
 	}
 
@@ -202,3 +211,11 @@ type HealthResponse struct {
 func (h *HealthResponse) Marshal() ([]byte, error) {
 	return json.Marshal(h)
 }
+
+// boolToFloat переводит флаг в значение gauge-метрики
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/pkg/storage"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/api"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/config"
@@ -58,6 +59,16 @@ func main() {
 	logger := logging.NewLogger("filewatcher")
 	logger.Info("Starting File Watcher Service v1.0.0 at "+time.Now().Format(time.RFC3339), nil)
 
+	// Initialize metrics
+	metricsCfg := metrics.ConfigFromEnv("filewatcher", "v1.0.0")
+	if _, err := metrics.Init(metricsCfg); err != nil {
+		logger.Error("Failed to initialize metrics", err)
+		// Continue anyway as metrics are optional
+	} else {
+		logger.Info("Metrics initialized", map[string]interface{}{"backend": metricsCfg.Backend})
+		defer func() { _ = metrics.Stop() }()
+	}
+
 	// Initialize statistics
 	stats := statistics.NewStatistics()
 
@@ -79,7 +90,7 @@ func main() {
 	cons := consumer.NewConsumer(cfg, logger, minioClient, rabbitmqClient, stats)
 
 	// Create API server
-	apiServer := api.NewServer(cfg, logger, watch, stats)
+	apiServer := api.NewServer(cfg, logger, watch, stats, rabbitmqClient)
 
 	// Start consumer
 	if err := cons.Start(ctx); err != nil {
@@ -190,11 +201,11 @@ func initializeDependencies(
 
 	logger.Info("Declaring RabbitMQ queues", nil)
 
-	if _, err := rabbitmqClient.DeclareQueue(messaging.QueueImageUpload); err != nil {
+	if err := rabbitmqClient.DeclareLanes(messaging.QueueImageUpload); err != nil {
 		return nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueImageUpload, err)
 	}
 
-	if _, err := rabbitmqClient.DeclareQueue(messaging.QueueImageProcessed); err != nil {
+	if _, err := rabbitmqClient.DeclareQueueWithDLQ(messaging.QueueImageProcessed, messaging.QueueDeadLetter); err != nil {
 		return nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueImageProcessed, err)
 	}
 
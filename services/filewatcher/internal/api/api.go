@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/config"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/statistics"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/watcher"
@@ -15,11 +17,12 @@ import (
 
 // Server represents the HTTP API server
 type Server struct {
-	cfg     *config.Config
-	logger  *logging.Logger
-	watcher *watcher.Watcher
-	stats   *statistics.Statistics
-	server  *http.Server
+	cfg      *config.Config
+	logger   *logging.Logger
+	watcher  *watcher.Watcher
+	stats    *statistics.Statistics
+	rabbitmq messaging.RabbitMQInterface
+	server   *http.Server
 }
 
 // NewServer creates a new API server
@@ -28,12 +31,14 @@ func NewServer(
 	logger *logging.Logger,
 	watcher *watcher.Watcher,
 	stats *statistics.Statistics,
+	rabbitmq messaging.RabbitMQInterface,
 ) *Server {
 	return &Server{
-		cfg:     cfg,
-		logger:  logger,
-		watcher: watcher,
-		stats:   stats,
+		cfg:      cfg,
+		logger:   logger,
+		watcher:  watcher,
+		stats:    stats,
+		rabbitmq: rabbitmq,
 	}
 }
 
@@ -45,6 +50,7 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/stats", s.handleStats)
 	mux.HandleFunc("/scan", s.handleScan)
+	mux.Handle("/metrics", metrics.Handler())
 
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", s.cfg.ServerPort),
@@ -88,7 +94,19 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		"time":    time.Now().Format(time.RFC3339),
 	}
 
+	// Report unhealthy while RabbitMQ is down, processed images cannot be received
+	status := http.StatusOK
+	if s.rabbitmq != nil {
+		state := s.rabbitmq.State()
+		response["rabbitmq"] = state
+		if !state.Connected {
+			response["status"] = "unhealthy"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
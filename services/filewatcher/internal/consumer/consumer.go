@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/idempotency"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
 	"github.com/shabohin/photo-tags/pkg/models"
@@ -22,6 +26,7 @@ type Consumer struct {
 	minio    storage.MinIOInterface
 	rabbitmq messaging.RabbitMQInterface
 	stats    *statistics.Statistics
+	ledger   *idempotency.Ledger
 }
 
 // NewConsumer creates a new Consumer instance
@@ -38,6 +43,7 @@ func NewConsumer(
 		minio:    minio,
 		rabbitmq: rabbitmq,
 		stats:    stats,
+		ledger:   idempotency.NewLedger(idempotency.NewMemoryStore(idempotency.DefaultCapacity), "filewatcher"),
 	}
 }
 
@@ -48,16 +54,26 @@ func (c *Consumer) Start(ctx context.Context) error {
 	})
 
 	// Consume messages from image_processed queue
-	return c.rabbitmq.ConsumeMessages(messaging.QueueImageProcessed, func(body []byte) error {
-		return c.handleMessage(ctx, body)
+	return c.rabbitmq.ConsumeMessagesWithContext(messaging.QueueImageProcessed, func(msgCtx context.Context, body []byte) error {
+		// Skip redelivered messages whose file was already written to the output directory
+		traceID := idempotency.TraceID(body)
+		duplicate, err := c.ledger.Process(ctx, traceID, func() error {
+			return c.handleMessage(msgCtx, body)
+		})
+		if duplicate {
+			c.logger.Info("Skipping already processed message", map[string]interface{}{
+				"trace_id": traceID,
+			})
+		}
+		return err
 	})
 }
 
 // handleMessage handles a single message from RabbitMQ
 func (c *Consumer) handleMessage(ctx context.Context, body []byte) error {
 	var msg models.ImageProcessed
-	if err := json.Unmarshal(body, &msg); err != nil {
-		c.logger.Error("Failed to unmarshal message", err)
+	if _, err := envelope.Decode(body, envelope.TypeImageProcessed, &msg); err != nil {
+		c.logger.Error("Failed to decode message", err)
 		return err
 	}
 
@@ -78,7 +94,7 @@ func (c *Consumer) handleMessage(ctx context.Context, body []byte) error {
 	}
 
 	// Check status
-	if msg.Status != "success" {
+	if msg.Status != "success" && msg.Status != "completed" {
 		c.logger.Error("Image processing failed", fmt.Errorf("%s", msg.Error))
 		c.stats.AddError(fmt.Sprintf("Processing failed: %s", msg.Error), msg.TraceID)
 		return nil // Don't requeue, just log the error
@@ -112,6 +128,15 @@ func (c *Consumer) handleMessage(ctx context.Context, body []byte) error {
 		"output_path": outputPath,
 	})
 
+	// Save the XMP sidecar next to the unchanged image
+	if msg.SidecarPath != "" {
+		if err := c.saveSidecar(ctx, msg, outputPath); err != nil {
+			c.logger.Error("Failed to save XMP sidecar", err)
+			c.stats.AddError(fmt.Sprintf("Failed to save sidecar: %v", err), msg.TraceID)
+			return err
+		}
+	}
+
 	// Save metadata JSON if available
 	if err := c.saveMetadata(msg, outputPath); err != nil {
 		c.logger.Error("Failed to save metadata", err)
@@ -121,12 +146,44 @@ func (c *Consumer) handleMessage(ctx context.Context, body []byte) error {
 	return nil
 }
 
+// saveSidecar downloads the XMP sidecar and writes it next to the image (IMG_0001.jpg -> IMG_0001.xmp)
+func (c *Consumer) saveSidecar(ctx context.Context, msg models.ImageProcessed, imagePath string) error {
+	obj, err := c.minio.DownloadFile(ctx, storage.BucketProcessed, msg.SidecarPath)
+	if err != nil {
+		return fmt.Errorf("failed to download sidecar: %w", err)
+	}
+	defer func() {
+		if closeErr := obj.Close(); closeErr != nil {
+			c.logger.Error("Failed to close MinIO object", closeErr)
+		}
+	}()
+
+	sidecarData, err := io.ReadAll(obj)
+	if err != nil {
+		return fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	sidecarPath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".xmp"
+	if err := os.WriteFile(sidecarPath, sidecarData, 0644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+
+	c.logger.Info("Saved XMP sidecar", map[string]interface{}{
+		"trace_id":     msg.TraceID,
+		"sidecar_path": sidecarPath,
+	})
+
+	return nil
+}
+
 // saveMetadata saves metadata to a JSON file next to the image
 func (c *Consumer) saveMetadata(msg models.ImageProcessed, imagePath string) error {
 	metadata := map[string]interface{}{
 		"trace_id":          msg.TraceID,
 		"original_filename": msg.OriginalFilename,
 		"processed_path":    msg.ProcessedPath,
+		"sidecar_path":      msg.SidecarPath,
+		"removed_tags":      msg.RemovedTags,
 		"timestamp":         msg.Timestamp,
 		"status":            msg.Status,
 	}
@@ -2,6 +2,7 @@ package processor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,10 +10,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shabohin/photo-tags/pkg/envelope"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/config"
 	"github.com/shabohin/photo-tags/services/filewatcher/internal/statistics"
 )
@@ -43,10 +47,15 @@ func NewProcessor(
 	}
 }
 
-// ProcessFile processes a single file
-func (p *Processor) ProcessFile(ctx context.Context, filePath string) error {
+// ProcessFile processes a single file, starting the trace that follows it through the pipeline
+func (p *Processor) ProcessFile(ctx context.Context, filePath string) (err error) {
 	traceID := uuid.New().String()
 
+	span, ctx := tracing.StartSpan(ctx, "filewatcher.upload")
+	span.SetTag("file", filePath)
+	span.SetTag("trace_id", traceID)
+	defer func() { span.Finish(err) }()
+
 	p.logger.Info("Processing file", map[string]interface{}{
 		"trace_id": traceID,
 		"file":     filePath,
@@ -92,10 +101,22 @@ func (p *Processor) ProcessFile(ctx context.Context, filePath string) error {
 		OriginalFilename: filename,
 		OriginalPath:     objectName,
 		TelegramID:       0, // Not from Telegram
+		MergePolicy:      p.cfg.MergePolicy,
+		OutputMode:       p.cfg.OutputMode,
+		PrivacyProfile:   p.cfg.PrivacyProfile,
+	}
+
+	body, err := envelope.Encode(envelope.TypeImageUpload, envelope.ProducerFilewatcher, message)
+	if err != nil {
+		p.stats.AddError(fmt.Sprintf("Failed to encode message: %v", err), traceID)
+		p.stats.IncrementFailed()
+		return fmt.Errorf("failed to encode message: %w", err)
 	}
 
-	// Publish to RabbitMQ
-	if err := p.rabbitmq.PublishMessage(messaging.QueueImageUpload, message); err != nil {
+	// Publish to the bulk lane, so directory dumps do not delay interactive uploads
+	queue := priority.QueueFor(messaging.QueueImageUpload, priority.SourceFilewatcher)
+	headers := priority.Headers(priority.SourceFilewatcher)
+	if err := p.rabbitmq.PublishMessageWithHeaders(ctx, queue, json.RawMessage(body), headers); err != nil {
 		p.stats.AddError(fmt.Sprintf("Failed to publish to RabbitMQ: %v", err), traceID)
 		p.stats.IncrementFailed()
 		return fmt.Errorf("failed to publish to RabbitMQ: %w", err)
@@ -103,7 +124,7 @@ func (p *Processor) ProcessFile(ctx context.Context, filePath string) error {
 
 	p.logger.Info("Published to RabbitMQ", map[string]interface{}{
 		"trace_id": traceID,
-		"queue":    messaging.QueueImageUpload,
+		"queue":    queue,
 	})
 
 	// Mark as processed
@@ -3,9 +3,11 @@ package statistics
 import (
 	"sync"
 	"time"
+
+	"github.com/shabohin/photo-tags/pkg/metrics"
 )
 
-// Statistics tracks processing statistics
+// Statistics tracks processing statistics and records them as metrics
 type Statistics struct {
 	mu                sync.RWMutex
 	FilesProcessed    int64     `json:"files_processed"`
@@ -16,6 +18,7 @@ type Statistics struct {
 	StartTime         time.Time `json:"start_time"`
 	Errors            []Error   `json:"recent_errors"`
 	maxErrors         int
+	metrics           *metrics.Metrics
 }
 
 // Error represents an error that occurred during processing
@@ -31,6 +34,7 @@ func NewStatistics() *Statistics {
 		StartTime: time.Now(),
 		Errors:    make([]Error, 0, 10),
 		maxErrors: 10,
+		metrics:   metrics.New(),
 	}
 }
 
@@ -40,6 +44,7 @@ func (s *Statistics) IncrementProcessed() {
 	defer s.mu.Unlock()
 	s.FilesProcessed++
 	s.LastProcessedTime = time.Now()
+	s.metrics.Incr("files.processed", []string{})
 }
 
 // IncrementSuccessful increments the successful files counter
@@ -47,6 +52,7 @@ func (s *Statistics) IncrementSuccessful() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.FilesSuccessful++
+	s.metrics.Incr("files.successful", []string{})
 }
 
 // IncrementFailed increments the failed files counter
@@ -54,6 +60,7 @@ func (s *Statistics) IncrementFailed() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.FilesFailed++
+	s.metrics.Incr("files.failed", []string{})
 }
 
 // IncrementReceived increments the received files counter
@@ -61,6 +68,7 @@ func (s *Statistics) IncrementReceived() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.FilesReceived++
+	s.metrics.Incr("files.received", []string{})
 }
 
 // AddError adds an error to the statistics
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -12,14 +11,18 @@ import (
 	"time"
 
 	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/idempotency"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/pkg/models"
 	"github.com/shabohin/photo-tags/pkg/storage"
 	"github.com/shabohin/photo-tags/services/gateway/internal/batch"
 	"github.com/shabohin/photo-tags/services/gateway/internal/config"
 	"github.com/shabohin/photo-tags/services/gateway/internal/handler"
 	"github.com/shabohin/photo-tags/services/gateway/internal/monitoring"
+	"github.com/shabohin/photo-tags/services/gateway/internal/outbox"
 	"github.com/shabohin/photo-tags/services/gateway/internal/telegram"
 )
 
@@ -61,15 +64,25 @@ func main() {
 	logger := logging.NewLogger("gateway")
 	logger.Info("Starting Gateway Service v1.0.0 at "+time.Now().Format(time.RFC3339), nil)
 
-	// Initialize Datadog monitoring
+	// Initialize Datadog tracing
 	if err := monitoring.Init("gateway", "v1.0.0"); err != nil {
-		logger.Error("Failed to initialize Datadog monitoring", err)
+		logger.Error("Failed to initialize Datadog tracing", err)
 		// Continue anyway as monitoring is optional
 	} else if monitoring.IsEnabled() {
-		logger.Info("Datadog monitoring initialized successfully", nil)
+		logger.Info("Datadog tracing initialized successfully", nil)
 		defer monitoring.Stop()
 	} else {
-		logger.Info("Datadog monitoring disabled (DD_API_KEY not set)", nil)
+		logger.Info("Datadog tracing disabled (DD_API_KEY not set)", nil)
+	}
+
+	// Initialize metrics
+	metricsCfg := metrics.ConfigFromEnv("gateway", "v1.0.0")
+	if _, err := metrics.Init(metricsCfg); err != nil {
+		logger.Error("Failed to initialize metrics", err)
+		// Continue anyway as metrics are optional
+	} else {
+		logger.Info("Metrics initialized", map[string]interface{}{"backend": metricsCfg.Backend})
+		defer func() { _ = metrics.Stop() }()
 	}
 
 	// Initialize dependencies
@@ -88,6 +101,28 @@ func main() {
 	wsHub := batch.NewHub(logger)
 	batchProcessor := batch.NewProcessor(batchStorage, minioClient, rabbitmqClient, wsHub, logger)
 	batchHandler := batch.NewHandler(batchProcessor, batchStorage, wsHub, logger)
+	if repo != nil {
+		batchProcessor.SetRepository(repo)
+		batchHandler.SetCreatorStore(repo)
+	}
+
+	// Skip redelivered processed images; PostgreSQL keeps the ledger across restarts
+	var ledgerStore idempotency.Store = idempotency.NewMemoryStore(idempotency.DefaultCapacity)
+	if dbClient != nil {
+		ledgerRepo := database.NewRepository(dbClient)
+		ledgerStore = ledgerRepo
+		go idempotency.Prune(ctx, ledgerRepo, time.Hour)
+	}
+	batchProcessor.SetLedger(idempotency.NewLedger(ledgerStore, "gateway.batch"))
+
+	// Publish bot uploads through the outbox and remove originals that were never recorded
+	var relay *outbox.Relay
+	if repo != nil {
+		relay = outbox.NewRelay(repo, rabbitmqClient, logger)
+		go relay.Run(ctx)
+		go outbox.NewSweeper(minioClient, repo, logger).Run(ctx, outbox.DefaultSweepInterval)
+		logger.Info("Outbox relay and orphan sweeper started", nil)
+	}
 
 	// Start WebSocket hub
 	go wsHub.Run()
@@ -128,6 +163,10 @@ func main() {
 			logger.Error("Failed to create Telegram bot", err)
 			os.Exit(1)
 		}
+		bot.SetLedger(idempotency.NewLedger(ledgerStore, "gateway.bot"))
+		if relay != nil {
+			bot.SetOutbox(relay)
+		}
 
 		go func() {
 			if err := bot.Start(ctx); err != nil {
@@ -188,8 +227,8 @@ func (c *metadataGeneratedConsumer) consumeMessages(ctx context.Context, rabbitM
 func (c *metadataGeneratedConsumer) handleMessage(msg []byte) {
 	var generated models.MetadataGenerated
 
-	if err := json.Unmarshal(msg, &generated); err != nil {
-		c.logger.Error("Failed to unmarshal metadata_generated message", err)
+	if _, err := envelope.Decode(msg, envelope.TypeMetadataGenerated, &generated); err != nil {
+		c.logger.Error("Failed to decode metadata_generated message", err)
 		return
 	}
 
@@ -208,6 +247,16 @@ func (c *metadataGeneratedConsumer) handleMessage(msg []byte) {
 	}
 }
 
+// runMigrations applies all database migrations in order
+func runMigrations(ctx context.Context, dbClient *database.Client) error {
+	for _, migration := range database.Migrations {
+		if err := dbClient.RunMigrations(ctx, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // initializeDependencies initializes MinIO, RabbitMQ, and PostgreSQL clients
 func initializeDependencies(
 	ctx context.Context,
@@ -247,7 +296,7 @@ func initializeDependencies(
 	} else {
 		// Run migrations
 		logger.Info("Running database migrations", nil)
-		if err := dbClient.RunMigrations(ctx, database.InitialSchema); err != nil {
+		if err := runMigrations(ctx, dbClient); err != nil {
 			logger.Error("Failed to run migrations", err)
 			logger.Info("Continuing without database functionality", nil)
 			database.Close(dbClient)
@@ -306,15 +355,17 @@ func initializeDependencies(
 		return nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueDeadLetter, err)
 	}
 
-	if _, err := rabbitmqClient.DeclareQueue(messaging.QueueImageUpload); err != nil {
+	// Uploads have an interactive and a bulk lane
+	if err := rabbitmqClient.DeclareLanes(messaging.QueueImageUpload); err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueImageUpload, err)
 	}
 
-	if _, err := rabbitmqClient.DeclareQueue(messaging.QueueMetadataGenerated); err != nil {
+	// Consumed queues dead-letter the messages their consumers reject
+	if _, err := rabbitmqClient.DeclareQueueWithDLQ(messaging.QueueMetadataGenerated, messaging.QueueDeadLetter); err != nil {
 		return nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueMetadataGenerated, err)
 	}
 
-	if _, err := rabbitmqClient.DeclareQueue(messaging.QueueImageProcessed); err != nil {
+	if _, err := rabbitmqClient.DeclareQueueWithDLQ(messaging.QueueImageProcessed, messaging.QueueDeadLetter); err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("failed to declare queue %s: %w", messaging.QueueProcessed, err)
 	}
 
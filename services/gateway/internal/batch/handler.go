@@ -8,6 +8,7 @@ import (
 
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/services/gateway/internal/creator"
 )
 
 // Handler handles batch API requests
@@ -16,6 +17,8 @@ type Handler struct {
 	storage   *Storage
 	wsHub     *Hub
 	logger    *logging.Logger
+
+	creatorStore creator.Store
 }
 
 // NewHandler creates a new batch handler
@@ -28,6 +31,11 @@ func NewHandler(processor *Processor, storage *Storage, wsHub *Hub, logger *logg
 	}
 }
 
+// SetCreatorStore enables creator profiles for batches sent with an X-API-Key header
+func (h *Handler) SetCreatorStore(store creator.Store) {
+	h.creatorStore = store
+}
+
 // CreateBatch handles POST /api/v1/batch
 func (h *Handler) CreateBatch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -53,6 +61,16 @@ func (h *Handler) CreateBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.PrivacyProfile != "" && !models.IsPrivacyProfile(req.PrivacyProfile) {
+		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Unknown privacy profile: %s", req.PrivacyProfile))
+		return
+	}
+
+	if req.MergePolicy != "" && !models.IsMergePolicy(req.MergePolicy) {
+		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Unknown merge policy: %s", req.MergePolicy))
+		return
+	}
+
 	// Validate each image source
 	for i, img := range req.Images {
 		if img.URL == "" && img.Base64 == "" {
@@ -65,8 +83,19 @@ func (h *Handler) CreateBatch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Creator profile of the API key, written to every image
+	creatorProfile, err := creator.Lookup(r.Context(), h.creatorStore, creator.RequestOwner(r))
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get creator profile: %v", err))
+		return
+	}
+
 	// Create batch job
-	job, err := h.processor.CreateBatchJob(r.Context(), req.Images)
+	job, err := h.processor.CreateBatchJob(r.Context(), req.Images, JobOptions{
+		PrivacyProfile: req.PrivacyProfile,
+		MergePolicy:    req.MergePolicy,
+		Creator:        creatorProfile,
+	})
 	if err != nil {
 		h.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create batch job: %v", err))
 		return
@@ -178,6 +207,11 @@ func (h *Handler) ListBatches(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Storage returns the job storage, used to export the images of a job
+func (h *Handler) Storage() *Storage {
+	return h.storage
+}
+
 // SetupRoutes sets up batch API routes
 func (h *Handler) SetupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/batch", func(w http.ResponseWriter, r *http.Request) {
@@ -12,7 +12,9 @@ import (
 
 	"github.com/minio/minio-go/v7"
 	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/messaging"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/storage"
 	amqp "github.com/streadway/amqp"
 )
 
@@ -34,13 +36,21 @@ func (m *mockMinIOClient) GetPresignedURL(ctx context.Context, bucketName, objec
 	return "http://example.com/test.jpg", nil
 }
 
+func (m *mockMinIOClient) ListObjects(ctx context.Context, bucketName, prefix string) ([]storage.ObjectInfo, error) {
+	return nil, nil
+}
+
+func (m *mockMinIOClient) RemoveObject(ctx context.Context, bucketName, objectName string) error {
+	return nil
+}
+
 type mockRabbitMQClient struct{}
 
 func (m *mockRabbitMQClient) PublishMessage(queueName string, message interface{}) error {
 	return nil
 }
 
-func (m *mockRabbitMQClient) PublishMessageWithHeaders(queueName string, message interface{}, headers map[string]interface{}) error {
+func (m *mockRabbitMQClient) PublishMessageWithHeaders(ctx context.Context, queueName string, message interface{}, headers map[string]interface{}) error {
 	return nil
 }
 
@@ -48,10 +58,18 @@ func (m *mockRabbitMQClient) ConsumeMessages(queueName string, handler func([]by
 	return nil
 }
 
+func (m *mockRabbitMQClient) ConsumeMessagesWithContext(queueName string, handler func(context.Context, []byte) error) error {
+	return nil
+}
+
 func (m *mockRabbitMQClient) GetMessages(queueName string, maxMessages int) ([]amqp.Delivery, error) {
 	return nil, nil
 }
 
+func (m *mockRabbitMQClient) State() messaging.ConnectionState {
+	return messaging.ConnectionState{Connected: true}
+}
+
 func (m *mockRabbitMQClient) RequeueMessage(queueName string, message []byte) error {
 	return nil
 }
@@ -64,6 +82,10 @@ func (m *mockRabbitMQClient) DeclareQueueWithDLQ(name string, dlqName string) (i
 	return nil, nil
 }
 
+func (m *mockRabbitMQClient) DeclareLanes(name string) error {
+	return nil
+}
+
 func (m *mockRabbitMQClient) Close() {
 	// no-op
 }
@@ -12,10 +12,15 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/idempotency"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 // Processor handles batch processing operations
@@ -26,6 +31,9 @@ type Processor struct {
 	wsHub         *Hub
 	logger        *logging.Logger
 	httpClient    *http.Client
+
+	repo   database.RepositoryInterface
+	ledger *idempotency.Ledger
 }
 
 // NewProcessor creates a new batch processor
@@ -48,8 +56,29 @@ func NewProcessor(
 	}
 }
 
+// SetRepository records batch images in the images table so they can be exported like bot uploads
+func (p *Processor) SetRepository(repo database.RepositoryInterface) {
+	p.repo = repo
+}
+
+// SetLedger skips processed image messages that were already recorded, e.g. redeliveries after a crash
+func (p *Processor) SetLedger(ledger *idempotency.Ledger) {
+	p.ledger = ledger
+}
+
+// JobOptions are applied to every image of a batch job
+type JobOptions struct {
+	PrivacyProfile string
+	MergePolicy    string
+	Creator        *models.CreatorProfile
+}
+
 // CreateBatchJob creates a new batch processing job
-func (p *Processor) CreateBatchJob(ctx context.Context, images []models.ImageSource) (*models.BatchJob, error) {
+func (p *Processor) CreateBatchJob(
+	ctx context.Context,
+	images []models.ImageSource,
+	opts JobOptions,
+) (*models.BatchJob, error) {
 	// Generate job ID
 	jobID := uuid.New().String()
 
@@ -62,13 +91,18 @@ func (p *Processor) CreateBatchJob(ctx context.Context, images []models.ImageSou
 	})
 
 	// Process images asynchronously
-	go p.processBatchImages(ctx, job, images)
+	go p.processBatchImages(ctx, job, images, opts)
 
 	return job, nil
 }
 
 // processBatchImages processes all images in a batch
-func (p *Processor) processBatchImages(ctx context.Context, job *models.BatchJob, images []models.ImageSource) {
+func (p *Processor) processBatchImages(
+	ctx context.Context,
+	job *models.BatchJob,
+	images []models.ImageSource,
+	opts JobOptions,
+) {
 	for i, imageSource := range images {
 		// Check if context is canceled
 		select {
@@ -104,10 +138,10 @@ func (p *Processor) processBatchImages(ctx context.Context, job *models.BatchJob
 		p.storage.AddImage(job.JobID, imageStatus)
 
 		// Process the image
-		p.processImage(ctx, job.JobID, traceID, groupID, imageSource, filename)
+		p.processImage(ctx, job.JobID, traceID, groupID, imageSource, filename, opts)
 
 		// Send progress update
-		p.sendProgressUpdate(job.JobID, "progress", nil)
+		_ = p.sendProgressUpdate(job.JobID, "progress", nil)
 	}
 }
 
@@ -119,10 +153,16 @@ func (p *Processor) processImage(
 	groupID string,
 	imageSource models.ImageSource,
 	filename string,
+	opts JobOptions,
 ) {
+	span, ctx := tracing.StartSpan(ctx, "batch.upload")
+	span.SetTag("job_id", jobID)
+	span.SetTag("trace_id", traceID)
+	defer span.Finish(nil)
+
 	// Update status to processing
 	p.storage.UpdateImageStatus(jobID, traceID, "processing", "", "")
-	p.sendProgressUpdate(jobID, "progress", nil)
+	_ = p.sendProgressUpdate(jobID, "progress", nil)
 
 	// Download or decode image data
 	imageData, err := p.getImageData(imageSource)
@@ -154,15 +194,23 @@ func (p *Processor) processImage(
 		OriginalFilename: filename,
 		OriginalPath:     objectPath,
 		TelegramID:       0, // Special value for batch processing
+		MergePolicy:      opts.MergePolicy,
+		PrivacyProfile:   opts.PrivacyProfile,
+		Creator:          opts.Creator,
 	}
 
-	messageData, err := json.Marshal(message)
+	messageData, err := envelope.Encode(envelope.TypeImageUpload, envelope.ProducerGateway, message)
 	if err != nil {
-		p.handleImageError(jobID, traceID, fmt.Sprintf("Failed to marshal message: %v", err))
+		p.handleImageError(jobID, traceID, fmt.Sprintf("Failed to encode message: %v", err))
 		return
 	}
 
-	err = p.rabbitmqClient.PublishMessage(messaging.QueueImageUpload, messageData)
+	// Batch jobs go to the bulk lane, so they do not delay interactive uploads
+	queue := priority.QueueFor(messaging.QueueImageUpload, priority.SourceBatch)
+	headers := priority.Headers(priority.SourceBatch)
+	err = messaging.PublishWithRetry(messaging.DefaultPublishAttempts, messaging.DefaultPublishRetryDelay, func() error {
+		return p.rabbitmqClient.PublishMessageWithHeaders(ctx, queue, json.RawMessage(messageData), headers)
+	})
 	if err != nil {
 		p.handleImageError(jobID, traceID, fmt.Sprintf("Failed to publish to queue: %v", err))
 		return
@@ -171,8 +219,24 @@ func (p *Processor) processImage(
 	p.logger.Info("Published image to queue", map[string]interface{}{
 		"job_id":   jobID,
 		"trace_id": traceID,
-		"queue":    messaging.QueueImageUpload,
+		"queue":    queue,
 	})
+
+	// Log image to database if repository is available
+	if p.repo != nil {
+		username := message.TelegramUsername
+		img := &database.Image{
+			TraceID:          traceID,
+			TelegramUsername: &username,
+			Filename:         filename,
+			OriginalPath:     &objectPath,
+			Status:           database.StatusPending,
+		}
+		if err := p.repo.CreateImage(ctx, img); err != nil {
+			// Don't fail the batch if database logging fails
+			p.logger.Error("Failed to log batch image to database", err)
+		}
+	}
 }
 
 // getImageData retrieves image data from URL or base64
@@ -245,23 +309,23 @@ func (p *Processor) handleImageError(jobID string, traceID string, errorMsg stri
 	// Find the image
 	for _, img := range job.Images {
 		if img.TraceID == traceID {
-			p.sendProgressUpdate(jobID, "image_complete", &img)
+			_ = p.sendProgressUpdate(jobID, "image_complete", &img)
 			break
 		}
 	}
 
 	// Check if job is complete
 	if job.IsComplete() {
-		p.sendProgressUpdate(jobID, "job_complete", nil)
+		_ = p.sendProgressUpdate(jobID, "job_complete", nil)
 	}
 }
 
 // sendProgressUpdate sends a progress update via WebSocket
-func (p *Processor) sendProgressUpdate(jobID string, updateType string, image *models.BatchImageStatus) {
+func (p *Processor) sendProgressUpdate(jobID string, updateType string, image *models.BatchImageStatus) error {
 	job, err := p.storage.GetJob(jobID)
 	if err != nil {
 		p.logger.Error("Failed to get job for progress update", err)
-		return
+		return err
 	}
 
 	update := &models.WSProgressUpdate{
@@ -277,26 +341,39 @@ func (p *Processor) sendProgressUpdate(jobID string, updateType string, image *m
 	}
 
 	p.wsHub.BroadcastProgress(update)
+	return nil
 }
 
 // StartProcessedImageConsumer starts consuming processed image messages
 func (p *Processor) StartProcessedImageConsumer(ctx context.Context) error {
-	handler := func(msg []byte) error {
+	handler := func(_ context.Context, msg []byte) error {
 		var processed models.ImageProcessed
-		if err := json.Unmarshal(msg, &processed); err != nil {
-			p.logger.Error("Failed to unmarshal processed message", err)
+		if _, err := envelope.Decode(msg, envelope.TypeImageProcessed, &processed); err != nil {
+			p.logger.Error("Failed to decode processed message", err)
 			return err
 		}
 
 		// Check if this is a batch job (TelegramID == 0)
-		if processed.TelegramID == 0 {
-			p.handleProcessedImage(processed)
+		if processed.TelegramID != 0 {
+			return nil
 		}
-		return nil
+		if p.ledger == nil {
+			return p.handleProcessedImage(processed)
+		}
+
+		duplicate, err := p.ledger.Process(ctx, processed.TraceID, func() error {
+			return p.handleProcessedImage(processed)
+		})
+		if duplicate {
+			p.logger.Info("Skipping already processed batch image", map[string]interface{}{
+				"trace_id": processed.TraceID,
+			})
+		}
+		return err
 	}
 
 	go func() {
-		if err := p.rabbitmqClient.ConsumeMessages(messaging.QueueImageProcessed, handler); err != nil {
+		if err := p.rabbitmqClient.ConsumeMessagesWithContext(messaging.QueueImageProcessed, handler); err != nil {
 			p.logger.Error("Failed to consume messages", err)
 		}
 	}()
@@ -304,36 +381,93 @@ func (p *Processor) StartProcessedImageConsumer(ctx context.Context) error {
 	return nil
 }
 
-// handleProcessedImage handles a processed image from the queue
-func (p *Processor) handleProcessedImage(processed models.ImageProcessed) {
+// recordProcessedImage updates the database record of a batch image if repository is available
+func (p *Processor) recordProcessedImage(processed models.ImageProcessed, status string) error {
+	if p.repo == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if status == "failed" {
+		errorMsg := processed.Error
+		if err := p.repo.UpdateImageStatus(ctx, processed.TraceID, database.StatusFailed, &errorMsg); err != nil {
+			p.logger.Error("Failed to update batch image status in database", err)
+			return fmt.Errorf("failed to update batch image status: %w", err)
+		}
+		return nil
+	}
+
+	var metadata *database.ImageMetadata
+	if processed.Metadata != nil {
+		metadata = &database.ImageMetadata{
+			Title:                  processed.Metadata.Title,
+			Description:            processed.Metadata.Description,
+			Keywords:               processed.Metadata.Keywords,
+			HierarchicalKeywords:   processed.Metadata.HierarchicalKeywords,
+			Category:               processed.Metadata.Category,
+			SupplementalCategories: processed.Metadata.SupplementalCategories,
+			AltText:                processed.Metadata.AltText,
+			RemovedTags:            processed.RemovedTags,
+		}
+	}
+	if err := p.repo.UpdateImageProcessed(ctx, processed.TraceID, processed.ProcessedPath, metadata, database.StatusSuccess); err != nil {
+		p.logger.Error("Failed to update processed batch image in database", err)
+		return fmt.Errorf("failed to update processed batch image: %w", err)
+	}
+	return nil
+}
+
+// handleProcessedImage handles a processed image from the queue. It returns an error if the
+// image could not be recorded or its progress sent, so the message is delivered again.
+func (p *Processor) handleProcessedImage(processed models.ImageProcessed) error {
 	// Find which job this image belongs to
 	jobs := p.storage.ListJobs()
 	for _, job := range jobs {
 		for _, img := range job.Images {
 			if img.TraceID == processed.TraceID {
-				// Update image status
 				status := "completed"
 				if processed.Status == "failed" {
 					status = "failed"
 				}
-				p.storage.UpdateImageStatus(job.JobID, processed.TraceID, status, processed.ProcessedPath, processed.Error)
+				if err := p.recordProcessedImage(processed, status); err != nil {
+					return err
+				}
+
+				// Update image status; a redelivery after a failed progress update must not count it twice
+				if img.Status != status {
+					if err := p.storage.UpdateImageStatus(job.JobID, processed.TraceID, status, processed.ProcessedPath, processed.Error); err != nil {
+						return err
+					}
+				}
+				if len(processed.RemovedTags) > 0 {
+					_ = p.storage.SetImageRemovedTags(job.JobID, processed.TraceID, processed.RemovedTags)
+				}
+				if processed.Metadata != nil && processed.Metadata.AltText != "" {
+					_ = p.storage.SetImageAltText(job.JobID, processed.TraceID, processed.Metadata.AltText)
+				}
 
 				// Send progress update
-				updatedJob, _ := p.storage.GetJob(job.JobID)
+				updatedJob, err := p.storage.GetJob(job.JobID)
+				if err != nil {
+					return err
+				}
 				for _, updatedImg := range updatedJob.Images {
 					if updatedImg.TraceID == processed.TraceID {
-						p.sendProgressUpdate(job.JobID, "image_complete", &updatedImg)
+						if err := p.sendProgressUpdate(job.JobID, "image_complete", &updatedImg); err != nil {
+							return err
+						}
 						break
 					}
 				}
 
 				// Check if job is complete
 				if updatedJob.IsComplete() {
-					p.sendProgressUpdate(job.JobID, "job_complete", nil)
+					return p.sendProgressUpdate(job.JobID, "job_complete", nil)
 				}
 
-				return
+				return nil
 			}
 		}
 	}
+	return nil
 }
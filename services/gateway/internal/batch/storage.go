@@ -88,6 +88,34 @@ func (s *Storage) UpdateImageStatus(jobID string, traceID string, status string,
 	return nil
 }
 
+// SetImageRemovedTags records the tags the privacy profile removed from an image in a batch
+func (s *Storage) SetImageRemovedTags(jobID string, traceID string, tags []string) error {
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job.SetImageRemovedTags(traceID, tags)
+	return nil
+}
+
+// SetImageAltText records the generated alt text of an image in a batch
+func (s *Storage) SetImageAltText(jobID string, traceID string, altText string) error {
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job.SetImageAltText(traceID, altText)
+	return nil
+}
+
 // ListJobs returns all batch jobs
 func (s *Storage) ListJobs() []*models.BatchJob {
 	s.mu.RLock()
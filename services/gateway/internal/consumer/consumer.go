@@ -2,8 +2,8 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
 
+	"github.com/shabohin/photo-tags/pkg/envelope"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
 	"github.com/shabohin/photo-tags/pkg/models"
@@ -57,8 +57,8 @@ func (c *ImageProcessedConsumer) Start(ctx context.Context) error {
 // handleMessage processes a single message from the queue
 func (c *ImageProcessedConsumer) handleMessage(msg []byte) {
 	var processed models.ImageProcessed
-	if err := json.Unmarshal(msg, &processed); err != nil {
-		c.logger.Error("Failed to unmarshal image_processed message", err)
+	if _, err := envelope.Decode(msg, envelope.TypeImageProcessed, &processed); err != nil {
+		c.logger.Error("Failed to decode image_processed message", err)
 		return
 	}
 
@@ -68,7 +68,7 @@ func (c *ImageProcessedConsumer) handleMessage(msg []byte) {
 	})
 
 	// Update image record based on status
-	if processed.Status == "success" {
+	if processed.Status == "success" || processed.Status == "completed" {
 		// Get metadata from the message
 		// Note: The ImageProcessed model doesn't include metadata, so we need to update it
 		// For now, we'll mark it as completed. The metadata should be included in the message.
@@ -78,6 +78,8 @@ func (c *ImageProcessedConsumer) handleMessage(msg []byte) {
 		// Update processed path
 		if record, exists := c.imageStorage.GetByTraceID(processed.TraceID); exists {
 			record.ProcessedPath = processed.ProcessedPath
+			record.SidecarPath = processed.SidecarPath
+			record.RemovedTags = processed.RemovedTags
 		}
 
 		c.logger.Info("Image processing completed successfully", map[string]interface{}{
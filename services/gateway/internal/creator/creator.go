@@ -0,0 +1,131 @@
+package creator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// APIKeyHeader identifies HTTP API clients whose uploads use a stored creator profile
+const APIKeyHeader = "X-API-Key"
+
+// Store is the subset of the repository used for creator profiles
+type Store interface {
+	GetCreatorProfile(ctx context.Context, owner string) (*database.CreatorProfile, error)
+	SaveCreatorProfile(ctx context.Context, profile *database.CreatorProfile) error
+	DeleteCreatorProfile(ctx context.Context, owner string) error
+}
+
+// fieldLimits are the maximum lengths of the profile fields, matching the creator_profiles columns
+var fieldLimits = map[string]int{
+	"creator":     255,
+	"rights":      500,
+	"usage_terms": 2000,
+	"email":       255,
+	"phone":       50,
+	"website":     500,
+	"city":        255,
+	"country":     255,
+}
+
+// TelegramOwner returns the owner key of a Telegram user's profile
+func TelegramOwner(telegramID int64) string {
+	return "telegram:" + strconv.FormatInt(telegramID, 10)
+}
+
+// APIKeyOwner returns the owner key of an API key's profile; only a hash of the key is stored
+func APIKeyOwner(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "apikey:" + hex.EncodeToString(sum[:])
+}
+
+// RequestOwner returns the owner key for the API key of an HTTP request, or an empty string
+func RequestOwner(r *http.Request) string {
+	apiKey := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if apiKey == "" {
+		return ""
+	}
+	return APIKeyOwner(apiKey)
+}
+
+// Validate checks the length of every field and the email format
+func Validate(profile *models.CreatorProfile) error {
+	fields := map[string]string{
+		"creator":     profile.Creator,
+		"rights":      profile.Rights,
+		"usage_terms": profile.UsageTerms,
+		"email":       profile.Email,
+		"phone":       profile.Phone,
+		"website":     profile.Website,
+		"city":        profile.City,
+		"country":     profile.Country,
+	}
+	for name, value := range fields {
+		if len(value) > fieldLimits[name] {
+			return fmt.Errorf("%s must be at most %d characters", name, fieldLimits[name])
+		}
+	}
+
+	if profile.Email != "" && !strings.Contains(profile.Email, "@") {
+		return fmt.Errorf("email is not a valid address")
+	}
+
+	return nil
+}
+
+// ToMessage converts a stored profile to the form sent with image_upload
+func ToMessage(profile *database.CreatorProfile) *models.CreatorProfile {
+	if profile == nil {
+		return nil
+	}
+	return &models.CreatorProfile{
+		Creator:    profile.Creator,
+		Rights:     profile.Rights,
+		UsageTerms: profile.UsageTerms,
+		Email:      profile.Email,
+		Phone:      profile.Phone,
+		Website:    profile.Website,
+		City:       profile.City,
+		Country:    profile.Country,
+	}
+}
+
+// FromMessage converts a profile to its stored form for owner
+func FromMessage(owner string, profile *models.CreatorProfile) *database.CreatorProfile {
+	return &database.CreatorProfile{
+		Owner:      owner,
+		Creator:    strings.TrimSpace(profile.Creator),
+		Rights:     strings.TrimSpace(profile.Rights),
+		UsageTerms: strings.TrimSpace(profile.UsageTerms),
+		Email:      strings.TrimSpace(profile.Email),
+		Phone:      strings.TrimSpace(profile.Phone),
+		Website:    strings.TrimSpace(profile.Website),
+		City:       strings.TrimSpace(profile.City),
+		Country:    strings.TrimSpace(profile.Country),
+	}
+}
+
+// Lookup returns the profile of owner for an upload message, or nil if there is none
+func Lookup(ctx context.Context, store Store, owner string) (*models.CreatorProfile, error) {
+	if store == nil || owner == "" {
+		return nil, nil
+	}
+
+	stored, err := store.GetCreatorProfile(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := ToMessage(stored)
+	if profile.IsEmpty() {
+		return nil, nil
+	}
+	return profile, nil
+}
@@ -0,0 +1,101 @@
+package creator
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// Handler manages the creator profile of an API key over HTTP
+type Handler struct {
+	logger *logging.Logger
+	store  Store
+}
+
+// NewHandler creates a new creator profile handler
+func NewHandler(logger *logging.Logger, store Store) *Handler {
+	return &Handler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+// Profile handles GET, PUT and DELETE /api/v1/creator-profile for the API key in the X-API-Key header
+func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
+	owner := RequestOwner(r)
+	if owner == "" {
+		http.Error(w, APIKeyHeader+" header is required", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getProfile(w, r, owner)
+	case http.MethodPut:
+		h.saveProfile(w, r, owner)
+	case http.MethodDelete:
+		h.deleteProfile(w, r, owner)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getProfile returns the stored profile
+func (h *Handler) getProfile(w http.ResponseWriter, r *http.Request, owner string) {
+	profile, err := h.store.GetCreatorProfile(r.Context(), owner)
+	if err != nil {
+		h.logger.Error("Failed to get creator profile", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if profile == nil {
+		http.Error(w, "Creator profile not found", http.StatusNotFound)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, profile)
+}
+
+// saveProfile replaces the stored profile with the request body
+func (h *Handler) saveProfile(w http.ResponseWriter, r *http.Request, owner string) {
+	var profile models.CreatorProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := Validate(&profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored := FromMessage(owner, &profile)
+	if err := h.store.SaveCreatorProfile(r.Context(), stored); err != nil {
+		h.logger.Error("Failed to save creator profile", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, stored)
+}
+
+// deleteProfile removes the stored profile
+func (h *Handler) deleteProfile(w http.ResponseWriter, r *http.Request, owner string) {
+	if err := h.store.DeleteCreatorProfile(r.Context(), owner); err != nil {
+		h.logger.Error("Failed to delete creator profile", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendJSON writes a JSON response
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Error("Failed to encode response", err)
+	}
+}
@@ -0,0 +1,130 @@
+package creator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+)
+
+type memoryStore struct {
+	profiles map[string]*database.CreatorProfile
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{profiles: make(map[string]*database.CreatorProfile)}
+}
+
+func (s *memoryStore) GetCreatorProfile(_ context.Context, owner string) (*database.CreatorProfile, error) {
+	return s.profiles[owner], nil
+}
+
+func (s *memoryStore) SaveCreatorProfile(_ context.Context, profile *database.CreatorProfile) error {
+	s.profiles[profile.Owner] = profile
+	return nil
+}
+
+func (s *memoryStore) DeleteCreatorProfile(_ context.Context, owner string) error {
+	delete(s.profiles, owner)
+	return nil
+}
+
+func TestProfile_RequiresAPIKey(t *testing.T) {
+	handler := NewHandler(logging.NewLogger("test"), newMemoryStore())
+
+	w := httptest.NewRecorder()
+	handler.Profile(w, httptest.NewRequest(http.MethodGet, "/api/v1/creator-profile", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestProfile_SaveGetDelete(t *testing.T) {
+	store := newMemoryStore()
+	handler := NewHandler(logging.NewLogger("test"), store)
+
+	body := `{"creator": " Jane Doe ", "rights": "© 2026 Jane Doe", "email": "jane@example.com"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/creator-profile", strings.NewReader(body))
+	req.Header.Set(APIKeyHeader, "secret-key")
+	w := httptest.NewRecorder()
+	handler.Profile(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	stored := store.profiles[APIKeyOwner("secret-key")]
+	require.NotNil(t, stored)
+	assert.Equal(t, "Jane Doe", stored.Creator)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/creator-profile", nil)
+	req.Header.Set(APIKeyHeader, "secret-key")
+	w = httptest.NewRecorder()
+	handler.Profile(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "© 2026 Jane Doe", response["rights"])
+	assert.NotContains(t, response, "owner")
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/creator-profile", nil)
+	req.Header.Set(APIKeyHeader, "secret-key")
+	w = httptest.NewRecorder()
+	handler.Profile(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, store.profiles)
+}
+
+func TestProfile_ValidationError(t *testing.T) {
+	handler := NewHandler(logging.NewLogger("test"), newMemoryStore())
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/creator-profile", strings.NewReader(`{"email": "not-an-email"}`))
+	req.Header.Set(APIKeyHeader, "secret-key")
+	w := httptest.NewRecorder()
+	handler.Profile(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProfile_NotFound(t *testing.T) {
+	handler := NewHandler(logging.NewLogger("test"), newMemoryStore())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/creator-profile", nil)
+	req.Header.Set(APIKeyHeader, "other-key")
+	w := httptest.NewRecorder()
+	handler.Profile(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOwnerKeys(t *testing.T) {
+	assert.Equal(t, "telegram:42", TelegramOwner(42))
+
+	owner := APIKeyOwner("secret-key")
+	assert.True(t, strings.HasPrefix(owner, "apikey:"))
+	assert.NotContains(t, owner, "secret-key")
+	assert.LessOrEqual(t, len(owner), 100)
+}
+
+func TestLookup(t *testing.T) {
+	store := newMemoryStore()
+	store.profiles["telegram:1"] = &database.CreatorProfile{Owner: "telegram:1", Creator: "Jane Doe"}
+	store.profiles["telegram:2"] = &database.CreatorProfile{Owner: "telegram:2"}
+
+	profile, err := Lookup(context.Background(), store, "telegram:1")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", profile.Creator)
+
+	profile, err = Lookup(context.Background(), store, "telegram:2")
+	require.NoError(t, err)
+	assert.Nil(t, profile, "empty profiles are not sent")
+
+	profile, err = Lookup(context.Background(), nil, "telegram:1")
+	require.NoError(t, err)
+	assert.Nil(t, profile)
+}
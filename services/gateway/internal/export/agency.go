@@ -0,0 +1,171 @@
+package export
+
+import (
+	"sort"
+	"strings"
+)
+
+// Agency describes the CSV format and limits of a stock agency
+type Agency struct {
+	// Name identifies the agency in the API and the bot, e.g. "adobe"
+	Name string
+	// Label is the display name
+	Label string
+
+	header           []string
+	titleLimit       int
+	descriptionLimit int
+	maxKeywords      int
+	categories       map[Category]string
+	defaultCategory  string
+	record           func(row Row) []string
+}
+
+// Row is one exported image after the agency limits are applied
+type Row struct {
+	Filename    string
+	Title       string
+	Description string
+	Keywords    []string
+	Category    string
+}
+
+// adobeStock uses the Adobe Stock contributor CSV: numeric categories, up to 49 keywords
+var adobeStock = &Agency{
+	Name:        "adobe",
+	Label:       "Adobe Stock",
+	header:      []string{"Filename", "Title", "Keywords", "Category", "Releases"},
+	titleLimit:  200,
+	maxKeywords: 49,
+	categories: map[Category]string{
+		CategoryAnimals:      "1",
+		CategoryArchitecture: "2",
+		CategoryBusiness:     "3",
+		CategoryDrinks:       "4",
+		CategoryFood:         "7",
+		CategoryAbstract:     "8",
+		CategoryIndustry:     "10",
+		CategoryNature:       "11",
+		CategoryPeople:       "13",
+		CategoryPlants:       "14",
+		CategoryScience:      "16",
+		CategorySports:       "18",
+		CategoryTechnology:   "19",
+		CategoryTransport:    "20",
+		CategoryTravel:       "21",
+	},
+	record: func(row Row) []string {
+		return []string{row.Filename, row.Title, strings.Join(row.Keywords, ","), row.Category, ""}
+	},
+}
+
+// shutterstock uses the Shutterstock submission CSV: the title goes into Description, up to 50 keywords
+var shutterstock = &Agency{
+	Name:        "shutterstock",
+	Label:       "Shutterstock",
+	header:      []string{"Filename", "Description", "Keywords", "Categories", "Editorial", "Mature content", "illustration"},
+	titleLimit:  200,
+	maxKeywords: 50,
+	categories: map[Category]string{
+		CategoryAnimals:      "Animals/Wildlife",
+		CategoryArchitecture: "Buildings/Landmarks",
+		CategoryBusiness:     "Business/Finance",
+		CategoryFood:         "Food and drink",
+		CategoryDrinks:       "Food and drink",
+		CategoryNature:       "Nature",
+		CategoryPlants:       "Nature",
+		CategoryPeople:       "People",
+		CategoryTechnology:   "Technology",
+		CategoryScience:      "Science",
+		CategorySports:       "Sports/Recreation",
+		CategoryTransport:    "Transportation",
+		CategoryTravel:       "Parks/Outdoor",
+		CategoryIndustry:     "Industrial",
+		CategoryAbstract:     "Backgrounds/Textures",
+	},
+	defaultCategory: "Miscellaneous",
+	record: func(row Row) []string {
+		return []string{row.Filename, row.Title, strings.Join(row.Keywords, ","), row.Category, "no", "no", "no"}
+	},
+}
+
+// getty uses the Getty Images / iStock upload CSV: short titles, a separate description, up to 50 keywords
+var getty = &Agency{
+	Name:             "getty",
+	Label:            "Getty Images",
+	header:           []string{"file name", "title", "description", "keywords", "category"},
+	titleLimit:       100,
+	descriptionLimit: 250,
+	maxKeywords:      50,
+	categories: map[Category]string{
+		CategoryAnimals:      "Animals",
+		CategoryArchitecture: "Architecture",
+		CategoryBusiness:     "Business",
+		CategoryFood:         "Food and Drink",
+		CategoryDrinks:       "Food and Drink",
+		CategoryNature:       "Nature",
+		CategoryPlants:       "Nature",
+		CategoryPeople:       "People",
+		CategoryTechnology:   "Science and Technology",
+		CategoryScience:      "Science and Technology",
+		CategorySports:       "Sports",
+		CategoryTransport:    "Transportation",
+		CategoryTravel:       "Travel",
+		CategoryIndustry:     "Industry",
+		CategoryAbstract:     "Backgrounds",
+	},
+	record: func(row Row) []string {
+		return []string{row.Filename, row.Title, row.Description, strings.Join(row.Keywords, ","), row.Category}
+	},
+}
+
+// agencies lists the supported exporters by name
+var agencies = map[string]*Agency{
+	adobeStock.Name:   adobeStock,
+	shutterstock.Name: shutterstock,
+	getty.Name:        getty,
+}
+
+// LookupAgency returns the agency with the given name
+func LookupAgency(name string) (*Agency, bool) {
+	agency, ok := agencies[strings.ToLower(strings.TrimSpace(name))]
+	return agency, ok
+}
+
+// AgencyNames returns the names of the supported agencies, sorted
+func AgencyNames() []string {
+	names := make([]string, 0, len(agencies))
+	for name := range agencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// category maps a neutral category to the agency's value
+func (a *Agency) category(category Category) string {
+	if value, ok := a.categories[category]; ok {
+		return value
+	}
+	return a.defaultCategory
+}
+
+// limitKeywords removes empty and duplicate keywords (case-insensitively) and keeps at most limit,
+// in their original order. Commas are removed because keywords are comma-separated.
+func limitKeywords(keywords []string, limit int) []string {
+	result := make([]string, 0, len(keywords))
+	seen := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(strings.ReplaceAll(keyword, ",", " "))
+		key := strings.ToLower(keyword)
+		if keyword == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, keyword)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result
+}
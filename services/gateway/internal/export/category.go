@@ -0,0 +1,113 @@
+package export
+
+import (
+	"strings"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+)
+
+// Category is an agency-neutral subject category; each agency maps it to its own list
+type Category string
+
+const (
+	CategoryAnimals      Category = "animals"
+	CategoryArchitecture Category = "architecture"
+	CategoryBusiness     Category = "business"
+	CategoryFood         Category = "food"
+	CategoryDrinks       Category = "drinks"
+	CategoryNature       Category = "nature"
+	CategoryPlants       Category = "plants"
+	CategoryPeople       Category = "people"
+	CategoryTechnology   Category = "technology"
+	CategoryScience      Category = "science"
+	CategorySports       Category = "sports"
+	CategoryTransport    Category = "transport"
+	CategoryTravel       Category = "travel"
+	CategoryIndustry     Category = "industry"
+	CategoryAbstract     Category = "abstract"
+)
+
+// categoryKeywords maps generated keywords to a category
+var categoryKeywords = map[string]Category{
+	"animal": CategoryAnimals, "dog": CategoryAnimals, "cat": CategoryAnimals, "bird": CategoryAnimals,
+	"horse": CategoryAnimals, "wildlife": CategoryAnimals, "pet": CategoryAnimals, "fish": CategoryAnimals,
+	"insect": CategoryAnimals, "mammal": CategoryAnimals,
+
+	"architecture": CategoryArchitecture, "building": CategoryArchitecture, "house": CategoryArchitecture,
+	"bridge": CategoryArchitecture, "tower": CategoryArchitecture, "church": CategoryArchitecture,
+	"skyscraper": CategoryArchitecture, "interior": CategoryArchitecture,
+
+	"business": CategoryBusiness, "office": CategoryBusiness, "finance": CategoryBusiness,
+	"money": CategoryBusiness, "meeting": CategoryBusiness,
+
+	"food": CategoryFood, "food and drink": CategoryFood, "meal": CategoryFood, "fruit": CategoryFood, "vegetable": CategoryFood,
+	"bread": CategoryFood, "dessert": CategoryFood, "cake": CategoryFood, "pizza": CategoryFood,
+
+	"drink": CategoryDrinks, "coffee": CategoryDrinks, "tea": CategoryDrinks, "wine": CategoryDrinks,
+	"beer": CategoryDrinks, "cocktail": CategoryDrinks, "juice": CategoryDrinks,
+
+	"nature": CategoryNature, "landscape": CategoryNature, "mountain": CategoryNature, "sea": CategoryNature,
+	"ocean": CategoryNature, "beach": CategoryNature, "forest": CategoryNature, "lake": CategoryNature,
+	"river": CategoryNature, "sunset": CategoryNature,
+
+	"plant": CategoryPlants, "flower": CategoryPlants, "tree": CategoryPlants, "leaf": CategoryPlants,
+	"garden": CategoryPlants,
+
+	"people": CategoryPeople, "person": CategoryPeople, "man": CategoryPeople, "woman": CategoryPeople,
+	"child": CategoryPeople, "portrait": CategoryPeople, "family": CategoryPeople, "lifestyle": CategoryPeople,
+
+	"technology": CategoryTechnology, "computer": CategoryTechnology, "laptop": CategoryTechnology,
+	"smartphone": CategoryTechnology, "robot": CategoryTechnology, "electronics": CategoryTechnology,
+
+	"science": CategoryScience, "laboratory": CategoryScience, "research": CategoryScience,
+	"microscope": CategoryScience, "space": CategoryScience, "planet": CategoryScience,
+
+	"sport": CategorySports, "football": CategorySports, "soccer": CategorySports,
+	"basketball": CategorySports, "tennis": CategorySports, "fitness": CategorySports, "yoga": CategorySports,
+
+	"transport": CategoryTransport, "transportation": CategoryTransport, "car": CategoryTransport,
+	"train": CategoryTransport, "airplane": CategoryTransport, "bicycle": CategoryTransport,
+	"bus": CategoryTransport, "ship": CategoryTransport, "boat": CategoryTransport, "vehicle": CategoryTransport,
+
+	"travel": CategoryTravel, "vacation": CategoryTravel, "tourism": CategoryTravel,
+	"landmark": CategoryTravel, "hotel": CategoryTravel,
+
+	"industry": CategoryIndustry, "factory": CategoryIndustry, "construction": CategoryIndustry,
+	"machinery": CategoryIndustry,
+
+	"abstract": CategoryAbstract, "background": CategoryAbstract, "texture": CategoryAbstract,
+	"pattern": CategoryAbstract,
+}
+
+// imageCategory returns the category of an image, preferring the category chosen by the analyzer
+// over one derived from its keywords
+func imageCategory(metadata *database.ImageMetadata) Category {
+	if category := categoryFromKeywords([]string{metadata.Category}, nil); category != "" {
+		return category
+	}
+	return categoryFromKeywords(metadata.Keywords, metadata.HierarchicalKeywords)
+}
+
+// categoryFromKeywords returns the category of the first keyword that has one.
+// Top-level hierarchical keywords (e.g. "Animals" in "Animals|Mammals|Dog") are checked first
+// because they describe the subject rather than a detail.
+func categoryFromKeywords(keywords, hierarchical []string) Category {
+	candidates := make([]string, 0, len(hierarchical)+len(keywords))
+	for _, path := range hierarchical {
+		top, _, _ := strings.Cut(path, "|")
+		candidates = append(candidates, top)
+	}
+	candidates = append(candidates, keywords...)
+
+	for _, keyword := range candidates {
+		word := strings.ToLower(strings.TrimSpace(keyword))
+		if category, ok := categoryKeywords[word]; ok {
+			return category
+		}
+		// Plurals: "dogs", "flowers"
+		if category, ok := categoryKeywords[strings.TrimSuffix(word, "s")]; ok {
+			return category
+		}
+	}
+	return ""
+}
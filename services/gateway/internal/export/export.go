@@ -0,0 +1,67 @@
+// Package export writes processed images as stock agency submission CSVs
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/text"
+)
+
+// ContentType is the MIME type of exported files
+const ContentType = "text/csv; charset=utf-8"
+
+// Filename returns the name of an export file created at t
+func (a *Agency) Filename(t time.Time) string {
+	return fmt.Sprintf("%s-%s.csv", a.Name, t.Format("2006-01-02"))
+}
+
+// BuildRow applies the agency limits and category mapping to an image.
+// It returns false for images that have not been processed successfully.
+func (a *Agency) BuildRow(img *database.Image) (Row, bool) {
+	if img == nil || img.Status != database.StatusSuccess || img.Metadata == nil {
+		return Row{}, false
+	}
+
+	metadata := img.Metadata
+	row := Row{
+		Filename: img.Filename,
+		Title:    text.Truncate(metadata.Title, a.titleLimit),
+		Keywords: limitKeywords(metadata.Keywords, a.maxKeywords),
+		Category: a.category(imageCategory(metadata)),
+	}
+	if a.descriptionLimit > 0 {
+		row.Description = text.Truncate(metadata.Description, a.descriptionLimit)
+	}
+	return row, true
+}
+
+// Write writes the header and one row per successfully processed image.
+// It returns the number of images written.
+func (a *Agency) Write(w io.Writer, images []*database.Image) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(a.header); err != nil {
+		return 0, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	written := 0
+	for _, img := range images {
+		row, ok := a.BuildRow(img)
+		if !ok {
+			continue
+		}
+		if err := writer.Write(a.record(row)); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", img.Filename, err)
+		}
+		written++
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return written, fmt.Errorf("failed to flush csv: %w", err)
+	}
+	return written, nil
+}
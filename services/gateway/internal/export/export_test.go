@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+)
+
+func processedImage(filename string, metadata *database.ImageMetadata) *database.Image {
+	return &database.Image{
+		TraceID:  "trace-" + filename,
+		Filename: filename,
+		Status:   database.StatusSuccess,
+		Metadata: metadata,
+	}
+}
+
+func readCSV(t *testing.T, data []byte) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestWrite_AdobeStock(t *testing.T) {
+	images := []*database.Image{
+		processedImage("dog.jpg", &database.ImageMetadata{
+			Title:    "Golden retriever on a beach",
+			Keywords: []string{"dog", "beach", "Dog", " ", "sea, sand"},
+		}),
+		{Filename: "failed.jpg", Status: database.StatusFailed},
+		processedImage("empty.jpg", nil),
+	}
+
+	var buf bytes.Buffer
+	count, err := adobeStock.Write(&buf, images)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	records := readCSV(t, buf.Bytes())
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"Filename", "Title", "Keywords", "Category", "Releases"}, records[0])
+	assert.Equal(t, []string{"dog.jpg", "Golden retriever on a beach", "dog,beach,sea  sand", "1", ""}, records[1])
+}
+
+func TestWrite_AgencyLimits(t *testing.T) {
+	keywords := make([]string, 0, 60)
+	for i := 0; i < 60; i++ {
+		keywords = append(keywords, "keyword"+strings.Repeat("x", i))
+	}
+	img := processedImage("long.jpg", &database.ImageMetadata{
+		Title:       strings.Repeat("word ", 60),
+		Description: strings.Repeat("detail ", 60),
+		Keywords:    keywords,
+	})
+
+	adobe, ok := adobeStock.BuildRow(img)
+	require.True(t, ok)
+	assert.LessOrEqual(t, len(adobe.Title), 200)
+	assert.Len(t, adobe.Keywords, 49)
+
+	sstk, ok := shutterstock.BuildRow(img)
+	require.True(t, ok)
+	assert.Len(t, sstk.Keywords, 50)
+	assert.Equal(t, "Miscellaneous", sstk.Category)
+
+	gettyRow, ok := getty.BuildRow(img)
+	require.True(t, ok)
+	assert.LessOrEqual(t, len(gettyRow.Title), 100)
+	assert.LessOrEqual(t, len(gettyRow.Description), 250)
+	assert.False(t, strings.HasSuffix(gettyRow.Title, " "))
+	assert.True(t, strings.HasSuffix(gettyRow.Title, "word"), "titles are cut at word boundaries")
+}
+
+func TestCategoryFromKeywords(t *testing.T) {
+	assert.Equal(t, CategoryAnimals, categoryFromKeywords([]string{"beach", "dog"}, []string{"Animals|Mammals|Dog"}))
+	assert.Equal(t, CategoryNature, categoryFromKeywords([]string{"Mountains", "snow"}, nil))
+	assert.Equal(t, Category(""), categoryFromKeywords([]string{"blue"}, nil))
+}
+
+func TestImageCategory(t *testing.T) {
+	assert.Equal(t, CategoryFood, imageCategory(&database.ImageMetadata{Category: "Food and Drink", Keywords: []string{"dog"}}))
+	assert.Equal(t, CategoryTransport, imageCategory(&database.ImageMetadata{Category: "Transportation"}))
+	assert.Equal(t, CategoryAnimals, imageCategory(&database.ImageMetadata{Category: "Unknown", Keywords: []string{"dog"}}))
+}
+
+func TestCategoryMapping(t *testing.T) {
+	img := processedImage("cake.jpg", &database.ImageMetadata{Title: "Cake", Keywords: []string{"cake"}})
+
+	for name, want := range map[string]string{"adobe": "7", "shutterstock": "Food and drink", "getty": "Food and Drink"} {
+		agency, ok := LookupAgency(name)
+		require.True(t, ok, name)
+		row, _ := agency.BuildRow(img)
+		assert.Equal(t, want, row.Category, name)
+	}
+}
+
+func TestLookupAgency(t *testing.T) {
+	agency, ok := LookupAgency(" Adobe ")
+	require.True(t, ok)
+	assert.Equal(t, "Adobe Stock", agency.Label)
+
+	_, ok = LookupAgency("pond5")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"adobe", "getty", "shutterstock"}, AgencyNames())
+}
+
+func TestFilename(t *testing.T) {
+	date := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "shutterstock-2026-10-18.csv", shutterstock.Filename(date))
+}
@@ -0,0 +1,160 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// DefaultRangeDays is the export period when no start date is given
+const DefaultRangeDays = 30
+
+// ImageStore is the subset of the repository used to select exported images
+type ImageStore interface {
+	GetImagesByTraceIDs(ctx context.Context, traceIDs []string) ([]*database.Image, error)
+	GetImagesByDateRange(ctx context.Context, telegramID *int64, startDate, endDate time.Time) ([]*database.Image, error)
+}
+
+// JobStore resolves batch jobs to their images
+type JobStore interface {
+	GetJob(jobID string) (*models.BatchJob, error)
+}
+
+// Handler serves agency CSV exports over HTTP
+type Handler struct {
+	logger *logging.Logger
+	images ImageStore
+	jobs   JobStore
+}
+
+// NewHandler creates a new export handler; jobs may be nil when batch processing is disabled
+func NewHandler(logger *logging.Logger, images ImageStore, jobs JobStore) *Handler {
+	return &Handler{
+		logger: logger,
+		images: images,
+		jobs:   jobs,
+	}
+}
+
+// Export handles GET /api/v1/export/{agency}?job_id=... or ?start_date=...&end_date=...[&telegram_id=...]
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agency, ok := LookupAgency(strings.TrimPrefix(r.URL.Path, "/api/v1/export/"))
+	if !ok {
+		http.Error(w, "Unknown agency. Supported: "+strings.Join(AgencyNames(), ", "), http.StatusNotFound)
+		return
+	}
+
+	images, status, err := h.selectImages(r)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to get images for export", err)
+			http.Error(w, "Internal server error", status)
+			return
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var buf bytes.Buffer
+	count, err := agency.Write(&buf, images)
+	if err != nil {
+		h.logger.Error("Failed to write export", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", agency.Filename(time.Now())))
+	w.Header().Set("X-Exported-Images", strconv.Itoa(count))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		h.logger.Error("Failed to write response", err)
+	}
+
+	h.logger.Info("Stock export created", map[string]interface{}{
+		"agency": agency.Name,
+		"images": count,
+	})
+}
+
+// selectImages returns the images of a batch job or a date range, with the HTTP status for errors
+func (h *Handler) selectImages(r *http.Request) ([]*database.Image, int, error) {
+	query := r.URL.Query()
+
+	if jobID := query.Get("job_id"); jobID != "" {
+		if h.jobs == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("batch job not found")
+		}
+		job, err := h.jobs.GetJob(jobID)
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("batch job not found")
+		}
+
+		traceIDs := make([]string, 0, len(job.Images))
+		for _, img := range job.Images {
+			traceIDs = append(traceIDs, img.TraceID)
+		}
+		images, err := h.images.GetImagesByTraceIDs(r.Context(), traceIDs)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return images, http.StatusOK, nil
+	}
+
+	startDate, endDate, err := ParseDateRange(query.Get("start_date"), query.Get("end_date"), time.Now())
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	var telegramID *int64
+	if telegramIDStr := query.Get("telegram_id"); telegramIDStr != "" {
+		id, err := strconv.ParseInt(telegramIDStr, 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid telegram_id")
+		}
+		telegramID = &id
+	}
+
+	images, err := h.images.GetImagesByDateRange(r.Context(), telegramID, startDate, endDate)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return images, http.StatusOK, nil
+}
+
+// ParseDateRange parses YYYY-MM-DD dates; an empty start defaults to DefaultRangeDays before
+// now and an empty end to now
+func ParseDateRange(startStr, endStr string, now time.Time) (time.Time, time.Time, error) {
+	startDate := now.AddDate(0, 0, -DefaultRangeDays)
+	endDate := now
+
+	var err error
+	if startStr != "" {
+		if startDate, err = time.Parse("2006-01-02", startStr); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start_date format (expected YYYY-MM-DD)")
+		}
+	}
+	if endStr != "" {
+		if endDate, err = time.Parse("2006-01-02", endStr); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end_date format (expected YYYY-MM-DD)")
+		}
+	}
+	if endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date must not be before start_date")
+	}
+
+	return startDate, endDate, nil
+}
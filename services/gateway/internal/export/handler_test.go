@@ -0,0 +1,116 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+type mockImageStore struct {
+	images     []*database.Image
+	traceIDs   []string
+	telegramID *int64
+	startDate  time.Time
+	endDate    time.Time
+}
+
+func (m *mockImageStore) GetImagesByTraceIDs(_ context.Context, traceIDs []string) ([]*database.Image, error) {
+	m.traceIDs = traceIDs
+	return m.images, nil
+}
+
+func (m *mockImageStore) GetImagesByDateRange(
+	_ context.Context, telegramID *int64, startDate, endDate time.Time,
+) ([]*database.Image, error) {
+	m.telegramID = telegramID
+	m.startDate = startDate
+	m.endDate = endDate
+	return m.images, nil
+}
+
+type mockJobStore struct {
+	job *models.BatchJob
+}
+
+func (m *mockJobStore) GetJob(jobID string) (*models.BatchJob, error) {
+	if m.job == nil || m.job.JobID != jobID {
+		return nil, errors.New("job not found")
+	}
+	return m.job, nil
+}
+
+func TestExport_BatchJob(t *testing.T) {
+	store := &mockImageStore{images: []*database.Image{
+		processedImage("a.jpg", &database.ImageMetadata{Title: "A", Keywords: []string{"tree"}}),
+	}}
+	jobs := &mockJobStore{job: &models.BatchJob{
+		JobID:  "job-1",
+		Images: []models.BatchImageStatus{{TraceID: "t1"}, {TraceID: "t2"}},
+	}}
+	handler := NewHandler(logging.NewLogger("test"), store, jobs)
+
+	w := httptest.NewRecorder()
+	handler.Export(w, httptest.NewRequest(http.MethodGet, "/api/v1/export/getty?job_id=job-1", nil))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "getty-")
+	assert.Equal(t, "1", w.Header().Get("X-Exported-Images"))
+	assert.Equal(t, []string{"t1", "t2"}, store.traceIDs)
+
+	records := readCSV(t, w.Body.Bytes())
+	require.Len(t, records, 2)
+	assert.Equal(t, "Nature", records[1][4])
+}
+
+func TestExport_DateRange(t *testing.T) {
+	store := &mockImageStore{}
+	handler := NewHandler(logging.NewLogger("test"), store, nil)
+
+	w := httptest.NewRecorder()
+	url := "/api/v1/export/adobe?start_date=2026-01-01&end_date=2026-01-31&telegram_id=42"
+	handler.Export(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, store.telegramID)
+	assert.Equal(t, int64(42), *store.telegramID)
+	assert.Equal(t, "2026-01-01", store.startDate.Format("2006-01-02"))
+	assert.Equal(t, "2026-01-31", store.endDate.Format("2006-01-02"))
+	assert.Equal(t, "0", w.Header().Get("X-Exported-Images"))
+}
+
+func TestExport_Errors(t *testing.T) {
+	handler := NewHandler(logging.NewLogger("test"), &mockImageStore{}, &mockJobStore{})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+	}{
+		{"unknown agency", http.MethodGet, "/api/v1/export/pond5", http.StatusNotFound},
+		{"unknown job", http.MethodGet, "/api/v1/export/adobe?job_id=missing", http.StatusNotFound},
+		{"bad date", http.MethodGet, "/api/v1/export/adobe?start_date=01-01-2026", http.StatusBadRequest},
+		{"reversed range", http.MethodGet, "/api/v1/export/adobe?start_date=2026-02-01&end_date=2026-01-01", http.StatusBadRequest},
+		{"bad telegram_id", http.MethodGet, "/api/v1/export/adobe?telegram_id=abc", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/api/v1/export/adobe", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Export(w, httptest.NewRequest(tt.method, tt.url, nil))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -14,12 +14,18 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/envelope"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 	"github.com/shabohin/photo-tags/services/gateway/internal/batch"
 	"github.com/shabohin/photo-tags/services/gateway/internal/config"
+	"github.com/shabohin/photo-tags/services/gateway/internal/creator"
+	"github.com/shabohin/photo-tags/services/gateway/internal/export"
 	"github.com/shabohin/photo-tags/services/gateway/internal/stats"
 	imagestorage "github.com/shabohin/photo-tags/services/gateway/internal/storage"
 )
@@ -35,6 +41,10 @@ type Handler struct {
 	batchHandler *batch.Handler
 	adminHandler *AdminHandler
 	statsHandler *stats.Handler
+
+	creatorHandler *creator.Handler
+	creatorStore   creator.Store
+	exportHandler  *export.Handler
 }
 
 // NewHandler creates a new Handler
@@ -54,8 +64,19 @@ func NewHandler(
 	}).ParseGlob("web/templates/*.html"))
 
 	var statsHandler *stats.Handler
+	var creatorHandler *creator.Handler
+	var creatorStore creator.Store
+	var exportHandler *export.Handler
 	if repo != nil {
 		statsHandler = stats.NewHandler(logger, repo)
+		creatorHandler = creator.NewHandler(logger, repo)
+		creatorStore = repo
+
+		var jobs export.JobStore
+		if batchHandler != nil {
+			jobs = batchHandler.Storage()
+		}
+		exportHandler = export.NewHandler(logger, repo, jobs)
 	}
 
 	return &Handler{
@@ -68,10 +89,15 @@ func NewHandler(
 		batchHandler: batchHandler,
 		adminHandler: NewAdminHandler(logger, rabbitmqClient),
 		statsHandler: statsHandler,
+
+		creatorHandler: creatorHandler,
+		creatorStore:   creatorStore,
+		exportHandler:  exportHandler,
 	}
 }
 
-// HealthCheck handles health check requests
+// HealthCheck handles health check requests.
+// It reports 503 while the RabbitMQ connection is down so orchestrators notice the outage.
 func (h *Handler) HealthCheck(w http.ResponseWriter, _ *http.Request) {
 	response := map[string]interface{}{
 		"status":    "ok",
@@ -79,9 +105,19 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, _ *http.Request) {
 		"service":   "gateway",
 	}
 
+	status := http.StatusOK
+	if h.rabbitMQ != nil {
+		state := h.rabbitMQ.State()
+		response["rabbitmq"] = state
+		if !state.Connected {
+			response["status"] = "degraded"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
 	// Set headers
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	// Write response
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -96,6 +132,9 @@ func (h *Handler) SetupRoutes() http.Handler {
 	// Health check
 	mux.HandleFunc("/health", h.HealthCheck)
 
+	// Prometheus metrics
+	mux.Handle("/metrics", metrics.Handler())
+
 	// Static files
 	fs := http.FileServer(http.Dir("web/static"))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
@@ -130,9 +169,20 @@ func (h *Handler) SetupRoutes() http.Handler {
 		mux.HandleFunc("/api/v1/stats/daily", h.statsHandler.GetDailyStats)
 		mux.HandleFunc("/api/v1/stats/errors", h.statsHandler.GetRecentErrors)
 		mux.HandleFunc("/api/v1/stats/errors/summary", h.statsHandler.GetErrorStats)
+		mux.HandleFunc("/api/v1/stats/experiments", h.statsHandler.GetExperimentStats)
 		mux.HandleFunc("/api/v1/images/trace", h.statsHandler.GetImageByTraceID)
 	}
 
+	// Creator profile of the API key in the X-API-Key header
+	if h.creatorHandler != nil {
+		mux.HandleFunc("/api/v1/creator-profile", h.creatorHandler.Profile)
+	}
+
+	// Stock agency CSV exports
+	if h.exportHandler != nil {
+		mux.HandleFunc("/api/v1/export/", h.exportHandler.Export)
+	}
+
 	// Log middleware
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -218,8 +268,37 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 
 	// Validate file type
 	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		http.Error(w, "Only JPEG and PNG images are supported", http.StatusBadRequest)
+	if !storage.IsSupportedUpload(header.Filename) {
+		http.Error(w, "Only JPEG, PNG and camera RAW images are supported", http.StatusBadRequest)
+		return
+	}
+
+	// Optional output mode; empty uses the Processor default
+	outputMode := r.FormValue("output_mode")
+	if outputMode != "" && outputMode != models.OutputModeEmbedded && outputMode != models.OutputModeSidecar {
+		http.Error(w, "output_mode must be embedded or sidecar", http.StatusBadRequest)
+		return
+	}
+
+	// Optional merge policy for tags already in the image; empty uses the Processor default
+	mergePolicy := r.FormValue("merge_policy")
+	if mergePolicy != "" && !models.IsMergePolicy(mergePolicy) {
+		http.Error(w, "merge_policy must be one of: "+strings.Join(models.MergePolicies, ", "), http.StatusBadRequest)
+		return
+	}
+
+	// Optional privacy profile; empty uses the Processor default
+	privacyProfile := r.FormValue("privacy_profile")
+	if privacyProfile != "" && !models.IsPrivacyProfile(privacyProfile) {
+		http.Error(w, "privacy_profile must be one of: "+strings.Join(models.PrivacyProfiles, ", "), http.StatusBadRequest)
+		return
+	}
+
+	// Creator profile of the API key, written to the image by the Processor
+	creatorProfile, err := creator.Lookup(r.Context(), h.creatorStore, creator.RequestOwner(r))
+	if err != nil {
+		h.logger.Error("Failed to get creator profile", err)
+		http.Error(w, "Failed to process upload", http.StatusInternalServerError)
 		return
 	}
 
@@ -237,8 +316,11 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	span, ctx := tracing.StartSpan(r.Context(), "web.upload")
+	span.SetTag("trace_id", traceID)
+	defer span.Finish(nil)
+
 	// Upload to MinIO
-	ctx := context.Background()
 	if err := h.minioClient.UploadFile(ctx, storage.BucketOriginal, objectName, bytes.NewReader(fileContent), int64(len(fileContent))); err != nil {
 		h.logger.Error("Failed to upload to MinIO", err)
 		http.Error(w, "Failed to upload file", http.StatusInternalServerError)
@@ -265,16 +347,21 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		OriginalFilename: header.Filename,
 		OriginalPath:     objectName,
 		TelegramID:       0, // Web upload, no Telegram ID
+		MergePolicy:      mergePolicy,
+		OutputMode:       outputMode,
+		PrivacyProfile:   privacyProfile,
+		Creator:          creatorProfile,
 	}
 
-	messageBytes, err := json.Marshal(message)
+	messageBytes, err := envelope.Encode(envelope.TypeImageUpload, envelope.ProducerGateway, message)
 	if err != nil {
-		h.logger.Error("Failed to marshal message", err)
+		h.logger.Error("Failed to encode message", err)
 		http.Error(w, "Failed to process upload", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.rabbitMQ.PublishMessage(messaging.QueueImageUpload, messageBytes); err != nil {
+	headers := priority.Headers(priority.SourceWeb)
+	if err := h.rabbitMQ.PublishMessageWithHeaders(ctx, messaging.QueueImageUpload, json.RawMessage(messageBytes), headers); err != nil {
 		h.logger.Error("Failed to publish message", err)
 		http.Error(w, "Failed to process upload", http.StatusInternalServerError)
 		return
@@ -344,6 +431,8 @@ func (h *Handler) HandleImageAPI(w http.ResponseWriter, r *http.Request) {
 		h.downloadProcessed(w, r, record)
 	case "download-original":
 		h.downloadOriginal(w, r, record)
+	case "download-sidecar":
+		h.downloadSidecar(w, r, record)
 	default:
 		http.NotFound(w, r)
 	}
@@ -375,15 +464,7 @@ func (h *Handler) serveImage(w http.ResponseWriter, _ *http.Request, record *ima
 	defer reader.Close()
 
 	// Set content type
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".jpg", ".jpeg":
-		w.Header().Set("Content-Type", "image/jpeg")
-	case ".png":
-		w.Header().Set("Content-Type", "image/png")
-	default:
-		w.Header().Set("Content-Type", "application/octet-stream")
-	}
+	w.Header().Set("Content-Type", storage.ContentType(path))
 
 	// Copy file to response
 	if _, err := io.Copy(w, reader); err != nil {
@@ -416,6 +497,31 @@ func (h *Handler) downloadProcessed(w http.ResponseWriter, r *http.Request, reco
 	}
 }
 
+// downloadSidecar downloads the XMP sidecar written in sidecar output mode
+func (h *Handler) downloadSidecar(w http.ResponseWriter, r *http.Request, record *imagestorage.ImageRecord) {
+	if record.SidecarPath == "" {
+		http.Error(w, "XMP sidecar not available", http.StatusNotFound)
+		return
+	}
+
+	ctx := context.Background()
+	reader, err := h.minioClient.GetFile(ctx, storage.BucketProcessed, record.SidecarPath)
+	if err != nil {
+		h.logger.Error("Failed to get sidecar file from MinIO", err)
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	filename := strings.TrimSuffix(record.OriginalFilename, filepath.Ext(record.OriginalFilename)) + ".xmp"
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Type", "application/rdf+xml")
+
+	if _, err := io.Copy(w, reader); err != nil {
+		h.logger.Error("Failed to write download response", err)
+	}
+}
+
 // downloadOriginal downloads the original image
 func (h *Handler) downloadOriginal(w http.ResponseWriter, r *http.Request, record *imagestorage.ImageRecord) {
 	ctx := context.Background()
@@ -471,6 +577,8 @@ func (h *Handler) formatImageForTemplate(record *imagestorage.ImageRecord) map[s
 		"Status":           record.Status,
 		"UploadedAt":       record.UploadedAt.Format("2006-01-02 15:04:05"),
 		"Error":            record.Error,
+		"HasSidecar":       record.SidecarPath != "",
+		"RemovedTags":      record.RemovedTags,
 	}
 
 	if record.CompletedAt != nil {
@@ -479,9 +587,12 @@ func (h *Handler) formatImageForTemplate(record *imagestorage.ImageRecord) map[s
 
 	if record.Metadata != nil {
 		formatted["Metadata"] = map[string]interface{}{
-			"Title":       record.Metadata.Title,
-			"Description": record.Metadata.Description,
-			"Keywords":    record.Metadata.Keywords,
+			"Title":                record.Metadata.Title,
+			"Description":          record.Metadata.Description,
+			"Keywords":             record.Metadata.Keywords,
+			"HierarchicalKeywords": record.Metadata.HierarchicalKeywords,
+			"Category":             record.Metadata.Category,
+			"AltText":              record.Metadata.AltText,
 		}
 	}
 
@@ -0,0 +1,80 @@
+package monitoring
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	ddtracer "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
+)
+
+// remoteContextKey holds the span context extracted from message headers
+type remoteContextKey struct{}
+
+// datadogTracer reports spans to Datadog.
+// It injects and extracts both Datadog and W3C trace context headers, so a trace continues
+// through services that only propagate traceparent.
+type datadogTracer struct{}
+
+// StartSpan starts a span, child of the span in ctx or of the extracted remote span
+func (datadogTracer) StartSpan(ctx context.Context, operation string) (tracing.Span, context.Context) {
+	var opts []ddtracer.StartSpanOption
+	if _, ok := ddtracer.SpanFromContext(ctx); !ok {
+		if remote, ok := ctx.Value(remoteContextKey{}).(ddtrace.SpanContext); ok {
+			opts = append(opts, ddtracer.ChildOf(remote))
+		}
+	}
+
+	span, ctx := ddtracer.StartSpanFromContext(ctx, operation, opts...)
+	return datadogSpan{span: span}, ctx
+}
+
+// Inject writes the trace context of the span in ctx
+func (datadogTracer) Inject(ctx context.Context, headers map[string]interface{}) {
+	span, ok := ddtracer.SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	carrier := ddtracer.TextMapCarrier{}
+	if err := ddtracer.Inject(span.Context(), carrier); err != nil {
+		return
+	}
+	for key, value := range carrier {
+		headers[key] = value
+	}
+}
+
+// Extract reads the trace context of the producer from headers
+func (datadogTracer) Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	carrier := ddtracer.TextMapCarrier{}
+	for key := range headers {
+		if value := tracing.HeaderString(headers, key); value != "" {
+			carrier[key] = value
+		}
+	}
+
+	remote, err := ddtracer.Extract(carrier)
+	if err != nil || remote == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteContextKey{}, remote)
+}
+
+// datadogSpan adapts a Datadog span to tracing.Span
+type datadogSpan struct {
+	span ddtrace.Span
+}
+
+func (s datadogSpan) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+func (s datadogSpan) Finish(err error) {
+	if err != nil {
+		s.span.Finish(ddtracer.WithError(err))
+		return
+	}
+	s.span.Finish()
+}
@@ -0,0 +1,285 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/pkg/tracing"
+)
+
+type mockOutboxStore struct {
+	messages []*database.OutboxMessage
+	sent     map[int64]bool
+	failed   map[int64]string
+	parked   map[int64]bool
+	claimed  map[int64]bool
+}
+
+func newMockOutboxStore(count int) *mockOutboxStore {
+	store := &mockOutboxStore{
+		sent:    map[int64]bool{},
+		failed:  map[int64]string{},
+		parked:  map[int64]bool{},
+		claimed: map[int64]bool{},
+	}
+	for i := 1; i <= count; i++ {
+		store.messages = append(store.messages, &database.OutboxMessage{
+			ID:      int64(i),
+			Queue:   messaging.QueueImageUpload,
+			Payload: []byte(fmt.Sprintf(`{"trace_id":"t%d"}`, i)),
+		})
+	}
+	return store
+}
+
+func (m *mockOutboxStore) ClaimPendingOutboxMessages(_ context.Context, limit int, _ time.Duration) ([]*database.OutboxMessage, error) {
+	var pending []*database.OutboxMessage
+	for _, msg := range m.messages {
+		if !m.sent[msg.ID] && !m.parked[msg.ID] && !m.claimed[msg.ID] {
+			pending = append(pending, msg)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Attempts < pending[j].Attempts })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	for _, msg := range pending {
+		m.claimed[msg.ID] = true
+	}
+	return pending, nil
+}
+
+func (m *mockOutboxStore) ReleaseOutboxMessages(_ context.Context, ids []int64) error {
+	for _, id := range ids {
+		delete(m.claimed, id)
+	}
+	return nil
+}
+
+func (m *mockOutboxStore) MarkOutboxMessageSent(_ context.Context, id int64) error {
+	m.sent[id] = true
+	delete(m.claimed, id)
+	return nil
+}
+
+func (m *mockOutboxStore) MarkOutboxMessageFailed(_ context.Context, id int64, errMsg string, park bool) error {
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			msg.Attempts++
+		}
+	}
+	m.failed[id] = errMsg
+	m.parked[id] = park
+	delete(m.claimed, id)
+	return nil
+}
+
+func (m *mockOutboxStore) DeleteSentOutboxMessagesBefore(_ context.Context, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+type mockPublisher struct {
+	published []string
+	headers   []map[string]interface{}
+	fail      func(traceID string) error
+}
+
+func (m *mockPublisher) PublishMessageWithHeaders(
+	_ context.Context,
+	queueName string,
+	message interface{},
+	headers map[string]interface{},
+) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	var msg struct {
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return err
+	}
+	if m.fail != nil {
+		if err := m.fail(msg.TraceID); err != nil {
+			return err
+		}
+	}
+	m.published = append(m.published, queueName+":"+msg.TraceID)
+	m.headers = append(m.headers, headers)
+	return nil
+}
+
+func TestRelay_FlushPublishesInOrder(t *testing.T) {
+	store := newMockOutboxStore(BatchSize + 2)
+	publisher := &mockPublisher{}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	assert.Equal(t, BatchSize+2, relay.Flush(context.Background()))
+	require.Len(t, publisher.published, BatchSize+2)
+	assert.Equal(t, "image_upload:t1", publisher.published[0])
+	assert.Equal(t, fmt.Sprintf("image_upload:t%d", BatchSize+2), publisher.published[BatchSize+1])
+
+	assert.Equal(t, 0, relay.Flush(context.Background()), "sent messages are not published again")
+}
+
+func TestRelay_PublishesStoredHeaders(t *testing.T) {
+	store := newMockOutboxStore(1)
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	store.messages[0].Headers = map[string]interface{}{tracing.HeaderTraceparent: traceparent}
+	publisher := &mockPublisher{}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	assert.Equal(t, 1, relay.Flush(context.Background()))
+	require.Len(t, publisher.headers, 1)
+	assert.Equal(t, traceparent, publisher.headers[0][tracing.HeaderTraceparent])
+}
+
+func TestRelay_FailedMessagesStayPending(t *testing.T) {
+	store := newMockOutboxStore(3)
+	publisher := &mockPublisher{fail: func(traceID string) error {
+		if traceID == "t2" {
+			return messaging.ErrUnroutable
+		}
+		return nil
+	}}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	assert.Equal(t, 2, relay.Flush(context.Background()))
+	assert.Equal(t, []string{"image_upload:t1", "image_upload:t3"}, publisher.published)
+	assert.False(t, store.sent[2])
+	assert.Contains(t, store.failed[2], "could not be routed")
+}
+
+func TestRelay_StopsWhileDisconnected(t *testing.T) {
+	store := newMockOutboxStore(3)
+	publisher := &mockPublisher{fail: func(string) error { return messaging.ErrNotConnected }}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	assert.Equal(t, 0, relay.Flush(context.Background()))
+	assert.Empty(t, store.failed, "a disconnected broker is not a failed attempt")
+	assert.Empty(t, store.claimed, "the claims are released for the next pass")
+}
+
+func TestRelay_ParksMessageAfterMaxAttempts(t *testing.T) {
+	store := newMockOutboxStore(2)
+	store.messages[0].Attempts = MaxAttempts - 1
+	publisher := &mockPublisher{fail: func(traceID string) error {
+		if traceID == "t1" {
+			return messaging.ErrUnroutable
+		}
+		return nil
+	}}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	assert.Equal(t, 1, relay.Flush(context.Background()))
+	assert.True(t, store.parked[1])
+	assert.False(t, store.parked[2])
+
+	publisher.fail = nil
+	assert.Equal(t, 0, relay.Flush(context.Background()), "a parked message is not published again")
+}
+
+func TestRelay_FailingMessagesDoNotHoldBackNewOnes(t *testing.T) {
+	store := newMockOutboxStore(BatchSize + 1)
+	publisher := &mockPublisher{fail: func(traceID string) error {
+		if traceID != fmt.Sprintf("t%d", BatchSize+1) {
+			return messaging.ErrUnroutable
+		}
+		return nil
+	}}
+	relay := NewRelay(store, publisher, logging.NewLogger("test"))
+
+	// The first pass reads a full batch of failing messages and stops
+	assert.Equal(t, 0, relay.Flush(context.Background()))
+
+	// The failed messages are now behind the one that was never attempted
+	assert.Equal(t, 1, relay.Flush(context.Background()))
+	assert.Equal(t, []string{fmt.Sprintf("image_upload:t%d", BatchSize+1)}, publisher.published)
+}
+
+type mockMinIOClient struct {
+	objects []storage.ObjectInfo
+	removed []string
+}
+
+func (m *mockMinIOClient) EnsureBucketExists(context.Context, string) error { return nil }
+
+func (m *mockMinIOClient) UploadFile(context.Context, string, string, io.Reader, string) error {
+	return nil
+}
+
+func (m *mockMinIOClient) DownloadFile(context.Context, string, string) (*minio.Object, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockMinIOClient) GetPresignedURL(context.Context, string, string, time.Duration) (string, error) {
+	return "", nil
+}
+
+func (m *mockMinIOClient) ListObjects(_ context.Context, _, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	for _, object := range m.objects {
+		if strings.HasPrefix(object.Name, prefix) {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func (m *mockMinIOClient) RemoveObject(_ context.Context, _, objectName string) error {
+	m.removed = append(m.removed, objectName)
+	return nil
+}
+
+type mockImageStore struct {
+	traceIDs []string
+}
+
+func (m *mockImageStore) GetImagesByTraceIDs(_ context.Context, traceIDs []string) ([]*database.Image, error) {
+	var images []*database.Image
+	for _, traceID := range traceIDs {
+		for _, known := range m.traceIDs {
+			if traceID == known {
+				images = append(images, &database.Image{TraceID: traceID})
+			}
+		}
+	}
+	return images, nil
+}
+
+func TestSweeper_DeletesOldUnrecordedUploads(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-2 * DefaultGracePeriod)
+	minioClient := &mockMinIOClient{objects: []storage.ObjectInfo{
+		{Name: "telegram/recorded/a.jpg", LastModified: old},
+		{Name: "telegram/orphan/b.jpg", LastModified: old},
+		{Name: "telegram/orphan/b.xmp", LastModified: old},
+		{Name: "telegram/recent/c.jpg", LastModified: now.Add(-time.Minute)},
+		{Name: "filewatcher/2026-03-01/d.jpg", LastModified: old},
+		{Name: "web-group/e.jpg", LastModified: old},
+	}}
+	sweeper := NewSweeper(minioClient, &mockImageStore{traceIDs: []string{"recorded"}}, logging.NewLogger("test"))
+
+	deleted, err := sweeper.Sweep(context.Background(), now)
+	require.NoError(t, err)
+
+	sort.Strings(minioClient.removed)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []string{"telegram/orphan/b.jpg", "telegram/orphan/b.xmp"}, minioClient.removed)
+}
@@ -0,0 +1,189 @@
+// Package outbox publishes queue messages that were stored in the same transaction as the
+// database change that produced them, so a message is sent if and only if the change is committed
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
+)
+
+// Relay defaults
+const (
+	// DefaultInterval is how often pending messages are published when nothing wakes the relay
+	DefaultInterval = 5 * time.Second
+	// BatchSize is the number of pending messages published per pass
+	BatchSize = 100
+	// Retention is how long sent messages are kept for inspection
+	Retention = 24 * time.Hour
+	// ClaimLease is how long claimed messages are skipped by the relays of other gateway replicas
+	ClaimLease = time.Minute
+	// MaxAttempts is the number of failed publishes after which a message is parked
+	MaxAttempts = 10
+)
+
+// Store is the subset of the repository used by the relay
+type Store interface {
+	ClaimPendingOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*database.OutboxMessage, error)
+	ReleaseOutboxMessages(ctx context.Context, ids []int64) error
+	MarkOutboxMessageSent(ctx context.Context, id int64) error
+	MarkOutboxMessageFailed(ctx context.Context, id int64, errMsg string, park bool) error
+	DeleteSentOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Publisher publishes a message with headers to a queue
+type Publisher interface {
+	PublishMessageWithHeaders(ctx context.Context, queueName string, message interface{}, headers map[string]interface{}) error
+}
+
+// Relay publishes pending outbox messages and marks them sent.
+// A message is marked sent after the broker confirms it, so a crash in between publishes it
+// again; consumers skip the duplicate through their processed-message ledger.
+// Messages are claimed for ClaimLease, so several gateway replicas do not publish the same message,
+// and a message that failed MaxAttempts times is parked instead of being retried forever.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	logger    *logging.Logger
+	metrics   *metrics.Metrics
+	interval  time.Duration
+	wake      chan struct{}
+}
+
+// NewRelay creates a relay that publishes every DefaultInterval and whenever Notify is called
+func NewRelay(store Store, publisher Publisher, logger *logging.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		logger:    logger,
+		metrics:   metrics.New(),
+		interval:  DefaultInterval,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay to publish a new message without waiting for the next tick
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes pending messages until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	r.Flush(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Flush(ctx)
+		case <-r.wake:
+			r.Flush(ctx)
+		case <-cleanup.C:
+			r.cleanup(ctx)
+		}
+	}
+}
+
+// Flush publishes pending messages, least attempted first, and returns how many were sent.
+// It stops early while RabbitMQ is disconnected; failed messages are retried on the next pass.
+func (r *Relay) Flush(ctx context.Context) int {
+	sent := 0
+	for {
+		messages, err := r.store.ClaimPendingOutboxMessages(ctx, BatchSize, ClaimLease)
+		if err != nil {
+			r.logger.Error("Failed to claim pending outbox messages", err)
+			return sent
+		}
+
+		published := 0
+		for i, msg := range messages {
+			// The stored headers carry the trace context of the upload
+			err := r.publisher.PublishMessageWithHeaders(ctx, msg.Queue, json.RawMessage(msg.Payload), msg.Headers)
+			if errors.Is(err, messaging.ErrNotConnected) {
+				// Not an attempt: hand the rest back to the next pass
+				r.release(ctx, messages[i:])
+				return sent + published
+			}
+			if err != nil {
+				r.fail(ctx, msg, err)
+				continue
+			}
+
+			if err := r.store.MarkOutboxMessageSent(ctx, msg.ID); err != nil {
+				r.logger.Error("Failed to mark outbox message sent", err)
+				r.release(ctx, messages[i+1:])
+				return sent + published
+			}
+			r.metrics.Incr("outbox.published", []string{"queue:" + msg.Queue})
+			published++
+		}
+
+		sent += published
+		// A full batch may have more behind it; stop when every message left has failed this pass
+		if len(messages) < BatchSize || published == 0 {
+			return sent
+		}
+	}
+}
+
+// fail records a failed publish of msg, parking it after MaxAttempts
+func (r *Relay) fail(ctx context.Context, msg *database.OutboxMessage, err error) {
+	r.metrics.Incr("outbox.publish.errors", []string{"queue:" + msg.Queue, "error:" + messaging.ErrorReason(err)})
+
+	park := msg.Attempts+1 >= MaxAttempts
+	if markErr := r.store.MarkOutboxMessageFailed(ctx, msg.ID, err.Error(), park); markErr != nil {
+		r.logger.Error("Failed to record outbox publish error", markErr)
+		return
+	}
+	if park {
+		r.metrics.Incr("outbox.parked", []string{"queue:" + msg.Queue})
+		r.logger.Error("Parked outbox message after repeated publish failures", map[string]interface{}{
+			"id":       msg.ID,
+			"queue":    msg.Queue,
+			"attempts": msg.Attempts + 1,
+			"error":    err.Error(),
+		})
+	}
+}
+
+// release drops the claims on messages that were not attempted
+func (r *Relay) release(ctx context.Context, messages []*database.OutboxMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	if err := r.store.ReleaseOutboxMessages(ctx, ids); err != nil {
+		r.logger.Error("Failed to release outbox messages", err)
+	}
+}
+
+// cleanup deletes messages sent more than Retention ago
+func (r *Relay) cleanup(ctx context.Context) {
+	deleted, err := r.store.DeleteSentOutboxMessagesBefore(ctx, time.Now().Add(-Retention))
+	if err != nil {
+		r.logger.Error("Failed to delete sent outbox messages", err)
+		return
+	}
+	if deleted > 0 {
+		r.logger.Info("Deleted sent outbox messages", map[string]interface{}{
+			"count": deleted,
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/logging"
+	"github.com/shabohin/photo-tags/pkg/storage"
+)
+
+// Sweeper defaults
+const (
+	// DefaultGracePeriod is how old an object must be before it can be swept, so uploads whose
+	// images row is still being written are left alone
+	DefaultGracePeriod = time.Hour
+	// DefaultSweepInterval is how often the sweeper runs
+	DefaultSweepInterval = 6 * time.Hour
+)
+
+// ImageStore is the subset of the repository used to find recorded images
+type ImageStore interface {
+	GetImagesByTraceIDs(ctx context.Context, traceIDs []string) ([]*database.Image, error)
+}
+
+// Sweeper deletes originals uploaded by the bot that have no images row, left behind when the
+// bot failed between uploading to MinIO and recording the image.
+// Only objects under storage.TelegramPrefix are considered: web, batch and filewatcher uploads
+// are not recorded in the images table the same way.
+type Sweeper struct {
+	minio  storage.MinIOInterface
+	images ImageStore
+	logger *logging.Logger
+	grace  time.Duration
+}
+
+// NewSweeper creates a sweeper with DefaultGracePeriod
+func NewSweeper(minio storage.MinIOInterface, images ImageStore, logger *logging.Logger) *Sweeper {
+	return &Sweeper{
+		minio:  minio,
+		images: images,
+		logger: logger,
+		grace:  DefaultGracePeriod,
+	}
+}
+
+// Run sweeps every interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx, time.Now()); err != nil {
+				s.logger.Error("Failed to sweep orphaned uploads", err)
+			}
+		}
+	}
+}
+
+// Sweep deletes orphaned originals last modified before now minus the grace period and
+// returns how many were deleted
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) (int, error) {
+	objects, err := s.minio.ListObjects(ctx, storage.BucketOriginal, storage.TelegramPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	// Group old enough objects by trace ID: "telegram/<trace_id>/<filename>"
+	candidates := make(map[string][]string)
+	for _, object := range objects {
+		if now.Sub(object.LastModified) < s.grace {
+			continue
+		}
+		traceID, _, ok := strings.Cut(strings.TrimPrefix(object.Name, storage.TelegramPrefix), "/")
+		if !ok || traceID == "" {
+			continue
+		}
+		candidates[traceID] = append(candidates[traceID], object.Name)
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	traceIDs := make([]string, 0, len(candidates))
+	for traceID := range candidates {
+		traceIDs = append(traceIDs, traceID)
+	}
+	recorded, err := s.images.GetImagesByTraceIDs(ctx, traceIDs)
+	if err != nil {
+		return 0, err
+	}
+	for _, img := range recorded {
+		delete(candidates, img.TraceID)
+	}
+
+	deleted := 0
+	for traceID, names := range candidates {
+		for _, name := range names {
+			if err := s.minio.RemoveObject(ctx, storage.BucketOriginal, name); err != nil {
+				s.logger.Error("Failed to delete orphaned upload "+name, err)
+				continue
+			}
+			deleted++
+		}
+		s.logger.Info("Deleted orphaned upload", map[string]interface{}{
+			"trace_id": traceID,
+			"objects":  len(names),
+		})
+	}
+
+	return deleted, nil
+}
@@ -24,7 +24,7 @@ func NewHandler(logger *logging.Logger, repo database.RepositoryInterface) *Hand
 	}
 }
 
-// GetUserImages returns images for a specific user
+// GetUserImages returns images for a specific user, optionally filtered by category
 func (h *Handler) GetUserImages(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -59,8 +59,13 @@ func (h *Handler) GetUserImages(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get images from database
-	images, err := h.repo.GetImagesByUser(r.Context(), telegramID, limit, offset)
+	// Get images from database, optionally only those of one category
+	var images []*database.Image
+	if category := r.URL.Query().Get("category"); category != "" {
+		images, err = h.repo.GetImagesByCategory(r.Context(), telegramID, category, limit, offset)
+	} else {
+		images, err = h.repo.GetImagesByUser(r.Context(), telegramID, limit, offset)
+	}
 	if err != nil {
 		h.logger.Error("Failed to get user images", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -299,3 +304,58 @@ func (h *Handler) GetImageByTraceID(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("Failed to encode response", err)
 	}
 }
+
+// GetExperimentStats returns per-variant quality statistics for prompt/model experiments
+func (h *Handler) GetExperimentStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse date range from query params
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	var startDate, endDate time.Time
+	var err error
+
+	if startDateStr == "" {
+		// Default to last 7 days
+		startDate = time.Now().AddDate(0, 0, -7)
+	} else {
+		startDate, err = time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			http.Error(w, "Invalid start_date format (expected YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if endDateStr == "" {
+		endDate = time.Now()
+	} else {
+		endDate, err = time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			http.Error(w, "Invalid end_date format (expected YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get stats from database
+	variants, err := h.repo.GetExperimentStats(r.Context(), startDate, endDate)
+	if err != nil {
+		h.logger.Error("Failed to get experiment stats", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Return response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"variants":   variants,
+		"start_date": startDate.Format("2006-01-02"),
+		"end_date":   endDate.Format("2006-01-02"),
+	}); err != nil {
+		h.logger.Error("Failed to encode response", err)
+	}
+}
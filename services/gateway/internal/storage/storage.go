@@ -15,6 +15,8 @@ type ImageRecord struct {
 	OriginalFilename string
 	OriginalPath     string
 	ProcessedPath    string
+	SidecarPath      string
+	RemovedTags      []string
 	Status           string // uploading, analyzing, processing, completed, failed
 	Metadata         *models.Metadata
 	UploadedAt       time.Time
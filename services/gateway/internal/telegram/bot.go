@@ -5,9 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,12 +13,17 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/idempotency"
 	"github.com/shabohin/photo-tags/pkg/logging"
 	"github.com/shabohin/photo-tags/pkg/messaging"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/pkg/storage"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 	"github.com/shabohin/photo-tags/services/gateway/internal/config"
-	"github.com/shabohin/photo-tags/services/gateway/internal/monitoring"
+	"github.com/shabohin/photo-tags/services/gateway/internal/outbox"
 )
 
 // Bot represents a Telegram bot
@@ -31,7 +34,9 @@ type Bot struct {
 	rabbitmq messaging.RabbitMQInterface
 	repo     database.RepositoryInterface
 	cfg      *config.Config
-	metrics  *monitoring.Metrics
+	metrics  *metrics.Metrics
+	ledger   *idempotency.Ledger
+	relay    *outbox.Relay
 }
 
 // BotLogger extends the Logger with group ID
@@ -73,10 +78,20 @@ func NewBot(
 		rabbitmq: rabbitmq,
 		repo:     repo,
 		cfg:      cfg,
-		metrics:  monitoring.NewMetrics(),
+		metrics:  metrics.New(),
 	}, nil
 }
 
+// SetLedger skips processed images that were already sent, so a redelivery does not reach the user twice
+func (b *Bot) SetLedger(ledger *idempotency.Ledger) {
+	b.ledger = ledger
+}
+
+// SetOutbox records uploads and their messages in one transaction and publishes them through relay
+func (b *Bot) SetOutbox(relay *outbox.Relay) {
+	b.relay = relay
+}
+
 // Start starts listening for updates
 func (b *Bot) Start(ctx context.Context) error {
 	// Ensure MinIO buckets exist
@@ -88,15 +103,15 @@ func (b *Bot) Start(ctx context.Context) error {
 	}
 
 	// Ensure RabbitMQ queues exist
-	if _, err := b.rabbitmq.DeclareQueue(messaging.QueueImageUpload); err != nil {
+	if _, err := b.rabbitmq.DeclareQueueWithDLQ(messaging.QueueImageUpload, messaging.QueueDeadLetter); err != nil {
 		return fmt.Errorf("failed to declare image upload queue: %w", err)
 	}
-	if _, err := b.rabbitmq.DeclareQueue(messaging.QueueImageProcessed); err != nil {
+	if _, err := b.rabbitmq.DeclareQueueWithDLQ(messaging.QueueImageProcessed, messaging.QueueDeadLetter); err != nil {
 		return fmt.Errorf("failed to declare image processed queue: %w", err)
 	}
 
 	// Start consuming processed images
-	if err := b.rabbitmq.ConsumeMessages(messaging.QueueImageProcessed, b.handleProcessedImage); err != nil {
+	if err := b.rabbitmq.ConsumeMessagesWithContext(messaging.QueueImageProcessed, b.consumeProcessedImage); err != nil {
 		return fmt.Errorf("failed to start consuming processed images: %w", err)
 	}
 
@@ -110,7 +125,7 @@ func (b *Bot) Start(ctx context.Context) error {
 
 	// Handle updates
 	for update := range updates {
-		if update.Message == nil {
+		if update.Message == nil && update.CallbackQuery == nil {
 			continue
 		}
 
@@ -178,10 +193,9 @@ func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
 		fileID := document.FileID
 
 		// Check file extension
-		ext := strings.ToLower(filepath.Ext(fileName))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		if !storage.IsSupportedUpload(fileName) {
 			b.metrics.Incr("telegram.messages.errors", []string{"type:document", "error:unsupported_format"})
-			b.sendErrorMessage(update.Message.Chat.ID, "Only JPG and PNG files are supported")
+			b.sendErrorMessage(update.Message.Chat.ID, "Only JPG, PNG and camera RAW files are supported")
 			return
 		}
 
@@ -212,13 +226,14 @@ func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
 		b.metrics.Incr("telegram.messages.received", []string{"type:text"})
 
 		// Handle text message
-		b.handleTextMessage(update.Message)
+		b.handleTextMessage(ctx, update.Message)
 
 		b.metrics.Incr("telegram.messages.processed", []string{"type:text"})
 	}
 }
 
-// processMedia processes media files (photos and documents)
+// processMedia processes media files (photos and documents).
+// It starts the trace that follows the image through every service and back to the reply.
 func (b *Bot) processMedia(
 	ctx context.Context,
 	log *BotLogger,
@@ -226,13 +241,19 @@ func (b *Bot) processMedia(
 	_ string,
 	fileName string,
 	fileURL string,
-) error {
+) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "telegram.upload")
+	span.SetTag("filename", fileName)
+	defer func() { span.Finish(err) }()
+
 	// Download file
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	downloadSpan, _ := tracing.StartSpan(ctx, "telegram.download")
 	resp, err := http.DefaultClient.Do(req)
+	downloadSpan.Finish(err)
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
@@ -243,17 +264,15 @@ func (b *Bot) processMedia(
 	}()
 
 	// Determine content type
-	contentType := mime.TypeByExtension(filepath.Ext(fileName))
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
+	contentType := storage.ContentType(fileName)
 
 	// Generate trace ID
 	traceID := uuid.New().String()
 	log = NewBotLogger(log.WithTraceID(traceID), log.GetGroupID())
+	span.SetTag("trace_id", traceID)
 
 	// Upload file to MinIO
-	minioObjectPath := fmt.Sprintf("%s/%s", traceID, fileName)
+	minioObjectPath := fmt.Sprintf("%s%s/%s", storage.TelegramPrefix, traceID, fileName)
 	uploadStart := time.Now()
 	if err := b.minio.UploadFile(ctx, storage.BucketOriginal, minioObjectPath, resp.Body, contentType); err != nil {
 		b.metrics.Incr("image.upload.errors", []string{"error:minio_upload"})
@@ -280,11 +299,28 @@ func (b *Bot) processMedia(
 		OriginalFilename: fileName,
 		OriginalPath:     minioObjectPath,
 		Timestamp:        time.Now(),
+		MergePolicy:      mergePolicyFromCaption(message.Caption),
+		OutputMode:       outputModeFromCaption(message.Caption),
+		PrivacyProfile:   b.userPrivacyProfile(ctx, log, message.From.ID),
+		Creator:          b.userCreatorProfile(ctx, log, message.From.ID),
+	}
+
+	body, err := envelope.Encode(envelope.TypeImageUpload, envelope.ProducerGateway, uploadMessage)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	if b.repo != nil && b.relay != nil {
+		return b.queueUpload(ctx, log, message, uploadMessage, body)
 	}
 
-	// Publish upload message
-	if err := b.rabbitmq.PublishMessage(messaging.QueueImageUpload, uploadMessage); err != nil {
-		b.metrics.Incr("rabbitmq.messages.publish.errors", []string{"queue:image_upload", "error:publish_failed"})
+	// Publish upload message, retrying while the broker is unavailable or does not confirm
+	err = messaging.PublishWithRetry(messaging.DefaultPublishAttempts, messaging.DefaultPublishRetryDelay, func() error {
+		return b.rabbitmq.PublishMessageWithHeaders(ctx, messaging.QueueImageUpload, json.RawMessage(body),
+			priority.Headers(priority.SourceTelegram))
+	})
+	if err != nil {
+		b.metrics.Incr("rabbitmq.messages.publish.errors", []string{"queue:image_upload", "error:" + messaging.ErrorReason(err)})
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
@@ -292,18 +328,7 @@ func (b *Bot) processMedia(
 
 	// Log image to database if repository is available
 	if b.repo != nil {
-		username := message.From.UserName
-		originalPath := minioObjectPath
-		img := &database.Image{
-			TraceID:          traceID,
-			TelegramID:       message.From.ID,
-			TelegramUsername: &username,
-			Filename:         fileName,
-			OriginalPath:     &originalPath,
-			Status:           database.StatusPending,
-		}
-
-		if err := b.repo.CreateImage(ctx, img); err != nil {
+		if err := b.repo.CreateImage(ctx, newImageRecord(uploadMessage)); err != nil {
 			log.Error("Failed to log image to database", err)
 			// Don't fail the upload if database logging fails
 		}
@@ -314,21 +339,77 @@ func (b *Bot) processMedia(
 	return nil
 }
 
-// handleProcessedImage handles a processed image
-func (b *Bot) handleProcessedImage(data []byte) error {
+// queueUpload records the image and its upload message in one transaction and wakes the relay.
+// If the transaction fails the uploaded original has no record and is removed by the orphan sweeper.
+func (b *Bot) queueUpload(
+	ctx context.Context,
+	log *BotLogger,
+	message *tgbotapi.Message,
+	upload models.ImageUpload,
+	payload []byte,
+) error {
+	headers := tracing.Headers(ctx)
+	headers[priority.HeaderSource] = priority.SourceTelegram
+	if err := b.repo.CreateImageWithOutbox(ctx, newImageRecord(upload), messaging.QueueImageUpload, payload, headers); err != nil {
+		b.metrics.Incr("image.upload.errors", []string{"error:db_outbox"})
+		return fmt.Errorf("failed to record image: %w", err)
+	}
+	b.relay.Notify()
+
+	log.Info("Image uploaded and message queued", map[string]interface{}{
+		"chat_id":       message.Chat.ID,
+		"original_path": upload.OriginalPath,
+	})
+
+	return nil
+}
+
+// newImageRecord builds the pending images row for an upload message
+func newImageRecord(upload models.ImageUpload) *database.Image {
+	username := upload.TelegramUsername
+	originalPath := upload.OriginalPath
+	return &database.Image{
+		TraceID:          upload.TraceID,
+		TelegramID:       upload.TelegramID,
+		TelegramUsername: &username,
+		Filename:         upload.OriginalFilename,
+		OriginalPath:     &originalPath,
+		Status:           database.StatusPending,
+	}
+}
+
+// consumeProcessedImage handles a processed image unless it was already delivered
+func (b *Bot) consumeProcessedImage(ctx context.Context, data []byte) error {
+	if b.ledger == nil {
+		return b.handleProcessedImage(ctx, data)
+	}
+
+	traceID := idempotency.TraceID(data)
+	duplicate, err := b.ledger.Process(ctx, traceID, func() error {
+		return b.handleProcessedImage(ctx, data)
+	})
+	if duplicate {
+		b.metrics.Incr("rabbitmq.messages.duplicate", []string{"queue:image_processed"})
+		b.logger.Info("Skipping already delivered image", map[string]interface{}{
+			"trace_id": traceID,
+		})
+	}
+	return err
+}
+
+// handleProcessedImage handles a processed image in the trace of its upload
+func (b *Bot) handleProcessedImage(ctx context.Context, data []byte) error {
 	// Record consumed message
 	b.metrics.Incr("rabbitmq.messages.consumed", []string{"queue:image_processed"})
 
 	var message models.ImageProcessed
-	if err := json.Unmarshal(data, &message); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+	if _, err := envelope.Decode(data, envelope.TypeImageProcessed, &message); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
 	}
 
 	botLog := NewBotLogger(b.logger.WithTraceID(message.TraceID).WithGroupID(message.GroupID), message.GroupID)
 	botLog.Info("Received processed image", message)
 
-	ctx := context.Background()
-
 	// Check if processing failed
 	if message.Status == "failed" {
 		b.sendErrorMessage(message.TelegramID, "Failed to process image: "+message.Error)
@@ -339,6 +420,7 @@ func (b *Bot) handleProcessedImage(data []byte) error {
 			if err := b.repo.UpdateImageStatus(ctx, message.TraceID, database.StatusFailed, &errorMsg); err != nil {
 				botLog.Error("Failed to update image status in database", err)
 			}
+			b.recordExperiment(ctx, botLog, message)
 
 			// Log error to errors table
 			errRecord := &database.Error{
@@ -385,21 +467,46 @@ func (b *Bot) handleProcessedImage(data []byte) error {
 	}
 	msg := tgbotapi.NewDocument(message.TelegramID, fileBytesObj)
 	msg.Caption = "✅ Image processed with AI-generated metadata"
+	if summary := removedTagsSummary(message.RemovedTags); summary != "" {
+		msg.Caption += "\n" + summary
+	}
+	if b.repo != nil {
+		msg.ReplyMarkup = feedbackKeyboard(message.TraceID)
+	}
 
-	if _, err := b.api.Send(msg); err != nil {
+	sendSpan, _ := tracing.StartSpan(ctx, "telegram.send")
+	sendSpan.SetTag("trace_id", message.TraceID)
+	_, err = b.api.Send(msg)
+	sendSpan.Finish(err)
+	if err != nil {
 		botLog.Error("Failed to send image", err)
 		b.sendErrorMessage(message.TelegramID, "Failed to send processed image")
 		return err
 	}
 
+	// In sidecar mode the image is unchanged and the metadata is in the .xmp
+	if message.SidecarPath != "" {
+		if err := b.sendSidecar(ctx, message); err != nil {
+			botLog.Error("Failed to send XMP sidecar", err)
+			b.sendErrorMessage(message.TelegramID, "Failed to send XMP sidecar")
+		}
+	}
+
 	// Update database status if repository is available
 	if b.repo != nil {
 		// Convert metadata from message to database format
 		var metadata *database.ImageMetadata
-		if message.OriginalFilename != "" {
-			// Note: We don't have the metadata in ImageProcessed message
-			// This could be enhanced in the future
-			metadata = nil
+		if message.Metadata != nil {
+			metadata = &database.ImageMetadata{
+				Title:                  message.Metadata.Title,
+				Description:            message.Metadata.Description,
+				Keywords:               message.Metadata.Keywords,
+				HierarchicalKeywords:   message.Metadata.HierarchicalKeywords,
+				Category:               message.Metadata.Category,
+				SupplementalCategories: message.Metadata.SupplementalCategories,
+				AltText:                message.Metadata.AltText,
+				RemovedTags:            message.RemovedTags,
+			}
 		}
 
 		processedPath := message.ProcessedPath
@@ -407,6 +514,7 @@ func (b *Bot) handleProcessedImage(data []byte) error {
 			botLog.Error("Failed to update processed image in database", err)
 			// Don't fail if database update fails
 		}
+		b.recordExperiment(ctx, botLog, message)
 	}
 
 	botLog.Info("Processed image sent", nil)
@@ -414,7 +522,7 @@ func (b *Bot) handleProcessedImage(data []byte) error {
 }
 
 // handleTextMessage handles text messages
-func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
+func (b *Bot) handleTextMessage(ctx context.Context, message *tgbotapi.Message) {
 	// Handle commands
 	if message.IsCommand() {
 		switch message.Command() {
@@ -424,6 +532,12 @@ func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
 			b.handleHelpCommand(message)
 		case "status":
 			b.handleStatusCommand(message)
+		case "privacy":
+			b.handlePrivacyCommand(ctx, message)
+		case "creator":
+			b.handleCreatorCommand(ctx, message)
+		case "export":
+			b.handleExportCommand(ctx, message)
 		default:
 			b.sendMessage(message.Chat.ID, "❓ Unknown command. Try /help for available commands.")
 		}
@@ -467,14 +581,20 @@ func (b *Bot) handleHelpCommand(message *tgbotapi.Message) {
 		"*Available Commands:*\n" +
 		"/start - Welcome message and quick actions\n" +
 		"/help - Show this help message\n" +
-		"/status - Check processing queue status\n\n" +
+		"/status - Check processing queue status\n" +
+		"/privacy - Choose which identifying tags are removed\n" +
+		"/creator - Set the creator and copyright written to your images\n" +
+		"/export - Download a stock agency CSV of your images\n\n" +
 		"*How to Use:*\n" +
-		"1. Send me a JPG or PNG image (as photo or document)\n" +
+		"1. Send me a JPG or PNG image (as photo or document) or a camera RAW file (as document)\n" +
 		"2. Wait for processing (usually takes a few seconds)\n" +
 		"3. Receive your image with AI-generated metadata\n\n" +
+		"Add #xmp to the caption to keep the image unchanged and get an XMP sidecar instead.\n" +
+		"Add #keep to keep tags already in the image, #append to add keywords to them or #replace to overwrite them.\n\n" +
 		"*Supported Formats:*\n" +
 		"• JPG/JPEG\n" +
-		"• PNG\n\n" +
+		"• PNG\n" +
+		"• Camera RAW (CR2, CR3, NEF, ARW, DNG, ORF, RAF, RW2, SRW, PEF), returned with an XMP sidecar\n\n" +
 		"*Features:*\n" +
 		"✅ Automatic title generation\n" +
 		"✅ Detailed descriptions\n" +
@@ -533,14 +653,20 @@ func (b *Bot) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQ
 			"*Available Commands:*\n" +
 			"/start - Welcome message and quick actions\n" +
 			"/help - Show this help message\n" +
-			"/status - Check processing queue status\n\n" +
+			"/status - Check processing queue status\n" +
+			"/privacy - Choose which identifying tags are removed\n" +
+			"/creator - Set the creator and copyright written to your images\n" +
+			"/export - Download a stock agency CSV of your images\n\n" +
 			"*How to Use:*\n" +
-			"1. Send me a JPG or PNG image (as photo or document)\n" +
+			"1. Send me a JPG or PNG image (as photo or document) or a camera RAW file (as document)\n" +
 			"2. Wait for processing (usually takes a few seconds)\n" +
 			"3. Receive your image with AI-generated metadata\n\n" +
+			"Add #xmp to the caption to keep the image unchanged and get an XMP sidecar instead.\n" +
+			"Add #keep to keep tags already in the image, #append to add keywords to them or #replace to overwrite them.\n\n" +
 			"*Supported Formats:*\n" +
 			"• JPG/JPEG\n" +
-			"• PNG\n\n" +
+			"• PNG\n" +
+			"• Camera RAW (CR2, CR3, NEF, ARW, DNG, ORF, RAF, RW2, SRW, PEF), returned with an XMP sidecar\n\n" +
 			"*Features:*\n" +
 			"✅ Automatic title generation\n" +
 			"✅ Detailed descriptions\n" +
@@ -580,6 +706,10 @@ func (b *Bot) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQ
 		}
 
 	default:
+		if strings.HasPrefix(query.Data, feedbackCallbackPrefix) {
+			b.handleFeedback(ctx, query)
+			return
+		}
 		b.logger.Error("Unknown callback data", fmt.Errorf("data: %s", query.Data))
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/minio/minio-go/v7"
+
+	"github.com/shabohin/photo-tags/pkg/storage"
 )
 
 // MockMinIOClient is a mock implementation of storage.MinIOInterface
@@ -17,6 +19,8 @@ type MockMinIOClient struct {
 		reader io.Reader, contentType string) error
 	DownloadFileFunc    func(ctx context.Context, bucketName, objectName string) (*minio.Object, error)
 	GetPresignedURLFunc func(ctx context.Context, bucketName, objectName string, expiry time.Duration) (string, error)
+	ListObjectsFunc     func(ctx context.Context, bucketName, prefix string) ([]storage.ObjectInfo, error)
+	RemoveObjectFunc    func(ctx context.Context, bucketName, objectName string) error
 }
 
 // EnsureBucketExists mocks the EnsureBucketExists method of MinIOInterface
@@ -43,6 +47,18 @@ func (m *MockMinIOClient) GetPresignedURL(ctx context.Context,
 	return m.GetPresignedURLFunc(ctx, bucketName, objectName, expiry)
 }
 
+// ListObjects mocks the ListObjects method of MinIOInterface
+func (m *MockMinIOClient) ListObjects(ctx context.Context,
+	bucketName, prefix string) ([]storage.ObjectInfo, error) {
+	return m.ListObjectsFunc(ctx, bucketName, prefix)
+}
+
+// RemoveObject mocks the RemoveObject method of MinIOInterface
+func (m *MockMinIOClient) RemoveObject(ctx context.Context,
+	bucketName, objectName string) error {
+	return m.RemoveObjectFunc(ctx, bucketName, objectName)
+}
+
 // MockRabbitMQClient is a mock implementation of messaging.RabbitMQInterface
 type MockRabbitMQClient struct {
 	DeclareQueueFunc    func(name string) (interface{}, error)
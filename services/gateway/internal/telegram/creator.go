@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/services/gateway/internal/creator"
+)
+
+// creatorFields lists the /creator fields in display order
+var creatorFields = []struct {
+	name  string
+	label string
+	value func(p *models.CreatorProfile) *string
+}{
+	{"name", "Creator", func(p *models.CreatorProfile) *string { return &p.Creator }},
+	{"rights", "Copyright", func(p *models.CreatorProfile) *string { return &p.Rights }},
+	{"terms", "Usage terms", func(p *models.CreatorProfile) *string { return &p.UsageTerms }},
+	{"email", "Email", func(p *models.CreatorProfile) *string { return &p.Email }},
+	{"phone", "Phone", func(p *models.CreatorProfile) *string { return &p.Phone }},
+	{"website", "Website", func(p *models.CreatorProfile) *string { return &p.Website }},
+	{"city", "City", func(p *models.CreatorProfile) *string { return &p.City }},
+	{"country", "Country", func(p *models.CreatorProfile) *string { return &p.Country }},
+}
+
+// creatorFieldNames returns the field names accepted by /creator
+func creatorFieldNames() []string {
+	names := make([]string, 0, len(creatorFields))
+	for _, field := range creatorFields {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+// applyCreatorArgument sets one field of profile from the argument of /creator <field> <value>.
+// An empty value clears the field.
+func applyCreatorArgument(profile *models.CreatorProfile, argument string) (string, error) {
+	name, value, _ := strings.Cut(strings.TrimSpace(argument), " ")
+	name = strings.ToLower(name)
+	for _, field := range creatorFields {
+		if field.name == name {
+			*field.value(profile) = strings.TrimSpace(value)
+			return field.label, nil
+		}
+	}
+	return "", fmt.Errorf("unknown creator field: %s", name)
+}
+
+// creatorProfileText shows the stored profile
+func creatorProfileText(profile *models.CreatorProfile) string {
+	var text strings.Builder
+	text.WriteString("©️ Creator Profile\n\n")
+	if profile.IsEmpty() {
+		text.WriteString("No creator profile set.\n")
+	} else {
+		for _, field := range creatorFields {
+			if value := *field.value(profile); value != "" {
+				text.WriteString(fmt.Sprintf("%s: %s\n", field.label, value))
+			}
+		}
+	}
+	text.WriteString("\nSet a field with /creator <field> <value>, e.g. /creator rights © 2026 Jane Doe\n")
+	text.WriteString("Fields: " + strings.Join(creatorFieldNames(), ", ") + "\n")
+	text.WriteString("Remove the profile with /creator clear")
+	return text.String()
+}
+
+// userCreatorProfile returns the stored creator profile of a user, or nil if there is none
+func (b *Bot) userCreatorProfile(ctx context.Context, log *BotLogger, telegramID int64) *models.CreatorProfile {
+	if b.repo == nil {
+		return nil
+	}
+
+	profile, err := creator.Lookup(ctx, b.repo, creator.TelegramOwner(telegramID))
+	if err != nil {
+		log.Error("Failed to get creator profile", err)
+		return nil
+	}
+	return profile
+}
+
+// handleCreatorCommand shows, changes or removes the creator profile written to the user's images
+func (b *Bot) handleCreatorCommand(ctx context.Context, message *tgbotapi.Message) {
+	if b.repo == nil {
+		b.sendErrorMessage(message.Chat.ID, "Creator profiles are not available right now")
+		return
+	}
+
+	owner := creator.TelegramOwner(message.From.ID)
+	stored, err := b.repo.GetCreatorProfile(ctx, owner)
+	if err != nil {
+		b.logger.Error("Failed to get creator profile", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to load creator profile")
+		return
+	}
+	profile := creator.ToMessage(stored)
+	if profile == nil {
+		profile = &models.CreatorProfile{}
+	}
+
+	argument := strings.TrimSpace(message.CommandArguments())
+	switch {
+	case argument == "":
+		b.sendMessage(message.Chat.ID, creatorProfileText(profile))
+		return
+
+	case strings.EqualFold(argument, "clear"):
+		if err := b.repo.DeleteCreatorProfile(ctx, owner); err != nil {
+			b.logger.Error("Failed to delete creator profile", err)
+			b.sendErrorMessage(message.Chat.ID, "Failed to remove creator profile")
+			return
+		}
+		b.metrics.Incr("telegram.creator.updated", []string{"action:clear"})
+		b.sendMessage(message.Chat.ID, "©️ Creator profile removed")
+		return
+	}
+
+	label, err := applyCreatorArgument(profile, argument)
+	if err != nil {
+		b.sendErrorMessage(message.Chat.ID, "Unknown field. Use one of: "+strings.Join(creatorFieldNames(), ", "))
+		return
+	}
+	if err := creator.Validate(profile); err != nil {
+		b.sendErrorMessage(message.Chat.ID, err.Error())
+		return
+	}
+
+	if err := b.repo.SaveCreatorProfile(ctx, creator.FromMessage(owner, profile)); err != nil {
+		b.metrics.Incr("telegram.creator.errors", []string{"error:db_update"})
+		b.logger.Error("Failed to save creator profile", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to save creator profile")
+		return
+	}
+
+	b.metrics.Incr("telegram.creator.updated", []string{"action:set"})
+	b.sendMessage(message.Chat.ID, fmt.Sprintf("©️ %s updated. It will be written to every image you send.", label))
+}
@@ -0,0 +1,40 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+func TestApplyCreatorArgument(t *testing.T) {
+	profile := &models.CreatorProfile{}
+
+	label, err := applyCreatorArgument(profile, "rights  © 2026 Jane Doe ")
+	require.NoError(t, err)
+	assert.Equal(t, "Copyright", label)
+	assert.Equal(t, "© 2026 Jane Doe", profile.Rights)
+
+	_, err = applyCreatorArgument(profile, "Name Jane Doe")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", profile.Creator)
+
+	_, err = applyCreatorArgument(profile, "rights")
+	require.NoError(t, err)
+	assert.Empty(t, profile.Rights, "a field without a value is cleared")
+
+	_, err = applyCreatorArgument(profile, "nickname Jane")
+	assert.Error(t, err)
+}
+
+func TestCreatorProfileText(t *testing.T) {
+	text := creatorProfileText(&models.CreatorProfile{})
+	assert.Contains(t, text, "No creator profile set")
+
+	text = creatorProfileText(&models.CreatorProfile{Creator: "Jane Doe", Website: "https://example.com"})
+	assert.Contains(t, text, "Creator: Jane Doe")
+	assert.Contains(t, text, "Website: https://example.com")
+	assert.NotContains(t, text, "Email:")
+}
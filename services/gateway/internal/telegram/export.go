@@ -0,0 +1,105 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/shabohin/photo-tags/services/gateway/internal/export"
+)
+
+// maxExportDays limits the period of a /export request
+const maxExportDays = 365
+
+// parseExportArguments parses "/export <agency> [days]"
+func parseExportArguments(argument string) (*export.Agency, int, error) {
+	fields := strings.Fields(argument)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, 0, fmt.Errorf("usage: /export <agency> [days]")
+	}
+
+	agency, ok := export.LookupAgency(fields[0])
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown agency: %s", fields[0])
+	}
+
+	days := export.DefaultRangeDays
+	if len(fields) == 2 {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > maxExportDays {
+			return nil, 0, fmt.Errorf("days must be between 1 and %d", maxExportDays)
+		}
+		days = n
+	}
+
+	return agency, days, nil
+}
+
+// exportUsageText explains the /export command
+func exportUsageText() string {
+	return "📤 Export your processed images as a stock agency CSV:\n" +
+		"/export <agency> [days], e.g. /export adobe 7\n\n" +
+		"Agencies: " + strings.Join(export.AgencyNames(), ", ") + "\n" +
+		fmt.Sprintf("The last %d days are exported by default.", export.DefaultRangeDays)
+}
+
+// handleExportCommand sends the user's images of the last days as an agency CSV
+func (b *Bot) handleExportCommand(ctx context.Context, message *tgbotapi.Message) {
+	if b.repo == nil {
+		b.sendErrorMessage(message.Chat.ID, "Exports are not available right now")
+		return
+	}
+
+	if strings.TrimSpace(message.CommandArguments()) == "" {
+		b.sendMessage(message.Chat.ID, exportUsageText())
+		return
+	}
+
+	agency, days, err := parseExportArguments(message.CommandArguments())
+	if err != nil {
+		b.sendErrorMessage(message.Chat.ID, err.Error()+"\n\n"+exportUsageText())
+		return
+	}
+
+	now := time.Now()
+	telegramID := message.From.ID
+	images, err := b.repo.GetImagesByDateRange(ctx, &telegramID, now.AddDate(0, 0, -days), now)
+	if err != nil {
+		b.metrics.Incr("telegram.export.errors", []string{"error:db_query"})
+		b.logger.Error("Failed to get images for export", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to load your images")
+		return
+	}
+
+	var buf bytes.Buffer
+	count, err := agency.Write(&buf, images)
+	if err != nil {
+		b.metrics.Incr("telegram.export.errors", []string{"error:write"})
+		b.logger.Error("Failed to write export", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to create export")
+		return
+	}
+	if count == 0 {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("📭 No processed images in the last %d days", days))
+		return
+	}
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  agency.Filename(now),
+		Bytes: buf.Bytes(),
+	})
+	doc.Caption = fmt.Sprintf("📤 %s CSV with %d images from the last %d days", agency.Label, count, days)
+
+	if _, err := b.api.Send(doc); err != nil {
+		b.logger.Error("Failed to send export", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to send export")
+		return
+	}
+
+	b.metrics.Incr("telegram.export.sent", []string{"agency:" + agency.Name})
+}
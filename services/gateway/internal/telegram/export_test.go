@@ -0,0 +1,27 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shabohin/photo-tags/services/gateway/internal/export"
+)
+
+func TestParseExportArguments(t *testing.T) {
+	agency, days, err := parseExportArguments("Shutterstock")
+	require.NoError(t, err)
+	assert.Equal(t, "shutterstock", agency.Name)
+	assert.Equal(t, export.DefaultRangeDays, days)
+
+	agency, days, err = parseExportArguments("adobe 7")
+	require.NoError(t, err)
+	assert.Equal(t, "adobe", agency.Name)
+	assert.Equal(t, 7, days)
+
+	for _, argument := range []string{"", "pond5", "getty 0", "getty abc", "getty 400", "getty 7 extra"} {
+		_, _, err := parseExportArguments(argument)
+		assert.Error(t, err, argument)
+	}
+}
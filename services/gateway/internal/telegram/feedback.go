@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+const (
+	feedbackCallbackPrefix = "feedback:"
+	feedbackUp             = "up"
+	feedbackDown           = "down"
+)
+
+// feedbackKeyboard creates thumbs up/down buttons for rating generated metadata
+func feedbackKeyboard(traceID string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👍", feedbackCallbackPrefix+feedbackUp+":"+traceID),
+			tgbotapi.NewInlineKeyboardButtonData("👎", feedbackCallbackPrefix+feedbackDown+":"+traceID),
+		),
+	)
+}
+
+// parseFeedbackData extracts the trace ID and feedback value from callback data
+func parseFeedbackData(data string) (string, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(data, feedbackCallbackPrefix), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", 0, fmt.Errorf("invalid feedback data: %s", data)
+	}
+
+	switch parts[0] {
+	case feedbackUp:
+		return parts[1], database.FeedbackPositive, nil
+	case feedbackDown:
+		return parts[1], database.FeedbackNegative, nil
+	default:
+		return "", 0, fmt.Errorf("invalid feedback value: %s", parts[0])
+	}
+}
+
+// handleFeedback stores a thumbs up/down rating for a processed image
+func (b *Bot) handleFeedback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	traceID, feedback, err := parseFeedbackData(query.Data)
+	if err != nil {
+		b.logger.Error("Failed to parse feedback", err)
+		return
+	}
+
+	if b.repo == nil {
+		return
+	}
+
+	if err := b.repo.SetImageFeedback(ctx, traceID, query.From.ID, feedback); err != nil {
+		b.metrics.Incr("telegram.feedback.errors", []string{"error:db_update"})
+		b.logger.WithTraceID(traceID).Error("Failed to store feedback", err)
+		return
+	}
+
+	rating := feedbackUp
+	if feedback == database.FeedbackNegative {
+		rating = feedbackDown
+	}
+	b.metrics.Incr("telegram.feedback.received", []string{"rating:" + rating})
+
+	if query.Message == nil {
+		return
+	}
+
+	// Remove the buttons so the image can only be rated once
+	edit := tgbotapi.NewEditMessageReplyMarkup(
+		query.Message.Chat.ID,
+		query.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}},
+	)
+	if _, err := b.api.Send(edit); err != nil {
+		b.logger.Error("Failed to remove feedback buttons", err)
+	}
+
+	b.sendMessage(query.Message.Chat.ID, "🙏 Thanks for your feedback!")
+}
+
+// recordExperiment stores the experiment variant and quality signals of a processed image
+func (b *Bot) recordExperiment(ctx context.Context, log *BotLogger, message models.ImageProcessed) {
+	if message.Experiment == nil {
+		return
+	}
+
+	experiment := &database.ImageExperiment{
+		VariantID:     message.Experiment.VariantID,
+		Model:         message.Experiment.Model,
+		KeywordCount:  message.Experiment.KeywordCount,
+		ParseFailures: message.Experiment.ParseFailures,
+	}
+	if err := b.repo.UpdateImageExperiment(ctx, message.TraceID, experiment); err != nil {
+		log.Error("Failed to record experiment in database", err)
+	}
+}
@@ -0,0 +1,69 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/pkg/database"
+)
+
+func TestParseFeedbackData(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expectedTrace string
+		expectedValue int
+		expectError   bool
+	}{
+		{
+			name:          "thumbs up",
+			data:          "feedback:up:trace-123",
+			expectedTrace: "trace-123",
+			expectedValue: database.FeedbackPositive,
+		},
+		{
+			name:          "thumbs down",
+			data:          "feedback:down:trace-123",
+			expectedTrace: "trace-123",
+			expectedValue: database.FeedbackNegative,
+		},
+		{
+			name:        "unknown value",
+			data:        "feedback:maybe:trace-123",
+			expectError: true,
+		},
+		{
+			name:        "missing trace ID",
+			data:        "feedback:up:",
+			expectError: true,
+		},
+		{
+			name:        "malformed",
+			data:        "feedback:up",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, value, err := parseFeedbackData(tt.data)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTrace, traceID)
+			assert.Equal(t, tt.expectedValue, value)
+		})
+	}
+}
+
+func TestFeedbackKeyboard_FitsCallbackLimit(t *testing.T) {
+	keyboard := feedbackKeyboard("123e4567-e89b-12d3-a456-426614174000")
+
+	for _, button := range keyboard.InlineKeyboard[0] {
+		// Telegram limits callback data to 64 bytes
+		assert.LessOrEqual(t, len(*button.CallbackData), 64)
+	}
+}
@@ -0,0 +1,25 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// mergeCaptionTags select how generated metadata is merged with tags already in the image
+var mergeCaptionTags = map[string]string{
+	"#replace": models.MergePolicyReplace,
+	"#append":  models.MergePolicyAppendUnique,
+	"#keep":    models.MergePolicyKeepExisting,
+}
+
+// mergePolicyFromCaption returns the merge policy requested in a media caption,
+// or an empty string to use the Processor default
+func mergePolicyFromCaption(caption string) string {
+	for _, word := range strings.Fields(strings.ToLower(caption)) {
+		if policy, ok := mergeCaptionTags[word]; ok {
+			return policy
+		}
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+func TestMergePolicyFromCaption(t *testing.T) {
+	tests := []struct {
+		caption  string
+		expected string
+	}{
+		{caption: "", expected: ""},
+		{caption: "holiday photos", expected: ""},
+		{caption: "#keep", expected: models.MergePolicyKeepExisting},
+		{caption: "archive scan #Append #xmp", expected: models.MergePolicyAppendUnique},
+		{caption: "#replace", expected: models.MergePolicyReplace},
+		{caption: "#keeper", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.caption, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergePolicyFromCaption(tt.caption))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+// maxRemovedTagsListed limits the tag names shown in the processed image caption
+const maxRemovedTagsListed = 5
+
+// privacyProfileDescriptions explains each profile in the /privacy command
+var privacyProfileDescriptions = map[string]string{
+	models.PrivacyProfileOff:      "keep all tags",
+	models.PrivacyProfileLocation: "remove GPS location",
+	models.PrivacyProfileStandard: "remove GPS, serial numbers and owner names",
+	models.PrivacyProfileStrict:   "also remove camera maker notes",
+}
+
+// parsePrivacyProfile validates the argument of the /privacy command
+func parsePrivacyProfile(argument string) (string, error) {
+	profile := strings.ToLower(strings.TrimSpace(argument))
+	if !models.IsPrivacyProfile(profile) {
+		return "", fmt.Errorf("unknown privacy profile: %s", argument)
+	}
+	return profile, nil
+}
+
+// privacyProfilesText lists the available profiles and marks the current one
+func privacyProfilesText(current string) string {
+	if current == "" {
+		current = models.PrivacyProfileOff
+	}
+
+	var text strings.Builder
+	text.WriteString("🔒 *Privacy Profile*\n\n")
+	for _, profile := range models.PrivacyProfiles {
+		marker := "•"
+		if profile == current {
+			marker = "✅"
+		}
+		text.WriteString(fmt.Sprintf("%s `%s` - %s\n", marker, profile, privacyProfileDescriptions[profile]))
+	}
+	text.WriteString("\nChange it with `/privacy <profile>`, e.g. `/privacy standard`.")
+	return text.String()
+}
+
+// removedTagsSummary describes the tags removed by the privacy profile for the image caption
+func removedTagsSummary(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		// Drop the group prefix: EXIF:GPSLatitude and XMP:GPSLatitude are both GPSLatitude
+		name := tag[strings.LastIndex(tag, ":")+1:]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	listed := names
+	if len(listed) > maxRemovedTagsListed {
+		listed = listed[:maxRemovedTagsListed]
+	}
+	summary := fmt.Sprintf("🔒 Removed %d identifying tags: %s", len(tags), strings.Join(listed, ", "))
+	if more := len(names) - len(listed); more > 0 {
+		summary += fmt.Sprintf(" and %d more", more)
+	}
+	return summary
+}
+
+// userPrivacyProfile returns the stored privacy profile of a user, or an empty string
+// to use the Processor default
+func (b *Bot) userPrivacyProfile(ctx context.Context, log *BotLogger, telegramID int64) string {
+	if b.repo == nil {
+		return ""
+	}
+
+	settings, err := b.repo.GetUserSettings(ctx, telegramID)
+	if err != nil {
+		log.Error("Failed to get user settings", err)
+		return ""
+	}
+	return settings.PrivacyProfile
+}
+
+// handlePrivacyCommand shows or changes the privacy profile applied to the user's images
+func (b *Bot) handlePrivacyCommand(ctx context.Context, message *tgbotapi.Message) {
+	if b.repo == nil {
+		b.sendErrorMessage(message.Chat.ID, "Privacy settings are not available right now")
+		return
+	}
+
+	argument := message.CommandArguments()
+	if argument == "" {
+		settings, err := b.repo.GetUserSettings(ctx, message.From.ID)
+		if err != nil {
+			b.logger.Error("Failed to get user settings", err)
+			b.sendErrorMessage(message.Chat.ID, "Failed to load privacy settings")
+			return
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, privacyProfilesText(settings.PrivacyProfile))
+		msg.ParseMode = "Markdown"
+		if _, err := b.api.Send(msg); err != nil {
+			b.logger.Error("Failed to send privacy message", err)
+		}
+		return
+	}
+
+	profile, err := parsePrivacyProfile(argument)
+	if err != nil {
+		b.sendErrorMessage(message.Chat.ID, "Unknown profile. Use one of: "+strings.Join(models.PrivacyProfiles, ", "))
+		return
+	}
+
+	if err := b.repo.SetUserPrivacyProfile(ctx, message.From.ID, profile); err != nil {
+		b.metrics.Incr("telegram.privacy.errors", []string{"error:db_update"})
+		b.logger.Error("Failed to set privacy profile", err)
+		b.sendErrorMessage(message.Chat.ID, "Failed to save privacy settings")
+		return
+	}
+
+	b.metrics.Incr("telegram.privacy.updated", []string{"profile:" + profile})
+	b.sendMessage(message.Chat.ID, fmt.Sprintf("🔒 Privacy profile set to %s: %s", profile, privacyProfileDescriptions[profile]))
+}
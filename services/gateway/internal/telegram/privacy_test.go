@@ -0,0 +1,39 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+func TestParsePrivacyProfile(t *testing.T) {
+	profile, err := parsePrivacyProfile(" Standard ")
+	assert.NoError(t, err)
+	assert.Equal(t, models.PrivacyProfileStandard, profile)
+
+	_, err = parsePrivacyProfile("paranoid")
+	assert.Error(t, err)
+}
+
+func TestPrivacyProfilesText(t *testing.T) {
+	text := privacyProfilesText("")
+	assert.Contains(t, text, "✅ `off`")
+
+	text = privacyProfilesText(models.PrivacyProfileStrict)
+	assert.Contains(t, text, "✅ `strict`")
+	assert.Contains(t, text, "• `off`")
+}
+
+func TestRemovedTagsSummary(t *testing.T) {
+	assert.Equal(t, "", removedTagsSummary(nil))
+
+	summary := removedTagsSummary([]string{"EXIF:GPSLatitude", "XMP:GPSLatitude", "EXIF:SerialNumber"})
+	assert.Equal(t, "🔒 Removed 3 identifying tags: GPSLatitude, SerialNumber", summary)
+
+	tags := []string{"GPS:A", "GPS:B", "GPS:C", "GPS:D", "GPS:E", "GPS:F", "GPS:G"}
+	summary = removedTagsSummary(tags)
+	assert.True(t, strings.HasSuffix(summary, "A, B, C, D, E and 2 more"), summary)
+}
@@ -0,0 +1,66 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/storage"
+)
+
+// sidecarCaptionTags request an XMP sidecar instead of modifying the image
+var sidecarCaptionTags = []string{"#xmp", "#sidecar"}
+
+// outputModeFromCaption returns the output mode requested in a media caption,
+// or an empty string to use the Processor default
+func outputModeFromCaption(caption string) string {
+	for _, word := range strings.Fields(strings.ToLower(caption)) {
+		for _, tag := range sidecarCaptionTags {
+			if word == tag {
+				return models.OutputModeSidecar
+			}
+		}
+	}
+	return ""
+}
+
+// sidecarFilename names the sidecar after the original image (IMG_0001.jpg -> IMG_0001.xmp)
+func sidecarFilename(originalFilename string) string {
+	return strings.TrimSuffix(originalFilename, filepath.Ext(originalFilename)) + ".xmp"
+}
+
+// sendSidecar downloads the XMP sidecar of a processed image and sends it as a document
+func (b *Bot) sendSidecar(ctx context.Context, message models.ImageProcessed) error {
+	obj, err := b.minio.DownloadFile(ctx, storage.BucketProcessed, message.SidecarPath)
+	if err != nil {
+		return fmt.Errorf("failed to download sidecar: %w", err)
+	}
+	defer func() {
+		if closeErr := obj.Close(); closeErr != nil {
+			b.logger.Error("Failed to close MinIO object", closeErr)
+		}
+	}()
+
+	sidecarBytes, err := io.ReadAll(obj)
+	if err != nil {
+		return fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	doc := tgbotapi.NewDocument(message.TelegramID, tgbotapi.FileBytes{
+		Name:  sidecarFilename(message.OriginalFilename),
+		Bytes: sidecarBytes,
+	})
+	doc.Caption = "📎 XMP sidecar with the generated metadata"
+
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("failed to send sidecar: %w", err)
+	}
+
+	b.metrics.Incr("telegram.sidecars.sent", []string{})
+	return nil
+}
@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shabohin/photo-tags/pkg/models"
+)
+
+func TestOutputModeFromCaption(t *testing.T) {
+	tests := []struct {
+		caption  string
+		expected string
+	}{
+		{caption: "", expected: ""},
+		{caption: "holiday photos", expected: ""},
+		{caption: "#xmp", expected: models.OutputModeSidecar},
+		{caption: "archive scan #Sidecar please", expected: models.OutputModeSidecar},
+		{caption: "#xmpfile", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.caption, func(t *testing.T) {
+			assert.Equal(t, tt.expected, outputModeFromCaption(tt.caption))
+		})
+	}
+}
+
+func TestSidecarFilename(t *testing.T) {
+	assert.Equal(t, "IMG_0001.xmp", sidecarFilename("IMG_0001.jpg"))
+	assert.Equal(t, "scan.final.xmp", sidecarFilename("scan.final.png"))
+	assert.Equal(t, "photo.xmp", sidecarFilename("photo"))
+}
@@ -10,10 +10,13 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/idempotency"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/processor/internal/config"
 	"github.com/shabohin/photo-tags/services/processor/internal/domain/service"
 	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 	"github.com/shabohin/photo-tags/services/processor/internal/handler"
+	"github.com/shabohin/photo-tags/services/processor/internal/monitoring"
 	"github.com/shabohin/photo-tags/services/processor/internal/storage/minio"
 	"github.com/shabohin/photo-tags/services/processor/internal/transport/rabbitmq"
 )
@@ -26,6 +29,7 @@ type App struct {
 	minioClient *minio.Client
 	exifTool    *exiftool.Client
 	processor   *service.MessageProcessorService
+	ledger      *idempotency.Ledger
 	httpHandler *handler.Handler
 	logger      *logrus.Logger
 	shutdownWg  sync.WaitGroup
@@ -39,6 +43,49 @@ func New(cfg *config.Config) (*App, error) {
 
 	logger.Info("Initializing Processor Service")
 
+	// Initialize Datadog tracing, so the ExifTool and MinIO spans are reported with the rest of the trace
+	if err := monitoring.Init("processor", "v1.0.0"); err != nil {
+		logger.WithError(err).Error("Failed to initialize Datadog tracing")
+		// Continue anyway as monitoring is optional
+	} else if monitoring.IsEnabled() {
+		logger.Info("Datadog tracing initialized successfully")
+	} else {
+		logger.Info("Datadog tracing disabled (DD_API_KEY not set)")
+	}
+
+	// Initialize metrics
+	metricsCfg := metrics.ConfigFromEnv("processor", "v1.0.0")
+	if _, err := metrics.Init(metricsCfg); err != nil {
+		logger.WithError(err).Error("Failed to initialize metrics")
+		// Continue anyway as metrics are optional
+	} else {
+		logger.WithField("backend", metricsCfg.Backend).Info("Metrics initialized")
+	}
+
+	verifyMode, err := service.ParseVerifyMode(cfg.ExifTool.VerifyMode)
+	if err != nil {
+		logger.WithError(err).Error("Invalid EXIFTOOL_VERIFY_MODE")
+		return nil, err
+	}
+
+	mergePolicy, err := exiftool.ParseMergePolicy(cfg.ExifTool.MergePolicy)
+	if err != nil {
+		logger.WithError(err).Error("Invalid EXIFTOOL_MERGE_POLICY")
+		return nil, err
+	}
+
+	outputMode, err := service.ParseOutputMode(cfg.ExifTool.OutputMode)
+	if err != nil {
+		logger.WithError(err).Error("Invalid EXIFTOOL_OUTPUT_MODE")
+		return nil, err
+	}
+
+	privacyProfile, err := exiftool.ParsePrivacyProfile(cfg.ExifTool.PrivacyProfile)
+	if err != nil {
+		logger.WithError(err).Error("Invalid EXIFTOOL_PRIVACY_PROFILE")
+		return nil, err
+	}
+
 	// Initialize MinIO client
 	minioClient, err := minio.NewClient(
 		cfg.MinIO.Endpoint,
@@ -57,8 +104,9 @@ func New(cfg *config.Config) (*App, error) {
 	}
 
 	// Initialize ExifTool client
-	exifToolClient := exiftool.NewClient(
+	exifToolClient := exiftool.NewPooledClient(
 		cfg.ExifTool.BinaryPath,
+		cfg.ExifTool.PoolSize,
 		cfg.ExifTool.CommandTimeout,
 		logger,
 	)
@@ -95,14 +143,16 @@ func New(cfg *config.Config) (*App, error) {
 		cfg.ExifTool.TempDir,
 		logger,
 	)
+	imageProcessor.SetVerifyMode(verifyMode)
+	imageProcessor.SetMergePolicy(mergePolicy)
+	imageProcessor.SetOutputMode(outputMode)
+	imageProcessor.SetPrivacyProfile(privacyProfile)
 
 	// Initialize message processor
 	messageProcessor := service.NewMessageProcessor(
 		imageProcessor,
 		publisher,
 		logger,
-		cfg.Worker.MaxRetries,
-		cfg.Worker.RetryDelay,
 	)
 
 	// Initialize RabbitMQ consumer
@@ -110,6 +160,7 @@ func New(cfg *config.Config) (*App, error) {
 		cfg.RabbitMQ.URL,
 		cfg.RabbitMQ.ConsumerQueue,
 		cfg.RabbitMQ.PrefetchCount,
+		cfg.RabbitMQ.LaneWeights,
 		cfg.RabbitMQ.ReconnectAttempts,
 		cfg.RabbitMQ.ReconnectDelay,
 		logger,
@@ -139,6 +190,7 @@ func New(cfg *config.Config) (*App, error) {
 		minioClient: minioClient,
 		exifTool:    exifToolClient,
 		processor:   messageProcessor,
+		ledger:      idempotency.NewLedger(idempotency.NewMemoryStore(idempotency.DefaultCapacity), "processor"),
 		httpHandler: httpHandler,
 		logger:      logger,
 		workerCount: cfg.Worker.Concurrency,
@@ -201,15 +253,21 @@ func (a *App) startWorker(ctx context.Context, id int) {
 	logger.Info("Worker started")
 
 	// Define message handler function
-	handler := func(message []byte) error {
-		processingCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	handler := func(msgCtx context.Context, message []byte) error {
+		processingCtx, cancel := context.WithTimeout(msgCtx, 5*time.Minute)
 		defer cancel()
 
-		err := a.processor.Process(processingCtx, message)
+		// Skip redelivered messages whose image was already written
+		duplicate, err := a.ledger.Process(processingCtx, idempotency.TraceID(message), func() error {
+			return a.processor.Process(processingCtx, message)
+		})
 		if err != nil {
 			logger.WithError(err).Error("Message processing failed")
 			return err
 		}
+		if duplicate {
+			logger.WithField("trace_id", idempotency.TraceID(message)).Info("Skipping already processed message")
+		}
 		return nil
 	}
 
@@ -248,5 +306,15 @@ func (a *App) Shutdown() {
 		a.logger.WithError(err).Error("Error closing publisher")
 	}
 
+	if err := a.exifTool.Close(); err != nil {
+		a.logger.WithError(err).Error("Error closing ExifTool processes")
+	}
+
+	// Stop Datadog tracing and flush metrics
+	monitoring.Stop()
+	if err := metrics.Stop(); err != nil {
+		a.logger.WithError(err).Error("Error flushing metrics")
+	}
+
 	a.logger.Info("Application shutdown complete")
 }
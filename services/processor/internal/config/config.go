@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/priority"
 	pkgstorage "github.com/shabohin/photo-tags/pkg/storage"
 )
 
@@ -27,6 +28,7 @@ type Config struct {
 		ReconnectDelay    time.Duration
 		ReconnectAttempts int
 		PrefetchCount     int
+		LaneWeights       priority.Weights
 	}
 
 	MinIO struct {
@@ -46,12 +48,15 @@ type Config struct {
 		BinaryPath     string
 		TempDir        string
 		CommandTimeout time.Duration
+		PoolSize       int
+		VerifyMode     string
+		MergePolicy    string
+		OutputMode     string
+		PrivacyProfile string
 	}
 
 	Worker struct {
-		RetryDelay  time.Duration
 		Concurrency int
-		MaxRetries  int
 	}
 }
 
@@ -66,6 +71,8 @@ func New() *Config {
 	cfg.RabbitMQ.ConsumerQueue = getEnv("RABBITMQ_CONSUMER_QUEUE", "metadata_generated")
 	cfg.RabbitMQ.PublisherQueue = getEnv("RABBITMQ_PUBLISHER_QUEUE", "image_processed")
 	cfg.RabbitMQ.PrefetchCount = getEnvAsInt("RABBITMQ_PREFETCH_COUNT", 1)
+	cfg.RabbitMQ.LaneWeights.Interactive = getEnvAsInt("RABBITMQ_INTERACTIVE_WEIGHT", priority.DefaultWeights.Interactive)
+	cfg.RabbitMQ.LaneWeights.Bulk = getEnvAsInt("RABBITMQ_BULK_WEIGHT", priority.DefaultWeights.Bulk)
 	cfg.RabbitMQ.ReconnectAttempts = getEnvAsInt("RABBITMQ_RECONNECT_ATTEMPTS", 5)
 	cfg.RabbitMQ.ReconnectDelay = getEnvAsDuration("RABBITMQ_RECONNECT_DELAY", 5*time.Second)
 
@@ -85,6 +92,10 @@ func New() *Config {
 	cfg.ExifTool.BinaryPath = getEnv("EXIFTOOL_BINARY_PATH", "/usr/bin/exiftool")
 	cfg.ExifTool.TempDir = getEnv("EXIFTOOL_TEMP_DIR", "/tmp/processor")
 	cfg.ExifTool.CommandTimeout = getEnvAsDuration("EXIFTOOL_COMMAND_TIMEOUT", 10*time.Second)
+	cfg.ExifTool.VerifyMode = getEnv("EXIFTOOL_VERIFY_MODE", "warn")
+	cfg.ExifTool.MergePolicy = getEnv("EXIFTOOL_MERGE_POLICY", "append-unique")
+	cfg.ExifTool.OutputMode = getEnv("EXIFTOOL_OUTPUT_MODE", "embedded")
+	cfg.ExifTool.PrivacyProfile = getEnv("EXIFTOOL_PRIVACY_PROFILE", "off")
 
 	// Log Config
 	cfg.Log.Level = getEnv("LOG_LEVEL", "info")
@@ -92,8 +103,9 @@ func New() *Config {
 
 	// Worker Config
 	cfg.Worker.Concurrency = getEnvAsInt("WORKER_CONCURRENCY", 3)
-	cfg.Worker.MaxRetries = getEnvAsInt("WORKER_MAX_RETRIES", 3)
-	cfg.Worker.RetryDelay = getEnvAsDuration("WORKER_RETRY_DELAY", 5*time.Second)
+
+	// One persistent ExifTool process per worker by default
+	cfg.ExifTool.PoolSize = getEnvAsInt("EXIFTOOL_POOL_SIZE", cfg.Worker.Concurrency)
 
 	return cfg
 }
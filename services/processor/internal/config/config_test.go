@@ -39,6 +39,26 @@ func TestNew(t *testing.T) {
 	if cfg.Worker.Concurrency != 3 {
 		t.Errorf("Expected worker concurrency 3, got %d", cfg.Worker.Concurrency)
 	}
+
+	if cfg.ExifTool.PoolSize != cfg.Worker.Concurrency {
+		t.Errorf("Expected exiftool pool size to default to worker concurrency, got %d", cfg.ExifTool.PoolSize)
+	}
+
+	if cfg.ExifTool.VerifyMode != "warn" {
+		t.Errorf("Expected verify mode 'warn', got %s", cfg.ExifTool.VerifyMode)
+	}
+
+	if cfg.ExifTool.MergePolicy != "append-unique" {
+		t.Errorf("Expected merge policy 'append-unique', got %s", cfg.ExifTool.MergePolicy)
+	}
+
+	if cfg.ExifTool.OutputMode != "embedded" {
+		t.Errorf("Expected output mode 'embedded', got %s", cfg.ExifTool.OutputMode)
+	}
+
+	if cfg.ExifTool.PrivacyProfile != "off" {
+		t.Errorf("Expected privacy profile 'off', got %s", cfg.ExifTool.PrivacyProfile)
+	}
 }
 
 func TestNewWithEnvVars(t *testing.T) {
@@ -15,8 +15,21 @@ type MinioClientInterface interface {
 
 // ExifToolInterface defines methods for ExifTool operations
 type ExifToolInterface interface {
+	ReadMetadata(ctx context.Context, imagePath string, traceID string) (exiftool.Metadata, error)
 	WriteMetadata(ctx context.Context, imagePath string, metadata exiftool.Metadata, traceID string) error
-	VerifyMetadata(ctx context.Context, imagePath string, traceID string) (bool, error)
+	WriteSidecar(ctx context.Context, sidecarPath string, metadata exiftool.Metadata, traceID string) error
+	FindPrivateTags(
+		ctx context.Context,
+		imagePath string,
+		profile exiftool.PrivacyProfile,
+		traceID string,
+	) ([]string, error)
+	VerifyMetadata(
+		ctx context.Context,
+		imagePath string,
+		expected exiftool.Metadata,
+		traceID string,
+	) (*exiftool.VerificationResult, error)
 	CheckAvailability() error
 }
 
@@ -28,5 +41,12 @@ type PublisherInterface interface {
 
 // ImageProcessorInterface defines methods for image processing
 type ImageProcessorInterface interface {
-	ProcessImage(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, traceID string) error
+	ProcessImage(
+		ctx context.Context,
+		originalPath string,
+		processedPath string,
+		metadata models.Metadata,
+		opts ProcessOptions,
+		traceID string,
+	) (*ProcessResult, error)
 }
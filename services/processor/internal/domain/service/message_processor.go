@@ -2,13 +2,16 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 )
 
 // MessageProcessorService processes messages from RabbitMQ
@@ -16,8 +19,7 @@ type MessageProcessorService struct {
 	imageProcessor ImageProcessorInterface
 	publisher      PublisherInterface
 	logger         *logrus.Logger
-	maxRetries     int
-	retryDelay     time.Duration
+	metrics        *metrics.Metrics
 }
 
 // NewMessageProcessor creates a new message processor
@@ -25,26 +27,27 @@ func NewMessageProcessor(
 	imageProcessor ImageProcessorInterface,
 	publisher PublisherInterface,
 	logger *logrus.Logger,
-	maxRetries int,
-	retryDelay time.Duration,
 ) *MessageProcessorService {
 	return &MessageProcessorService{
 		imageProcessor: imageProcessor,
 		publisher:      publisher,
 		logger:         logger,
-		maxRetries:     maxRetries,
-		retryDelay:     retryDelay,
+		metrics:        metrics.New(),
 	}
 }
 
 // Process handles a single message from metadata_generated queue
 func (s *MessageProcessorService) Process(ctx context.Context, messageBody []byte) error {
+	startTime := time.Now()
+	s.metrics.Incr("rabbitmq.messages.consumed", []string{"queue:metadata_generated"})
+
 	// Parse message
 	var msg models.MetadataGenerated
-	if err := json.Unmarshal(messageBody, &msg); err != nil {
-		s.logger.WithError(err).Error("Failed to unmarshal message")
-		// Don't retry for malformed messages
-		return fmt.Errorf("unmarshal failed: %w", err)
+	if _, err := envelope.Decode(messageBody, envelope.TypeMetadataGenerated, &msg); err != nil {
+		s.logger.WithError(err).Error("Failed to decode message")
+		s.metrics.Incr("message_processor.errors", []string{"error:decode_failed"})
+		// Don't retry for malformed or unsupported messages
+		return retryqueue.Permanent(fmt.Errorf("decode failed: %w", err))
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -57,59 +60,56 @@ func (s *MessageProcessorService) Process(ctx context.Context, messageBody []byt
 	// Generate processed path
 	processedPath := fmt.Sprintf("processed/%s/%s", msg.TraceID, msg.OriginalFilename)
 
-	// Process with retry logic
-	var lastErr error
-	for attempt := 0; attempt < s.maxRetries; attempt++ {
-		if attempt > 0 {
-			s.logger.WithFields(logrus.Fields{
-				"trace_id": msg.TraceID,
-				"attempt":  attempt + 1,
-				"max":      s.maxRetries,
-			}).Info("Retrying image processing")
-
-			// Wait before retry
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(s.retryDelay):
-			}
-		}
-
-		err := s.imageProcessor.ProcessImage(
-			ctx,
-			msg.OriginalPath,
-			processedPath,
-			msg.Metadata,
-			msg.TraceID,
-		)
-
-		if err == nil {
-			// Success - publish completed message
-			return s.publishResult(ctx, msg, processedPath, "completed", "")
-		}
-
-		lastErr = err
+	result, err := s.imageProcessor.ProcessImage(
+		ctx,
+		msg.OriginalPath,
+		processedPath,
+		msg.Metadata,
+		ProcessOptions{
+			MergePolicy:    msg.MergePolicy,
+			OutputMode:     msg.OutputMode,
+			PrivacyProfile: msg.PrivacyProfile,
+			Creator:        msg.Creator,
+		},
+		msg.TraceID,
+	)
+	if err == nil {
+		duration := time.Since(startTime).Milliseconds()
+		s.metrics.Timing("image.processing.duration", duration, []string{"status:success"})
+		s.metrics.Incr("image.processing.success", []string{})
+
+		// Success - publish completed message
+		return s.publishResult(ctx, msg, result, "completed", "")
+	}
+
+	// A transient failure is returned to the consumer, which retries it through the delay queues
+	if !retryqueue.IsPermanent(err) && !retryqueue.LastAttempt(ctx) {
 		s.logger.WithFields(logrus.Fields{
-			"trace_id": msg.TraceID,
-			"attempt":  attempt + 1,
-			"error":    err.Error(),
+			"trace_id":    msg.TraceID,
+			"retry_count": retryqueue.RetryCountFromContext(ctx),
+			"error":       err.Error(),
 		}).Warn("Image processing attempt failed")
+		return fmt.Errorf("image processing failed: %w", err)
 	}
 
-	// All retries exhausted - publish failed message
+	// Retries exhausted or failure is permanent - publish failed message and dead-letter it
 	s.logger.WithFields(logrus.Fields{
 		"trace_id": msg.TraceID,
-		"error":    lastErr.Error(),
+		"error":    err.Error(),
 	}).Error("Image processing failed after all retries")
+	s.metrics.Incr("image.processing.failed", []string{"error:processing_failed"})
 
-	return s.publishResult(ctx, msg, "", "failed", lastErr.Error())
+	if publishErr := s.publishResult(ctx, msg, nil, "failed", err.Error()); publishErr != nil {
+		return publishErr
+	}
+	return retryqueue.Permanent(fmt.Errorf("image processing failed: %w", err))
 }
 
 // publishResult sends result to image_processed queue
 func (s *MessageProcessorService) publishResult(
 	ctx context.Context,
 	originalMsg models.MetadataGenerated,
-	processedPath string,
+	processed *ProcessResult,
 	status string,
 	errorMsg string,
 ) error {
@@ -119,19 +119,31 @@ func (s *MessageProcessorService) publishResult(
 		TelegramID:       originalMsg.TelegramID,
 		TelegramUsername: "", // Will be filled by Gateway
 		OriginalFilename: originalMsg.OriginalFilename,
-		ProcessedPath:    processedPath,
 		Status:           status,
 		Error:            errorMsg,
 		Timestamp:        time.Now(),
+		Experiment:       originalMsg.Experiment,
 	}
 
-	resultBytes, err := json.Marshal(result)
+	if processed != nil {
+		result.ProcessedPath = processed.ProcessedPath
+		result.SidecarPath = processed.SidecarPath
+		result.RemovedTags = processed.RemovedTags
+	}
+
+	// Include the written metadata so the Gateway stores what the file holds, not the request
+	if status == "completed" && processed != nil {
+		metadata := writtenMetadata(originalMsg.Metadata, processed.Metadata)
+		result.Metadata = &metadata
+	}
+
+	resultBytes, err := envelope.Encode(envelope.TypeImageProcessed, envelope.ProducerProcessor, result)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": originalMsg.TraceID,
 			"error":    err.Error(),
-		}).Error("Failed to marshal result message")
-		return fmt.Errorf("failed to marshal result: %w", err)
+		}).Error("Failed to encode result message")
+		return fmt.Errorf("failed to encode result: %w", err)
 	}
 
 	if err := s.publisher.Publish(ctx, resultBytes); err != nil {
@@ -140,8 +152,10 @@ func (s *MessageProcessorService) publishResult(
 			"status":   status,
 			"error":    err.Error(),
 		}).Error("Failed to publish result message")
+		s.metrics.Incr("rabbitmq.messages.publish.errors", []string{"queue:image_processed", "error:publish_failed"})
 		return fmt.Errorf("publish failed: %w", err)
 	}
+	s.metrics.Incr("rabbitmq.messages.published", []string{"queue:image_processed", "status:" + status})
 
 	s.logger.WithFields(logrus.Fields{
 		"trace_id": originalMsg.TraceID,
@@ -150,3 +164,16 @@ func (s *MessageProcessorService) publishResult(
 
 	return nil
 }
+
+// writtenMetadata replaces the requested fields with the merged ones written to the file.
+// The consensus of the request is kept.
+func writtenMetadata(requested models.Metadata, written exiftool.Metadata) models.Metadata {
+	requested.Title = written.Title
+	requested.Description = written.Description
+	requested.Keywords = written.Keywords
+	requested.HierarchicalKeywords = written.HierarchicalKeywords
+	requested.Category = written.Category
+	requested.SupplementalCategories = written.SupplementalCategories
+	requested.AltText = written.AltText
+	return requested
+}
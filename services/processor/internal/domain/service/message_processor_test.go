@@ -9,7 +9,10 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/envelope"
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 )
 
 // Mock publisher
@@ -32,16 +35,33 @@ func (m *mockPublisher) Close() error {
 
 // Mock image processor
 type mockImageProcessor struct {
-	processFunc func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, traceID string) error
-	callCount   int
+	processFunc func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error
+	removedTags []string
+	// merged, if set, is reported as the metadata written to the image instead of the request
+	merged    *exiftool.Metadata
+	callCount int
 }
 
-func (m *mockImageProcessor) ProcessImage(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, traceID string) error {
+func (m *mockImageProcessor) ProcessImage(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) (*ProcessResult, error) {
 	m.callCount++
 	if m.processFunc != nil {
-		return m.processFunc(ctx, originalPath, processedPath, metadata, traceID)
+		if err := m.processFunc(ctx, originalPath, processedPath, metadata, opts, traceID); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	written := exiftool.Metadata{
+		Title:                metadata.Title,
+		Description:          metadata.Description,
+		Keywords:             metadata.Keywords,
+		HierarchicalKeywords: metadata.HierarchicalKeywords,
+	}
+	if m.merged != nil {
+		written = *m.merged
+	}
+	if opts.OutputMode == models.OutputModeSidecar {
+		return &ProcessResult{ProcessedPath: processedPath, SidecarPath: processedPath + ".xmp", Metadata: written}, nil
+	}
+	return &ProcessResult{ProcessedPath: processedPath, Metadata: written, RemovedTags: m.removedTags}, nil
 }
 
 func TestNewMessageProcessor(t *testing.T) {
@@ -49,14 +69,14 @@ func TestNewMessageProcessor(t *testing.T) {
 	imageProcessor := &mockImageProcessor{}
 	publisher := &mockPublisher{}
 
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, 3, 5*time.Second)
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
 
 	if processor == nil {
 		t.Fatal("Expected non-nil processor")
 	}
 
-	if processor.maxRetries != 3 {
-		t.Errorf("Expected maxRetries 3, got %d", processor.maxRetries)
+	if processor.publisher != publisher {
+		t.Error("Expected publisher to be set")
 	}
 }
 
@@ -67,7 +87,7 @@ func TestProcess_Success(t *testing.T) {
 	imageProcessor := &mockImageProcessor{}
 	publisher := &mockPublisher{}
 
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, 3, 100*time.Millisecond)
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
 
 	// Create test message
 	msg := models.MetadataGenerated{
@@ -110,53 +130,369 @@ func TestProcess_Success(t *testing.T) {
 		t.Errorf("Expected trace_id 'test-trace-id', got %s", result.TraceID)
 	}
 
+	// Check the envelope header
+	header, _ := envelope.ReadHeader(publisher.messages[0])
+	if header.SchemaVersion != envelope.CurrentVersion || header.Type != envelope.TypeImageProcessed {
+		t.Errorf("Unexpected header %+v", header)
+	}
+	if header.ProducedBy != envelope.ProducerProcessor {
+		t.Errorf("Expected produced_by 'processor', got %s", header.ProducedBy)
+	}
+
 	// Check that image processor was called once
 	if imageProcessor.callCount != 1 {
 		t.Errorf("Expected imageProcessor to be called once, got %d", imageProcessor.callCount)
 	}
 }
 
-func TestProcess_RetryAndFail(t *testing.T) {
+func TestProcess_ForwardsExperiment(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	imageProcessor := &mockImageProcessor{}
+	publisher := &mockPublisher{}
+
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		GroupID:          "test-group-id",
+		TelegramID:       123456789,
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test-trace-id/test.jpg",
+		Metadata: models.Metadata{
+			Title:    "Test Title",
+			Keywords: []string{"test", "image"},
+		},
+		Experiment: &models.Experiment{
+			VariantID:     "variant-a",
+			KeywordCount:  2,
+			ParseFailures: 1,
+		},
+		Timestamp: time.Now(),
+	}
+
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var result models.ImageProcessed
+	json.Unmarshal(publisher.messages[0], &result)
+
+	if result.Experiment == nil {
+		t.Fatal("Expected experiment to be forwarded")
+	}
+
+	if result.Experiment.VariantID != "variant-a" || result.Experiment.ParseFailures != 1 {
+		t.Errorf("Unexpected experiment in result: %+v", result.Experiment)
+	}
+}
+
+func TestProcess_ForwardsMetadata(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	imageProcessor := &mockImageProcessor{}
+	publisher := &mockPublisher{}
+
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		GroupID:          "test-group-id",
+		TelegramID:       123456789,
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test-trace-id/test.jpg",
+		Metadata: models.Metadata{
+			Title:                "Test Title",
+			Keywords:             []string{"dog"},
+			HierarchicalKeywords: []string{"Animals|Mammals|Dog"},
+		},
+		Timestamp: time.Now(),
+	}
+
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var result models.ImageProcessed
+	json.Unmarshal(publisher.messages[0], &result)
+
+	if result.Metadata == nil {
+		t.Fatal("Expected metadata to be forwarded")
+	}
+
+	if len(result.Metadata.HierarchicalKeywords) != 1 || result.Metadata.HierarchicalKeywords[0] != "Animals|Mammals|Dog" {
+		t.Errorf("Unexpected hierarchical keywords in result: %v", result.Metadata.HierarchicalKeywords)
+	}
+}
+
+func TestProcess_PublishesMergedMetadata(t *testing.T) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel)
 
-	// Image processor always fails
 	imageProcessor := &mockImageProcessor{
-		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, traceID string) error {
-			return errors.New("processing failed")
+		merged: &exiftool.Metadata{Title: "Existing Title", Keywords: []string{"existing", "dog"}},
+	}
+	publisher := &mockPublisher{}
+
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test-trace-id/test.jpg",
+		MergePolicy:      "keep-existing",
+		Metadata: models.Metadata{
+			Title:     "Generated Title",
+			Keywords:  []string{"dog"},
+			Consensus: &models.Consensus{Models: []string{"model-a", "model-b"}},
+		},
+		Timestamp: time.Now(),
+	}
+
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var result models.ImageProcessed
+	if err := json.Unmarshal(publisher.messages[0], &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	if result.Metadata == nil {
+		t.Fatal("Expected metadata to be published")
+	}
+	if result.Metadata.Title != "Existing Title" {
+		t.Errorf("Expected the merged title, got %q", result.Metadata.Title)
+	}
+	if len(result.Metadata.Keywords) != 2 {
+		t.Errorf("Expected the merged keywords, got %v", result.Metadata.Keywords)
+	}
+	if result.Metadata.Consensus == nil {
+		t.Error("Expected the consensus of the request to be kept")
+	}
+}
+
+func TestProcess_ForwardsMergePolicy(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	var received string
+	imageProcessor := &mockImageProcessor{
+		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error {
+			received = opts.MergePolicy
+			return nil
 		},
 	}
 
+	processor := NewMessageProcessor(imageProcessor, &mockPublisher{}, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test.jpg",
+		Metadata:         models.Metadata{Title: "Test"},
+		MergePolicy:      models.MergePolicyKeepExisting,
+		Timestamp:        time.Now(),
+	}
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if received != models.MergePolicyKeepExisting {
+		t.Errorf("Expected merge policy %q, got %q", models.MergePolicyKeepExisting, received)
+	}
+}
+
+func TestProcess_ForwardsSidecarPath(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
 	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(&mockImageProcessor{}, publisher, logger)
 
-	maxRetries := 3
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, maxRetries, 10*time.Millisecond)
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test.jpg",
+		Metadata:         models.Metadata{Title: "Test"},
+		OutputMode:       models.OutputModeSidecar,
+		Timestamp:        time.Now(),
+	}
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var result models.ImageProcessed
+	if err := json.Unmarshal(publisher.messages[0], &result); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+
+	if result.ProcessedPath != "processed/test-trace-id/test.jpg" {
+		t.Errorf("Unexpected processed path: %s", result.ProcessedPath)
+	}
+	if result.SidecarPath != "processed/test-trace-id/test.jpg.xmp" {
+		t.Errorf("Unexpected sidecar path: %s", result.SidecarPath)
+	}
+}
+
+func TestProcess_RawUploadDeliversSidecar(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	exifTool := &mockExifTool{
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			t.Error("RAW files must not be modified")
+			return nil
+		},
+	}
+	imageProcessor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "IMG_0001.CR2",
+		OriginalPath:     "telegram/test-trace-id/IMG_0001.CR2",
+		Metadata:         models.Metadata{Title: "Test"},
+		Timestamp:        time.Now(),
+	}
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var result models.ImageProcessed
+	if err := json.Unmarshal(publisher.messages[0], &result); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+
+	if result.Status != "completed" {
+		t.Errorf("Expected completed status, got %s (%s)", result.Status, result.Error)
+	}
+	if result.SidecarPath != "processed/test-trace-id/IMG_0001.xmp" {
+		t.Errorf("Unexpected sidecar path: %s", result.SidecarPath)
+	}
+}
+
+func TestProcess_ForwardsPrivacyProfile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	imageProcessor := &mockImageProcessor{
+		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error {
+			if opts.PrivacyProfile != models.PrivacyProfileStrict {
+				t.Errorf("Expected strict privacy profile, got %q", opts.PrivacyProfile)
+			}
+			return nil
+		},
+		removedTags: []string{"EXIF:GPSLatitude"},
+	}
+	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
 
 	msg := models.MetadataGenerated{
 		TraceID:          "test-trace-id",
 		OriginalFilename: "test.jpg",
 		OriginalPath:     "original/test.jpg",
 		Metadata:         models.Metadata{Title: "Test"},
+		PrivacyProfile:   models.PrivacyProfileStrict,
 		Timestamp:        time.Now(),
 	}
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
 
+	var result models.ImageProcessed
+	if err := json.Unmarshal(publisher.messages[0], &result); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if len(result.RemovedTags) != 1 || result.RemovedTags[0] != "EXIF:GPSLatitude" {
+		t.Errorf("Expected removed tags in result, got %v", result.RemovedTags)
+	}
+}
+
+func TestProcess_TransientFailureIsRetried(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	imageProcessor := &mockImageProcessor{
+		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error {
+			return errors.New("processing failed")
+		},
+	}
+
+	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test.jpg",
+		Metadata:         models.Metadata{Title: "Test"},
+		Timestamp:        time.Now(),
+	}
 	msgBytes, _ := json.Marshal(msg)
 
-	ctx := context.Background()
-	err := processor.Process(ctx, msgBytes)
+	err := processor.Process(context.Background(), msgBytes)
+	if err == nil || retryqueue.IsPermanent(err) {
+		t.Errorf("Expected a transient error for the consumer to retry, got %v", err)
+	}
 
-	if err != nil {
-		t.Errorf("Process should not return error on retry exhaustion: %v", err)
+	// The delay queues retry the message, not the processor
+	if imageProcessor.callCount != 1 {
+		t.Errorf("Expected imageProcessor to be called once, got %d", imageProcessor.callCount)
 	}
 
-	// Check that image processor was called maxRetries times
-	if imageProcessor.callCount != maxRetries {
-		t.Errorf("Expected imageProcessor to be called %d times, got %d", maxRetries, imageProcessor.callCount)
+	if len(publisher.messages) != 0 {
+		t.Errorf("Expected no published message before the last attempt, got %d", len(publisher.messages))
+	}
+}
+
+func TestProcess_FailsOnLastAttempt(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	imageProcessor := &mockImageProcessor{
+		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error {
+			return errors.New("processing failed")
+		},
+	}
+
+	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test.jpg",
+		Metadata:         models.Metadata{Title: "Test"},
+		Timestamp:        time.Now(),
+	}
+	msgBytes, _ := json.Marshal(msg)
+
+	ctx := retryqueue.ContextWithRetryCount(context.Background(), len(retryqueue.Tiers))
+	err := processor.Process(ctx, msgBytes)
+	if !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected a permanent error after the last retry, got %v", err)
 	}
 
-	// Check that failed result was published
 	if len(publisher.messages) != 1 {
-		t.Errorf("Expected 1 published message, got %d", len(publisher.messages))
+		t.Fatalf("Expected 1 published message, got %d", len(publisher.messages))
 	}
 
 	var result models.ImageProcessed
@@ -171,6 +507,48 @@ func TestProcess_RetryAndFail(t *testing.T) {
 	}
 }
 
+func TestProcess_PermanentFailureSkipsRetries(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	imageProcessor := &mockImageProcessor{
+		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, opts ProcessOptions, traceID string) error {
+			return retryqueue.Permanent(ErrVerificationFailed)
+		},
+	}
+
+	publisher := &mockPublisher{}
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	msg := models.MetadataGenerated{
+		TraceID:          "test-trace-id",
+		OriginalFilename: "test.jpg",
+		OriginalPath:     "original/test.jpg",
+		Metadata:         models.Metadata{Title: "Test"},
+		Timestamp:        time.Now(),
+	}
+	msgBytes, _ := json.Marshal(msg)
+
+	if err := processor.Process(context.Background(), msgBytes); !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+
+	if imageProcessor.callCount != 1 {
+		t.Errorf("Expected imageProcessor to be called once, got %d", imageProcessor.callCount)
+	}
+
+	if len(publisher.messages) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(publisher.messages))
+	}
+
+	var result models.ImageProcessed
+	json.Unmarshal(publisher.messages[0], &result)
+
+	if result.Status != "failed" {
+		t.Errorf("Expected status 'failed', got %s", result.Status)
+	}
+}
+
 func TestProcess_InvalidJSON(t *testing.T) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel)
@@ -178,7 +556,7 @@ func TestProcess_InvalidJSON(t *testing.T) {
 	imageProcessor := &mockImageProcessor{}
 	publisher := &mockPublisher{}
 
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, 3, 100*time.Millisecond)
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
 
 	// Invalid JSON
 	invalidJSON := []byte("{invalid json")
@@ -190,6 +568,11 @@ func TestProcess_InvalidJSON(t *testing.T) {
 		t.Error("Expected error for invalid JSON")
 	}
 
+	// Malformed messages go straight to the dead letter queue
+	if !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected a permanent error for invalid JSON, got %v", err)
+	}
+
 	// Should not publish anything
 	if len(publisher.messages) != 0 {
 		t.Errorf("Expected 0 published messages for invalid JSON, got %d", len(publisher.messages))
@@ -201,6 +584,27 @@ func TestProcess_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestProcess_UnsupportedVersion(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	imageProcessor := &mockImageProcessor{}
+	publisher := &mockPublisher{}
+
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
+
+	// A message from a producer newer than this processor
+	err := processor.Process(context.Background(), []byte(`{"schema_version":99,"type":"metadata_generated","trace_id":"t1"}`))
+
+	if !errors.Is(err, envelope.ErrUnsupportedVersion) || !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected a permanent unsupported version error, got %v", err)
+	}
+
+	if imageProcessor.callCount != 0 {
+		t.Errorf("Expected imageProcessor not to be called, got %d calls", imageProcessor.callCount)
+	}
+}
+
 func TestProcess_PublishFailure(t *testing.T) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel)
@@ -214,7 +618,7 @@ func TestProcess_PublishFailure(t *testing.T) {
 		},
 	}
 
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, 3, 100*time.Millisecond)
+	processor := NewMessageProcessor(imageProcessor, publisher, logger)
 
 	msg := models.MetadataGenerated{
 		TraceID:          "test-trace-id",
@@ -238,47 +642,3 @@ func TestProcess_PublishFailure(t *testing.T) {
 		t.Errorf("Expected imageProcessor to be called once, got %d", imageProcessor.callCount)
 	}
 }
-
-func TestProcess_ContextCancellation(t *testing.T) {
-	logger := logrus.New()
-	logger.SetLevel(logrus.ErrorLevel)
-
-	// Image processor always fails to force retry
-	imageProcessor := &mockImageProcessor{
-		processFunc: func(ctx context.Context, originalPath string, processedPath string, metadata models.Metadata, traceID string) error {
-			return errors.New("processing failed")
-		},
-	}
-
-	publisher := &mockPublisher{}
-
-	processor := NewMessageProcessor(imageProcessor, publisher, logger, 10, 100*time.Millisecond)
-
-	msg := models.MetadataGenerated{
-		TraceID:          "test-trace-id",
-		OriginalFilename: "test.jpg",
-		OriginalPath:     "original/test.jpg",
-		Metadata:         models.Metadata{Title: "Test"},
-		Timestamp:        time.Now(),
-	}
-
-	msgBytes, _ := json.Marshal(msg)
-
-	// Cancel context after short delay
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		time.Sleep(50 * time.Millisecond)
-		cancel()
-	}()
-
-	err := processor.Process(ctx, msgBytes)
-
-	if err != context.Canceled {
-		t.Errorf("Expected context.Canceled error, got: %v", err)
-	}
-
-	// Should have attempted processing at least once
-	if imageProcessor.callCount == 0 {
-		t.Error("Expected at least one processing attempt")
-	}
-}
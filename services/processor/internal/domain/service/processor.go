@@ -2,21 +2,56 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/storage"
 	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 )
 
+// ErrVerificationFailed is returned when the metadata read back from the image differs from the request
+var ErrVerificationFailed = errors.New("metadata verification failed")
+
+// VerifyMode controls what happens when written metadata does not match the request
+type VerifyMode string
+
+const (
+	// VerifyOff skips reading metadata back
+	VerifyOff VerifyMode = "off"
+	// VerifyWarn logs differences and uploads the image anyway
+	VerifyWarn VerifyMode = "warn"
+	// VerifyRetry fails the attempt so the message is processed again
+	VerifyRetry VerifyMode = "retry"
+	// VerifyStrict fails the message without further retries
+	VerifyStrict VerifyMode = "strict"
+)
+
+// ParseVerifyMode validates a verification mode from configuration
+func ParseVerifyMode(value string) (VerifyMode, error) {
+	switch mode := VerifyMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case VerifyOff, VerifyWarn, VerifyRetry, VerifyStrict:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown verify mode %q", value)
+	}
+}
+
 // ImageProcessorService handles image processing workflow
 type ImageProcessorService struct {
 	minioClient MinioClientInterface
 	exifTool    ExifToolInterface
 	tempDir     string
+	verifyMode  VerifyMode
+	mergePolicy exiftool.MergePolicy
+	outputMode  string
+	privacy     exiftool.PrivacyProfile
 	logger      *logrus.Logger
 }
 
@@ -31,22 +66,126 @@ func NewImageProcessor(
 		minioClient: minioClient,
 		exifTool:    exifTool,
 		tempDir:     tempDir,
+		verifyMode:  VerifyWarn,
+		mergePolicy: exiftool.MergeAppendUnique,
+		outputMode:  models.OutputModeEmbedded,
 		logger:      logger,
 	}
 }
 
-// ProcessImage processes an image: downloads, writes metadata, and uploads
+// SetMergePolicy sets the merge policy used when a message does not select one
+func (s *ImageProcessorService) SetMergePolicy(policy exiftool.MergePolicy) {
+	s.mergePolicy = policy
+}
+
+// SetVerifyMode sets how metadata verification failures are handled
+func (s *ImageProcessorService) SetVerifyMode(mode VerifyMode) {
+	s.verifyMode = mode
+}
+
+// SetPrivacyProfile sets the privacy profile used when a message does not select one
+func (s *ImageProcessorService) SetPrivacyProfile(profile exiftool.PrivacyProfile) {
+	s.privacy = profile
+}
+
+// ProcessOptions are per-message choices; empty values use the service defaults.
+// Creator is the uploader's profile and is written to every image when set.
+type ProcessOptions struct {
+	MergePolicy    string
+	OutputMode     string
+	PrivacyProfile string
+	Creator        *models.CreatorProfile
+}
+
+// ProcessResult lists the objects uploaded to the processed bucket, the metadata written
+// after merging with the existing tags, and the tags removed from the image
+type ProcessResult struct {
+	ProcessedPath string
+	SidecarPath   string
+	Metadata      exiftool.Metadata
+	RemovedTags   []string
+}
+
+// resolvedOptions are the options of a message after defaults are applied
+type resolvedOptions struct {
+	mergePolicy exiftool.MergePolicy
+	outputMode  string
+	privacy     exiftool.PrivacyProfile
+}
+
+// ParseOutputMode validates an output mode from configuration or a message
+func ParseOutputMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case models.OutputModeEmbedded, models.OutputModeSidecar:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q", value)
+	}
+}
+
+// SetOutputMode sets the output mode used when a message does not select one
+func (s *ImageProcessorService) SetOutputMode(mode string) {
+	s.outputMode = mode
+}
+
+// resolveOptions applies defaults and validates the options of a message
+func (s *ImageProcessorService) resolveOptions(opts ProcessOptions, originalPath string) (resolvedOptions, error) {
+	resolved := resolvedOptions{
+		mergePolicy: s.mergePolicy,
+		outputMode:  s.outputMode,
+		privacy:     s.privacy,
+	}
+
+	if opts.MergePolicy != "" {
+		parsed, err := exiftool.ParseMergePolicy(opts.MergePolicy)
+		if err != nil {
+			return resolvedOptions{}, err
+		}
+		resolved.mergePolicy = parsed
+	}
+
+	if opts.OutputMode != "" {
+		parsed, err := ParseOutputMode(opts.OutputMode)
+		if err != nil {
+			return resolvedOptions{}, err
+		}
+		resolved.outputMode = parsed
+	} else if storage.IsRAW(originalPath) {
+		// Camera RAW files get a sidecar unless a message asks otherwise
+		resolved.outputMode = models.OutputModeSidecar
+	}
+
+	if opts.PrivacyProfile != "" {
+		parsed, err := exiftool.ParsePrivacyProfile(opts.PrivacyProfile)
+		if err != nil {
+			return resolvedOptions{}, err
+		}
+		resolved.privacy = parsed
+	}
+
+	return resolved, nil
+}
+
+// ProcessImage processes an image: downloads, merges and writes metadata, and uploads.
+// In sidecar mode the image is uploaded unchanged and the metadata goes to an .xmp next to it.
 func (s *ImageProcessorService) ProcessImage(
 	ctx context.Context,
 	originalPath string,
 	processedPath string,
 	metadata models.Metadata,
+	opts ProcessOptions,
 	traceID string,
-) error {
+) (*ProcessResult, error) {
+	resolved, err := s.resolveOptions(opts, originalPath)
+	if err != nil {
+		return nil, retryqueue.Permanent(err)
+	}
+
 	s.logger.WithFields(logrus.Fields{
 		"trace_id":       traceID,
 		"original_path":  originalPath,
 		"processed_path": processedPath,
+		"output_mode":    resolved.outputMode,
 	}).Info("Starting image processing")
 
 	// Step 1: Download image from MinIO (original bucket)
@@ -56,7 +195,7 @@ func (s *ImageProcessorService) ProcessImage(
 			"trace_id": traceID,
 			"error":    err.Error(),
 		}).Error("Failed to download image from MinIO")
-		return fmt.Errorf("download failed: %w", err)
+		return nil, fmt.Errorf("download failed: %w", err)
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -67,24 +206,48 @@ func (s *ImageProcessorService) ProcessImage(
 	// Step 2: Save to temporary directory
 	tempFilePath, err := s.saveTempFile(imageBytes, traceID)
 	if err != nil {
-		return fmt.Errorf("failed to save temp file: %w", err)
+		return nil, fmt.Errorf("failed to save temp file: %w", err)
 	}
 	defer s.cleanupTempFile(tempFilePath, traceID)
 
-	// Step 3: Convert metadata format
-	exifMetadata := exiftool.Metadata{
-		Title:       metadata.Title,
-		Description: metadata.Description,
-		Keywords:    metadata.Keywords,
+	// Step 3: Convert metadata format and merge it with the tags already in the image
+	exifMetadata, err := s.mergeMetadata(ctx, tempFilePath, exiftool.Metadata{
+		Title:                  metadata.Title,
+		Description:            metadata.Description,
+		Keywords:               metadata.Keywords,
+		HierarchicalKeywords:   metadata.HierarchicalKeywords,
+		Category:               metadata.Category,
+		SupplementalCategories: metadata.SupplementalCategories,
+		AltText:                metadata.AltText,
+		Creator:                creatorFromProfile(opts.Creator),
+	}, resolved.mergePolicy, traceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolved.outputMode == models.OutputModeSidecar {
+		if len(resolved.privacy) > 0 {
+			s.logger.WithField("trace_id", traceID).Warn("Privacy profile is not applied in sidecar mode, the image is unchanged")
+		}
+		return s.processSidecar(ctx, tempFilePath, imageBytes, processedPath, exifMetadata, traceID)
+	}
+
+	// Step 4: Find the identifying tags to remove in the same ExifTool pass
+	removedTags, err := s.findPrivateTags(ctx, tempFilePath, resolved.privacy, traceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(removedTags) > 0 {
+		exifMetadata.RemoveTags = resolved.privacy.Tags()
 	}
 
-	// Step 4: Write metadata with ExifTool
+	// Step 5: Write metadata with ExifTool
 	if err := s.exifTool.WriteMetadata(ctx, tempFilePath, exifMetadata, traceID); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": traceID,
 			"error":    err.Error(),
 		}).Error("Failed to write metadata")
-		return fmt.Errorf("metadata write failed: %w", err)
+		return nil, fmt.Errorf("metadata write failed: %w", err)
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -93,29 +256,24 @@ func (s *ImageProcessorService) ProcessImage(
 		"keywords_count": len(metadata.Keywords),
 	}).Info("Metadata written successfully")
 
-	// Step 5: Verify metadata (optional, log warning if failed)
-	verified, err := s.exifTool.VerifyMetadata(ctx, tempFilePath, traceID)
-	if err != nil || !verified {
-		s.logger.WithFields(logrus.Fields{
-			"trace_id": traceID,
-			"verified": verified,
-			"error":    err,
-		}).Warn("Metadata verification failed, proceeding anyway")
+	// Step 6: Verify metadata
+	if err := s.verifyMetadata(ctx, tempFilePath, exifMetadata, traceID); err != nil {
+		return nil, err
 	}
 
-	// Step 6: Read processed image
+	// Step 7: Read processed image
 	processedImageBytes, err := os.ReadFile(tempFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to read processed file: %w", err)
+		return nil, fmt.Errorf("failed to read processed file: %w", err)
 	}
 
-	// Step 7: Upload to MinIO (processed bucket)
+	// Step 8: Upload to MinIO (processed bucket)
 	if err := s.minioClient.UploadImage(ctx, processedPath, processedImageBytes); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"trace_id": traceID,
 			"error":    err.Error(),
 		}).Error("Failed to upload processed image to MinIO")
-		return fmt.Errorf("upload failed: %w", err)
+		return nil, fmt.Errorf("upload failed: %w", err)
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -124,7 +282,172 @@ func (s *ImageProcessorService) ProcessImage(
 		"size_kb":        len(processedImageBytes) / 1024,
 	}).Info("Image processing completed successfully")
 
-	return nil
+	return &ProcessResult{ProcessedPath: processedPath, Metadata: exifMetadata, RemovedTags: removedTags}, nil
+}
+
+// creatorFromProfile converts the creator profile of a message to ExifTool fields
+func creatorFromProfile(profile *models.CreatorProfile) exiftool.Creator {
+	if profile == nil {
+		return exiftool.Creator{}
+	}
+	return exiftool.Creator{
+		Name:       profile.Creator,
+		Rights:     profile.Rights,
+		UsageTerms: profile.UsageTerms,
+		Email:      profile.Email,
+		Phone:      profile.Phone,
+		Website:    profile.Website,
+		City:       profile.City,
+		Country:    profile.Country,
+	}
+}
+
+// processSidecar writes metadata to an .xmp sidecar and uploads it next to a byte-identical copy of the image
+func (s *ImageProcessorService) processSidecar(
+	ctx context.Context,
+	tempFilePath string,
+	imageBytes []byte,
+	processedPath string,
+	metadata exiftool.Metadata,
+	traceID string,
+) (*ProcessResult, error) {
+	tempSidecarPath := exiftool.SidecarPath(tempFilePath)
+	defer s.cleanupTempFile(tempSidecarPath, traceID)
+
+	if err := s.exifTool.WriteSidecar(ctx, tempSidecarPath, metadata, traceID); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"error":    err.Error(),
+		}).Error("Failed to write XMP sidecar")
+		return nil, fmt.Errorf("sidecar write failed: %w", err)
+	}
+
+	if err := s.verifyMetadata(ctx, tempSidecarPath, metadata, traceID); err != nil {
+		return nil, err
+	}
+
+	sidecarBytes, err := os.ReadFile(tempSidecarPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar file: %w", err)
+	}
+
+	sidecarPath := exiftool.SidecarPath(processedPath)
+	if err := s.minioClient.UploadImage(ctx, sidecarPath, sidecarBytes); err != nil {
+		return nil, fmt.Errorf("sidecar upload failed: %w", err)
+	}
+
+	// The original bytes are uploaded, not the temp file, so the copy is byte-identical
+	if err := s.minioClient.UploadImage(ctx, processedPath, imageBytes); err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"trace_id":       traceID,
+		"processed_path": processedPath,
+		"sidecar_path":   sidecarPath,
+	}).Info("Sidecar processing completed successfully")
+
+	return &ProcessResult{ProcessedPath: processedPath, SidecarPath: sidecarPath, Metadata: metadata}, nil
+}
+
+// mergeMetadata reads the existing tags unless the policy replaces them and applies the policy
+func (s *ImageProcessorService) mergeMetadata(
+	ctx context.Context,
+	imagePath string,
+	requested exiftool.Metadata,
+	policy exiftool.MergePolicy,
+	traceID string,
+) (exiftool.Metadata, error) {
+	var existing exiftool.Metadata
+	if policy != exiftool.MergeReplace {
+		var err error
+		existing, err = s.exifTool.ReadMetadata(ctx, imagePath, traceID)
+		if err != nil {
+			return exiftool.Metadata{}, fmt.Errorf("metadata read failed: %w", err)
+		}
+	}
+
+	merged := exiftool.MergeMetadata(existing, requested, policy)
+
+	s.logger.WithFields(logrus.Fields{
+		"trace_id":          traceID,
+		"merge_policy":      policy,
+		"existing_keywords": len(existing.Keywords),
+		"keywords":          len(merged.Keywords),
+	}).Debug("Metadata merged with existing tags")
+
+	return merged, nil
+}
+
+// findPrivateTags lists the tags present in the image that the privacy profile removes
+func (s *ImageProcessorService) findPrivateTags(
+	ctx context.Context,
+	imagePath string,
+	profile exiftool.PrivacyProfile,
+	traceID string,
+) ([]string, error) {
+	if len(profile) == 0 {
+		return nil, nil
+	}
+
+	tags, err := s.exifTool.FindPrivateTags(ctx, imagePath, profile, traceID)
+	if err != nil {
+		return nil, fmt.Errorf("privacy scan failed: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"trace_id":     traceID,
+		"groups":       profile,
+		"removed_tags": tags,
+	}).Debug("Private tags selected for removal")
+
+	return tags, nil
+}
+
+// verifyMetadata reads the written tags back and applies the verification mode to any differences
+func (s *ImageProcessorService) verifyMetadata(
+	ctx context.Context,
+	imagePath string,
+	expected exiftool.Metadata,
+	traceID string,
+) error {
+	if s.verifyMode == VerifyOff {
+		return nil
+	}
+
+	result, err := s.exifTool.VerifyMetadata(ctx, imagePath, expected, traceID)
+	if err == nil && result.OK() {
+		s.logger.WithField("trace_id", traceID).Debug("Metadata verified")
+		return nil
+	}
+
+	var verifyErr error
+	if err != nil {
+		verifyErr = fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	} else {
+		verifyErr = fmt.Errorf("%w: %s", ErrVerificationFailed, result)
+	}
+
+	fields := logrus.Fields{
+		"trace_id": traceID,
+		"mode":     s.verifyMode,
+		"error":    verifyErr.Error(),
+	}
+	if result != nil {
+		fields["diffs"] = result.Diffs
+	}
+
+	switch s.verifyMode {
+	case VerifyRetry:
+		s.logger.WithFields(fields).Warn("Metadata verification failed")
+		return verifyErr
+	case VerifyStrict:
+		s.logger.WithFields(fields).Error("Metadata verification failed")
+		return retryqueue.Permanent(verifyErr)
+	default:
+		s.logger.WithFields(fields).Warn("Metadata verification failed, proceeding anyway")
+		return nil
+	}
 }
 
 // saveTempFile saves image bytes to a temporary file
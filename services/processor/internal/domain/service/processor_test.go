@@ -9,6 +9,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
 	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 )
 
@@ -34,8 +35,18 @@ func (m *mockMinioClient) UploadImage(ctx context.Context, path string, data []b
 
 // Mock ExifTool client
 type mockExifTool struct {
-	writeFunc  func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error
-	verifyFunc func(ctx context.Context, path string, traceID string) (bool, error)
+	readFunc    func(ctx context.Context, path string, traceID string) (exiftool.Metadata, error)
+	sidecarFunc func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error
+	writeFunc   func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error
+	verifyFunc  func(ctx context.Context, path string, expected exiftool.Metadata, traceID string) (*exiftool.VerificationResult, error)
+	privacyFunc func(ctx context.Context, path string, profile exiftool.PrivacyProfile, traceID string) ([]string, error)
+}
+
+func (m *mockExifTool) ReadMetadata(ctx context.Context, path string, traceID string) (exiftool.Metadata, error) {
+	if m.readFunc != nil {
+		return m.readFunc(ctx, path, traceID)
+	}
+	return exiftool.Metadata{}, nil
 }
 
 func (m *mockExifTool) WriteMetadata(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
@@ -45,11 +56,35 @@ func (m *mockExifTool) WriteMetadata(ctx context.Context, path string, metadata
 	return nil
 }
 
-func (m *mockExifTool) VerifyMetadata(ctx context.Context, path string, traceID string) (bool, error) {
+func (m *mockExifTool) WriteSidecar(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+	if m.sidecarFunc != nil {
+		return m.sidecarFunc(ctx, path, metadata, traceID)
+	}
+	return os.WriteFile(path, []byte("<x:xmpmeta/>"), 0644)
+}
+
+func (m *mockExifTool) VerifyMetadata(
+	ctx context.Context,
+	path string,
+	expected exiftool.Metadata,
+	traceID string,
+) (*exiftool.VerificationResult, error) {
 	if m.verifyFunc != nil {
-		return m.verifyFunc(ctx, path, traceID)
+		return m.verifyFunc(ctx, path, expected, traceID)
 	}
-	return true, nil
+	return &exiftool.VerificationResult{}, nil
+}
+
+func (m *mockExifTool) FindPrivateTags(
+	ctx context.Context,
+	path string,
+	profile exiftool.PrivacyProfile,
+	traceID string,
+) ([]string, error) {
+	if m.privacyFunc != nil {
+		return m.privacyFunc(ctx, path, profile, traceID)
+	}
+	return nil, nil
 }
 
 func (m *mockExifTool) CheckAvailability() error {
@@ -112,7 +147,7 @@ func TestProcessImage_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, "test-trace-id")
+	_, err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, ProcessOptions{}, "test-trace-id")
 
 	if err != nil {
 		t.Errorf("ProcessImage failed: %v", err)
@@ -138,7 +173,7 @@ func TestProcessImage_DownloadFailure(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, "test-trace-id")
+	_, err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, ProcessOptions{}, "test-trace-id")
 
 	if err == nil {
 		t.Error("Expected error when download fails")
@@ -174,7 +209,7 @@ func TestProcessImage_MetadataWriteFailure(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, "test-trace-id")
+	_, err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, ProcessOptions{}, "test-trace-id")
 
 	if err == nil {
 		t.Error("Expected error when metadata write fails")
@@ -209,7 +244,7 @@ func TestProcessImage_UploadFailure(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, "test-trace-id")
+	_, err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, ProcessOptions{}, "test-trace-id")
 
 	if err == nil {
 		t.Error("Expected error when upload fails")
@@ -234,8 +269,13 @@ func TestProcessImage_VerificationWarning(t *testing.T) {
 
 	// Verification fails but processing continues
 	exifTool := &mockExifTool{
-		verifyFunc: func(ctx context.Context, path string, traceID string) (bool, error) {
-			return false, errors.New("verification failed")
+		verifyFunc: func(
+			ctx context.Context,
+			path string,
+			expected exiftool.Metadata,
+			traceID string,
+		) (*exiftool.VerificationResult, error) {
+			return nil, errors.New("verification failed")
 		},
 	}
 
@@ -246,10 +286,458 @@ func TestProcessImage_VerificationWarning(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, "test-trace-id")
+	_, err := processor.ProcessImage(ctx, "original/test.jpg", "processed/test.jpg", metadata, ProcessOptions{}, "test-trace-id")
 
 	// Should still succeed even if verification fails
 	if err != nil {
 		t.Errorf("ProcessImage should succeed even with verification failure, got: %v", err)
 	}
 }
+
+// mismatchedExifTool reports a title that differs from the requested one
+func mismatchedExifTool(verifyCalls *int) *mockExifTool {
+	return &mockExifTool{
+		verifyFunc: func(
+			ctx context.Context,
+			path string,
+			expected exiftool.Metadata,
+			traceID string,
+		) (*exiftool.VerificationResult, error) {
+			*verifyCalls++
+			return &exiftool.VerificationResult{Diffs: []exiftool.FieldDiff{{
+				Field:    "Title",
+				Tag:      "XMP:Title",
+				Expected: expected.Title,
+				Actual:   "",
+			}}}, nil
+		},
+	}
+}
+
+func TestProcessImage_VerifyModes(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          VerifyMode
+		expectError   bool
+		expectPerm    bool
+		expectVerify  int
+		expectUploads int
+	}{
+		{name: "off", mode: VerifyOff, expectVerify: 0, expectUploads: 1},
+		{name: "warn", mode: VerifyWarn, expectVerify: 1, expectUploads: 1},
+		{name: "retry", mode: VerifyRetry, expectError: true, expectVerify: 1},
+		{name: "strict", mode: VerifyStrict, expectError: true, expectPerm: true, expectVerify: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+
+			uploads := 0
+			minioClient := &mockMinioClient{
+				downloadFunc: func(ctx context.Context, path string) ([]byte, error) {
+					return []byte{0xFF, 0xD8, 0xFF, 0xD9}, nil
+				},
+				uploadFunc: func(ctx context.Context, path string, data []byte) error {
+					uploads++
+					return nil
+				},
+			}
+
+			verifyCalls := 0
+			processor := NewImageProcessor(minioClient, mismatchedExifTool(&verifyCalls), t.TempDir(), logger)
+			processor.SetVerifyMode(tt.mode)
+
+			_, err := processor.ProcessImage(
+				context.Background(),
+				"original/test.jpg",
+				"processed/test.jpg",
+				models.Metadata{Title: "Test"},
+				ProcessOptions{},
+				"test-trace-id",
+			)
+
+			if tt.expectError {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Errorf("Expected ErrVerificationFailed, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if retryqueue.IsPermanent(err) != tt.expectPerm {
+				t.Errorf("Expected permanent=%v, got %v", tt.expectPerm, retryqueue.IsPermanent(err))
+			}
+			if verifyCalls != tt.expectVerify {
+				t.Errorf("Expected %d verify calls, got %d", tt.expectVerify, verifyCalls)
+			}
+			if uploads != tt.expectUploads {
+				t.Errorf("Expected %d uploads, got %d", tt.expectUploads, uploads)
+			}
+		})
+	}
+}
+
+func TestParseVerifyMode(t *testing.T) {
+	mode, err := ParseVerifyMode(" Strict ")
+	if err != nil || mode != VerifyStrict {
+		t.Errorf("Expected strict mode, got %q (%v)", mode, err)
+	}
+
+	if _, err := ParseVerifyMode("sometimes"); err == nil {
+		t.Error("Expected error for unknown verify mode")
+	}
+}
+
+func TestProcessImage_MergePolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultPolicy  exiftool.MergePolicy
+		messagePolicy  string
+		expectRead     bool
+		expectTitle    string
+		expectKeywords int
+	}{
+		{name: "default append unique", defaultPolicy: exiftool.MergeAppendUnique, expectRead: true, expectTitle: "New", expectKeywords: 2},
+		{name: "message keep existing", defaultPolicy: exiftool.MergeAppendUnique, messagePolicy: "keep-existing", expectRead: true, expectTitle: "Old", expectKeywords: 1},
+		{name: "message replace skips read", defaultPolicy: exiftool.MergeKeepExisting, messagePolicy: "replace", expectTitle: "New", expectKeywords: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+
+			minioClient := &mockMinioClient{
+				downloadFunc: func(ctx context.Context, path string) ([]byte, error) {
+					return []byte{0xFF, 0xD8, 0xFF, 0xD9}, nil
+				},
+			}
+
+			read := false
+			var written exiftool.Metadata
+			exifTool := &mockExifTool{
+				readFunc: func(ctx context.Context, path string, traceID string) (exiftool.Metadata, error) {
+					read = true
+					return exiftool.Metadata{Title: "Old", Keywords: []string{"existing"}}, nil
+				},
+				writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+					written = metadata
+					return nil
+				},
+			}
+
+			processor := NewImageProcessor(minioClient, exifTool, t.TempDir(), logger)
+			processor.SetMergePolicy(tt.defaultPolicy)
+
+			result, err := processor.ProcessImage(
+				context.Background(),
+				"original/test.jpg",
+				"processed/test.jpg",
+				models.Metadata{Title: "New", Keywords: []string{"generated"}},
+				ProcessOptions{MergePolicy: tt.messagePolicy},
+				"test-trace-id",
+			)
+			if err != nil {
+				t.Fatalf("ProcessImage failed: %v", err)
+			}
+
+			if read != tt.expectRead {
+				t.Errorf("Expected read=%v, got %v", tt.expectRead, read)
+			}
+			if written.Title != tt.expectTitle {
+				t.Errorf("Expected title %q, got %q", tt.expectTitle, written.Title)
+			}
+			if len(written.Keywords) != tt.expectKeywords {
+				t.Errorf("Expected %d keywords, got %v", tt.expectKeywords, written.Keywords)
+			}
+			if result.Metadata.Title != written.Title || len(result.Metadata.Keywords) != len(written.Keywords) {
+				t.Errorf("Expected the result to report the written metadata, got %+v", result.Metadata)
+			}
+		})
+	}
+}
+
+func TestProcessImage_InvalidMergePolicy(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	processor := NewImageProcessor(&mockMinioClient{}, &mockExifTool{}, t.TempDir(), logger)
+
+	_, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{MergePolicy: "overwrite"},
+		"test-trace-id",
+	)
+	if !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected permanent error for unknown merge policy, got %v", err)
+	}
+}
+
+func TestProcessImage_ReadFailure(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	exifTool := &mockExifTool{
+		readFunc: func(ctx context.Context, path string, traceID string) (exiftool.Metadata, error) {
+			return exiftool.Metadata{}, errors.New("read failed")
+		},
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			t.Error("Metadata must not be written when existing tags cannot be read")
+			return nil
+		},
+	}
+
+	processor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+
+	_, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{},
+		"test-trace-id",
+	)
+	if err == nil || retryqueue.IsPermanent(err) {
+		t.Errorf("Expected retryable read error, got %v", err)
+	}
+}
+
+func TestProcessImage_SidecarMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	original := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	uploads := make(map[string][]byte)
+	minioClient := &mockMinioClient{
+		downloadFunc: func(ctx context.Context, path string) ([]byte, error) {
+			return original, nil
+		},
+		uploadFunc: func(ctx context.Context, path string, data []byte) error {
+			uploads[path] = data
+			return nil
+		},
+	}
+
+	var verifiedPath string
+	exifTool := &mockExifTool{
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			t.Error("Image must not be modified in sidecar mode")
+			return nil
+		},
+		verifyFunc: func(
+			ctx context.Context,
+			path string,
+			expected exiftool.Metadata,
+			traceID string,
+		) (*exiftool.VerificationResult, error) {
+			verifiedPath = path
+			return &exiftool.VerificationResult{}, nil
+		},
+	}
+
+	processor := NewImageProcessor(minioClient, exifTool, t.TempDir(), logger)
+
+	result, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/trace/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{OutputMode: models.OutputModeSidecar},
+		"test-trace-id",
+	)
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+
+	if result.SidecarPath != "processed/trace/test.xmp" {
+		t.Errorf("Unexpected sidecar path: %s", result.SidecarPath)
+	}
+	if string(uploads["processed/trace/test.jpg"]) != string(original) {
+		t.Error("Expected the image to be uploaded byte-identical")
+	}
+	if len(uploads["processed/trace/test.xmp"]) == 0 {
+		t.Error("Expected the sidecar to be uploaded")
+	}
+	if !exiftool.IsSidecar(verifiedPath) {
+		t.Errorf("Expected the sidecar to be verified, got %s", verifiedPath)
+	}
+}
+
+func TestProcessImage_RawDefaultsToSidecar(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	exifTool := &mockExifTool{
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			t.Error("RAW files must not be modified")
+			return nil
+		},
+	}
+
+	processor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+
+	result, err := processor.ProcessImage(
+		context.Background(),
+		"original/IMG_0001.CR2",
+		"processed/trace/IMG_0001.CR2",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{},
+		"test-trace-id",
+	)
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+	if result.SidecarPath != "processed/trace/IMG_0001.xmp" {
+		t.Errorf("Unexpected sidecar path: %s", result.SidecarPath)
+	}
+}
+
+func TestProcessImage_InvalidOutputMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	processor := NewImageProcessor(&mockMinioClient{}, &mockExifTool{}, t.TempDir(), logger)
+
+	_, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{OutputMode: "both"},
+		"test-trace-id",
+	)
+	if !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected permanent error for unknown output mode, got %v", err)
+	}
+}
+
+func TestProcessImage_PrivacyProfile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	var written exiftool.Metadata
+	exifTool := &mockExifTool{
+		privacyFunc: func(ctx context.Context, path string, profile exiftool.PrivacyProfile, traceID string) ([]string, error) {
+			if len(profile) != 3 {
+				t.Errorf("Expected standard profile with 3 groups, got %v", profile)
+			}
+			return []string{"EXIF:GPSLatitude", "EXIF:SerialNumber"}, nil
+		},
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			written = metadata
+			return nil
+		},
+	}
+
+	processor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+
+	result, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{PrivacyProfile: models.PrivacyProfileStandard},
+		"test-trace-id",
+	)
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+
+	if len(result.RemovedTags) != 2 || result.RemovedTags[0] != "EXIF:GPSLatitude" {
+		t.Errorf("Expected removed tags to be reported, got %v", result.RemovedTags)
+	}
+	if len(written.RemoveTags) == 0 || written.Title != "Test" {
+		t.Errorf("Expected tags to be removed in the metadata write, got %+v", written)
+	}
+}
+
+func TestProcessImage_PrivacyProfileNothingToRemove(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	exifTool := &mockExifTool{
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			if len(metadata.RemoveTags) != 0 {
+				t.Errorf("Expected no delete arguments for a clean image, got %v", metadata.RemoveTags)
+			}
+			return nil
+		},
+	}
+
+	processor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+	processor.SetPrivacyProfile(exiftool.PrivacyProfile{exiftool.PrivacyGPS})
+
+	result, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{},
+		"test-trace-id",
+	)
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+	if len(result.RemovedTags) != 0 {
+		t.Errorf("Expected no removed tags, got %v", result.RemovedTags)
+	}
+}
+
+func TestProcessImage_InvalidPrivacyProfile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	processor := NewImageProcessor(&mockMinioClient{}, &mockExifTool{}, t.TempDir(), logger)
+
+	_, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{PrivacyProfile: "paranoid"},
+		"test-trace-id",
+	)
+	if !retryqueue.IsPermanent(err) {
+		t.Errorf("Expected permanent error for unknown privacy profile, got %v", err)
+	}
+}
+
+func TestProcessImage_CreatorProfile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	var written exiftool.Metadata
+	exifTool := &mockExifTool{
+		writeFunc: func(ctx context.Context, path string, metadata exiftool.Metadata, traceID string) error {
+			written = metadata
+			return nil
+		},
+	}
+
+	processor := NewImageProcessor(&mockMinioClient{}, exifTool, t.TempDir(), logger)
+
+	_, err := processor.ProcessImage(
+		context.Background(),
+		"original/test.jpg",
+		"processed/test.jpg",
+		models.Metadata{Title: "Test"},
+		ProcessOptions{Creator: &models.CreatorProfile{
+			Creator:    "Jane Doe",
+			Rights:     "© 2026 Jane Doe",
+			UsageTerms: "Editorial use only",
+		}},
+		"test-trace-id",
+	)
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+
+	expected := exiftool.Creator{Name: "Jane Doe", Rights: "© 2026 Jane Doe", UsageTerms: "Editorial use only"}
+	if written.Creator != expected {
+		t.Errorf("Expected creator %+v to be written, got %+v", expected, written.Creator)
+	}
+}
@@ -3,36 +3,61 @@ package exiftool
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
-// Metadata represents image metadata to be written
+// Metadata represents image metadata to be written.
+// HierarchicalKeywords are Lightroom keyword paths such as "Animals|Mammals|Dog".
+// RemoveTags are deleted in the same pass, before the new values are written.
 type Metadata struct {
-	Title       string
-	Description string
-	Keywords    []string
+	Title                  string
+	Description            string
+	Keywords               []string
+	HierarchicalKeywords   []string
+	Category               string
+	SupplementalCategories []string
+	AltText                string
+	Creator                Creator
+	RemoveTags             []string
 }
 
-// Client wraps ExifTool command-line tool
+// Client wraps ExifTool command-line tool.
+// Commands run through a pool of persistent -stay_open processes to avoid forking Perl per image.
 type Client struct {
+	pool       *Pool
 	binaryPath string
 	timeout    time.Duration
 	logger     *logrus.Logger
 }
 
-// NewClient creates a new ExifTool client
+// NewClient creates a new ExifTool client backed by a single persistent process
 func NewClient(binaryPath string, timeout time.Duration, logger *logrus.Logger) *Client {
+	return NewPooledClient(binaryPath, 1, timeout, logger)
+}
+
+// NewPooledClient creates a new ExifTool client backed by up to poolSize persistent processes
+func NewPooledClient(binaryPath string, poolSize int, timeout time.Duration, logger *logrus.Logger) *Client {
 	return &Client{
+		pool:       NewPool(binaryPath, poolSize, timeout, logger),
 		binaryPath: binaryPath,
 		timeout:    timeout,
 		logger:     logger,
 	}
 }
 
+// Close stops the persistent ExifTool processes
+func (c *Client) Close() error {
+	return c.pool.Close()
+}
+
 // WriteMetadata writes metadata to an image file
 // The image is modified in-place
 func (c *Client) WriteMetadata(ctx context.Context, imagePath string, metadata Metadata, traceID string) error {
@@ -46,10 +71,6 @@ func (c *Client) WriteMetadata(ctx context.Context, imagePath string, metadata M
 		return fmt.Errorf("exiftool not found at %s: %w", c.binaryPath, err)
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
-	defer cancel()
-
 	// Build ExifTool command arguments
 	args := c.buildMetadataArgs(imagePath, metadata)
 
@@ -62,31 +83,143 @@ func (c *Client) WriteMetadata(ctx context.Context, imagePath string, metadata M
 	}).Debug("Writing metadata with ExifTool")
 
 	// Execute command
-	cmd := exec.CommandContext(ctx, c.binaryPath, args...)
-	output, err := cmd.CombinedOutput()
+	stdout, stderr, err := c.execute(ctx, "exiftool.write", args)
 
 	if err != nil {
 		c.logger.WithFields(logrus.Fields{
 			"trace_id": traceID,
-			"output":   string(output),
+			"output":   stdout + stderr,
 			"error":    err.Error(),
 		}).Error("ExifTool command failed")
-		return fmt.Errorf("exiftool failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("exiftool failed: %w, output: %s", err, stdout+stderr)
 	}
 
 	c.logger.WithFields(logrus.Fields{
 		"trace_id": traceID,
-		"output":   string(output),
+		"output":   stdout,
 	}).Debug("ExifTool command succeeded")
 
 	return nil
 }
 
+// WriteSidecar writes metadata as XMP to a new sidecar file, leaving the image untouched.
+// An existing file at sidecarPath is replaced.
+func (c *Client) WriteSidecar(ctx context.Context, sidecarPath string, metadata Metadata, traceID string) error {
+	if err := os.Remove(sidecarPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old sidecar: %w", err)
+	}
+
+	args := c.buildSidecarArgs(sidecarPath, metadata)
+
+	c.logger.WithFields(logrus.Fields{
+		"trace_id": traceID,
+		"sidecar":  sidecarPath,
+		"keywords": len(metadata.Keywords),
+	}).Debug("Writing XMP sidecar with ExifTool")
+
+	stdout, stderr, err := c.execute(ctx, "exiftool.write_sidecar", args)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"output":   stdout + stderr,
+			"error":    err.Error(),
+		}).Error("ExifTool sidecar command failed")
+		return fmt.Errorf("exiftool sidecar failed: %w, output: %s", err, stdout+stderr)
+	}
+
+	return nil
+}
+
+// ReadMetadata reads the title, description and keywords already embedded in an image
+func (c *Client) ReadMetadata(ctx context.Context, imagePath string, traceID string) (Metadata, error) {
+	stdout, _, err := c.execute(ctx, "exiftool.read", readArgs(imagePath))
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"error":    err.Error(),
+		}).Warn("Failed to read existing metadata")
+		return Metadata{}, fmt.Errorf("read failed: %w", err)
+	}
+
+	existing, err := parseExistingMetadata([]byte(stdout))
+	if err != nil {
+		return Metadata{}, fmt.Errorf("read failed: %w", err)
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"trace_id":    traceID,
+		"has_title":   existing.Title != "",
+		"keywords":    len(existing.Keywords),
+		"hierarchies": len(existing.HierarchicalKeywords),
+	}).Debug("Read existing metadata")
+
+	return existing, nil
+}
+
+// FindPrivateTags lists the tags present in an image that the privacy profile would remove
+func (c *Client) FindPrivateTags(
+	ctx context.Context,
+	imagePath string,
+	profile PrivacyProfile,
+	traceID string,
+) ([]string, error) {
+	stdout, _, err := c.execute(ctx, "exiftool.read_private_tags", privacyReadArgs(imagePath, profile))
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"trace_id": traceID,
+			"error":    err.Error(),
+		}).Warn("Failed to read private tags")
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+
+	tags, err := parsePrivateTags([]byte(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"trace_id": traceID,
+		"tags":     len(tags),
+	}).Debug("Found private tags")
+
+	return tags, nil
+}
+
+// execute runs an ExifTool command in a span named operation, turning errors printed by
+// ExifTool into an error
+func (c *Client) execute(ctx context.Context, operation string, args []string) (string, string, error) {
+	span, ctx := tracing.StartSpan(ctx, operation)
+	stdout, stderr, err := c.pool.Execute(ctx, args)
+	if err == nil && hasExifToolError(stderr) {
+		err = fmt.Errorf("%s", strings.TrimSpace(stderr))
+	}
+	span.Finish(err)
+	return stdout, stderr, err
+}
+
+// hasExifToolError reports whether exiftool printed an error, which in -stay_open
+// mode replaces a non-zero exit code
+func hasExifToolError(stderr string) bool {
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Error") {
+			return true
+		}
+	}
+	return false
+}
+
 // buildMetadataArgs constructs ExifTool command arguments
 func (c *Client) buildMetadataArgs(imagePath string, metadata Metadata) []string {
 	args := []string{
 		"-overwrite_original", // Don't create backup files
 		"-charset", "utf8",    // Support Unicode characters
+		// Store IPTC as UTF-8 instead of Latin-1 so non-Latin text survives
+		"-IPTC:CodedCharacterSet=UTF8",
+	}
+
+	// Delete identifying tags selected by the privacy profile
+	for _, tag := range metadata.RemoveTags {
+		args = append(args, fmt.Sprintf("-%s=", tag))
 	}
 
 	// Write Title to multiple tags
@@ -107,61 +240,141 @@ func (c *Client) buildMetadataArgs(imagePath string, metadata Metadata) []string
 		)
 	}
 
-	// Write Keywords - ExifTool needs each keyword separately
+	// Write Keywords - ExifTool needs each keyword separately.
+	// Repeated assignments in one command replace the list, so the keywords must
+	// already be merged with the existing ones (see MergeMetadata).
 	for _, keyword := range metadata.Keywords {
 		if keyword != "" {
 			args = append(args,
-				fmt.Sprintf("-IPTC:Keywords+=%s", keyword),
-				fmt.Sprintf("-XMP:Subject+=%s", keyword),
+				fmt.Sprintf("-IPTC:Keywords=%s", keyword),
+				fmt.Sprintf("-XMP:Subject=%s", keyword),
 			)
 		}
 	}
 
+	// Write Lightroom keyword hierarchy alongside the flat keywords
+	for _, path := range metadata.HierarchicalKeywords {
+		if path != "" {
+			args = append(args, fmt.Sprintf("-XMP-lr:HierarchicalSubject=%s", path))
+		}
+	}
+
+	// Write the category for DAMs and stock sites that read the Photoshop schema
+	args = append(args, categoryArgs(metadata)...)
+
+	// Write the IPTC 2021 accessibility fields used as alt text by CMSs
+	args = append(args, accessibilityArgs(metadata)...)
+
+	// Write creator, rights and contact info from the user's profile
+	args = append(args, creatorArgs(metadata.Creator, false)...)
+
 	// Add the image path as last argument
 	args = append(args, imagePath)
 
 	return args
 }
 
-// VerifyMetadata checks that metadata was written correctly
-func (c *Client) VerifyMetadata(ctx context.Context, imagePath string, traceID string) (bool, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
-	defer cancel()
+// buildSidecarArgs constructs ExifTool arguments that create an XMP file from scratch.
+// Only XMP tags can be stored in a sidecar, so IPTC and EXIF copies are not written.
+func (c *Client) buildSidecarArgs(sidecarPath string, metadata Metadata) []string {
+	args := []string{"-charset", "utf8"}
+
+	if metadata.Title != "" {
+		args = append(args, fmt.Sprintf("-XMP:Title=%s", metadata.Title))
+	}
+	if metadata.Description != "" {
+		args = append(args, fmt.Sprintf("-XMP:Description=%s", metadata.Description))
+	}
+	for _, keyword := range metadata.Keywords {
+		if keyword != "" {
+			args = append(args, fmt.Sprintf("-XMP:Subject=%s", keyword))
+		}
+	}
+	for _, path := range metadata.HierarchicalKeywords {
+		if path != "" {
+			args = append(args, fmt.Sprintf("-XMP-lr:HierarchicalSubject=%s", path))
+		}
+	}
+	args = append(args, categoryArgs(metadata)...)
+	args = append(args, accessibilityArgs(metadata)...)
+	args = append(args, creatorArgs(metadata.Creator, true)...)
+
+	return append(args, sidecarPath)
+}
+
+// categoryArgs builds the XMP-photoshop category assignments
+func categoryArgs(metadata Metadata) []string {
+	var args []string
+	if metadata.Category != "" {
+		args = append(args, fmt.Sprintf("-XMP-photoshop:Category=%s", metadata.Category))
+	}
+	for _, category := range metadata.SupplementalCategories {
+		if category != "" {
+			args = append(args, fmt.Sprintf("-XMP-photoshop:SupplementalCategories=%s", category))
+		}
+	}
+	return args
+}
+
+// accessibilityArgs builds the IPTC Core accessibility assignments: the short alt text and,
+// elaborating on it, the full description as the extended description
+func accessibilityArgs(metadata Metadata) []string {
+	if metadata.AltText == "" {
+		return nil
+	}
+	args := []string{fmt.Sprintf("-XMP-iptc4xmpCore:AltTextAccessibility=%s", metadata.AltText)}
+	if metadata.Description != "" {
+		args = append(args, fmt.Sprintf("-XMP-iptc4xmpCore:ExtDescrAccessibility=%s", metadata.Description))
+	}
+	return args
+}
+
+// SidecarPath returns the .xmp sidecar path for an image, replacing its extension
+// as Lightroom and other editors expect (IMG_0001.CR2 -> IMG_0001.xmp)
+func SidecarPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".xmp"
+}
+
+// IsSidecar reports whether path is an XMP sidecar file
+func IsSidecar(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xmp")
+}
 
+// VerifyMetadata reads the written tags back and compares them with the requested metadata.
+// A mismatch is reported in the result; the error is only set if the tags could not be read.
+func (c *Client) VerifyMetadata(
+	ctx context.Context,
+	imagePath string,
+	expected Metadata,
+	traceID string,
+) (*VerificationResult, error) {
 	c.logger.WithFields(logrus.Fields{
 		"trace_id": traceID,
 		"image":    imagePath,
 	}).Debug("Verifying metadata")
 
 	// Read back metadata in JSON format
-	cmd := exec.CommandContext(ctx, c.binaryPath,
-		"-j",
-		"-Title",
-		"-Description",
-		"-Keywords",
-		"-Subject",
-		imagePath,
-	)
-
-	output, err := cmd.CombinedOutput()
+	stdout, _, err := c.execute(ctx, "exiftool.verify", verifyArgs(imagePath))
 	if err != nil {
 		c.logger.WithFields(logrus.Fields{
 			"trace_id": traceID,
 			"error":    err.Error(),
-		}).Warn("Metadata verification failed")
-		return false, fmt.Errorf("verification failed: %w", err)
+		}).Warn("Failed to read back metadata")
+		return nil, fmt.Errorf("verification failed: %w", err)
 	}
 
-	// Check that output contains valid JSON and no error messages
-	outputStr := string(output)
-	hasContent := len(output) > 0 && !strings.Contains(outputStr, "error")
+	result, err := compareMetadata(expected, tagsToVerify(imagePath), []byte(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("verification failed: %w", err)
+	}
 
 	c.logger.WithFields(logrus.Fields{
-		"trace_id":    traceID,
-		"has_content": hasContent,
+		"trace_id": traceID,
+		"verified": result.OK(),
+		"diffs":    len(result.Diffs),
 	}).Debug("Metadata verification result")
 
-	return hasContent, nil
+	return result, nil
 }
 
 // CheckAvailability verifies that ExifTool is installed and accessible
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -72,7 +73,7 @@ func TestBuildMetadataArgs(t *testing.T) {
 	// Check that keywords are added
 	keywordCount := 0
 	for _, arg := range args {
-		if arg == "-IPTC:Keywords+=keyword1" || arg == "-IPTC:Keywords+=keyword2" {
+		if arg == "-IPTC:Keywords=keyword1" || arg == "-IPTC:Keywords=keyword2" {
 			keywordCount++
 		}
 	}
@@ -86,6 +87,120 @@ func TestBuildMetadataArgs(t *testing.T) {
 	}
 }
 
+func TestBuildMetadataArgs_HierarchicalKeywords(t *testing.T) {
+	logger := logrus.New()
+	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
+
+	metadata := Metadata{
+		Keywords:             []string{"dog"},
+		HierarchicalKeywords: []string{"Animals|Mammals|Dog", ""},
+	}
+
+	args := client.buildMetadataArgs("/tmp/test.jpg", metadata)
+
+	hierarchyCount := 0
+	hasFlatKeyword := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-XMP-lr:HierarchicalSubject") {
+			hierarchyCount++
+			if arg != "-XMP-lr:HierarchicalSubject=Animals|Mammals|Dog" {
+				t.Errorf("Unexpected hierarchical subject argument: %s", arg)
+			}
+		}
+		if arg == "-XMP:Subject=dog" {
+			hasFlatKeyword = true
+		}
+	}
+	if hierarchyCount != 1 {
+		t.Errorf("Expected 1 hierarchical subject argument, got %d", hierarchyCount)
+	}
+	if !hasFlatKeyword {
+		t.Error("Expected flat keyword alongside the hierarchy")
+	}
+}
+
+func TestBuildMetadataArgs_Category(t *testing.T) {
+	logger := logrus.New()
+	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
+
+	metadata := Metadata{
+		Category:               "Animals",
+		SupplementalCategories: []string{"Nature", ""},
+	}
+
+	args := strings.Join(client.buildMetadataArgs("/tmp/test.jpg", metadata), "\n")
+	if !strings.Contains(args, "-XMP-photoshop:Category=Animals") {
+		t.Error("Expected category argument")
+	}
+	if strings.Count(args, "-XMP-photoshop:SupplementalCategories=") != 1 ||
+		!strings.Contains(args, "-XMP-photoshop:SupplementalCategories=Nature") {
+		t.Errorf("Expected one supplemental category argument, got %s", args)
+	}
+
+	sidecar := strings.Join(client.buildSidecarArgs("/tmp/test.xmp", metadata), "\n")
+	if !strings.Contains(sidecar, "-XMP-photoshop:Category=Animals") {
+		t.Error("Expected category in the sidecar")
+	}
+}
+
+func TestBuildMetadataArgs_AltText(t *testing.T) {
+	logger := logrus.New()
+	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
+
+	metadata := Metadata{
+		Description: "A brown dog running along a sandy beach at sunset with waves in the background",
+		AltText:     "Dog running on a beach at sunset",
+	}
+
+	args := strings.Join(client.buildMetadataArgs("/tmp/test.jpg", metadata), "\n")
+	if !strings.Contains(args, "-XMP-iptc4xmpCore:AltTextAccessibility=Dog running on a beach at sunset") {
+		t.Error("Expected alt text argument")
+	}
+	if !strings.Contains(args, "-XMP-iptc4xmpCore:ExtDescrAccessibility="+metadata.Description) {
+		t.Error("Expected the description as extended description")
+	}
+
+	sidecar := strings.Join(client.buildSidecarArgs("/tmp/test.xmp", metadata), "\n")
+	if !strings.Contains(sidecar, "-XMP-iptc4xmpCore:AltTextAccessibility=") {
+		t.Error("Expected alt text in the sidecar")
+	}
+
+	args = strings.Join(client.buildMetadataArgs("/tmp/test.jpg", Metadata{Description: "Only a description"}), "\n")
+	if strings.Contains(args, "Accessibility") {
+		t.Errorf("Expected no accessibility fields without alt text, got %s", args)
+	}
+}
+
+func TestBuildMetadataArgs_RemoveTags(t *testing.T) {
+	logger := logrus.New()
+	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
+
+	metadata := Metadata{
+		Title:      "Sunset",
+		RemoveTags: []string{"*GPS*", "XMP-dc:Creator"},
+	}
+
+	args := client.buildMetadataArgs("/tmp/test.jpg", metadata)
+
+	gpsIndex, creatorIndex, titleIndex := -1, -1, -1
+	for i, arg := range args {
+		switch arg {
+		case "-*GPS*=":
+			gpsIndex = i
+		case "-XMP-dc:Creator=":
+			creatorIndex = i
+		case "-XMP:Title=Sunset":
+			titleIndex = i
+		}
+	}
+	if gpsIndex < 0 || creatorIndex < 0 {
+		t.Fatalf("Expected delete arguments for removed tags, got %v", args)
+	}
+	if titleIndex < creatorIndex {
+		t.Error("Expected tags to be deleted before new values are written")
+	}
+}
+
 func TestBuildMetadataArgs_EmptyFields(t *testing.T) {
 	logger := logrus.New()
 	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
@@ -148,6 +263,61 @@ func TestBuildMetadataArgs_UnicodeContent(t *testing.T) {
 	}
 }
 
+func TestBuildSidecarArgs(t *testing.T) {
+	logger := logrus.New()
+	client := NewClient("/usr/bin/exiftool", 10*time.Second, logger)
+
+	metadata := Metadata{
+		Title:                "Test Title",
+		Keywords:             []string{"dog"},
+		HierarchicalKeywords: []string{"Animals|Dog"},
+	}
+
+	args := client.buildSidecarArgs("/tmp/test.xmp", metadata)
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-IPTC:") || strings.HasPrefix(arg, "-XPTitle") || arg == "-overwrite_original" {
+			t.Errorf("Unexpected non-XMP argument for sidecar: %s", arg)
+		}
+	}
+
+	expected := []string{"-XMP:Title=Test Title", "-XMP:Subject=dog", "-XMP-lr:HierarchicalSubject=Animals|Dog"}
+	for _, want := range expected {
+		found := false
+		for _, arg := range args {
+			if arg == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected sidecar argument %s", want)
+		}
+	}
+
+	if args[len(args)-1] != "/tmp/test.xmp" {
+		t.Errorf("Expected last arg to be sidecar path, got %s", args[len(args)-1])
+	}
+}
+
+func TestSidecarPath(t *testing.T) {
+	tests := map[string]string{
+		"processed/trace/IMG_0001.CR2": "processed/trace/IMG_0001.xmp",
+		"photo.jpg":                    "photo.xmp",
+		"archive/scan":                 "archive/scan.xmp",
+	}
+
+	for imagePath, expected := range tests {
+		if got := SidecarPath(imagePath); got != expected {
+			t.Errorf("SidecarPath(%q) = %q, expected %q", imagePath, got, expected)
+		}
+	}
+
+	if !IsSidecar("photo.XMP") || IsSidecar("photo.jpg") {
+		t.Error("IsSidecar should match the .xmp extension only")
+	}
+}
+
 // Integration test - only runs if exiftool is available
 func TestWriteMetadata_Integration(t *testing.T) {
 	// Check if exiftool is available
@@ -188,13 +358,13 @@ func TestWriteMetadata_Integration(t *testing.T) {
 	}
 
 	// Verify metadata was written
-	verified, err := client.VerifyMetadata(ctx, testImagePath, "test-trace-id")
+	result, err := client.VerifyMetadata(ctx, testImagePath, metadata, "test-trace-id")
 	if err != nil {
-		t.Errorf("VerifyMetadata failed: %v", err)
+		t.Fatalf("VerifyMetadata failed: %v", err)
 	}
 
-	if !verified {
-		t.Error("Metadata verification returned false")
+	if !result.OK() {
+		t.Errorf("Metadata verification reported differences: %s", result)
 	}
 }
 
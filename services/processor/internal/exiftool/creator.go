@@ -0,0 +1,59 @@
+package exiftool
+
+import "fmt"
+
+// Creator holds the creator, rights and contact fields of a user's profile.
+// They are written to every image alongside the generated metadata.
+type Creator struct {
+	Name       string
+	Rights     string
+	UsageTerms string
+	Email      string
+	Phone      string
+	Website    string
+	City       string
+	Country    string
+}
+
+// creatorTag maps a profile field to the tag it is written to
+type creatorTag struct {
+	name  string
+	value func(Creator) string
+	xmp   bool
+}
+
+// creatorTags lists the IPTC Core and IIM tags stock agencies read for attribution and licensing
+var creatorTags = []creatorTag{
+	{name: "XMP-dc:Creator", value: func(c Creator) string { return c.Name }, xmp: true},
+	{name: "IPTC:By-line", value: func(c Creator) string { return c.Name }},
+	{name: "EXIF:Artist", value: func(c Creator) string { return c.Name }},
+	{name: "XMP-dc:Rights", value: func(c Creator) string { return c.Rights }, xmp: true},
+	{name: "IPTC:CopyrightNotice", value: func(c Creator) string { return c.Rights }},
+	{name: "EXIF:Copyright", value: func(c Creator) string { return c.Rights }},
+	{name: "XMP-xmpRights:UsageTerms", value: func(c Creator) string { return c.UsageTerms }, xmp: true},
+	{name: "XMP-iptcCore:CreatorWorkEmail", value: func(c Creator) string { return c.Email }, xmp: true},
+	{name: "XMP-iptcCore:CreatorWorkTelephone", value: func(c Creator) string { return c.Phone }, xmp: true},
+	{name: "XMP-iptcCore:CreatorWorkURL", value: func(c Creator) string { return c.Website }, xmp: true},
+	{name: "XMP-iptcCore:CreatorCity", value: func(c Creator) string { return c.City }, xmp: true},
+	{name: "XMP-iptcCore:CreatorCountry", value: func(c Creator) string { return c.Country }, xmp: true},
+}
+
+// creatorArgs builds the assignments for the non-empty profile fields.
+// Sidecars only hold XMP, so xmpOnly skips the IPTC and EXIF copies.
+func creatorArgs(creator Creator, xmpOnly bool) []string {
+	var args []string
+	for _, tag := range creatorTags {
+		value := tag.value(creator)
+		if value == "" || (xmpOnly && !tag.xmp) {
+			continue
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", tag.name, value))
+	}
+
+	// Flag the image as copyrighted so editors show the rights notice
+	if creator.Rights != "" {
+		args = append(args, "-XMP-xmpRights:Marked=True")
+	}
+
+	return args
+}
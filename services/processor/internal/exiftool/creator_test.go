@@ -0,0 +1,50 @@
+package exiftool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreatorArgs(t *testing.T) {
+	creator := Creator{
+		Name:       "Jane Doe",
+		Rights:     "© 2026 Jane Doe",
+		UsageTerms: "Editorial use only",
+		Email:      "jane@example.com",
+	}
+
+	args := creatorArgs(creator, false)
+
+	expected := []string{
+		"-XMP-dc:Creator=Jane Doe",
+		"-IPTC:By-line=Jane Doe",
+		"-EXIF:Artist=Jane Doe",
+		"-XMP-dc:Rights=© 2026 Jane Doe",
+		"-IPTC:CopyrightNotice=© 2026 Jane Doe",
+		"-EXIF:Copyright=© 2026 Jane Doe",
+		"-XMP-xmpRights:UsageTerms=Editorial use only",
+		"-XMP-iptcCore:CreatorWorkEmail=jane@example.com",
+		"-XMP-xmpRights:Marked=True",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestCreatorArgs_XMPOnly(t *testing.T) {
+	args := creatorArgs(Creator{Name: "Jane Doe", Country: "Norway"}, true)
+
+	expected := []string{
+		"-XMP-dc:Creator=Jane Doe",
+		"-XMP-iptcCore:CreatorCountry=Norway",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestCreatorArgs_Empty(t *testing.T) {
+	if args := creatorArgs(Creator{}, false); len(args) != 0 {
+		t.Errorf("Expected no arguments for an empty profile, got %v", args)
+	}
+}
@@ -0,0 +1,170 @@
+package exiftool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergePolicy selects how requested metadata is combined with tags already in the image
+type MergePolicy string
+
+const (
+	// MergeReplace overwrites existing values with the requested ones
+	MergeReplace MergePolicy = "replace"
+	// MergeAppendUnique overwrites title and description and adds keywords that are not present yet
+	MergeAppendUnique MergePolicy = "append-unique"
+	// MergeKeepExisting keeps every non-empty existing field and only fills the missing ones
+	MergeKeepExisting MergePolicy = "keep-existing"
+)
+
+// ParseMergePolicy validates a merge policy from configuration or a message
+func ParseMergePolicy(value string) (MergePolicy, error) {
+	switch policy := MergePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case MergeReplace, MergeAppendUnique, MergeKeepExisting:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown merge policy %q", value)
+	}
+}
+
+// existingTags are the -G output names read before writing.
+// Scalar fields use the first non-empty tag, lists combine all tags.
+var existingTags = struct {
+	title, description, keywords, hierarchy, category, supplemental, altText []string
+}{
+	title:        []string{"XMP:Title", "IPTC:Headline", "EXIF:XPTitle"},
+	description:  []string{"XMP:Description", "IPTC:Caption-Abstract", "EXIF:ImageDescription"},
+	keywords:     []string{"XMP:Subject", "IPTC:Keywords"},
+	hierarchy:    []string{"XMP:HierarchicalSubject"},
+	category:     []string{"XMP:Category"},
+	supplemental: []string{"XMP:SupplementalCategories"},
+	altText:      []string{"XMP:AltTextAccessibility"},
+}
+
+// readArgs builds the command that reads the tags a merge depends on as JSON
+func readArgs(imagePath string) []string {
+	return []string{
+		"-j", "-G", "-charset", "utf8",
+		"-XMP:Title", "-IPTC:Headline", "-EXIF:XPTitle",
+		"-XMP:Description", "-IPTC:Caption-Abstract", "-EXIF:ImageDescription",
+		"-XMP:Subject", "-IPTC:Keywords",
+		"-XMP-lr:HierarchicalSubject",
+		"-XMP-photoshop:Category", "-XMP-photoshop:SupplementalCategories",
+		"-XMP-iptc4xmpCore:AltTextAccessibility",
+		imagePath,
+	}
+}
+
+// parseExistingMetadata converts `exiftool -j -G` output into Metadata.
+// Keywords from XMP and IPTC are combined without duplicates.
+func parseExistingMetadata(output []byte) (Metadata, error) {
+	tags, err := parseJSONOutput(output)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	first := func(names []string) string {
+		for _, name := range names {
+			if value := strings.Join(tags[name], ", "); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	all := func(names []string) []string {
+		var values []string
+		for _, name := range names {
+			values = append(values, tags[name]...)
+		}
+		return uniqueValues(values)
+	}
+
+	return Metadata{
+		Title:                  first(existingTags.title),
+		Description:            first(existingTags.description),
+		Keywords:               all(existingTags.keywords),
+		HierarchicalKeywords:   all(existingTags.hierarchy),
+		Category:               first(existingTags.category),
+		SupplementalCategories: all(existingTags.supplemental),
+		AltText:                first(existingTags.altText),
+	}, nil
+}
+
+// MergeMetadata applies policy to each field of the existing and requested metadata
+// and returns the values that should be written to the image.
+// The creator profile is chosen by the user and always replaces existing values.
+func MergeMetadata(existing, requested Metadata, policy MergePolicy) Metadata {
+	switch policy {
+	case MergeReplace:
+		return Metadata{
+			Title:                  requested.Title,
+			Description:            requested.Description,
+			Keywords:               uniqueValues(requested.Keywords),
+			HierarchicalKeywords:   uniqueValues(requested.HierarchicalKeywords),
+			Category:               requested.Category,
+			SupplementalCategories: uniqueValues(requested.SupplementalCategories),
+			AltText:                requested.AltText,
+			Creator:                requested.Creator,
+		}
+	case MergeKeepExisting:
+		return Metadata{
+			Title:                  keepValue(existing.Title, requested.Title),
+			Description:            keepValue(existing.Description, requested.Description),
+			Keywords:               uniqueValues(keepList(existing.Keywords, requested.Keywords)),
+			HierarchicalKeywords:   uniqueValues(keepList(existing.HierarchicalKeywords, requested.HierarchicalKeywords)),
+			Category:               keepValue(existing.Category, requested.Category),
+			SupplementalCategories: uniqueValues(keepList(existing.SupplementalCategories, requested.SupplementalCategories)),
+			AltText:                keepValue(existing.AltText, requested.AltText),
+			Creator:                requested.Creator,
+		}
+	default:
+		return Metadata{
+			Title:                  requested.Title,
+			Description:            requested.Description,
+			Keywords:               uniqueValues(concat(existing.Keywords, requested.Keywords)),
+			HierarchicalKeywords:   uniqueValues(concat(existing.HierarchicalKeywords, requested.HierarchicalKeywords)),
+			Category:               requested.Category,
+			SupplementalCategories: uniqueValues(concat(existing.SupplementalCategories, requested.SupplementalCategories)),
+			AltText:                requested.AltText,
+			Creator:                requested.Creator,
+		}
+	}
+}
+
+// keepValue returns the existing value unless it is empty
+func keepValue(existing, requested string) string {
+	if strings.TrimSpace(existing) != "" {
+		return existing
+	}
+	return requested
+}
+
+// keepList returns the existing list unless it is empty
+func keepList(existing, requested []string) []string {
+	if len(uniqueValues(existing)) > 0 {
+		return existing
+	}
+	return requested
+}
+
+// concat joins two lists without modifying either of them
+func concat(first, second []string) []string {
+	joined := make([]string, 0, len(first)+len(second))
+	joined = append(joined, first...)
+	return append(joined, second...)
+}
+
+// uniqueValues drops empty values and case-insensitive duplicates, keeping the first spelling
+func uniqueValues(values []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		key := strings.ToLower(strings.TrimSpace(value))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
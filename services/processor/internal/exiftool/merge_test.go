@@ -0,0 +1,174 @@
+package exiftool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	existing := Metadata{
+		Title:                "Photographer title",
+		Description:          "",
+		Keywords:             []string{"Sunset", "beach"},
+		HierarchicalKeywords: []string{"Places|Beach"},
+	}
+	requested := Metadata{
+		Title:                "Generated title",
+		Description:          "Generated description",
+		Keywords:             []string{"sunset", "sea", "sea"},
+		HierarchicalKeywords: []string{"Nature|Sea"},
+	}
+
+	tests := []struct {
+		name     string
+		policy   MergePolicy
+		expected Metadata
+	}{
+		{
+			name:   "replace",
+			policy: MergeReplace,
+			expected: Metadata{
+				Title:                "Generated title",
+				Description:          "Generated description",
+				Keywords:             []string{"sunset", "sea"},
+				HierarchicalKeywords: []string{"Nature|Sea"},
+			},
+		},
+		{
+			name:   "append unique",
+			policy: MergeAppendUnique,
+			expected: Metadata{
+				Title:                "Generated title",
+				Description:          "Generated description",
+				Keywords:             []string{"Sunset", "beach", "sea"},
+				HierarchicalKeywords: []string{"Places|Beach", "Nature|Sea"},
+			},
+		},
+		{
+			name:   "keep existing",
+			policy: MergeKeepExisting,
+			expected: Metadata{
+				Title:                "Photographer title",
+				Description:          "Generated description",
+				Keywords:             []string{"Sunset", "beach"},
+				HierarchicalKeywords: []string{"Places|Beach"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergeMetadata(existing, requested, tt.policy)
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, merged)
+			}
+		})
+	}
+
+	// Merging must not modify the inputs
+	if len(existing.Keywords) != 2 || len(requested.Keywords) != 3 {
+		t.Errorf("Inputs were modified: %v, %v", existing.Keywords, requested.Keywords)
+	}
+}
+
+func TestMergeMetadata_ReprocessingDoesNotDuplicate(t *testing.T) {
+	requested := Metadata{Keywords: []string{"dog", "park"}}
+
+	first := MergeMetadata(Metadata{}, requested, MergeAppendUnique)
+	second := MergeMetadata(first, requested, MergeAppendUnique)
+
+	if !reflect.DeepEqual(second.Keywords, []string{"dog", "park"}) {
+		t.Errorf("Expected keywords to stay unique, got %v", second.Keywords)
+	}
+}
+
+func TestMergeMetadata_KeepExistingFillsEmptyImage(t *testing.T) {
+	requested := Metadata{Title: "Title", Keywords: []string{"dog"}}
+
+	merged := MergeMetadata(Metadata{Keywords: []string{" "}}, requested, MergeKeepExisting)
+
+	if merged.Title != "Title" || !reflect.DeepEqual(merged.Keywords, []string{"dog"}) {
+		t.Errorf("Expected missing fields to be filled, got %+v", merged)
+	}
+}
+
+func TestParseExistingMetadata(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"IPTC:Headline": "Headline only",
+		"EXIF:ImageDescription": "Camera description",
+		"XMP:Subject": ["dog", "Park"],
+		"IPTC:Keywords": ["park", 2024],
+		"XMP:HierarchicalSubject": "Animals|Dog",
+		"XMP:Category": "Animals",
+		"XMP:SupplementalCategories": ["Nature", "Pets"],
+		"XMP:AltTextAccessibility": "Dog in a park"
+	}]`
+
+	existing, err := parseExistingMetadata([]byte(output))
+	if err != nil {
+		t.Fatalf("parseExistingMetadata failed: %v", err)
+	}
+
+	expected := Metadata{
+		Title:                  "Headline only",
+		Description:            "Camera description",
+		Keywords:               []string{"dog", "Park", "2024"},
+		HierarchicalKeywords:   []string{"Animals|Dog"},
+		Category:               "Animals",
+		SupplementalCategories: []string{"Nature", "Pets"},
+		AltText:                "Dog in a park",
+	}
+	if !reflect.DeepEqual(existing, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, existing)
+	}
+}
+
+func TestParseMergePolicy(t *testing.T) {
+	policy, err := ParseMergePolicy(" Keep-Existing ")
+	if err != nil || policy != MergeKeepExisting {
+		t.Errorf("Expected keep-existing policy, got %q (%v)", policy, err)
+	}
+
+	if _, err := ParseMergePolicy("overwrite"); err == nil {
+		t.Error("Expected error for unknown merge policy")
+	}
+}
+
+func TestMergeMetadata_CreatorAlwaysFromProfile(t *testing.T) {
+	requested := Metadata{Creator: Creator{Name: "Jane Doe"}}
+
+	for _, policy := range []MergePolicy{MergeReplace, MergeAppendUnique, MergeKeepExisting} {
+		merged := MergeMetadata(Metadata{Title: "Existing"}, requested, policy)
+		if merged.Creator.Name != "Jane Doe" {
+			t.Errorf("%s: expected creator from the profile, got %+v", policy, merged.Creator)
+		}
+	}
+}
+
+func TestMergeMetadata_Category(t *testing.T) {
+	existing := Metadata{Category: "Travel", SupplementalCategories: []string{"Nature"}}
+	requested := Metadata{Category: "Animals", SupplementalCategories: []string{"nature", "Pets"}}
+
+	merged := MergeMetadata(existing, requested, MergeAppendUnique)
+	if merged.Category != "Animals" || !reflect.DeepEqual(merged.SupplementalCategories, []string{"Nature", "Pets"}) {
+		t.Errorf("append-unique: expected generated category and combined supplemental categories, got %+v", merged)
+	}
+
+	merged = MergeMetadata(existing, requested, MergeKeepExisting)
+	if merged.Category != "Travel" || !reflect.DeepEqual(merged.SupplementalCategories, []string{"Nature"}) {
+		t.Errorf("keep-existing: expected existing categories, got %+v", merged)
+	}
+}
+
+func TestMergeMetadata_AltText(t *testing.T) {
+	existing := Metadata{AltText: "Hand-written alt text"}
+	requested := Metadata{AltText: "Generated alt text"}
+
+	if merged := MergeMetadata(existing, requested, MergeAppendUnique); merged.AltText != "Generated alt text" {
+		t.Errorf("append-unique: expected generated alt text, got %q", merged.AltText)
+	}
+	if merged := MergeMetadata(existing, requested, MergeKeepExisting); merged.AltText != "Hand-written alt text" {
+		t.Errorf("keep-existing: expected existing alt text, got %q", merged.AltText)
+	}
+}
@@ -0,0 +1,306 @@
+package exiftool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPoolClosed is returned when a command is executed after the pool was closed
+var ErrPoolClosed = errors.New("exiftool pool is closed")
+
+// errProcessExited is returned when the exiftool process died before or while running a command
+var errProcessExited = errors.New("exiftool process exited")
+
+// errNotDelivered is returned when the process exited before it received a command. Only then is
+// the command run again: once exiftool read it, a write with -overwrite_original may have been
+// applied already.
+var errNotDelivered = fmt.Errorf("%w before the command was delivered", errProcessExited)
+
+// lineBreaks flattens values for the line based -@ argument file
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// closeTimeout bounds how long Close waits for a process to exit before killing it
+const closeTimeout = 5 * time.Second
+
+// Pool manages long-lived `exiftool -stay_open True -@ -` processes.
+// Each process runs one command at a time; the pool is safe for concurrent use.
+type Pool struct {
+	logger     *logrus.Logger
+	slots      chan *process
+	binaryPath string
+	timeout    time.Duration
+	mu         sync.Mutex
+	closed     bool
+	size       int
+}
+
+// result is the output of a single -execute command
+type result struct {
+	err    error
+	stdout string
+	stderr string
+}
+
+// NewPool creates a pool of up to size exiftool processes.
+// Processes are started on first use and restarted automatically if they crash.
+func NewPool(binaryPath string, size int, timeout time.Duration, logger *logrus.Logger) *Pool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &Pool{
+		binaryPath: binaryPath,
+		timeout:    timeout,
+		logger:     logger,
+		size:       size,
+		slots:      make(chan *process, size),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+
+	return p
+}
+
+// Execute runs a single exiftool command and returns its stdout and stderr.
+// A command that exceeds the timeout kills its process, which is restarted on next use.
+func (p *Pool) Execute(ctx context.Context, args []string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var proc *process
+	select {
+	case proc = <-p.slots:
+	case <-ctx.Done():
+		return "", "", fmt.Errorf("waiting for exiftool process: %w", ctx.Err())
+	}
+
+	if p.isClosed() {
+		p.release(proc)
+		return "", "", ErrPoolClosed
+	}
+
+	res, proc := p.run(ctx, proc, args)
+	p.release(proc)
+
+	return res.stdout, res.stderr, res.err
+}
+
+// run executes a command, restarting a crashed process and retrying once if the
+// command could not be delivered. A process that died while running the command is
+// restarted for the next command, but the command is not run again.
+func (p *Pool) run(ctx context.Context, proc *process, args []string) (result, *process) {
+	for attempt := 0; ; attempt++ {
+		if proc == nil || proc.exited() {
+			if proc != nil {
+				p.logger.Warn("ExifTool process exited unexpectedly, restarting")
+			}
+
+			var err error
+			proc, err = startProcess(p.binaryPath)
+			if err != nil {
+				return result{err: err}, nil
+			}
+		}
+
+		res := proc.execute(ctx, args)
+		if res.err == nil {
+			return res, proc
+		}
+
+		// The process state is unknown after a failure, so never reuse it
+		proc.kill()
+		if !errors.Is(res.err, errNotDelivered) || attempt > 0 || ctx.Err() != nil {
+			return res, nil
+		}
+		proc = nil
+	}
+}
+
+// release returns a process slot to the pool, stopping the process if the pool is closed
+func (p *Pool) release(proc *process) {
+	if proc != nil && p.isClosed() {
+		proc.stop()
+		proc = nil
+	}
+	p.slots <- proc
+}
+
+// isClosed reports whether Close was called
+func (p *Pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Close stops all processes, waiting for running commands to finish
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	for i := 0; i < p.size; i++ {
+		if proc := <-p.slots; proc != nil {
+			proc.stop()
+		}
+		p.slots <- nil
+	}
+
+	p.logger.Info("ExifTool process pool closed")
+	return nil
+}
+
+// process is a single exiftool process in -stay_open mode
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *bufio.Reader
+	done   chan struct{}
+	seq    int
+}
+
+// startProcess starts exiftool reading arguments from stdin
+func startProcess(binaryPath string) (*process, error) {
+	cmd := exec.Command(binaryPath, "-stay_open", "True", "-@", "-")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exiftool stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exiftool stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exiftool stderr: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start exiftool: %w", err)
+	}
+
+	proc := &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		stderr: bufio.NewReader(stderr),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		_ = cmd.Wait()
+		close(proc.done)
+	}()
+
+	return proc, nil
+}
+
+// exited reports whether the process has terminated
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// execute sends one command framed by -execute and reads output up to the ready marker.
+// -echo4 prints the same marker to stderr so both streams can be read to completion.
+func (p *process) execute(ctx context.Context, args []string) result {
+	p.seq++
+	marker := fmt.Sprintf("{ready%d}", p.seq)
+
+	var command strings.Builder
+	for _, arg := range args {
+		// The argument file is line based, so values cannot contain line breaks
+		command.WriteString(lineBreaks.Replace(arg))
+		command.WriteByte('\n')
+	}
+	fmt.Fprintf(&command, "-echo4\n%s\n-execute%d\n", marker, p.seq)
+
+	if _, err := io.WriteString(p.stdin, command.String()); err != nil {
+		return result{err: fmt.Errorf("%w: %v", errNotDelivered, err)}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		var wg sync.WaitGroup
+		var stderrErr error
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.stderr, stderrErr = readUntil(p.stderr, marker)
+		}()
+
+		stdout, err := readUntil(p.stdout, marker)
+		wg.Wait()
+
+		res.stdout = stdout
+		if err == nil {
+			err = stderrErr
+		}
+		if err != nil {
+			res.err = fmt.Errorf("%w: %v", errProcessExited, err)
+		}
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		return res
+	case <-ctx.Done():
+		return result{err: fmt.Errorf("exiftool command timed out: %w", ctx.Err())}
+	}
+}
+
+// stop asks exiftool to exit and kills it if it does not stop in time
+func (p *process) stop() {
+	_, _ = io.WriteString(p.stdin, "-stay_open\nFalse\n")
+	_ = p.stdin.Close()
+
+	select {
+	case <-p.done:
+	case <-time.After(closeTimeout):
+		p.kill()
+	}
+}
+
+// kill terminates the process immediately
+func (p *process) kill() {
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+	_ = p.stdin.Close()
+}
+
+// readUntil reads lines until the marker line and returns everything before it
+func readUntil(r *bufio.Reader, marker string) (string, error) {
+	var output strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if strings.TrimRight(line, "\r\n") == marker {
+			return output.String(), nil
+		}
+		output.WriteString(line)
+		if err != nil {
+			return output.String(), err
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package exiftool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const fakeExifToolEnv = "EXIFTOOL_FAKE_PROCESS"
+
+// TestMain lets the test binary act as a fake `exiftool -stay_open True -@ -` process
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeExifToolEnv) == "1" {
+		runFakeExifTool()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeExifTool implements the -stay_open protocol: arguments are read line by line
+// until -executeN, then output is followed by {readyN} on stdout and the -echo4 text on stderr
+func runFakeExifTool() {
+	scanner := bufio.NewScanner(os.Stdin)
+	var args []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "False" && len(args) > 0 && args[len(args)-1] == "-stay_open" {
+			return
+		}
+		if !strings.HasPrefix(line, "-execute") {
+			args = append(args, line)
+			continue
+		}
+
+		var echo string
+		var command []string
+		for i := 0; i < len(args); i++ {
+			if args[i] == "-echo4" && i+1 < len(args) {
+				echo = args[i+1]
+				i++
+				continue
+			}
+			command = append(command, args[i])
+		}
+		args = nil
+
+		switch {
+		case contains(command, "crash"):
+			os.Exit(1)
+		case len(command) == 2 && command[0] == "record-and-crash":
+			// Leaves a trace of every run, then dies like a write that crashed exiftool
+			f, err := os.OpenFile(command[1], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err == nil {
+				fmt.Fprintln(f, "run")
+				_ = f.Close()
+			}
+			os.Exit(1)
+		case contains(command, "hang"):
+			time.Sleep(time.Minute)
+		case contains(command, "bad.jpg"):
+			fmt.Fprintln(os.Stderr, "Error: File not found - bad.jpg")
+		case contains(command, "-ver"):
+			fmt.Println("12.40")
+		default:
+			fmt.Printf("    1 image files updated (pid %d)\n", os.Getpid())
+		}
+
+		fmt.Printf("{ready%s}\n", strings.TrimPrefix(line, "-execute"))
+		fmt.Fprintln(os.Stderr, echo)
+	}
+}
+
+func contains(args []string, value string) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newFakePool(t *testing.T, size int, timeout time.Duration) *Pool {
+	t.Helper()
+	t.Setenv(fakeExifToolEnv, "1")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	pool := NewPool(os.Args[0], size, timeout, logger)
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func TestPool_ReusesProcess(t *testing.T) {
+	pool := newFakePool(t, 1, 5*time.Second)
+
+	first, _, err := pool.Execute(context.Background(), []string{"image.jpg"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	second, _, err := pool.Execute(context.Background(), []string{"image.jpg"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("Expected the same process to serve both commands, got %q and %q", first, second)
+	}
+}
+
+func TestPool_ReportsStderr(t *testing.T) {
+	pool := newFakePool(t, 1, 5*time.Second)
+
+	_, stderr, err := pool.Execute(context.Background(), []string{"bad.jpg"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !hasExifToolError(stderr) {
+		t.Errorf("Expected error on stderr, got %q", stderr)
+	}
+}
+
+func TestPool_RestartsAfterCrash(t *testing.T) {
+	pool := newFakePool(t, 1, 5*time.Second)
+
+	before, _, err := pool.Execute(context.Background(), []string{"image.jpg"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if _, _, err := pool.Execute(context.Background(), []string{"crash"}); err == nil {
+		t.Fatal("Expected error when the process crashes")
+	}
+
+	after, _, err := pool.Execute(context.Background(), []string{"image.jpg"})
+	if err != nil {
+		t.Fatalf("Execute after crash failed: %v", err)
+	}
+	if before == after {
+		t.Error("Expected a new process after the crash")
+	}
+}
+
+func TestPool_DoesNotRerunCommandAfterCrash(t *testing.T) {
+	pool := newFakePool(t, 1, 5*time.Second)
+	runs := filepath.Join(t.TempDir(), "runs")
+
+	if _, _, err := pool.Execute(context.Background(), []string{"record-and-crash", runs}); err == nil {
+		t.Fatal("Expected error when the process crashes")
+	}
+
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("Failed to read runs: %v", err)
+	}
+	if got := strings.Count(string(data), "run"); got != 1 {
+		t.Errorf("Expected the command to run once, ran %d times", got)
+	}
+}
+
+func TestPool_Timeout(t *testing.T) {
+	pool := newFakePool(t, 1, 200*time.Millisecond)
+
+	_, _, err := pool.Execute(context.Background(), []string{"hang"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	if _, _, err := pool.Execute(context.Background(), []string{"-ver"}); err != nil {
+		t.Fatalf("Execute after timeout failed: %v", err)
+	}
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	pool := newFakePool(t, 3, 5*time.Second)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stdout, _, err := pool.Execute(context.Background(), []string{"image.jpg"})
+			if err == nil && !strings.Contains(stdout, "1 image files updated") {
+				err = fmt.Errorf("unexpected output %q", stdout)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Concurrent execute failed: %v", err)
+		}
+	}
+}
+
+func TestPool_Closed(t *testing.T) {
+	pool := newFakePool(t, 1, 5*time.Second)
+
+	if _, _, err := pool.Execute(context.Background(), []string{"-ver"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, _, err := pool.Execute(context.Background(), []string{"-ver"}); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestClient_WriteMetadataUsesPool(t *testing.T) {
+	t.Setenv(fakeExifToolEnv, "1")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	client := NewPooledClient(os.Args[0], 2, 5*time.Second, logger)
+	defer client.Close()
+
+	if err := client.WriteMetadata(context.Background(), "image.jpg", Metadata{Title: "Line one\nline two"}, "trace-1"); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+
+	if err := client.WriteMetadata(context.Background(), "bad.jpg", Metadata{Title: "Title"}, "trace-2"); err == nil {
+		t.Error("Expected error reported on stderr to fail the write")
+	}
+}
@@ -0,0 +1,96 @@
+package exiftool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PrivacyGroup is a group of identifying tags that a privacy profile removes together
+type PrivacyGroup string
+
+const (
+	// PrivacyGPS covers GPS coordinates in EXIF, XMP and maker notes
+	PrivacyGPS PrivacyGroup = "gps"
+	// PrivacyMakerNotes covers the vendor-specific MakerNotes block
+	PrivacyMakerNotes PrivacyGroup = "makernotes"
+	// PrivacySerials covers camera body and lens serial numbers
+	PrivacySerials PrivacyGroup = "serials"
+	// PrivacyOwner covers owner, artist and creator names
+	PrivacyOwner PrivacyGroup = "owner"
+)
+
+// privacyGroupTags are the ExifTool tag names deleted for each group
+var privacyGroupTags = map[PrivacyGroup][]string{
+	PrivacyGPS:        {"*GPS*"},
+	PrivacyMakerNotes: {"MakerNotes:all"},
+	PrivacySerials:    {"SerialNumber", "InternalSerialNumber", "LensSerialNumber", "CameraSerialNumber"},
+	PrivacyOwner:      {"OwnerName", "CameraOwnerName", "Artist", "IPTC:By-line", "XMP-dc:Creator"},
+}
+
+// privacyProfiles are the named profiles accepted in messages (see models.PrivacyProfiles)
+var privacyProfiles = map[string]PrivacyProfile{
+	"off":      {},
+	"location": {PrivacyGPS},
+	"standard": {PrivacyGPS, PrivacySerials, PrivacyOwner},
+	"strict":   {PrivacyGPS, PrivacyMakerNotes, PrivacySerials, PrivacyOwner},
+}
+
+// PrivacyProfile lists the tag groups removed from an image; groups that are not listed are kept
+type PrivacyProfile []PrivacyGroup
+
+// ParsePrivacyProfile accepts a named profile ("off", "location", "standard", "strict")
+// or a comma-separated list of groups such as "gps,owner"
+func ParsePrivacyProfile(value string) (PrivacyProfile, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if profile, ok := privacyProfiles[value]; ok {
+		return profile, nil
+	}
+
+	var profile PrivacyProfile
+	for _, name := range strings.Split(value, ",") {
+		group := PrivacyGroup(strings.TrimSpace(name))
+		if _, ok := privacyGroupTags[group]; !ok {
+			return nil, fmt.Errorf("unknown privacy profile or tag group %q", value)
+		}
+		profile = append(profile, group)
+	}
+	return profile, nil
+}
+
+// Tags returns the ExifTool tag names removed by the profile
+func (p PrivacyProfile) Tags() []string {
+	var tags []string
+	for _, group := range p {
+		tags = append(tags, privacyGroupTags[group]...)
+	}
+	return tags
+}
+
+// privacyReadArgs builds the command that lists the tags a profile would remove
+func privacyReadArgs(imagePath string, profile PrivacyProfile) []string {
+	args := []string{"-j", "-G"}
+	for _, tag := range profile.Tags() {
+		args = append(args, "-"+tag)
+	}
+	return append(args, imagePath)
+}
+
+// parsePrivateTags returns the sorted group:tag names present in `exiftool -j -G` output.
+// Composite tags are derived from other tags and disappear with them, so they are not listed.
+func parsePrivateTags(output []byte) ([]string, error) {
+	tags, err := parseJSONOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range tags {
+		if name == "SourceFile" || strings.HasPrefix(name, "Composite:") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
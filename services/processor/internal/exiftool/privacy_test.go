@@ -0,0 +1,72 @@
+package exiftool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrivacyProfile(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected PrivacyProfile
+	}{
+		{value: "off", expected: PrivacyProfile{}},
+		{value: "location", expected: PrivacyProfile{PrivacyGPS}},
+		{value: " Strict ", expected: PrivacyProfile{PrivacyGPS, PrivacyMakerNotes, PrivacySerials, PrivacyOwner}},
+		{value: "gps, owner", expected: PrivacyProfile{PrivacyGPS, PrivacyOwner}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			profile, err := ParsePrivacyProfile(tt.value)
+			if err != nil {
+				t.Fatalf("ParsePrivacyProfile failed: %v", err)
+			}
+			if !reflect.DeepEqual(profile, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, profile)
+			}
+		})
+	}
+
+	for _, value := range []string{"paranoid", "gps,faces", ""} {
+		if _, err := ParsePrivacyProfile(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestPrivacyReadArgs(t *testing.T) {
+	args := privacyReadArgs("/tmp/test.jpg", PrivacyProfile{PrivacyGPS, PrivacySerials})
+
+	expected := []string{
+		"-j", "-G", "-*GPS*",
+		"-SerialNumber", "-InternalSerialNumber", "-LensSerialNumber", "-CameraSerialNumber",
+		"/tmp/test.jpg",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestParsePrivateTags(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"EXIF:GPSLatitude": "52 deg 31' 12.00\" N",
+		"EXIF:GPSLongitude": "13 deg 24' 36.00\" E",
+		"Composite:GPSPosition": "52 deg 31' 12.00\" N, 13 deg 24' 36.00\" E",
+		"EXIF:SerialNumber": 123456,
+		"MakerNotes:InternalSerialNumber": "AB123"
+	}]`
+
+	tags, err := parsePrivateTags([]byte(output))
+	if err != nil {
+		t.Fatalf("parsePrivateTags failed: %v", err)
+	}
+
+	expected := []string{
+		"EXIF:GPSLatitude", "EXIF:GPSLongitude", "EXIF:SerialNumber", "MakerNotes:InternalSerialNumber",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %v, got %v", expected, tags)
+	}
+}
@@ -0,0 +1,248 @@
+package exiftool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// IPTC IIM record limits in bytes; ExifTool truncates longer values when writing
+const (
+	iptcHeadlineLimit  = 256
+	iptcCaptionLimit   = 2000
+	iptcKeywordLimit   = 64
+	iptcByLineLimit    = 32
+	iptcCopyrightLimit = 128
+)
+
+// verifiedTag is a tag read back during verification and the field it stores
+type verifiedTag struct {
+	field string
+	name  string
+	limit int
+}
+
+// verifiedTags lists the tags written by buildMetadataArgs, in -G group:tag form
+var verifiedTags = []verifiedTag{
+	{field: "Title", name: "XMP:Title"},
+	{field: "Title", name: "IPTC:Headline", limit: iptcHeadlineLimit},
+	{field: "Title", name: "EXIF:XPTitle"},
+	{field: "Description", name: "XMP:Description"},
+	{field: "Description", name: "IPTC:Caption-Abstract", limit: iptcCaptionLimit},
+	{field: "Description", name: "EXIF:ImageDescription"},
+	{field: "Keywords", name: "XMP:Subject"},
+	{field: "Keywords", name: "IPTC:Keywords", limit: iptcKeywordLimit},
+	{field: "Category", name: "XMP:Category"},
+	{field: "SupplementalCategories", name: "XMP:SupplementalCategories"},
+	{field: "AltText", name: "XMP:AltTextAccessibility"},
+	{field: "ExtDescr", name: "XMP:ExtDescrAccessibility"},
+	{field: "Creator", name: "XMP:Creator"},
+	{field: "Creator", name: "IPTC:By-line", limit: iptcByLineLimit},
+	{field: "Creator", name: "EXIF:Artist"},
+	{field: "Rights", name: "XMP:Rights"},
+	{field: "Rights", name: "IPTC:CopyrightNotice", limit: iptcCopyrightLimit},
+	{field: "Rights", name: "EXIF:Copyright"},
+}
+
+// FieldDiff describes a tag whose value read back from the file differs from the requested one.
+// For keyword tags Missing lists the requested keywords that were not found.
+type FieldDiff struct {
+	Field    string   `json:"field"`
+	Tag      string   `json:"tag"`
+	Expected string   `json:"expected,omitempty"`
+	Actual   string   `json:"actual,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+// String formats the diff for logs and error messages
+func (d FieldDiff) String() string {
+	if len(d.Missing) > 0 {
+		return fmt.Sprintf("%s: missing %q", d.Tag, d.Missing)
+	}
+	return fmt.Sprintf("%s: expected %q, got %q", d.Tag, d.Expected, d.Actual)
+}
+
+// VerificationResult is the structured comparison of requested and written metadata
+type VerificationResult struct {
+	Diffs []FieldDiff `json:"diffs,omitempty"`
+}
+
+// OK reports whether every written tag matched the requested metadata
+func (r *VerificationResult) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// String joins all diffs into a single line
+func (r *VerificationResult) String() string {
+	if r.OK() {
+		return "metadata verified"
+	}
+
+	parts := make([]string, 0, len(r.Diffs))
+	for _, diff := range r.Diffs {
+		parts = append(parts, diff.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// tagsToVerify returns the tags written to path; sidecars only hold the XMP tags
+func tagsToVerify(path string) []verifiedTag {
+	if !IsSidecar(path) {
+		return verifiedTags
+	}
+
+	var tags []verifiedTag
+	for _, tag := range verifiedTags {
+		if strings.HasPrefix(tag.name, "XMP:") {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// verifyArgs builds the command that reads back the verified tags as JSON
+func verifyArgs(path string) []string {
+	args := []string{"-j", "-G", "-charset", "utf8"}
+	for _, tag := range tagsToVerify(path) {
+		args = append(args, "-"+tag.name)
+	}
+	return append(args, path)
+}
+
+// compareMetadata compares `exiftool -j -G` output for the given tags with the metadata
+// that was written. Empty fields were not written and are not checked.
+func compareMetadata(expected Metadata, tagsToCheck []verifiedTag, output []byte) (*VerificationResult, error) {
+	tags, err := parseJSONOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerificationResult{}
+	for _, tag := range tagsToCheck {
+		switch tag.field {
+		case "Title":
+			result.compareValue(tag, expected.Title, tags[tag.name])
+		case "Description":
+			result.compareValue(tag, expected.Description, tags[tag.name])
+		case "Keywords":
+			result.compareKeywords(tag, expected.Keywords, tags[tag.name])
+		case "Category":
+			result.compareValue(tag, expected.Category, tags[tag.name])
+		case "SupplementalCategories":
+			result.compareKeywords(tag, expected.SupplementalCategories, tags[tag.name])
+		case "AltText":
+			result.compareValue(tag, expected.AltText, tags[tag.name])
+		case "ExtDescr":
+			// Only written together with the alt text, see accessibilityArgs
+			if expected.AltText != "" {
+				result.compareValue(tag, expected.Description, tags[tag.name])
+			}
+		case "Creator":
+			result.compareValue(tag, expected.Creator.Name, tags[tag.name])
+		case "Rights":
+			result.compareValue(tag, expected.Creator.Rights, tags[tag.name])
+		}
+	}
+
+	return result, nil
+}
+
+// compareValue records a diff if a single-valued tag does not hold the expected value
+func (r *VerificationResult) compareValue(tag verifiedTag, expected string, actual []string) {
+	if expected == "" {
+		return
+	}
+
+	expected = lineBreaks.Replace(expected)
+	value := strings.Join(actual, ", ")
+	if matchesValue(expected, value, tag.limit) {
+		return
+	}
+
+	r.Diffs = append(r.Diffs, FieldDiff{
+		Field:    tag.field,
+		Tag:      tag.name,
+		Expected: expected,
+		Actual:   value,
+	})
+}
+
+// compareKeywords records a diff if any expected keyword is missing from a list tag.
+// Extra values are not reported, since merge policies may keep existing keywords.
+func (r *VerificationResult) compareKeywords(tag verifiedTag, expected []string, actual []string) {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, keyword := range expected {
+		keyword = lineBreaks.Replace(keyword)
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+
+		found := false
+		for _, value := range actual {
+			if matchesValue(keyword, value, tag.limit) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, keyword)
+		}
+	}
+
+	if len(missing) > 0 {
+		r.Diffs = append(r.Diffs, FieldDiff{
+			Field:   tag.field,
+			Tag:     tag.name,
+			Missing: missing,
+		})
+	}
+}
+
+// matchesValue compares a written value, allowing it to be cut to limit bytes
+// when the expected value exceeds an IPTC length limit
+func matchesValue(expected, actual string, limit int) bool {
+	if actual == expected {
+		return true
+	}
+	if limit == 0 || len(expected) <= limit {
+		return false
+	}
+
+	// Truncation may split a multi-byte character, which is then dropped or replaced
+	actual = strings.TrimRight(strings.ToValidUTF8(actual, ""), string(utf8.RuneError))
+	return len(actual) <= limit &&
+		len(actual) > limit-utf8.UTFMax &&
+		strings.HasPrefix(expected, actual)
+}
+
+// parseJSONOutput decodes the single-file array printed by -j into tag values.
+// ExifTool prints numeric-looking values as JSON numbers and single keywords as scalars.
+func parseJSONOutput(output []byte) (map[string][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+
+	var files []map[string]interface{}
+	if err := decoder.Decode(&files); err != nil {
+		return nil, fmt.Errorf("failed to parse exiftool output: %w", err)
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("expected metadata for 1 file, got %d", len(files))
+	}
+
+	tags := make(map[string][]string, len(files[0]))
+	for name, value := range files[0] {
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				tags[name] = append(tags[name], fmt.Sprint(item))
+			}
+			continue
+		}
+		tags[name] = []string{fmt.Sprint(value)}
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,253 @@
+package exiftool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareMetadata_Match(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Title": "Sunset",
+		"IPTC:Headline": "Sunset",
+		"EXIF:XPTitle": "Sunset",
+		"XMP:Description": "Sun over the sea",
+		"IPTC:Caption-Abstract": "Sun over the sea",
+		"EXIF:ImageDescription": "Sun over the sea",
+		"XMP:Subject": ["sunset", "sea", 2024],
+		"IPTC:Keywords": ["sunset", "sea", 2024]
+	}]`
+
+	metadata := Metadata{
+		Title:       "Sunset",
+		Description: "Sun over the sea",
+		Keywords:    []string{"sunset", "sea", "2024"},
+	}
+
+	result, err := compareMetadata(metadata, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Expected metadata to match, got %s", result)
+	}
+}
+
+func TestCompareMetadata_ReportsDiffs(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Title": "Sunrise",
+		"IPTC:Headline": "Sunset",
+		"EXIF:XPTitle": "Sunset",
+		"XMP:Subject": "sunset",
+		"IPTC:Keywords": ["sunset", "sea"]
+	}]`
+
+	metadata := Metadata{
+		Title:    "Sunset",
+		Keywords: []string{"sunset", "sea"},
+	}
+
+	result, err := compareMetadata(metadata, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+
+	if len(result.Diffs) != 2 {
+		t.Fatalf("Expected 2 diffs, got %d: %s", len(result.Diffs), result)
+	}
+
+	title := result.Diffs[0]
+	if title.Tag != "XMP:Title" || title.Expected != "Sunset" || title.Actual != "Sunrise" {
+		t.Errorf("Unexpected title diff: %+v", title)
+	}
+
+	keywords := result.Diffs[1]
+	if keywords.Tag != "XMP:Subject" || len(keywords.Missing) != 1 || keywords.Missing[0] != "sea" {
+		t.Errorf("Unexpected keyword diff: %+v", keywords)
+	}
+}
+
+func TestCompareMetadata_MissingTag(t *testing.T) {
+	output := `[{"SourceFile": "/tmp/test.jpg"}]`
+
+	result, err := compareMetadata(Metadata{Description: "Sun over the sea"}, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+
+	// All three description tags are missing
+	if len(result.Diffs) != 3 {
+		t.Errorf("Expected 3 diffs, got %d: %s", len(result.Diffs), result)
+	}
+	for _, diff := range result.Diffs {
+		if diff.Field != "Description" || diff.Actual != "" {
+			t.Errorf("Unexpected diff: %+v", diff)
+		}
+	}
+}
+
+func TestCompareMetadata_IPTCTruncation(t *testing.T) {
+	longKeyword := strings.Repeat("k", 70)
+	// "ж" is two bytes, so a 64 byte cut splits the last character
+	unicodeKeyword := "a" + strings.Repeat("ж", 40)
+
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Subject": ["` + longKeyword + `", "` + unicodeKeyword + `"],
+		"IPTC:Keywords": ["` + longKeyword[:64] + `", "` + unicodeKeyword[:63] + `"]
+	}]`
+
+	metadata := Metadata{Keywords: []string{longKeyword, unicodeKeyword}}
+
+	result, err := compareMetadata(metadata, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Expected truncated IPTC keywords to match, got %s", result)
+	}
+}
+
+func TestCompareMetadata_RejectsShortTruncation(t *testing.T) {
+	longKeyword := strings.Repeat("k", 70)
+
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Subject": ["` + longKeyword + `"],
+		"IPTC:Keywords": ["kkk"]
+	}]`
+
+	result, err := compareMetadata(Metadata{Keywords: []string{longKeyword}}, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if result.OK() || result.Diffs[0].Tag != "IPTC:Keywords" {
+		t.Errorf("Expected IPTC keyword diff, got %s", result)
+	}
+}
+
+func TestCompareMetadata_LineBreaks(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Description": "First line Second line",
+		"IPTC:Caption-Abstract": "First line Second line",
+		"EXIF:ImageDescription": "First line Second line"
+	}]`
+
+	result, err := compareMetadata(Metadata{Description: "First line\nSecond line"}, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Expected flattened line breaks to match, got %s", result)
+	}
+}
+
+func TestCompareMetadata_InvalidOutput(t *testing.T) {
+	if _, err := compareMetadata(Metadata{Title: "Sunset"}, verifiedTags, []byte("not json")); err == nil {
+		t.Error("Expected error for invalid JSON output")
+	}
+
+	if _, err := compareMetadata(Metadata{Title: "Sunset"}, verifiedTags, []byte("[]")); err == nil {
+		t.Error("Expected error for empty file list")
+	}
+}
+
+func TestCompareMetadata_SidecarChecksXMPOnly(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.xmp",
+		"XMP:Title": "Sunset",
+		"XMP:Subject": ["sunset"]
+	}]`
+
+	metadata := Metadata{Title: "Sunset", Keywords: []string{"sunset"}}
+
+	result, err := compareMetadata(metadata, tagsToVerify("/tmp/test.xmp"), []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Expected sidecar to verify without IPTC and EXIF tags, got %s", result)
+	}
+
+	result, err = compareMetadata(metadata, tagsToVerify("/tmp/test.jpg"), []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if result.OK() {
+		t.Error("Expected missing IPTC and EXIF tags to be reported for an image")
+	}
+}
+
+func TestCompareMetadata_Creator(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Creator": "Jane Doe",
+		"IPTC:By-line": "Jane Doe",
+		"EXIF:Artist": "Jane Doe",
+		"XMP:Rights": "© 2026 Jane Doe",
+		"IPTC:CopyrightNotice": "© 2026 Jane Doe"
+	}]`
+
+	metadata := Metadata{Creator: Creator{Name: "Jane Doe", Rights: "© 2026 Jane Doe"}}
+
+	result, err := compareMetadata(metadata, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Tag != "EXIF:Copyright" {
+		t.Errorf("Expected only the missing EXIF copyright to be reported, got %s", result)
+	}
+}
+
+func TestCompareMetadata_Category(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Category": "Animals",
+		"XMP:SupplementalCategories": "Nature"
+	}]`
+
+	metadata := Metadata{Category: "Animals", SupplementalCategories: []string{"Nature", "Pets"}}
+
+	result, err := compareMetadata(metadata, verifiedTags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Tag != "XMP:SupplementalCategories" ||
+		!strings.Contains(result.String(), "Pets") {
+		t.Errorf("Expected the missing supplemental category to be reported, got %s", result)
+	}
+}
+
+func TestCompareMetadata_AltText(t *testing.T) {
+	output := `[{
+		"SourceFile": "/tmp/test.jpg",
+		"XMP:Description": "A dog on the beach",
+		"XMP:AltTextAccessibility": "Dog on a beach"
+	}]`
+
+	metadata := Metadata{Description: "A dog on the beach", AltText: "Dog on a beach"}
+	tags := []verifiedTag{
+		{field: "Description", name: "XMP:Description"},
+		{field: "AltText", name: "XMP:AltTextAccessibility"},
+		{field: "ExtDescr", name: "XMP:ExtDescrAccessibility"},
+	}
+
+	result, err := compareMetadata(metadata, tags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Tag != "XMP:ExtDescrAccessibility" {
+		t.Errorf("Expected the missing extended description to be reported, got %s", result)
+	}
+
+	metadata.AltText = ""
+	result, err = compareMetadata(metadata, tags, []byte(output))
+	if err != nil {
+		t.Fatalf("compareMetadata failed: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Expected accessibility fields to be skipped without alt text, got %s", result)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/shabohin/photo-tags/pkg/metrics"
 	"github.com/shabohin/photo-tags/services/processor/internal/config"
 	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
 	"github.com/shabohin/photo-tags/services/processor/internal/storage/minio"
@@ -240,6 +241,7 @@ func (h *Handler) SetupRoutes() http.Handler {
 
 	// Add routes
 	mux.HandleFunc("/health", h.HealthCheck)
+	mux.Handle("/metrics", metrics.Handler())
 
 	// Log middleware
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
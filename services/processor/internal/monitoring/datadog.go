@@ -0,0 +1,62 @@
+// Package monitoring reports traces to Datadog APM.
+// Metrics are recorded through pkg/metrics, which supports Datadog and other backends.
+package monitoring
+
+import (
+	"fmt"
+	"os"
+
+	ddtracer "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
+)
+
+var isEnabled bool
+
+// Init initializes Datadog tracing
+func Init(serviceName, serviceVersion string) error {
+	ddAPIKey := os.Getenv("DD_API_KEY")
+	if ddAPIKey == "" {
+		// Datadog is not configured, skip initialization
+		isEnabled = false
+		return nil
+	}
+
+	isEnabled = true
+
+	// Initialize Datadog tracer
+	ddAgentHost := os.Getenv("DD_AGENT_HOST")
+	if ddAgentHost == "" {
+		ddAgentHost = "datadog"
+	}
+
+	ddEnv := os.Getenv("DD_ENV")
+	if ddEnv == "" {
+		ddEnv = "development"
+	}
+
+	ddtracer.Start(
+		ddtracer.WithService(serviceName),
+		ddtracer.WithServiceVersion(serviceVersion),
+		ddtracer.WithEnv(ddEnv),
+		ddtracer.WithAgentAddr(fmt.Sprintf("%s:8126", ddAgentHost)),
+	)
+	tracing.SetTracer(datadogTracer{})
+
+	return nil
+}
+
+// Stop stops the Datadog tracer
+func Stop() {
+	if !isEnabled {
+		return
+	}
+
+	tracing.SetTracer(tracing.W3CTracer{})
+	ddtracer.Stop()
+}
+
+// IsEnabled returns whether Datadog tracing is enabled
+func IsEnabled() bool {
+	return isEnabled
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 // Client wraps MinIO client for processor service
@@ -117,8 +119,17 @@ func (c *Client) ensureBucketExists(ctx context.Context, bucketName string) erro
 	return nil
 }
 
-// DownloadImage downloads an image from the original bucket
+// DownloadImage downloads an image from the original bucket in a "minio.download" span
 func (c *Client) DownloadImage(ctx context.Context, objectPath string) ([]byte, error) {
+	span, ctx := tracing.StartSpan(ctx, "minio.download")
+	span.SetTag("bucket", c.originalBucket)
+	span.SetTag("object", objectPath)
+	data, err := c.downloadImage(ctx, objectPath)
+	span.Finish(err)
+	return data, err
+}
+
+func (c *Client) downloadImage(ctx context.Context, objectPath string) ([]byte, error) {
 	c.logger.WithFields(logrus.Fields{
 		"bucket": c.originalBucket,
 		"object": objectPath,
@@ -159,8 +170,17 @@ func (c *Client) DownloadImage(ctx context.Context, objectPath string) ([]byte,
 	return data, nil
 }
 
-// UploadImage uploads a processed image to the processed bucket
+// UploadImage uploads a processed image to the processed bucket in a "minio.upload" span
 func (c *Client) UploadImage(ctx context.Context, objectPath string, data []byte) error {
+	span, ctx := tracing.StartSpan(ctx, "minio.upload")
+	span.SetTag("bucket", c.processedBucket)
+	span.SetTag("object", objectPath)
+	err := c.uploadImage(ctx, objectPath, data)
+	span.Finish(err)
+	return err
+}
+
+func (c *Client) uploadImage(ctx context.Context, objectPath string, data []byte) error {
 	c.logger.WithFields(logrus.Fields{
 		"bucket":     c.processedBucket,
 		"object":     objectPath,
@@ -174,6 +194,9 @@ func (c *Client) UploadImage(ctx context.Context, objectPath string, data []byte
 	if len(objectPath) > 4 && objectPath[len(objectPath)-4:] == ".png" {
 		contentType = "image/png"
 	}
+	if len(objectPath) > 4 && objectPath[len(objectPath)-4:] == ".xmp" {
+		contentType = "application/rdf+xml"
+	}
 
 	_, err := c.client.PutObject(
 		ctx,
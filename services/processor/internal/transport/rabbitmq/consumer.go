@@ -4,27 +4,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/priority"
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 type Consumer struct {
 	logger        *logrus.Logger
 	conn          *amqp.Connection
 	channel       *amqp.Channel
+	confirms      *confirmer
 	url           string
 	queueName     string
 	retryDelay    time.Duration
 	prefetchCount int
 	maxRetries    int
+	weights       priority.Weights
+
+	// mu guards conn, channel and confirms, which the reconnect goroutine replaces
+	mu sync.Mutex
 }
 
 func NewConsumer(
 	url string,
 	queueName string,
 	prefetchCount int,
+	weights priority.Weights,
 	maxRetries int,
 	retryDelay time.Duration,
 	logger *logrus.Logger,
@@ -33,6 +44,7 @@ func NewConsumer(
 		url:           url,
 		queueName:     queueName,
 		prefetchCount: prefetchCount,
+		weights:       weights,
 		maxRetries:    maxRetries,
 		retryDelay:    retryDelay,
 		logger:        logger,
@@ -46,10 +58,13 @@ func NewConsumer(
 }
 
 func (c *Consumer) connect() error {
-	var err error
+	var (
+		conn *amqp.Connection
+		err  error
+	)
 
 	for i := 0; i < c.maxRetries; i++ {
-		c.conn, err = amqp.Dial(c.url)
+		conn, err = amqp.Dial(c.url)
 		if err == nil {
 			break
 		}
@@ -62,43 +77,97 @@ func (c *Consumer) connect() error {
 		return fmt.Errorf("failed to connect to RabbitMQ after %d attempts: %w", c.maxRetries, err)
 	}
 
-	c.channel, err = c.conn.Channel()
+	channel, err := conn.Channel()
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	_, err = c.channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		c.queueName,
 		true,  // durable
 		false, // delete when unused
 		false, // exclusive
 		false, // no-wait
-		nil,   // arguments
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": retryqueue.DeadLetterQueue,
+		},
 	)
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	err = c.channel.Qos(
+	// Metadata of batch and filewatcher uploads waits in the bulk lane
+	bulkQueue := priority.QueueName(c.queueName, priority.LaneBulk)
+	_, err = channel.QueueDeclare(
+		bulkQueue,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table(priority.BulkQueueArgs(retryqueue.DeadLetterQueue)),
+	)
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+		}
+		return fmt.Errorf("failed to declare bulk queue: %w", err)
+	}
+
+	// Failed messages wait in the retry queues of their lane before they are delivered again
+	queues := append([]retryqueue.Queue{{Name: retryqueue.DeadLetterQueue}}, retryqueue.Queues(c.queueName)...)
+	for _, queue := range append(queues, retryqueue.Queues(bulkQueue)...) {
+		_, err = channel.QueueDeclare(
+			queue.Name,
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table(queue.Args),
+		)
+		if err != nil {
+			if closeErr := conn.Close(); closeErr != nil {
+				c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+			}
+			return fmt.Errorf("failed to declare retry queue %s: %w", queue.Name, err)
+		}
+	}
+
+	err = channel.Qos(
 		c.prefetchCount, // prefetch count
 		0,               // prefetch size
 		false,           // global
 	)
 	if err != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
+		if closeErr := conn.Close(); closeErr != nil {
 			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
 		}
 		return fmt.Errorf("failed to set QoS: %w", err)
 	}
 
+	// Retry publishes wait for the broker to confirm them before the failed message is acked
+	confirms, err := newConfirmer(channel)
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			c.logger.WithError(closeErr).Error("Failed to close connection during cleanup")
+		}
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.channel = channel
+	c.confirms = confirms
+	c.mu.Unlock()
+
 	go func() {
-		<-c.conn.NotifyClose(make(chan *amqp.Error))
+		<-conn.NotifyClose(make(chan *amqp.Error))
 		c.logger.Warn("RabbitMQ connection closed, attempting to reconnect...")
 		for {
 			if err := c.connect(); err != nil {
@@ -114,13 +183,61 @@ func (c *Consumer) connect() error {
 	return nil
 }
 
-func (c *Consumer) Consume(ctx context.Context, handler func(message []byte) error) error {
-	if c.conn == nil || c.conn.IsClosed() {
+// Consume delivers messages from the interactive and bulk lanes to handler, weighted by the
+// consumer weights, with a context carrying the trace context and source of the message
+func (c *Consumer) Consume(ctx context.Context, handler func(ctx context.Context, message []byte) error) error {
+	conn, channel := c.current()
+	if conn == nil || conn.IsClosed() {
 		return errors.New("connection is not open")
 	}
 
-	msgs, err := c.channel.Consume(
-		c.queueName,
+	interactive, err := c.consumeLane(channel, priority.LaneInteractive)
+	if err != nil {
+		return err
+	}
+	bulk, err := c.consumeLane(channel, priority.LaneBulk)
+	if err != nil {
+		return err
+	}
+	receiver := priority.NewReceiver(c.weights, interactive, bulk)
+
+	for {
+		msg, lane, err := receiver.Receive(ctx)
+		if errors.Is(err, priority.ErrLaneClosed) {
+			c.logger.Warn("Consumer channel closed")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		queueName := priority.QueueName(c.queueName, lane)
+		c.logger.WithFields(logrus.Fields{
+			"delivery_tag": msg.DeliveryTag,
+			"content_type": msg.ContentType,
+			"queue":        queueName,
+		}).Debug("Received message")
+
+		msgCtx := priority.Extract(tracing.Extract(ctx, msg.Headers), msg.Headers)
+		msgCtx = retryqueue.Extract(msgCtx, msg.Headers)
+		span, msgCtx := tracing.StartSpan(msgCtx, "rabbitmq.consume")
+		span.SetTag("queue", queueName)
+		err = handler(msgCtx, msg.Body)
+		span.Finish(err)
+		if err != nil {
+			c.retry(ctx, queueName, msg, err)
+		} else {
+			if err := msg.Ack(false); err != nil {
+				c.logger.WithError(err).Error("Failed to ack message")
+			}
+		}
+	}
+}
+
+// consumeLane registers a consumer on the queue of lane
+func (c *Consumer) consumeLane(channel *amqp.Channel, lane priority.Lane) (<-chan amqp.Delivery, error) {
+	msgs, err := channel.Consume(
+		priority.QueueName(c.queueName, lane),
 		"",    // consumer
 		false, // auto-ack
 		false, // exclusive
@@ -129,48 +246,88 @@ func (c *Consumer) Consume(ctx context.Context, handler func(message []byte) err
 		nil,   // args
 	)
 	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+		return nil, fmt.Errorf("failed to register %s consumer: %w", lane, err)
 	}
+	return msgs, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case msg, ok := <-msgs:
-			if !ok {
-				c.logger.Warn("Consumer channel closed")
-				return nil
-			}
+// retry publishes a message that failed on queueName to its next retry queue, or the dead letter
+// queue after the last tier, and acks it once the broker confirms the publish. If that publish
+// fails, is rejected or is not confirmed in time the message is dead-lettered by the broker.
+func (c *Consumer) retry(ctx context.Context, queueName string, msg amqp.Delivery, failure error) {
+	// Interrupted by shutdown: deliver the message again after the restart
+	if ctx.Err() != nil {
+		if err := msg.Nack(false, true); err != nil {
+			c.logger.WithError(err).Error("Failed to nack message")
+		}
+		return
+	}
 
-			c.logger.WithFields(logrus.Fields{
-				"delivery_tag": msg.DeliveryTag,
-				"content_type": msg.ContentType,
-			}).Debug("Received message")
-
-			err := handler(msg.Body)
-			if err != nil {
-				c.logger.WithError(err).Error("Failed to process message")
-				if err := msg.Nack(false, true); err != nil {
-					c.logger.WithError(err).Error("Failed to nack message")
-				}
-			} else {
-				if err := msg.Ack(false); err != nil {
-					c.logger.WithError(err).Error("Failed to ack message")
-				}
-			}
+	target, headers := retryqueue.Route(queueName, msg.Headers, failure, time.Now())
+	log := c.logger.WithFields(logrus.Fields{
+		"error":       failure.Error(),
+		"retry_count": retryqueue.RetryCount(headers),
+		"target":      target,
+	})
+
+	channel, confirms := c.retryPublisher()
+	err := confirms.publish(
+		ctx,
+		channel,
+		target,
+		amqp.Publishing{
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			DeliveryMode:  amqp.Persistent,
+			Priority:      msg.Priority,
+			Headers:       amqp.Table(headers),
+			Body:          msg.Body,
+		},
+	)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish message for retry, sending to DLQ")
+		// Nack with requeue=false to send message to dead letter queue
+		if err := msg.Nack(false, false); err != nil {
+			c.logger.WithError(err).Error("Failed to nack message")
 		}
+		return
 	}
+
+	if target == retryqueue.DeadLetterQueue {
+		log.Error("Failed to process message, sending to DLQ")
+	} else {
+		log.Warn("Failed to process message, scheduling retry")
+	}
+	if err := msg.Ack(false); err != nil {
+		c.logger.WithError(err).Error("Failed to ack message")
+	}
+}
+
+// current returns the connection and channel, which a reconnect replaces
+func (c *Consumer) current() (*amqp.Connection, *amqp.Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.channel
+}
+
+// retryPublisher returns the channel and its confirmer, which a reconnect replaces
+func (c *Consumer) retryPublisher() (*amqp.Channel, *confirmer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.channel, c.confirms
 }
 
 func (c *Consumer) Close() error {
-	if c.channel != nil {
-		if err := c.channel.Close(); err != nil {
+	conn, channel := c.current()
+	if channel != nil {
+		if err := channel.Close(); err != nil {
 			return err
 		}
 	}
 
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil {
 			return err
 		}
 	}
@@ -7,6 +7,9 @@ import (
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
+
+	"github.com/shabohin/photo-tags/pkg/retryqueue"
+	"github.com/shabohin/photo-tags/pkg/tracing"
 )
 
 type Publisher struct {
@@ -67,7 +70,10 @@ func (p *Publisher) connect() error {
 		false, // delete when unused
 		false, // exclusive
 		false, // no-wait
-		nil,   // arguments
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": retryqueue.DeadLetterQueue,
+		},
 	)
 	if err != nil {
 		if closeErr := p.conn.Close(); closeErr != nil {
@@ -103,6 +109,9 @@ func (p *Publisher) Publish(ctx context.Context, message []byte) error {
 	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	headers := amqp.Table{}
+	tracing.Inject(ctx, headers)
+
 	err := p.channel.PublishWithContext(
 		publishCtx,
 		"",          // exchange
@@ -111,6 +120,7 @@ func (p *Publisher) Publish(ctx context.Context, message []byte) error {
 		false,       // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			Headers:     headers,
 			Body:        message,
 		},
 	)
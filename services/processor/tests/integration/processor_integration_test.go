@@ -20,6 +20,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/shabohin/photo-tags/pkg/priority"
 	"github.com/shabohin/photo-tags/services/processor/internal/domain/model"
 	"github.com/shabohin/photo-tags/services/processor/internal/domain/service"
 	"github.com/shabohin/photo-tags/services/processor/internal/exiftool"
@@ -416,6 +417,7 @@ func TestGracefulShutdown(t *testing.T) {
 		testRabbitMQURL,
 		"test-processor-shutdown-"+time.Now().Format("20060102150405"),
 		5,
+		priority.DefaultWeights,
 		retryAttempts,
 		retryDelay,
 		logger,
@@ -438,7 +440,7 @@ func TestGracefulShutdown(t *testing.T) {
 
 	go func() {
 		defer close(consumeDone)
-		handler := func(msg []byte) error {
+		handler := func(_ context.Context, msg []byte) error {
 			logger.Info("Received message during shutdown test")
 			return nil
 		}
@@ -504,6 +506,7 @@ func TestEndToEndProcessing(t *testing.T) {
 		testRabbitMQURL,
 		queueName,
 		1,
+		priority.DefaultWeights,
 		retryAttempts,
 		retryDelay,
 		logger,
@@ -578,8 +581,8 @@ func TestEndToEndProcessing(t *testing.T) {
 
 	// Consume and process message
 	messageProcessed := make(chan bool, 1)
-	handler := func(msg []byte) error {
-		err := messageProcessor.Process(ctx, msg)
+	handler := func(msgCtx context.Context, msg []byte) error {
+		err := messageProcessor.Process(msgCtx, msg)
 		if err == nil {
 			messageProcessed <- true
 		}
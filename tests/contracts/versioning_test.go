@@ -0,0 +1,215 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shabohin/photo-tags/pkg/envelope"
+	"github.com/shabohin/photo-tags/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contract is a message type with the services that produce and consume it
+type contract struct {
+	msgType   string
+	schema    string
+	producers []string
+	consumers []string
+	// sample returns the message as the producer builds it
+	sample func(producer string) interface{}
+}
+
+var fixedTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var contracts = []contract{
+	{
+		msgType:   envelope.TypeImageUpload,
+		schema:    "image_upload.json",
+		producers: []string{envelope.ProducerGateway, envelope.ProducerFilewatcher},
+		consumers: []string{envelope.ProducerAnalyzer},
+		sample: func(producer string) interface{} {
+			return models.ImageUpload{
+				Timestamp:        fixedTime,
+				TraceID:          "trace-" + producer,
+				GroupID:          producer,
+				TelegramUsername: producer,
+				OriginalFilename: "photo.jpg",
+				OriginalPath:     producer + "/photo.jpg",
+				TelegramID:       42,
+				OutputMode:       models.OutputModeSidecar,
+				PrivacyProfile:   models.PrivacyProfileStandard,
+				Creator:          &models.CreatorProfile{Creator: "Alice"},
+			}
+		},
+	},
+	{
+		msgType:   envelope.TypeMetadataGenerated,
+		schema:    "metadata_generated.json",
+		producers: []string{envelope.ProducerAnalyzer},
+		consumers: []string{envelope.ProducerProcessor, envelope.ProducerGateway},
+		sample: func(producer string) interface{} {
+			return models.MetadataGenerated{
+				Timestamp:        fixedTime,
+				TraceID:          "trace-" + producer,
+				GroupID:          "group",
+				OriginalFilename: "photo.jpg",
+				OriginalPath:     "telegram/trace/photo.jpg",
+				Metadata: models.Metadata{
+					Title:       "Sunset",
+					Description: "A sunset over the sea",
+					Keywords:    []string{"sunset", "sea"},
+					AltText:     "Sunset over the sea",
+				},
+				TelegramID:  42,
+				MergePolicy: models.MergePolicyAppendUnique,
+			}
+		},
+	},
+	{
+		msgType:   envelope.TypeImageProcessed,
+		schema:    "image_processed.json",
+		producers: []string{envelope.ProducerProcessor},
+		consumers: []string{envelope.ProducerGateway, envelope.ProducerFilewatcher},
+		sample: func(producer string) interface{} {
+			return models.ImageProcessed{
+				Timestamp:        fixedTime,
+				TraceID:          "trace-" + producer,
+				GroupID:          "group",
+				TelegramUsername: "alice",
+				OriginalFilename: "photo.jpg",
+				ProcessedPath:    "processed/trace/photo.jpg",
+				Status:           "completed",
+				TelegramID:       42,
+				Metadata:         &models.Metadata{Title: "Sunset", Keywords: []string{"sunset"}},
+			}
+		},
+	},
+}
+
+// encodeVersion serializes message as a producer of the given schema version did
+func encodeVersion(t *testing.T, version int, c contract, producer string, message interface{}) []byte {
+	t.Helper()
+
+	var body []byte
+	var err error
+	switch version {
+	case 1:
+		body, err = json.Marshal(message)
+	case 2:
+		body, err = envelope.Encode(c.msgType, producer, message)
+	default:
+		t.Fatalf("no encoder for %s version %d", c.msgType, version)
+	}
+	require.NoError(t, err)
+	return body
+}
+
+// decodeVersion deserializes body as a consumer of the given schema version does.
+// Version 1 consumers predate the envelope and unmarshal the body directly.
+func decodeVersion(version int, c contract, body []byte, message interface{}) error {
+	if version == 1 {
+		return json.Unmarshal(body, message)
+	}
+	_, err := envelope.Decode(body, c.msgType, message)
+	return err
+}
+
+// TestVersionedContracts checks every producer and consumer pair at every supported version of
+// each side, so services can be deployed in any order
+func TestVersionedContracts(t *testing.T) {
+	for _, c := range contracts {
+		for _, producer := range c.producers {
+			for _, consumer := range c.consumers {
+				for produced := envelope.MinVersion; produced <= envelope.CurrentVersion; produced++ {
+					for consumed := envelope.MinVersion; consumed <= envelope.CurrentVersion; consumed++ {
+						name := fmt.Sprintf("%s/%s v%d -> %s v%d", c.msgType, producer, produced, consumer, consumed)
+						t.Run(name, func(t *testing.T) {
+							sent := c.sample(producer)
+							body := encodeVersion(t, produced, c, producer, sent)
+
+							received := reflect.New(reflect.TypeOf(sent))
+							require.NoError(t, decodeVersion(consumed, c, body, received.Interface()))
+							assert.Equal(t, sent, received.Elem().Interface())
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestVersionedContracts_Header checks the header written by every producer
+func TestVersionedContracts_Header(t *testing.T) {
+	for _, c := range contracts {
+		for _, producer := range c.producers {
+			t.Run(c.msgType+"/"+producer, func(t *testing.T) {
+				body := encodeVersion(t, envelope.CurrentVersion, c, producer, c.sample(producer))
+
+				header, err := envelope.ReadHeader(body)
+				require.NoError(t, err)
+				assert.Equal(t, envelope.Header{
+					SchemaVersion: envelope.CurrentVersion,
+					Type:          c.msgType,
+					ProducedBy:    producer,
+				}, header)
+			})
+		}
+	}
+}
+
+// TestVersionedContracts_Schemas validates every supported version against the JSON schemas
+func TestVersionedContracts_Schemas(t *testing.T) {
+	for _, c := range contracts {
+		schema := loadSchema(t, c.schema)
+		for _, producer := range c.producers {
+			for version := envelope.MinVersion; version <= envelope.CurrentVersion; version++ {
+				t.Run(fmt.Sprintf("%s/%s v%d", c.msgType, producer, version), func(t *testing.T) {
+					body := encodeVersion(t, version, c, producer, c.sample(producer))
+
+					result := validateAgainstSchema(t, schema, json.RawMessage(body))
+					assert.True(t, result.Valid(), "Schema errors: %v", result.Errors())
+				})
+			}
+		}
+	}
+}
+
+// TestVersionedContracts_Base64Uploads checks that version 1 uploads from the web and batch
+// handlers, which were published as a base64 JSON string, are upcast for the analyzer
+func TestVersionedContracts_Base64Uploads(t *testing.T) {
+	sent := contracts[0].sample(envelope.ProducerGateway).(models.ImageUpload)
+	marshalled, err := json.Marshal(sent)
+	require.NoError(t, err)
+	body, err := json.Marshal(marshalled)
+	require.NoError(t, err)
+
+	var received models.ImageUpload
+	header, err := envelope.Decode(body, envelope.TypeImageUpload, &received)
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.SchemaVersion)
+	assert.Equal(t, sent, received)
+}
+
+// TestVersionedContracts_Rejections checks the messages consumers must not misread
+func TestVersionedContracts_Rejections(t *testing.T) {
+	t.Run("Newer version than the consumer supports", func(t *testing.T) {
+		body := []byte(fmt.Sprintf(`{"schema_version": %d, "type": "image_upload", "trace_id": "t1"}`, envelope.CurrentVersion+1))
+
+		var msg models.ImageUpload
+		_, err := envelope.Decode(body, envelope.TypeImageUpload, &msg)
+		assert.ErrorIs(t, err, envelope.ErrUnsupportedVersion)
+	})
+
+	t.Run("Message of another type", func(t *testing.T) {
+		body, err := envelope.Encode(envelope.TypeImageProcessed, envelope.ProducerProcessor, contracts[2].sample(envelope.ProducerProcessor))
+		require.NoError(t, err)
+
+		var msg models.ImageUpload
+		_, err = envelope.Decode(body, envelope.TypeImageUpload, &msg)
+		assert.ErrorIs(t, err, envelope.ErrUnexpectedType)
+	})
+}